@@ -0,0 +1,49 @@
+// +build ignore
+
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mirrorview watches a session shared with tcell.ServeMirror.  The
+// application being watched should be started with something like:
+//
+//	l, _ := net.Listen("unix", "/tmp/app.sock")
+//	go tcell.ServeMirror(screen, l)
+//
+// and then "go run mirrorview.go /tmp/app.sock" in a terminal of the
+// same type and size shows what it displays.  The view is read-only;
+// press Ctrl-C to stop watching.
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <socket>\n", os.Args[0])
+		os.Exit(1)
+	}
+	c, e := net.Dial("unix", os.Args[1])
+	if e != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", e)
+		os.Exit(1)
+	}
+	io.Copy(os.Stdout, c)
+
+	// Leave the alternate screen that the session entered.
+	fmt.Print("\x1b[?1049l")
+}
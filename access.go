@@ -0,0 +1,180 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sort"
+	"strings"
+)
+
+// TextBlock is a piece of the text on a screen, as returned by
+// Screen.Linearize, for use by assistive technology such as screen
+// readers and braille displays.
+type TextBlock struct {
+	// Region is the id of the region registered with RegisterRegion
+	// that the text is in, or the empty string for text in none.
+	Region string
+
+	// Area is the rectangle the text was taken from.  For a region,
+	// this is the part of the region on the screen.
+	Area Rect
+
+	// Text is the text, with a line for each row that has any.  Spaces
+	// at the ends of lines are removed, and lines that are empty are
+	// left out.
+	Text string
+}
+
+// linearize returns the text of the buffer as blocks, in reading order.
+// Each region is a block of its own, made of the cells where it is the
+// topmost region.  The cells in no region are gathered into a block for
+// each run of rows that have any text in them.  The blocks are ordered by
+// their upper left corners, from the top, and then from the left.  A run
+// of cells separated by another region's cells is joined with a space.
+func linearize(cb *CellBuffer, rg *regions) []TextBlock {
+	rg.lk.Lock()
+	list := append([]region(nil), rg.list...)
+	rg.lk.Unlock()
+
+	screen := Rect{Width: cb.w, Height: cb.h}
+	owner := func(x, y int) int {
+		for i := len(list) - 1; i >= 0; i-- {
+			if list[i].r.Contains(x, y) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// row returns the text of the cells in row y owned by region i.
+	var sb strings.Builder
+	row := func(i, x0, x1, y int) string {
+		sb.Reset()
+		gap := false
+		for x := x0; x < x1; {
+			mainc, combc, _, width := cb.GetContent(x, y)
+			if owner(x, y) != i {
+				gap = true
+				x += width
+				continue
+			}
+			if gap && sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			gap = false
+			sb.WriteRune(mainc)
+			for _, r := range combc {
+				sb.WriteRune(r)
+			}
+			x += width
+		}
+		return strings.TrimSpace(sb.String())
+	}
+
+	var blocks []TextBlock
+	for i, rgn := range list {
+		area := rgn.r.Intersect(screen)
+		var lines []string
+		for y := area.Y; y < area.Y+area.Height; y++ {
+			if line := row(i, area.X, area.X+area.Width, y); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, TextBlock{
+				Region: rgn.id,
+				Area:   area,
+				Text:   strings.Join(lines, "\n"),
+			})
+		}
+	}
+
+	var lines []string
+	top := 0
+	for y := 0; y <= cb.h; y++ {
+		line := ""
+		if y < cb.h {
+			line = row(-1, 0, cb.w, y)
+		}
+		if line != "" {
+			if len(lines) == 0 {
+				top = y
+			}
+			lines = append(lines, line)
+			continue
+		}
+		if len(lines) > 0 {
+			blocks = append(blocks, TextBlock{
+				Area: Rect{Y: top, Width: cb.w, Height: y - top},
+				Text: strings.Join(lines, "\n"),
+			})
+			lines = nil
+		}
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		a, b := blocks[i].Area, blocks[j].Area
+		if a.Y != b.Y {
+			return a.Y < b.Y
+		}
+		return a.X < b.X
+	})
+	return blocks
+}
+
+// textWatch reports changes to the text of a screen, to the function
+// given to OnTextChange.  The owning screen serializes the calls.
+type textWatch struct {
+	fn   func([]TextBlock)
+	last []TextBlock
+}
+
+// Set sets the function to call, and forgets the last text reported, so
+// that the next check reports the text afresh.
+func (tw *textWatch) Set(fn func([]TextBlock)) {
+	tw.fn = fn
+	tw.last = nil
+}
+
+// Check linearizes the buffer, and returns a function that reports the
+// text if it has changed since the last check, or nil if it has not.
+// The function is meant to be called once the screen is unlocked.
+func (tw *textWatch) Check(cb *CellBuffer, rg *regions) func() {
+	if tw.fn == nil {
+		return nil
+	}
+	blocks := linearize(cb, rg)
+	if tw.last != nil && sameBlocks(blocks, tw.last) {
+		return nil
+	}
+	if blocks == nil {
+		blocks = []TextBlock{}
+	}
+	tw.last = blocks
+	fn := tw.fn
+	return func() { fn(blocks) }
+}
+
+func sameBlocks(a, b []TextBlock) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"time"
+)
+
+// AnimatedStyle is a sequence of styles that the screen shows in turn,
+// each for the same period, without the application having to set the
+// content again.  Two styles make a blink that works on terminals
+// without the blink attribute, or that can blink in color.
+type AnimatedStyle struct {
+	// Styles are the phases of the animation, in order.
+	Styles []Style
+
+	// Period is how long each phase is shown.
+	Period time.Duration
+}
+
+// NewBlinkStyle returns an AnimatedStyle that alternates between two
+// styles, showing each for the given period.
+func NewBlinkStyle(on, off Style, period time.Duration) AnimatedStyle {
+	return AnimatedStyle{Styles: []Style{on, off}, Period: period}
+}
+
+// animation is an AnimatedStyle in progress.
+type animation struct {
+	AnimatedStyle
+	start time.Time
+	phase int
+}
+
+// animator keeps the animations of a screen, keyed by the style that
+// cells are set to in order to be animated.  The zero value has none.
+// The owning screen serializes the calls.
+type animator struct {
+	anims map[Style]*animation
+}
+
+// Set animates cells with the given style, or stops animating them if
+// the animation has fewer than two styles.
+func (a *animator) Set(key Style, anim AnimatedStyle, now time.Time) {
+	if len(anim.Styles) < 2 || anim.Period <= 0 {
+		delete(a.anims, key)
+		return
+	}
+	if a.anims == nil {
+		a.anims = make(map[Style]*animation)
+	}
+	styles := append([]Style(nil), anim.Styles...)
+	a.anims[key] = &animation{
+		AnimatedStyle: AnimatedStyle{Styles: styles, Period: anim.Period},
+		start:         now,
+	}
+}
+
+// Len returns the number of animations.
+func (a *animator) Len() int {
+	return len(a.anims)
+}
+
+// Apply returns the style that a cell with the given style is shown
+// with at present.
+func (a *animator) Apply(style Style) Style {
+	if an, ok := a.anims[style]; ok {
+		return an.Styles[an.phase]
+	}
+	return style
+}
+
+// Advance brings the animations up to the given time, and returns the
+// keys of those that have changed phase, or nil if none have.
+func (a *animator) Advance(now time.Time) map[Style]bool {
+	var changed map[Style]bool
+	for key, an := range a.anims {
+		phase := int(now.Sub(an.start)/an.Period) % len(an.Styles)
+		if phase < 0 || phase == an.phase {
+			continue
+		}
+		an.phase = phase
+		if changed == nil {
+			changed = make(map[Style]bool)
+		}
+		changed[key] = true
+	}
+	return changed
+}
+
+// Next returns how long it is from the given time until the next
+// animation changes phase, or zero if there are no animations.
+func (a *animator) Next(now time.Time) time.Duration {
+	var next time.Duration
+	for _, an := range a.anims {
+		d := an.Period - now.Sub(an.start)%an.Period
+		if next == 0 || d < next {
+			next = d
+		}
+	}
+	return next
+}
@@ -28,6 +28,7 @@ const (
 	AttrDim
 	AttrItalic
 	AttrStrikeThrough
+	AttrRapidBlink
 	AttrInvalid              // Mark the style or attributes invalid
 	AttrNone    AttrMask = 0 // Just normal text.
 )
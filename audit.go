@@ -0,0 +1,128 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zyedidia/tcell/v2/terminfo"
+)
+
+// capAudit records which terminfo capabilities a screen sends, so that
+// a report can be logged when it is finalized.  It is enabled by setting
+// TCELL_AUDIT as well as TCELL_TRACE, and is meant for finding out why
+// some styling does nothing on a particular terminal: most often the
+// capability is missing from its terminfo entry, and the empty string
+// is quietly sent in its place.
+//
+// Strings that are not a capability as such (parameterized ones, or
+// those we build ourselves) are recorded by the place they were sent
+// from instead.
+type capAudit struct {
+	names map[string]string
+	sent  map[string]int
+	empty map[string]int
+	pad   map[string]string
+	sync.Mutex
+}
+
+func newCapAudit(ti *terminfo.Terminfo) *capAudit {
+	a := &capAudit{
+		names: make(map[string]string),
+		sent:  make(map[string]int),
+		empty: make(map[string]int),
+		pad:   make(map[string]string),
+	}
+	v := reflect.ValueOf(ti).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() != reflect.String {
+			continue
+		}
+		s := v.Field(i).String()
+		if _, dup := a.names[s]; s != "" && !dup {
+			a.names[s] = v.Type().Field(i).Name
+		}
+	}
+	return a
+}
+
+// record notes that s was sent.  It is called from tScreen.TPuts, and
+// the caller of that is the one that is reported.
+func (a *capAudit) record(s string) {
+	a.Lock()
+	defer a.Unlock()
+	name, ok := a.names[s]
+	if !ok || s == "" {
+		name = "?"
+		if _, file, line, ok := runtime.Caller(2); ok {
+			name = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		}
+	}
+	if s == "" {
+		a.empty[name]++
+		return
+	}
+	a.sent[name]++
+	if strings.Contains(s, "$<") {
+		a.pad[name] = s
+	}
+}
+
+// report logs what was recorded, most suspicious first.
+func (a *capAudit) report(ti *terminfo.Terminfo, l *log.Logger) {
+	a.Lock()
+	defer a.Unlock()
+
+	l.Printf("audit: terminal %q", ti.Name)
+	for _, name := range sortedKeys(a.empty) {
+		l.Printf("audit: empty string skipped %d times at %s", a.empty[name], name)
+	}
+	// Only output capabilities are of interest; keys are never sent.
+	var missing []string
+	v := reflect.ValueOf(ti).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if f := v.Field(i); f.Kind() == reflect.String && f.String() == "" &&
+			!strings.HasPrefix(name, "Key") {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		l.Printf("audit: capabilities missing: %s", strings.Join(missing, " "))
+	}
+	for _, name := range sortedKeys(a.sent) {
+		if s, ok := a.pad[name]; ok {
+			l.Printf("audit: %s sent %d times, with padding %q", name, a.sent[name], s)
+		} else {
+			l.Printf("audit: %s sent %d times", name, a.sent[name])
+		}
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
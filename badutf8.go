@@ -0,0 +1,34 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// UTF8Policy selects what becomes of input that cannot be decoded in
+// the terminal's character set, such as malformed or overlong UTF-8, or
+// a character cut short when no more input arrives for it.  Each byte
+// that cannot begin a character is dealt with separately, as is each
+// truncated character.
+type UTF8Policy int
+
+const (
+	// UTF8Drop discards the input.  This is the default.
+	UTF8Drop UTF8Policy = iota
+
+	// UTF8Replace delivers an EventKey for the replacement character,
+	// U+FFFD, in its place.
+	UTF8Replace
+
+	// UTF8Raw delivers an EventRaw holding the bytes.
+	UTF8Raw
+)
@@ -0,0 +1,71 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// Capability is a feature that a Screen may lack, depending on the
+// backend and the terminal.  The methods for a feature that a screen
+// lacks do nothing, or return ErrNotSupported, so applications can ask
+// with Screen.Has before offering it, instead of checking the type of
+// the screen.  New capabilities are added at the end, and a screen that
+// does not know of one does not have it.
+type Capability int
+
+const (
+	// CapMouse is mouse support, as reported by HasMouse.
+	CapMouse Capability = iota + 1
+
+	// CapPaste is pasted text arriving as EventPaste, rather than as
+	// keys, without guessing at it with SetPaste.
+	CapPaste
+
+	// CapClipboard is access to the system clipboard with GetClipboard
+	// and SetClipboard.
+	CapClipboard
+
+	// CapTrueColor is 24-bit color.
+	CapTrueColor
+
+	// CapRequestResize is changing the size of the window with
+	// RequestResize.
+	CapRequestResize
+
+	// CapKeyBindings is control of the input sequences for keys, with
+	// BindSequence, UnbindSequence, KeySequences and KeyConflicts.
+	CapKeyBindings
+
+	// CapAddInput is reading input from other streams with AddInput.
+	CapAddInput
+)
+
+// String returns the name of the capability.
+func (c Capability) String() string {
+	switch c {
+	case CapMouse:
+		return "Mouse"
+	case CapPaste:
+		return "Paste"
+	case CapClipboard:
+		return "Clipboard"
+	case CapTrueColor:
+		return "TrueColor"
+	case CapRequestResize:
+		return "RequestResize"
+	case CapKeyBindings:
+		return "KeyBindings"
+	case CapAddInput:
+		return "AddInput"
+	}
+	return "Unknown"
+}
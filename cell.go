@@ -14,18 +14,66 @@
 
 package tcell
 
-import (
-	runewidth "github.com/mattn/go-runewidth"
-)
+// cellRow holds one row of cells, stored as parallel arrays rather than
+// as an array of structures.  This keeps the per-cell overhead small for
+// very large windows, and lets whole rows be moved by exchanging slices.
+//
+// The combining rune slices are owned by the row, and are reused in place
+// when a cell changes, so that steady state redraws do not allocate.
+type cellRow struct {
+	currMain  []rune
+	currComb  [][]rune
+	currStyle []Style
+	lastMain  []rune
+	lastComb  [][]rune
+	lastStyle []Style
+	width     []uint8
+	tag       []uint32
+}
 
-type cell struct {
-	currMain  rune
-	currComb  []rune
-	currStyle Style
-	lastMain  rune
-	lastStyle Style
-	lastComb  []rune
-	width     int
+// resize sets the row to w cells, preserving the contents of the cells
+// that remain, and reusing the existing storage where possible.  All
+// cells are marked dirty.
+func (r *cellRow) resize(w int) {
+	if cap(r.currMain) < w {
+		nr := cellRow{
+			currMain:  make([]rune, w),
+			currComb:  make([][]rune, w),
+			currStyle: make([]Style, w),
+			lastMain:  make([]rune, w),
+			lastComb:  make([][]rune, w),
+			lastStyle: make([]Style, w),
+			width:     make([]uint8, w),
+			tag:       make([]uint32, w),
+		}
+		copy(nr.currMain, r.currMain)
+		copy(nr.currComb, r.currComb)
+		copy(nr.currStyle, r.currStyle)
+		copy(nr.lastComb, r.lastComb)
+		copy(nr.width, r.width)
+		copy(nr.tag, r.tag)
+		*r = nr
+	} else {
+		old := len(r.currMain)
+		r.currMain = r.currMain[:w]
+		r.currComb = r.currComb[:w]
+		r.currStyle = r.currStyle[:w]
+		r.lastMain = r.lastMain[:w]
+		r.lastComb = r.lastComb[:w]
+		r.lastStyle = r.lastStyle[:w]
+		r.width = r.width[:w]
+		r.tag = r.tag[:w]
+		for x := old; x < w; x++ {
+			r.currMain[x] = 0
+			r.currComb[x] = r.currComb[x][:0]
+			r.currStyle[x] = StyleDefault
+			r.width[x] = 0
+			r.tag[x] = 0
+		}
+	}
+	for x := range r.lastMain {
+		r.lastMain[x] = 0
+	}
 }
 
 // CellBuffer represents a two dimensional array of character cells.
@@ -35,9 +83,32 @@ type cell struct {
 //
 // CellBuffer is not thread safe.
 type CellBuffer struct {
-	w     int
-	h     int
-	cells []cell
+	w       int
+	h       int
+	rows    []cellRow
+	ondirty func(x, y int)
+}
+
+// OnDirty registers a function to be called with the location of each
+// cell whose content is changed, or which is explicitly marked dirty.
+// This lets higher level code know exactly what changed between frames,
+// for example to mirror the display elsewhere.  The function is called
+// synchronously, and must not modify the buffer.  Passing nil removes
+// the function.
+func (cb *CellBuffer) OnDirty(fn func(x, y int)) {
+	cb.ondirty = fn
+}
+
+// notify reports the cells of the given area to the dirty observer.
+func (cb *CellBuffer) notify(x, y, w, h int) {
+	if cb.ondirty == nil {
+		return
+	}
+	for row := y; row < y+h; row++ {
+		for col := x; col < x+w; col++ {
+			cb.ondirty(col, row)
+		}
+	}
 }
 
 // SetContent sets the contents (primary rune, combining runes,
@@ -46,15 +117,22 @@ func (cb *CellBuffer) SetContent(x int, y int,
 	mainc rune, combc []rune, style Style) {
 
 	if x >= 0 && y >= 0 && x < cb.w && y < cb.h {
-		c := &cb.cells[(y*cb.w)+x]
+		r := &cb.rows[y]
+
+		changed := r.currMain[x] != mainc || r.currStyle[x] != style ||
+			!runesEqual(r.currComb[x], combc)
 
-		c.currComb = append([]rune{}, combc...)
+		r.currComb[x] = append(r.currComb[x][:0], combc...)
 
-		if c.currMain != mainc {
-			c.width = runewidth.RuneWidth(mainc)
+		if r.currMain[x] != mainc {
+			r.width[x] = uint8(RuneWidth(mainc))
+		}
+		r.currMain[x] = mainc
+		r.currStyle[x] = style
+
+		if changed {
+			cb.notify(x, y, 1, 1)
 		}
-		c.currMain = mainc
-		c.currStyle = style
 	}
 }
 
@@ -68,9 +146,15 @@ func (cb *CellBuffer) GetContent(x, y int) (rune, []rune, Style, int) {
 	var style Style
 	var width int
 	if x >= 0 && y >= 0 && x < cb.w && y < cb.h {
-		c := &cb.cells[(y*cb.w)+x]
-		mainc, combc, style = c.currMain, c.currComb, c.currStyle
-		if width = c.width; width == 0 || mainc < ' ' {
+		r := &cb.rows[y]
+		mainc, combc, style = r.currMain[x], r.currComb[x], r.currStyle[x]
+		if len(combc) == 0 {
+			combc = nil
+		} else {
+			// The buffer reuses its storage when the cell is set.
+			combc = append([]rune(nil), combc...)
+		}
+		if width = int(r.width[x]); width == 0 || mainc < ' ' {
 			width = 1
 			mainc = ' '
 		}
@@ -78,6 +162,28 @@ func (cb *CellBuffer) GetContent(x, y int) (rune, []rune, Style, int) {
 	return mainc, combc, style, width
 }
 
+// SetTag sets the tag for a cell.  Tags are opaque values that belong to
+// the application, typically used to find what model object a cell was
+// drawn for, such as the one under the mouse.  They are not displayed,
+// so changing a tag does not make the cell dirty.  SetContent leaves the
+// tag alone; Fill, and clearing or scrolling in new cells, resets it to
+// zero.  Tags move with their cells when the buffer is scrolled or a
+// region is copied.
+func (cb *CellBuffer) SetTag(x, y int, tag uint32) {
+	if x >= 0 && y >= 0 && x < cb.w && y < cb.h {
+		cb.rows[y].tag[x] = tag
+	}
+}
+
+// GetTag returns the tag for a cell, or zero if none was set or the
+// location is out of range.
+func (cb *CellBuffer) GetTag(x, y int) uint32 {
+	if x >= 0 && y >= 0 && x < cb.w && y < cb.h {
+		return cb.rows[y].tag[x]
+	}
+	return 0
+}
+
 // Size returns the (width, height) in cells of the buffer.
 func (cb *CellBuffer) Size() (int, int) {
 	return cb.w, cb.h
@@ -85,9 +191,34 @@ func (cb *CellBuffer) Size() (int, int) {
 
 // Invalidate marks all characters within the buffer as dirty.
 func (cb *CellBuffer) Invalidate() {
-	for i := range cb.cells {
-		cb.cells[i].lastMain = rune(0)
+	for y := range cb.rows {
+		lm := cb.rows[y].lastMain
+		for x := range lm {
+			lm[x] = rune(0)
+		}
+	}
+	cb.notify(0, 0, cb.w, cb.h)
+}
+
+// InvalidateRect marks the cells within the rectangle as needing to be
+// redrawn, like Invalidate.  A wide character whose right half lies
+// within it is included as well, since it can only be drawn whole.
+func (cb *CellBuffer) InvalidateRect(rect Rect) {
+	rect = rect.Intersect(Rect{Width: cb.w, Height: cb.h})
+	if rect.Empty() {
+		return
+	}
+	for y := rect.Y; y < rect.Y+rect.Height; y++ {
+		r := &cb.rows[y]
+		x0 := rect.X
+		if x0 > 0 && r.width[x0-1] > 1 {
+			x0--
+		}
+		for x := x0; x < rect.X+rect.Width; x++ {
+			r.lastMain[x] = rune(0)
+		}
 	}
+	cb.notify(rect.X, rect.Y, rect.Width, rect.Height)
 }
 
 // Dirty checks if a character at the given location needs an
@@ -96,43 +227,51 @@ func (cb *CellBuffer) Invalidate() {
 // marked clean.
 func (cb *CellBuffer) Dirty(x, y int) bool {
 	if x >= 0 && y >= 0 && x < cb.w && y < cb.h {
-		c := &cb.cells[(y*cb.w)+x]
-		if c.lastMain == rune(0) {
+		r := &cb.rows[y]
+		if r.lastMain[x] == rune(0) {
 			return true
 		}
-		if c.lastMain != c.currMain {
+		if r.lastMain[x] != r.currMain[x] {
 			return true
 		}
-		if c.lastStyle != c.currStyle {
+		if r.lastStyle[x] != r.currStyle[x] {
 			return true
 		}
-		if len(c.lastComb) != len(c.currComb) {
+		if !runesEqual(r.lastComb[x], r.currComb[x]) {
 			return true
 		}
-		for i := range c.lastComb {
-			if c.lastComb[i] != c.currComb[i] {
-				return true
-			}
-		}
 	}
 	return false
 }
 
+func runesEqual(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // SetDirty is normally used to indicate that a cell has
 // been displayed (in which case dirty is false), or to manually
 // force a cell to be marked dirty.
 func (cb *CellBuffer) SetDirty(x, y int, dirty bool) {
 	if x >= 0 && y >= 0 && x < cb.w && y < cb.h {
-		c := &cb.cells[(y*cb.w)+x]
+		r := &cb.rows[y]
 		if dirty {
-			c.lastMain = rune(0)
+			r.lastMain[x] = rune(0)
+			cb.notify(x, y, 1, 1)
 		} else {
-			if c.currMain == rune(0) {
-				c.currMain = ' '
+			if r.currMain[x] == rune(0) {
+				r.currMain[x] = ' '
 			}
-			c.lastMain = c.currMain
-			c.lastComb = c.currComb
-			c.lastStyle = c.currStyle
+			r.lastMain[x] = r.currMain[x]
+			r.lastComb[x] = append(r.lastComb[x][:0], r.currComb[x]...)
+			r.lastStyle[x] = r.currStyle[x]
 		}
 	}
 }
@@ -146,32 +285,208 @@ func (cb *CellBuffer) Resize(w, h int) {
 		return
 	}
 
-	newc := make([]cell, w*h)
-	for y := 0; y < h && y < cb.h; y++ {
-		for x := 0; x < w && x < cb.w; x++ {
-			oc := &cb.cells[(y*cb.w)+x]
-			nc := &newc[(y*w)+x]
-			nc.currMain = oc.currMain
-			nc.currComb = oc.currComb
-			nc.currStyle = oc.currStyle
-			nc.width = oc.width
-			nc.lastMain = rune(0)
+	// Rows dropped off the bottom keep their storage in the spare
+	// capacity of the slice, so growing again later reuses it.
+	if cap(cb.rows) < h {
+		rows := make([]cellRow, h)
+		copy(rows, cb.rows)
+		cb.rows = rows
+	} else {
+		cb.rows = cb.rows[:h]
+	}
+	for y := range cb.rows {
+		r := &cb.rows[y]
+		if y >= cb.h {
+			// A row coming back into use must start out blank.
+			r.resize(0)
 		}
+		r.resize(w)
 	}
-	cb.cells = newc
 	cb.h = h
 	cb.w = w
+	cb.notify(0, 0, w, h)
 }
 
 // Fill fills the entire cell buffer array with the specified character
 // and style.  Normally choose ' ' to clear the screen.  This API doesn't
 // support combining characters, or characters with a width larger than one.
 func (cb *CellBuffer) Fill(r rune, style Style) {
-	for i := range cb.cells {
-		c := &cb.cells[i]
-		c.currMain = r
-		c.currComb = nil
-		c.currStyle = style
-		c.width = 1
+	for y := range cb.rows {
+		row := &cb.rows[y]
+		for x := range row.currMain {
+			row.currMain[x] = r
+			row.currComb[x] = row.currComb[x][:0]
+			row.currStyle[x] = style
+			row.width[x] = 1
+			row.tag[x] = 0
+		}
+	}
+	cb.notify(0, 0, cb.w, cb.h)
+}
+
+// FillRect is like Fill, but only fills the cells within the rectangle,
+// clipped to the buffer.
+func (cb *CellBuffer) FillRect(rect Rect, r rune, style Style) {
+	x0, y0 := rect.X, rect.Y
+	x1, y1 := rect.X+rect.Width, rect.Y+rect.Height
+	if x0 < 0 {
+		x0 = 0
+	}
+	if y0 < 0 {
+		y0 = 0
+	}
+	if x1 > cb.w {
+		x1 = cb.w
+	}
+	if y1 > cb.h {
+		y1 = cb.h
+	}
+	if x0 >= x1 || y0 >= y1 {
+		return
+	}
+	for y := y0; y < y1; y++ {
+		row := &cb.rows[y]
+		for x := x0; x < x1; x++ {
+			row.currMain[x] = r
+			row.currComb[x] = row.currComb[x][:0]
+			row.currStyle[x] = style
+			row.width[x] = 1
+			row.tag[x] = 0
+		}
+	}
+	cb.notify(x0, y0, x1-x0, y1-y0)
+}
+
+// clear blanks the cells of the row, and marks them dirty.
+func (r *cellRow) clear() {
+	for x := range r.currMain {
+		r.currMain[x] = 0
+		r.currComb[x] = r.currComb[x][:0]
+		r.currStyle[x] = StyleDefault
+		r.width[x] = 0
+		r.tag[x] = 0
+		r.lastMain[x] = 0
+	}
+}
+
+// ScrollUp moves the contents of the buffer up by n rows.  The top n
+// rows are discarded, and n blank rows are added at the bottom.
+//
+// The state of what was last drawn moves along with each cell, as it
+// would if the physical display were scrolled as well.  If the display
+// is not also being scrolled, the caller should Invalidate the buffer.
+func (cb *CellBuffer) ScrollUp(n int) {
+	if n <= 0 {
+		return
+	}
+	if n > cb.h {
+		n = cb.h
+	}
+	cb.rotate(n)
+	for y := cb.h - n; y < cb.h; y++ {
+		cb.rows[y].clear()
+	}
+	cb.notify(0, 0, cb.w, cb.h)
+}
+
+// ScrollDown moves the contents of the buffer down by n rows.  The
+// bottom n rows are discarded, and n blank rows are added at the top.
+// As with ScrollUp, the state of what was last drawn moves as well.
+func (cb *CellBuffer) ScrollDown(n int) {
+	if n <= 0 {
+		return
+	}
+	if n > cb.h {
+		n = cb.h
+	}
+	cb.rotate(cb.h - n)
+	for y := 0; y < n; y++ {
+		cb.rows[y].clear()
+	}
+	cb.notify(0, 0, cb.w, cb.h)
+}
+
+// rotate moves row n to the top of the buffer, and the rows above it to
+// the bottom.  Only the row headers move; the cells are not copied.
+func (cb *CellBuffer) rotate(n int) {
+	if n <= 0 || n >= cb.h {
+		return
+	}
+	rows := cb.rows[:cb.h]
+	tmp := make([]cellRow, n)
+	copy(tmp, rows[:n])
+	copy(rows, rows[n:])
+	copy(rows[cb.h-n:], tmp)
+}
+
+// CopyRegion copies the cells in the src rectangle to the dst rectangle,
+// along with the state of what was last drawn for them.  The regions may
+// overlap.  The area copied is the smaller of the two rectangles, clipped
+// to the buffer; the upper left corners of src and dst correspond.
+func (cb *CellBuffer) CopyRegion(src, dst Rect) {
+	w, h := src.Width, src.Height
+	if dst.Width < w {
+		w = dst.Width
+	}
+	if dst.Height < h {
+		h = dst.Height
+	}
+	sx, sy, dx, dy := src.X, src.Y, dst.X, dst.Y
+
+	// Clip to the buffer, keeping the two corners in step.
+	if d := -sx; d > 0 {
+		sx, dx, w = sx+d, dx+d, w-d
+	}
+	if d := -dx; d > 0 {
+		sx, dx, w = sx+d, dx+d, w-d
+	}
+	if d := -sy; d > 0 {
+		sy, dy, h = sy+d, dy+d, h-d
+	}
+	if d := -dy; d > 0 {
+		sy, dy, h = sy+d, dy+d, h-d
+	}
+	if e := cb.w - sx; e < w {
+		w = e
+	}
+	if e := cb.w - dx; e < w {
+		w = e
+	}
+	if e := cb.h - sy; e < h {
+		h = e
+	}
+	if e := cb.h - dy; e < h {
+		h = e
+	}
+	if w <= 0 || h <= 0 {
+		return
+	}
+
+	// Work from the far end when moving down or right, so that
+	// overlapping source cells are read before they are overwritten.
+	for i := 0; i < h; i++ {
+		j := i
+		if dy > sy {
+			j = h - 1 - i
+		}
+		sr, dr := &cb.rows[sy+j], &cb.rows[dy+j]
+		copy(dr.currMain[dx:dx+w], sr.currMain[sx:sx+w])
+		copy(dr.currStyle[dx:dx+w], sr.currStyle[sx:sx+w])
+		copy(dr.lastMain[dx:dx+w], sr.lastMain[sx:sx+w])
+		copy(dr.lastStyle[dx:dx+w], sr.lastStyle[sx:sx+w])
+		copy(dr.width[dx:dx+w], sr.width[sx:sx+w])
+		copy(dr.tag[dx:dx+w], sr.tag[sx:sx+w])
+
+		// Combining runes are copied into the storage owned by
+		// the destination cell, rather than shared.
+		for k := 0; k < w; k++ {
+			x := k
+			if dx > sx {
+				x = w - 1 - k
+			}
+			dr.currComb[dx+x] = append(dr.currComb[dx+x][:0], sr.currComb[sx+x]...)
+			dr.lastComb[dx+x] = append(dr.lastComb[dx+x][:0], sr.lastComb[sx+x]...)
+		}
 	}
+	cb.notify(dx, dy, w, h)
 }
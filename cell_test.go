@@ -0,0 +1,427 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestCellBufferResize(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(4, 3)
+	cb.SetContent(1, 1, 'x', nil, StyleDefault.Bold(true))
+	cb.SetContent(3, 2, 'y', nil, StyleDefault)
+
+	cb.Resize(2, 2)
+	if m, _, st, _ := cb.GetContent(1, 1); m != 'x' || st != StyleDefault.Bold(true) {
+		t.Errorf("Content lost on shrink: %q %v", m, st)
+	}
+
+	// Cells brought back into view must be blank, not stale.
+	cb.Resize(4, 3)
+	if m, _, _, _ := cb.GetContent(3, 2); m != ' ' {
+		t.Errorf("Stale content after regrow: %q", m)
+	}
+	if m, _, _, _ := cb.GetContent(1, 1); m != 'x' {
+		t.Errorf("Content lost on regrow: %q", m)
+	}
+	if !cb.Dirty(1, 1) {
+		t.Errorf("Cells not invalidated by resize")
+	}
+}
+
+func TestCellBufferCombDirty(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(2, 1)
+	cb.SetContent(0, 0, 'e', []rune{'́'}, StyleDefault)
+	cb.SetDirty(0, 0, false)
+	if cb.Dirty(0, 0) {
+		t.Errorf("Cell dirty after being marked clean")
+	}
+
+	// Reusing the combining storage must not disturb what was last drawn.
+	cb.SetContent(0, 0, 'e', []rune{'̀'}, StyleDefault)
+	if !cb.Dirty(0, 0) {
+		t.Errorf("Change of combining rune not detected")
+	}
+	if _, comb, _, _ := cb.GetContent(0, 0); len(comb) != 1 || comb[0] != '̀' {
+		t.Errorf("Bad combining runes: %v", comb)
+	}
+	cb.SetContent(0, 0, 'e', nil, StyleDefault)
+	if _, comb, _, _ := cb.GetContent(0, 0); comb != nil {
+		t.Errorf("Expected nil combining runes, got %v", comb)
+	}
+}
+
+func TestCellBufferGetContentCopy(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(1, 1)
+	cb.SetContent(0, 0, 'e', []rune{'\u0301'}, StyleDefault)
+	_, comb, _, _ := cb.GetContent(0, 0)
+
+	// Setting the cell again leaves the runes returned alone.
+	cb.SetContent(0, 0, 'e', []rune{'\u0308'}, StyleDefault)
+	if len(comb) != 1 || comb[0] != '\u0301' {
+		t.Errorf("Returned runes changed: %q", comb)
+	}
+
+	// And changing them does not change the buffer.
+	cb.SetDirty(0, 0, false)
+	_, comb, _, _ = cb.GetContent(0, 0)
+	comb[0] = 'x'
+	if _, comb, _, _ = cb.GetContent(0, 0); comb[0] != '\u0308' || cb.Dirty(0, 0) {
+		t.Errorf("Buffer changed through returned runes: %q", comb)
+	}
+}
+
+func cellText(cb *CellBuffer, y int) string {
+	w, _ := cb.Size()
+	s := ""
+	for x := 0; x < w; x++ {
+		m, _, _, _ := cb.GetContent(x, y)
+		s += string(m)
+	}
+	return s
+}
+
+func TestCellBufferScroll(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(3, 3)
+	for y, s := range []string{"abc", "def", "ghi"} {
+		for x, r := range s {
+			cb.SetContent(x, y, r, nil, StyleDefault)
+			cb.SetDirty(x, y, false)
+		}
+	}
+
+	cb.ScrollUp(1)
+	if a, b, c := cellText(cb, 0), cellText(cb, 1), cellText(cb, 2); a != "def" || b != "ghi" || c != "   " {
+		t.Errorf("Bad scroll up: %q %q %q", a, b, c)
+	}
+	if cb.Dirty(0, 0) || !cb.Dirty(0, 2) {
+		t.Errorf("Dirty state did not move with cells")
+	}
+
+	cb.ScrollDown(2)
+	if a, c := cellText(cb, 0), cellText(cb, 2); a != "   " || c != "def" {
+		t.Errorf("Bad scroll down: %q %q", a, c)
+	}
+}
+
+func TestCellBufferCopyRegion(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(5, 2)
+	for x, r := range "abcde" {
+		cb.SetContent(x, 0, r, nil, StyleDefault)
+	}
+	cb.SetContent(0, 0, 'a', []rune{'́'}, StyleDefault)
+
+	// Overlapping move to the right.
+	cb.CopyRegion(Rect{X: 0, Y: 0, Width: 4, Height: 1}, Rect{X: 1, Y: 0, Width: 4, Height: 1})
+	if s := cellText(cb, 0); s != "aabcd" {
+		t.Errorf("Bad overlapping copy: %q", s)
+	}
+
+	// Copies are clipped to the buffer.
+	cb.CopyRegion(Rect{X: 0, Y: 0, Width: 5, Height: 1}, Rect{X: 3, Y: 1, Width: 5, Height: 5})
+	if s := cellText(cb, 1); s != "   aa" {
+		t.Errorf("Bad clipped copy: %q", s)
+	}
+
+	// The copied combining runes must be independent of the source.
+	cb.SetContent(0, 0, 'a', []rune{'̀'}, StyleDefault)
+	if _, comb, _, _ := cb.GetContent(3, 1); len(comb) != 1 || comb[0] != '́' {
+		t.Errorf("Combining runes shared between cells: %v", comb)
+	}
+}
+
+func TestCellBufferOnDirty(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(3, 2)
+	var seen []Rect
+	cb.OnDirty(func(x, y int) {
+		seen = append(seen, Rect{X: x, Y: y, Width: 1, Height: 1})
+	})
+
+	cb.SetContent(1, 1, 'x', nil, StyleDefault)
+	cb.SetContent(1, 1, 'x', nil, StyleDefault) // unchanged
+	cb.SetDirty(2, 0, true)
+	if len(seen) != 2 || !seen[0].Contains(1, 1) || !seen[1].Contains(2, 0) {
+		t.Errorf("Bad dirty notifications: %v", seen)
+	}
+
+	seen = nil
+	cb.CopyRegion(Rect{Width: 2, Height: 1}, Rect{X: 1, Y: 1, Width: 2, Height: 1})
+	if len(seen) != 2 {
+		t.Errorf("Expected 2 notifications for copy, got %d", len(seen))
+	}
+
+	seen = nil
+	cb.OnDirty(nil)
+	cb.Invalidate()
+	if len(seen) != 0 {
+		t.Errorf("Notified after observer removed")
+	}
+}
+
+func TestCellBufferTags(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(4, 3)
+	cb.SetContent(1, 1, 'x', nil, StyleDefault)
+	cb.SetDirty(1, 1, false)
+	cb.SetTag(1, 1, 42)
+	if cb.GetTag(1, 1) != 42 {
+		t.Errorf("Tag not stored")
+	}
+	if cb.Dirty(1, 1) {
+		t.Errorf("Tag should not make the cell dirty")
+	}
+	cb.SetContent(1, 1, 'y', nil, StyleDefault)
+	if cb.GetTag(1, 1) != 42 {
+		t.Errorf("SetContent should keep the tag")
+	}
+	if cb.GetTag(-1, 0) != 0 || cb.GetTag(4, 0) != 0 {
+		t.Errorf("Out of range tag should be zero")
+	}
+
+	cb.ScrollUp(1)
+	if cb.GetTag(1, 0) != 42 || cb.GetTag(1, 2) != 0 {
+		t.Errorf("Tag did not scroll with its cell")
+	}
+	cb.CopyRegion(Rect{X: 1, Y: 0, Width: 1, Height: 1}, Rect{X: 3, Y: 2, Width: 1, Height: 1})
+	if cb.GetTag(3, 2) != 42 {
+		t.Errorf("Tag not copied")
+	}
+	cb.Resize(5, 3)
+	if cb.GetTag(3, 2) != 42 || cb.GetTag(4, 2) != 0 {
+		t.Errorf("Tag not preserved by resize")
+	}
+	cb.Fill(' ', StyleDefault)
+	if cb.GetTag(1, 0) != 0 {
+		t.Errorf("Fill should reset tags")
+	}
+}
+
+func TestDiffStream(t *testing.T) {
+	var src, dst CellBuffer
+	var enc DiffEncoder
+	buf := &bytes.Buffer{}
+
+	src.Resize(10, 3)
+	src.Fill(' ', StyleDefault)
+	src.SetContent(2, 1, 'e', []rune{'\u0301'}, StyleDefault.Bold(true))
+	src.SetContent(3, 1, '世', nil, StyleDefault.Foreground(ColorRed))
+	enc.Encode(buf, &src)
+	full := buf.Len()
+
+	// A second frame only carries what changed.
+	src.SetContent(9, 2, 'z', nil, StyleDefault)
+	enc.Encode(buf, &src)
+	if n := buf.Len() - full; n > 12 {
+		t.Errorf("Diff frame too large: %d bytes", n)
+	}
+	src.Resize(12, 2)
+	src.SetContent(11, 0, 'w', nil, StyleDefault)
+	enc.Encode(buf, &src)
+
+	r := bufio.NewReader(buf)
+	for i := 0; i < 3; i++ {
+		if e := DecodeDiff(r, &dst); e != nil {
+			t.Fatalf("Frame %d: %v", i, e)
+		}
+	}
+	if e := DecodeDiff(r, &dst); e != io.EOF {
+		t.Errorf("Expected EOF, got %v", e)
+	}
+	if w, h := dst.Size(); w != 12 || h != 2 {
+		t.Fatalf("Bad size %dx%d", w, h)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 12; x++ {
+			m1, c1, s1, _ := src.GetContent(x, y)
+			m2, c2, s2, _ := dst.GetContent(x, y)
+			if m1 != m2 || s1 != s2 || !runesEqual(c1, c2) {
+				t.Errorf("Cell %d,%d: %q %v, want %q %v", x, y, m2, s2, m1, s1)
+			}
+		}
+	}
+
+	if e := DecodeDiff(bufio.NewReader(bytes.NewReader([]byte("F\x02\x02\x01\x05"))), &dst); e != ErrBadDiff {
+		t.Errorf("Expected ErrBadDiff, got %v", e)
+	}
+	// 65536 by 65536 is too many cells, even though each side is fine.
+	if e := DecodeDiff(bufio.NewReader(bytes.NewReader([]byte("F\x80\x80\x04\x80\x80\x04\x00"))), &dst); e != ErrBadDiff {
+		t.Errorf("Expected ErrBadDiff for huge frame, got %v", e)
+	}
+}
+
+func TestCellBufferInvalidateRect(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(6, 3)
+	cb.Fill('x', StyleDefault)
+	cb.SetContent(0, 1, '日', nil, StyleDefault)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			cb.SetDirty(x, y, false)
+		}
+	}
+
+	cb.InvalidateRect(Rect{X: 1, Y: 1, Width: 2, Height: 5})
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			want := y >= 1 && x < 3 && (x > 0 || y == 1)
+			if cb.Dirty(x, y) != want {
+				t.Errorf("Cell %d,%d dirty %v", x, y, !want)
+			}
+		}
+	}
+}
+
+func TestCellBufferCompare(t *testing.T) {
+	var a, b CellBuffer
+	a.Resize(5, 2)
+	b.Resize(5, 2)
+	a.Fill(' ', StyleDefault)
+	b.Fill(' ', StyleDefault)
+	if !a.Equal(&b) || len(a.Diff(&b)) != 0 {
+		t.Fatalf("Blank buffers differ")
+	}
+
+	// Tags are not displayed, so they do not count.
+	a.SetTag(0, 0, 7)
+	a.SetContent(1, 0, 'x', nil, StyleDefault.Bold(true))
+	a.SetContent(2, 0, 'y', nil, StyleDefault)
+	a.SetContent(4, 1, 'e', []rune{'\u0301'}, StyleDefault)
+	if a.Equal(&b) {
+		t.Errorf("Changed buffers equal")
+	}
+	want := []Rect{
+		{X: 1, Y: 0, Width: 2, Height: 1},
+		{X: 4, Y: 1, Width: 1, Height: 1},
+	}
+	if d := a.Diff(&b); !reflect.DeepEqual(d, want) {
+		t.Errorf("Bad diff %v, want %v", d, want)
+	}
+
+	b.Resize(6, 2)
+	if a.Equal(&b) {
+		t.Errorf("Buffers of different sizes equal")
+	}
+	if d := b.Diff(&a); len(d) != 3 || d[1] != (Rect{X: 5, Y: 0, Width: 1, Height: 1}) {
+		t.Errorf("Bad diff after resize %v", d)
+	}
+}
+
+func TestCellBufferDump(t *testing.T) {
+	var cb CellBuffer
+	cb.Resize(4, 2)
+	cb.Fill(' ', StyleDefault)
+	if s := cb.Dump(); s != "4x2\n|    |\n|    |\n" {
+		t.Errorf("Bad plain dump %q", s)
+	}
+	cb.SetContent(0, 0, '世', nil, StyleDefault.Foreground(ColorRed))
+	cb.SetContent(2, 0, 'e', []rune{'\u0301'}, StyleDefault)
+	cb.SetContent(3, 1, 'z', nil, StyleDefault.Background(NewHexColor(0x102030)).Bold(true).Underline(true))
+	want := "4x2\n" +
+		"|世e\u0301 |\n" +
+		"|   z|\n" +
+		"styles:\n" +
+		"|A..|\n" +
+		"|...B|\n" +
+		"A: fg=9 bg=default\n" +
+		"B: fg=default bg=#102030 bold underline\n"
+	if s := cb.Dump(); s != want {
+		t.Errorf("Bad dump:\n%s\nwant:\n%s", s, want)
+	}
+}
+
+func TestWordSelection(t *testing.T) {
+	var cb CellBuffer
+	cb.Resize(26, 2)
+	cb.Fill(' ', StyleDefault)
+	x := 0
+	for _, r := range "cat ~/my_file.go  ==世界x" {
+		cb.SetContent(x, 0, r, nil, StyleDefault)
+		x++
+		if r == '世' || r == '界' {
+			x++
+		}
+	}
+
+	tests := []struct {
+		x     int
+		chars string
+		want  Rect
+	}{
+		{1, "", Rect{X: 0, Y: 0, Width: 3, Height: 1}},
+		{6, "", Rect{X: 6, Y: 0, Width: 2, Height: 1}},
+		{6, "_~/.", Rect{X: 4, Y: 0, Width: 12, Height: 1}},
+		{16, "", Rect{X: 16, Y: 0, Width: 2, Height: 1}},
+		{18, "", Rect{X: 18, Y: 0, Width: 2, Height: 1}},
+		{3, "", Rect{X: 3, Y: 0, Width: 1, Height: 1}},
+		{21, "", Rect{X: 20, Y: 0, Width: 5, Height: 1}},
+		{26, "", Rect{}},
+	}
+	for _, tc := range tests {
+		if r := cb.WordSelection(tc.x, 0, tc.chars); r != tc.want {
+			t.Errorf("Word at %d with %q: %v, want %v", tc.x, tc.chars, r, tc.want)
+		}
+	}
+	if s := cb.Text(cb.WordSelection(24, 0, "")); s != "世界x" {
+		t.Errorf("Bad word text %q", s)
+	}
+	if s := cb.Line(0); s != "cat ~/my_file.go  ==世界x" {
+		t.Errorf("Bad line %q", s)
+	}
+	if r := LineSelection(1, 0, 26); len(r) != 1 || r[0] != (Rect{Width: 26, Height: 2}) {
+		t.Errorf("Bad line selection %v", r)
+	}
+}
+
+func TestCellBufferFind(t *testing.T) {
+	var cb CellBuffer
+	cb.Resize(12, 2)
+	cb.Fill(' ', StyleDefault)
+	cb.SetContent(0, 0, 'a', nil, StyleDefault)
+	cb.SetContent(1, 0, '世', nil, StyleDefault)
+	cb.SetContent(3, 0, '界', nil, StyleDefault)
+	cb.SetContent(5, 0, 'e', []rune{'\u0301'}, StyleDefault)
+	cb.SetContent(6, 0, 'b', nil, StyleDefault)
+	cb.SetContent(0, 1, 'a', nil, StyleDefault)
+	cb.SetContent(1, 1, 'a', nil, StyleDefault)
+
+	if r := cb.FindString("世界"); !reflect.DeepEqual(r, []Rect{{X: 1, Y: 0, Width: 4, Height: 1}}) {
+		t.Errorf("Bad wide match %v", r)
+	}
+	if r := cb.FindString("e\u0301b"); !reflect.DeepEqual(r, []Rect{{X: 5, Y: 0, Width: 2, Height: 1}}) {
+		t.Errorf("Bad combining match %v", r)
+	}
+	want := []Rect{
+		{X: 0, Y: 0, Width: 1, Height: 1},
+		{X: 0, Y: 1, Width: 1, Height: 1},
+		{X: 1, Y: 1, Width: 1, Height: 1},
+	}
+	if r := cb.FindString("a"); !reflect.DeepEqual(r, want) {
+		t.Errorf("Bad matches %v", r)
+	}
+	if r := cb.Find(regexp.MustCompile(`x*`)); len(r) != 0 {
+		t.Errorf("Empty matches returned %v", r)
+	}
+}
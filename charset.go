@@ -0,0 +1,116 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"strings"
+)
+
+// charsetNames maps the spellings of character sets found in locale names
+// and elsewhere to the names that encodings are registered under.  Keys
+// are lower case, with dashes and underscores removed.
+var charsetNames = map[string]string{
+	"utf8":          "UTF-8",
+	"ascii":         "US-ASCII",
+	"usascii":       "US-ASCII",
+	"ansix3.41968":  "US-ASCII",
+	"646":           "US-ASCII",
+	"iso646":        "US-ASCII",
+	"iso88591":      "ISO8859-1",
+	"iso88592":      "ISO8859-2",
+	"iso88593":      "ISO8859-3",
+	"iso88594":      "ISO8859-4",
+	"iso88595":      "ISO8859-5",
+	"iso88596":      "ISO8859-6",
+	"iso88597":      "ISO8859-7",
+	"iso88598":      "ISO8859-8",
+	"iso88599":      "ISO8859-9",
+	"iso885910":     "ISO8859-10",
+	"iso885913":     "ISO8859-13",
+	"iso885914":     "ISO8859-14",
+	"iso885915":     "ISO8859-15",
+	"iso885916":     "ISO8859-16",
+	"koi8r":         "KOI8-R",
+	"koi8u":         "KOI8-U",
+	"eucjp":         "EUC-JP",
+	"ujis":          "EUC-JP",
+	"sjis":          "Shift_JIS",
+	"shiftjis":      "Shift_JIS",
+	"pck":           "Shift_JIS",
+	"iso2022jp":     "ISO2022JP",
+	"euckr":         "EUC-KR",
+	"gb18030":       "GB18030",
+	"gb2312":        "GB2312",
+	"euccn":         "GB2312",
+	"gbk":           "GBK",
+	"big5":          "Big5",
+	"big5hkscs":     "Big5",
+	"utf16":         "UTF-16",
+	"utf16le":       "UTF-16LE",
+	"cp1252":        "windows-1252",
+	"windows1252":   "windows-1252",
+	"cp437":         "IBM437",
+	"ibm437":        "IBM437",
+	"cp850":         "IBM850",
+	"ibm850":        "IBM850",
+	"cp866":         "IBM866",
+	"ibm866":        "IBM866",
+	"cp1251":        "windows-1251",
+	"windows1251":   "windows-1251",
+	"cp932":         "Shift_JIS",
+	"cp936":         "GBK",
+	"cp949":         "EUC-KR",
+	"cp950":         "Big5",
+	"iso10646ucs2":  "UTF-16",
+	"iso10646utf1":  "UTF-8",
+	"10646utf8":     "UTF-8",
+	"iso10646ucs4":  "UTF-32",
+	"unicode11utf8": "UTF-8",
+}
+
+// normalizeCharset returns the usual name of a character set, so that
+// for example "utf8" and "UTF-8" are treated alike.  Names that are not
+// known are returned unchanged.
+func normalizeCharset(name string) string {
+	key := strings.ToLower(name)
+	key = strings.Replace(key, "-", "", -1)
+	key = strings.Replace(key, "_", "", -1)
+	if n, ok := charsetNames[key]; ok {
+		return n
+	}
+	return name
+}
+
+// localeCharset returns the character set of a POSIX locale name, of the
+// form language[_territory][.codeset][@modifier].  The aliases function,
+// if not nil, is used to expand names such as "japanese" which do not
+// have a codeset.  If no codeset can be found, the result is empty.
+func localeCharset(locale string, aliases func(string) string) string {
+	if i := strings.IndexRune(locale, '@'); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "POSIX" || locale == "C" {
+		return "US-ASCII"
+	}
+	if i := strings.LastIndexByte(locale, '.'); i >= 0 {
+		return normalizeCharset(locale[i+1:])
+	}
+	if aliases != nil {
+		if full := aliases(locale); full != "" && full != locale {
+			return localeCharset(full, nil)
+		}
+	}
+	return ""
+}
@@ -1,4 +1,4 @@
-// +build plan9 nacl
+// +build nacl
 
 // Copyright 2015 The TCell Authors
 //
@@ -0,0 +1,62 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"testing"
+)
+
+func TestLocaleCharset(t *testing.T) {
+	aliases := func(name string) string {
+		if name == "japanese" {
+			return "ja_JP.eucJP"
+		}
+		return ""
+	}
+	for locale, cs := range map[string]string{
+		"en_US.UTF-8":            "UTF-8",
+		"en_US.utf8":             "UTF-8",
+		"C":                      "US-ASCII",
+		"POSIX":                  "US-ASCII",
+		"C.UTF-8":                "UTF-8",
+		"de_DE.ISO-8859-15@euro": "ISO8859-15",
+		"ru_RU.koi8r":            "KOI8-R",
+		"ja_JP.SJIS":             "Shift_JIS",
+		"japanese":               "EUC-JP",
+		"en_US":                  "",
+		"xx.Mystery":             "Mystery",
+	} {
+		if got := localeCharset(locale, aliases); got != cs {
+			t.Errorf("Locale %q: expected %q, got %q", locale, cs, got)
+		}
+	}
+}
+
+func TestSetCharset(t *testing.T) {
+	s := NewSimulationScreen("")
+	if e := s.SetCharset("no-such-charset"); e != ErrNoCharset {
+		t.Errorf("Expected ErrNoCharset, got %v", e)
+	}
+	if e := s.SetCharset("ascii"); e != nil {
+		t.Fatalf("SetCharset failed: %v", e)
+	}
+	if e := s.Init(); e != nil {
+		t.Fatalf("Failed to initialize screen: %v", e)
+	}
+	defer s.Fini()
+	if cs := s.CharacterSet(); cs != "US-ASCII" {
+		t.Errorf("Expected US-ASCII, got %q", cs)
+	}
+}
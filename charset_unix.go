@@ -18,10 +18,43 @@
 package tcell
 
 import (
+	"bufio"
 	"os"
 	"strings"
 )
 
+// localeAliasFiles are where the C library keeps its table of locale
+// aliases, such as "japanese" for "ja_JP.eucJP".
+var localeAliasFiles = []string{
+	"/usr/share/locale/locale.alias",
+	"/usr/lib/locale/locale.alias",
+	"/etc/locale.alias",
+}
+
+// lookupLocaleAlias expands a locale alias, returning the empty string
+// if it is not one.
+func lookupLocaleAlias(name string) string {
+	for _, fn := range localeAliasFiles {
+		f, e := os.Open(fn)
+		if e != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			if strings.EqualFold(fields[0], name) {
+				f.Close()
+				return fields[1]
+			}
+		}
+		f.Close()
+	}
+	return ""
+}
+
 func getCharset() string {
 	// Determine the character set.  This can help us later.
 	// Per POSIX, we search for LC_ALL first, then LC_CTYPE, and
@@ -32,19 +65,12 @@ func getCharset() string {
 			locale = os.Getenv("LANG")
 		}
 	}
-	if locale == "POSIX" || locale == "C" {
-		return "US-ASCII"
-	}
-	if i := strings.IndexRune(locale, '@'); i >= 0 {
-		locale = locale[:i]
-	}
-	if i := strings.LastIndexByte(locale, '.'); i >= 0 {
-		locale = locale[i+1:]
-	} else {
-		// Default assumption, and on Linux we can see LC_ALL
-		// without a character set, which we assume implies UTF-8.
-		return "UTF-8"
+	// Without cgo we cannot ask nl_langinfo, so this is a best effort
+	// at what it would say, using the same alias table as the C library.
+	if cs := localeCharset(locale, lookupLocaleAlias); cs != "" {
+		return cs
 	}
-	// XXX: add support for aliases
-	return locale
+	// Default assumption, and on Linux we can see LC_ALL
+	// without a character set, which we assume implies UTF-8.
+	return "UTF-8"
 }
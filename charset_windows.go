@@ -16,6 +16,44 @@
 
 package tcell
 
+import (
+	"strconv"
+)
+
+var procGetConsoleOutputCP = k32.NewProc("GetConsoleOutputCP")
+
+// codePages maps Windows code pages to character set names.
+var codePages = map[uintptr]string{
+	437:   "IBM437",
+	850:   "IBM850",
+	866:   "IBM866",
+	932:   "Shift_JIS",
+	936:   "GBK",
+	949:   "EUC-KR",
+	950:   "Big5",
+	1200:  "UTF-16LE",
+	1251:  "windows-1251",
+	1252:  "windows-1252",
+	20127: "US-ASCII",
+	20866: "KOI8-R",
+	21866: "KOI8-U",
+	28591: "ISO8859-1",
+	28592: "ISO8859-2",
+	28605: "ISO8859-15",
+	51932: "EUC-JP",
+	54936: "GB18030",
+	65001: "UTF-8",
+}
+
 func getCharset() string {
-	return "UTF-16"
+	// The console itself is always driven with UTF-16, but the output
+	// code page is what other programs writing to it will be using.
+	cp, _, _ := procGetConsoleOutputCP.Call()
+	if cp == 0 {
+		return "UTF-16"
+	}
+	if name, ok := codePages[cp]; ok {
+		return name
+	}
+	return "CP" + strconv.Itoa(int(cp))
 }
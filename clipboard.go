@@ -0,0 +1,136 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sync"
+)
+
+// ClipboardRegister names one of the selections that GetClipboard and
+// SetClipboard operate on.  The values are those used by the OSC 52
+// escape sequence.
+type ClipboardRegister string
+
+const (
+	// ClipboardSystem is the system clipboard, used for explicit
+	// copy and paste.
+	ClipboardSystem ClipboardRegister = "c"
+
+	// ClipboardPrimary is the X11 primary selection, which is the
+	// text most recently selected.
+	ClipboardPrimary ClipboardRegister = "p"
+
+	// ClipboardSecondary is the rarely used X11 secondary selection.
+	ClipboardSecondary ClipboardRegister = "q"
+
+	// ClipboardCut0 through ClipboardCut7 are the X11 cut buffers.
+	ClipboardCut0 ClipboardRegister = "0"
+	ClipboardCut1 ClipboardRegister = "1"
+	ClipboardCut2 ClipboardRegister = "2"
+	ClipboardCut3 ClipboardRegister = "3"
+	ClipboardCut4 ClipboardRegister = "4"
+	ClipboardCut5 ClipboardRegister = "5"
+	ClipboardCut6 ClipboardRegister = "6"
+	ClipboardCut7 ClipboardRegister = "7"
+)
+
+// Valid returns true if the register is one of those defined above.
+func (r ClipboardRegister) Valid() bool {
+	if len(r) != 1 {
+		return false
+	}
+	switch c := r[0]; {
+	case c == 'c', c == 'p', c == 'q':
+		return true
+	case c >= '0' && c <= '7':
+		return true
+	}
+	return false
+}
+
+// clipHistory keeps the texts most recently placed in the clipboard with
+// SetClipboard, or pasted, most recent first.  This is used by Screen
+// implementors to provide ClipboardHistory.  The zero value keeps nothing
+// until limits are set.
+type clipHistory struct {
+	texts   []string
+	size    int
+	max     int
+	maxSize int
+	lk      sync.Mutex
+}
+
+// SetLimits sets the most texts to keep, and the most bytes they may
+// take in total, dropping the oldest texts to fit.  A limit of zero or
+// less for either turns the history off, and empties it.
+func (h *clipHistory) SetLimits(n, size int) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	if n <= 0 || size <= 0 {
+		n, size = 0, 0
+	}
+	h.max, h.maxSize = n, size
+	h.trim()
+}
+
+// trim drops the oldest texts until the history fits its limits.
+func (h *clipHistory) trim() {
+	for len(h.texts) > 0 && (len(h.texts) > h.max || h.size > h.maxSize) {
+		last := len(h.texts) - 1
+		h.size -= len(h.texts[last])
+		h.texts[last] = ""
+		h.texts = h.texts[:last]
+	}
+}
+
+// Add records a text.  If the text is already in the history, it is moved
+// to the front, rather than kept twice.  Empty texts, and texts that are
+// larger than the limit on the total, are not recorded.
+func (h *clipHistory) Add(text string) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	if text == "" || len(text) > h.maxSize {
+		return
+	}
+	for i, t := range h.texts {
+		if t == text {
+			copy(h.texts[1:i+1], h.texts[:i])
+			h.texts[0] = text
+			return
+		}
+	}
+	h.texts = append(h.texts, "")
+	copy(h.texts[1:], h.texts)
+	h.texts[0] = text
+	h.size += len(text)
+	h.trim()
+}
+
+// Note records the text of the event if it is a paste.
+func (h *clipHistory) Note(ev Event) {
+	h.lk.Lock()
+	on := h.max > 0
+	h.lk.Unlock()
+	if ep, ok := ev.(*EventPaste); ok && on {
+		h.Add(ep.Text())
+	}
+}
+
+// Texts returns a copy of the history, most recent first.
+func (h *clipHistory) Texts() []string {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return append([]string(nil), h.texts...)
+}
@@ -110,3 +110,53 @@ func TestColorRGB(t *testing.T) {
 		t.Errorf("RGB wrong (%x, %x, %x)", r, g, b)
 	}
 }
+
+func TestPaletteValues(t *testing.T) {
+	if n := len(paletteValues(1 << 24)); n != 256 {
+		t.Errorf("Palette of direct color terminal has %d colors", n)
+	}
+	if v := paletteValues(8); len(v) != 8 || v[1] != 0x800000 || v[7] != 0xc0c0c0 {
+		t.Errorf("Bad 8 color palette %x", v)
+	}
+
+	// The 88 color cube and grays differ from those of 256 colors.
+	pal := paletteValues(88)
+	if pal[52] != 0xcd8b00 || pal[79] != 0xffffff || pal[82] != 0x737373 {
+		t.Errorf("Bad 88 color palette %x %x %x", pal[52], pal[79], pal[82])
+	}
+	if i := nearestColor(0xcd8b00, pal); i != 52 {
+		t.Errorf("Cube color fit to %d", i)
+	}
+	if i := nearestColor(0x767676, pal); i != 82 {
+		t.Errorf("Gray fit to %d", i)
+	}
+	if i := nearestColor(0x800000, pal); i != 1 {
+		t.Errorf("ANSI color fit to %d", i)
+	}
+	if i := nearestColor(0x123456, nil); i != -1 {
+		t.Errorf("Fit in empty palette %d", i)
+	}
+}
+
+func TestColorCache(t *testing.T) {
+	cc := newColorCache(3)
+	for i := 0; i < 3; i++ {
+		cc.Put(NewHexColor(int32(i)), PaletteColor(i))
+	}
+	// Using the first color keeps it when the next is added.
+	if v, ok := cc.Get(NewHexColor(0)); !ok || v != PaletteColor(0) {
+		t.Errorf("Cached color not found: %v", v)
+	}
+	cc.Put(NewHexColor(3), PaletteColor(3))
+	if cc.Len() != 3 {
+		t.Errorf("Cache has %d colors", cc.Len())
+	}
+	if _, ok := cc.Get(NewHexColor(1)); ok {
+		t.Errorf("Least recently used color kept")
+	}
+	for _, i := range []int32{0, 2, 3} {
+		if v, ok := cc.Get(NewHexColor(i)); !ok || v != PaletteColor(int(i)) {
+			t.Errorf("Color %d lost: %v", i, v)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package tcell
 
 import (
+	"container/list"
 	"github.com/lucasb-eyer/go-colorful"
 	"math"
 )
@@ -23,30 +24,124 @@ import (
 // from the palette given.  This is an expensive operation, so results should
 // be cached by the caller.
 func FindColor(c Color, palette []Color) Color {
-	match := ColorDefault
+	values := make([]int32, len(palette))
+	for i, d := range palette {
+		values[i] = d.Hex()
+	}
+	if i := nearestColor(c.Hex(), values); i >= 0 {
+		return palette[i]
+	}
+	return ColorDefault
+}
+
+// nearestColor returns the index of the RGB value in values that is the
+// closest to v, or -1 if there are none.
+func nearestColor(v int32, values []int32) int {
+	match := -1
 	dist := float64(0)
-	r, g, b := c.RGB()
-	c1 := colorful.Color{
-		R: float64(r) / 255.0,
-		G: float64(g) / 255.0,
-		B: float64(b) / 255.0,
-	}
-	for _, d := range palette {
-		r, g, b = d.RGB()
-		c2 := colorful.Color{
-			R: float64(r) / 255.0,
-			G: float64(g) / 255.0,
-			B: float64(b) / 255.0,
-		}
+	c1 := hexColorful(v)
+	for i, d := range values {
 		// CIE94 is more accurate, but really really expensive.
-		nd := c1.DistanceCIE76(c2)
+		nd := c1.DistanceCIE76(hexColorful(d))
 		if math.IsNaN(nd) {
 			nd = math.Inf(1)
 		}
-		if match == ColorDefault || nd < dist {
-			match = d
+		if match < 0 || nd < dist {
+			match = i
 			dist = nd
 		}
 	}
 	return match
 }
+
+func hexColorful(v int32) colorful.Color {
+	if v < 0 {
+		return colorful.Color{R: -1 / 255.0, G: -1 / 255.0, B: -1 / 255.0}
+	}
+	return colorful.Color{
+		R: float64((v>>16)&0xff) / 255.0,
+		G: float64((v>>8)&0xff) / 255.0,
+		B: float64(v&0xff) / 255.0,
+	}
+}
+
+// paletteValues returns the RGB values of the palette of a terminal
+// with n colors.  Most use the first 8 or 16 of the standard colors, or
+// all 256 of them, with a 6x6x6 color cube and 24 grays after the first
+// 16.  Terminals with 88 colors, such as rxvt, have a 4x4x4 color cube
+// and 8 grays there instead.  Palettes are never larger than 256 colors.
+func paletteValues(n int) []int32 {
+	if n > 256 {
+		n = 256
+	}
+	if n < 0 {
+		n = 0
+	}
+	values := make([]int32, n)
+	for i := range values {
+		values[i] = PaletteColor(i).Hex()
+	}
+	if n == 88 {
+		levels := [4]int32{0x00, 0x8b, 0xcd, 0xff}
+		for i := 0; i < 64; i++ {
+			values[16+i] = levels[i/16]<<16 | levels[i/4%4]<<8 | levels[i%4]
+		}
+		grays := [8]int32{0x2e, 0x5c, 0x73, 0x8b, 0xa2, 0xb9, 0xd0, 0xe7}
+		for i, g := range grays {
+			values[80+i] = g<<16 | g<<8 | g
+		}
+	}
+	return values
+}
+
+// colorCacheMax limits the number of colors a colorCache remembers.  An
+// application drawing gradients can use any number of colors, but only a
+// screenful or so at a time.
+const colorCacheMax = 4096
+
+// colorCache remembers the palette colors that colors were fitted to, so
+// that they need not be fitted again.  Once it is full, the color that was
+// used least recently is forgotten to make room.
+type colorCache struct {
+	max   int
+	m     map[Color]*list.Element
+	order *list.List
+}
+
+type colorCacheEntry struct {
+	c, v Color
+}
+
+func newColorCache(max int) *colorCache {
+	return &colorCache{max: max, m: make(map[Color]*list.Element), order: list.New()}
+}
+
+// Get returns the palette color that c was fitted to, if it is known.
+func (cc *colorCache) Get(c Color) (Color, bool) {
+	e, ok := cc.m[c]
+	if !ok {
+		return ColorDefault, false
+	}
+	cc.order.MoveToFront(e)
+	return e.Value.(*colorCacheEntry).v, true
+}
+
+// Put records that c was fitted to v.
+func (cc *colorCache) Put(c, v Color) {
+	if e, ok := cc.m[c]; ok {
+		e.Value.(*colorCacheEntry).v = v
+		cc.order.MoveToFront(e)
+		return
+	}
+	if cc.order.Len() >= cc.max {
+		e := cc.order.Back()
+		cc.order.Remove(e)
+		delete(cc.m, e.Value.(*colorCacheEntry).c)
+	}
+	cc.m[c] = cc.order.PushFront(&colorCacheEntry{c: c, v: v})
+}
+
+// Len returns the number of colors remembered.
+func (cc *colorCache) Len() int {
+	return cc.order.Len()
+}
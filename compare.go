@@ -0,0 +1,185 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sameCell reports whether the cell at x, y has the same content in both
+// buffers, as returned by GetContent.  Tags and dirty state are ignored,
+// as they are not displayed.  A cell outside of a buffer has no content,
+// so it differs from any cell that is inside the other.
+func sameCell(a, b *CellBuffer, x, y int) bool {
+	m1, c1, s1, w1 := a.GetContent(x, y)
+	m2, c2, s2, w2 := b.GetContent(x, y)
+	return m1 == m2 && s1 == s2 && w1 == w2 && runesEqual(c1, c2)
+}
+
+// Equal returns true if the two buffers are the same size, and every cell
+// has the same runes, style and width.  Tags, and whether cells are dirty,
+// are not compared.
+func (cb *CellBuffer) Equal(other *CellBuffer) bool {
+	if cb.w != other.w || cb.h != other.h {
+		return false
+	}
+	for y := 0; y < cb.h; y++ {
+		for x := 0; x < cb.w; x++ {
+			if !sameCell(cb, other, x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Diff returns the cells that differ between the two buffers, compared
+// as Equal does.  Each changed run of cells on a row is returned as a
+// Rect one row high, in order from the top left.  If the buffers are not
+// the same size, the cells that are in only one of them are included.
+// The result can be passed to InvalidateRect or SetSelection.
+func (cb *CellBuffer) Diff(other *CellBuffer) []Rect {
+	w, h := cb.w, cb.h
+	if other.w > w {
+		w = other.w
+	}
+	if other.h > h {
+		h = other.h
+	}
+	var rects []Rect
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if sameCell(cb, other, x, y) {
+				continue
+			}
+			r := Rect{X: x, Y: y, Width: 1, Height: 1}
+			for x++; x < w && !sameCell(cb, other, x, y); x++ {
+				r.Width++
+			}
+			rects = append(rects, r)
+		}
+	}
+	return rects
+}
+
+// dumpKeys are the characters used to name styles in Dump.
+const dumpKeys = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// Dump returns a human readable picture of the buffer, for use in test
+// failures and snapshot files.  The first line is the size, followed by
+// a line for each row, with its text between vertical bars.  The second
+// cell of a wide character is omitted, so the bars still line up when
+// shown in a fixed width font.
+//
+// If any cell has a style other than StyleDefault, a second picture
+// follows, with a character for the style of each cell: '.' for the
+// default, and a letter or digit for the others, in the order in which
+// they are first used.  A line for each of these then gives the colors
+// and attributes.  Should there be more styles than letters and digits,
+// the rest are all shown as '*'.
+func (cb *CellBuffer) Dump() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%dx%d\n", cb.w, cb.h)
+
+	var styles []Style
+	keys := make(map[Style]byte)
+	for y := 0; y < cb.h; y++ {
+		sb.WriteByte('|')
+		for x := 0; x < cb.w; x++ {
+			mainc, combc, style, width := cb.GetContent(x, y)
+			sb.WriteRune(mainc)
+			for _, r := range combc {
+				sb.WriteRune(r)
+			}
+			if _, ok := keys[style]; !ok && style != StyleDefault {
+				k := byte('*')
+				if len(styles) < len(dumpKeys) {
+					k = dumpKeys[len(styles)]
+				}
+				keys[style] = k
+				styles = append(styles, style)
+			}
+			x += width - 1
+		}
+		sb.WriteString("|\n")
+	}
+	if len(styles) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString("styles:\n")
+	for y := 0; y < cb.h; y++ {
+		sb.WriteByte('|')
+		for x := 0; x < cb.w; x++ {
+			_, _, style, width := cb.GetContent(x, y)
+			if k, ok := keys[style]; ok {
+				sb.WriteByte(k)
+			} else {
+				sb.WriteByte('.')
+			}
+			x += width - 1
+		}
+		sb.WriteString("|\n")
+	}
+	for i, style := range styles {
+		if i >= len(dumpKeys) {
+			break
+		}
+		fmt.Fprintf(&sb, "%c: %s\n", dumpKeys[i], dumpStyle(style))
+	}
+	return sb.String()
+}
+
+// dumpStyle describes a style for Dump.
+func dumpStyle(style Style) string {
+	fg, bg, attrs := style.Decompose()
+	s := "fg=" + dumpColor(fg) + " bg=" + dumpColor(bg)
+	names := []struct {
+		attr AttrMask
+		name string
+	}{
+		{AttrBold, "bold"},
+		{AttrBlink, "blink"},
+		{AttrReverse, "reverse"},
+		{AttrUnderline, "underline"},
+		{AttrDim, "dim"},
+		{AttrItalic, "italic"},
+		{AttrStrikeThrough, "strikethrough"},
+		{AttrRapidBlink, "rapidblink"},
+	}
+	for _, n := range names {
+		if attrs&n.attr != 0 {
+			s += " " + n.name
+		}
+	}
+	return s
+}
+
+// dumpColor names a color for Dump.  Palette colors are given by their
+// index, rather than by name, since several names share an index.
+func dumpColor(c Color) string {
+	switch {
+	case c == ColorDefault:
+		return "default"
+	case c == ColorReset:
+		return "reset"
+	case c.IsRGB():
+		return fmt.Sprintf("#%06x", c.Hex())
+	case c.Valid():
+		return fmt.Sprintf("%d", int(c-ColorValid))
+	}
+	return fmt.Sprintf("%#x", uint64(c))
+}
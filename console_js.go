@@ -0,0 +1,1022 @@
+// +build js
+
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+)
+
+// jsScreen is a screen that renders into a grid of elements in a web
+// page, for programs compiled to WebAssembly.  The grid is placed in the
+// element with the id "tcell", which is created (as a <pre> appended to
+// the body) if the page has none.  The size of the screen follows the
+// size of that element, and keyboard, mouse, and window resize events
+// from the browser are converted into tcell events.
+type jsScreen struct {
+	w       int
+	h       int
+	fini    bool
+	style   Style
+	evch    chan Event
+	quit    chan struct{}
+	cells   CellBuffer
+	cursorx int
+	cursory int
+	cshape  CursorStyle
+	extra   cursorSet
+	mouse   bool
+	paste   bool
+	subs    subscribers
+	diffs   diffMirrors
+	regions regions
+	sel     selection
+	hl      selection
+	ticks   ticker
+	minsz   minSize
+
+	onresize func(int, int)
+	laidw    int
+	laidh    int
+	curstack cursorStack
+	cliphist clipHistory
+	textw    textWatch
+
+	doc       js.Value
+	term      js.Value
+	grid      [][]js.Value
+	listeners []jsListener
+
+	sync.Mutex
+}
+
+// jsListener is a browser event handler that we have registered.
+type jsListener struct {
+	target js.Value
+	name   string
+	fn     js.Func
+}
+
+// Colors used for cells that have the default color, which are needed
+// to show reverse video.
+const (
+	jsDefaultFg = "#cccccc"
+	jsDefaultBg = "#000000"
+)
+
+// NewConsoleScreen returns a Screen that draws into the web page.
+func NewConsoleScreen() (Screen, error) {
+	doc := js.Global().Get("document")
+	if doc.IsUndefined() || doc.IsNull() {
+		return nil, ErrNoScreen
+	}
+	return &jsScreen{doc: doc}, nil
+}
+
+func (s *jsScreen) Init() error {
+	s.evch = make(chan Event, 10)
+	s.quit = make(chan struct{})
+	s.fini = false
+	s.cursorx = -1
+	s.cursory = -1
+	s.style = StyleDefault
+
+	s.term = s.doc.Call("getElementById", "tcell")
+	if s.term.IsNull() {
+		s.term = s.doc.Call("createElement", "pre")
+		s.term.Set("id", "tcell")
+		s.doc.Get("body").Call("appendChild", s.term)
+	}
+	st := s.term.Get("style")
+	st.Set("color", jsDefaultFg)
+	st.Set("backgroundColor", jsDefaultBg)
+	st.Set("fontFamily", "monospace")
+	st.Set("lineHeight", "1.2")
+	st.Set("margin", "0")
+	st.Set("whiteSpace", "pre")
+
+	s.listen(s.doc, "keydown", s.onKey)
+	s.listen(s.term, "mousedown", s.onMouse)
+	s.listen(s.term, "mouseup", s.onMouse)
+	s.listen(s.term, "mousemove", s.onMouse)
+	s.listen(s.term, "wheel", s.onMouse)
+	s.listen(s.term, "contextmenu", func(ev js.Value) {
+		if s.mouse {
+			ev.Call("preventDefault")
+		}
+	})
+	s.listen(s.doc, "paste", s.onPaste)
+	s.listen(js.Global(), "resize", func(js.Value) {
+		// Callbacks run on the browser's event loop, so must not
+		// wait for the lock.
+		go func() {
+			s.Lock()
+			if !s.fini {
+				s.resize()
+				s.draw()
+			}
+			s.Unlock()
+		}()
+	})
+
+	s.Lock()
+	s.resize()
+	s.ticks.Run(s.quit, s.postTick)
+	s.Unlock()
+	return nil
+}
+
+func (s *jsScreen) listen(target js.Value, name string, fn func(js.Value)) {
+	f := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		fn(args[0])
+		return nil
+	})
+	target.Call("addEventListener", name, f)
+	s.listeners = append(s.listeners, jsListener{target, name, f})
+}
+
+func (s *jsScreen) Fini() {
+	s.Lock()
+	defer s.Unlock()
+	if s.fini {
+		return
+	}
+	s.fini = true
+	s.cells.Resize(0, 0)
+	s.w, s.h = 0, 0
+	s.term.Set("innerHTML", "")
+	s.grid = nil
+	s.ticks.Stop()
+	close(s.quit)
+	s.subs.Close()
+	s.diffs.Close()
+
+	for _, l := range s.listeners {
+		l.target.Call("removeEventListener", l.name, l.fn)
+		l.fn.Release()
+	}
+	s.listeners = nil
+}
+
+// cellSize measures the size of a single character cell.
+func (s *jsScreen) cellSize() (float64, float64) {
+	span := s.doc.Call("createElement", "span")
+	span.Set("textContent", "M")
+	s.term.Call("appendChild", span)
+	r := span.Call("getBoundingClientRect")
+	s.term.Call("removeChild", span)
+	return r.Get("width").Float(), r.Get("height").Float()
+}
+
+// winSize determines how many cells will fit in the browser window.
+func (s *jsScreen) winSize() (int, int) {
+	cw, ch := s.cellSize()
+	win := js.Global()
+	ww := win.Get("innerWidth").Float()
+	wh := win.Get("innerHeight").Float()
+	if cw <= 0 || ch <= 0 {
+		return 80, 25
+	}
+	w, h := int(ww/cw), int(wh/ch)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// resize rebuilds the grid if the window size has changed.  The caller
+// must hold the lock.
+func (s *jsScreen) resize() {
+	w, h := s.winSize()
+	if w == s.w && h == s.h {
+		return
+	}
+	s.cells.Resize(w, h)
+	s.cells.Invalidate()
+	s.w, s.h = w, h
+
+	s.term.Set("innerHTML", "")
+	s.grid = make([][]js.Value, h)
+	for y := range s.grid {
+		row := s.doc.Call("createElement", "div")
+		s.grid[y] = make([]js.Value, w)
+		for x := range s.grid[y] {
+			cell := s.doc.Call("createElement", "span")
+			cell.Set("textContent", " ")
+			row.Call("appendChild", cell)
+			s.grid[y][x] = cell
+		}
+		s.term.Call("appendChild", row)
+	}
+	s.PostEvent(NewEventResize(w, h))
+	s.checkMinSize()
+}
+
+// relayout calls the OnResize callback if the size has changed since it
+// was last called, as for tScreen.relayout.  The caller holds the lock.
+func (s *jsScreen) relayout() bool {
+	for s.onresize != nil && !s.fini {
+		w, h := s.w, s.h
+		if w == s.laidw && h == s.laidh {
+			break
+		}
+		fn := s.onresize
+		s.laidw, s.laidh = w, h
+		s.Unlock()
+		fn(w, h)
+		s.Lock()
+		if s.fini {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMinSize posts an EventTooSmall if the screen has crossed its
+// minimum size.
+func (s *jsScreen) checkMinSize() {
+	if ev := s.minsz.Check(s.w, s.h); ev != nil {
+		s.cells.Invalidate()
+		s.PostEvent(ev)
+	}
+}
+
+func (s *jsScreen) SetStyle(style Style) {
+	s.Lock()
+	s.style = style
+	s.Unlock()
+}
+
+func (s *jsScreen) Clear() {
+	s.Fill(' ', s.style)
+}
+
+func (s *jsScreen) Fill(r rune, style Style) {
+	s.Lock()
+	s.cells.Fill(r, style)
+	s.Unlock()
+}
+
+func (s *jsScreen) ClearRect(x, y, w, h int, style Style) {
+	s.Lock()
+	s.cells.FillRect(Rect{X: x, Y: y, Width: w, Height: h}, ' ', style)
+	s.Unlock()
+}
+
+func (s *jsScreen) ClearLine(y int) {
+	s.Lock()
+	s.cells.FillRect(Rect{X: 0, Y: y, Width: s.w, Height: 1}, ' ', s.style)
+	s.Unlock()
+}
+
+func (s *jsScreen) SetCell(x, y int, style Style, ch ...rune) {
+	if len(ch) > 0 {
+		s.SetContent(x, y, ch[0], ch[1:], style)
+	} else {
+		s.SetContent(x, y, ' ', nil, style)
+	}
+}
+
+func (s *jsScreen) SetContent(x, y int, mainc rune, combc []rune, style Style) {
+	s.Lock()
+	s.cells.SetContent(x, y, mainc, combc, style)
+	s.Unlock()
+}
+
+func (s *jsScreen) GetContent(x, y int) (rune, []rune, Style, int) {
+	s.Lock()
+	mainc, combc, style, width := s.cells.GetContent(x, y)
+	s.Unlock()
+	return mainc, combc, style, width
+}
+
+func (s *jsScreen) SetTag(x, y int, tag uint32) {
+	s.Lock()
+	s.cells.SetTag(x, y, tag)
+	s.Unlock()
+}
+
+func (s *jsScreen) GetTag(x, y int) uint32 {
+	s.Lock()
+	tag := s.cells.GetTag(x, y)
+	s.Unlock()
+	return tag
+}
+
+func (s *jsScreen) SetSelection(rects []Rect, style Style) {
+	s.Lock()
+	s.sel.set(&s.cells, rects, style)
+	s.Unlock()
+}
+
+func (s *jsScreen) SelectedText() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.cells.Text(s.sel.rects...)
+}
+
+func (s *jsScreen) SetHighlight(rects []Rect, style Style) {
+	s.Lock()
+	s.hl.set(&s.cells, rects, style)
+	s.Unlock()
+}
+
+func (s *jsScreen) Find(re *regexp.Regexp) []Rect {
+	s.Lock()
+	defer s.Unlock()
+	return s.cells.Find(re)
+}
+
+func (s *jsScreen) ShowCursor(x, y int) {
+	s.ShowCursorStyle(x, y, CursorStyleDefault)
+}
+
+// The browser has no cursor of its own, so the cursor is always drawn
+// in software.
+func (s *jsScreen) ShowCursorStyle(x, y int, cs CursorStyle) {
+	s.ShowCursors(Cursor{X: x, Y: y, Style: cs})
+}
+
+func (s *jsScreen) ShowCursors(cursors ...Cursor) {
+	c := Cursor{X: -1, Y: -1}
+	if len(cursors) > 0 {
+		c = cursors[0]
+	}
+	s.Lock()
+	s.cells.SetDirty(s.cursorx, s.cursory, true)
+	s.extra.mark(&s.cells)
+	s.cursorx, s.cursory = c.X, c.Y
+	s.cshape = c.Style
+	s.extra = secondary(cursors)
+	s.cells.SetDirty(c.X, c.Y, true)
+	s.extra.mark(&s.cells)
+	s.Unlock()
+}
+
+func (s *jsScreen) SetSoftCursor(bool)  {}
+func (s *jsScreen) SetCursorBlink(bool) {}
+
+func (s *jsScreen) HideCursor() {
+	s.ShowCursor(-1, -1)
+}
+
+func (s *jsScreen) PushCursorState() {
+	s.Lock()
+	s.curstack.Push(Cursor{X: s.cursorx, Y: s.cursory, Style: s.cshape}, s.extra)
+	s.Unlock()
+}
+
+func (s *jsScreen) PopCursorState() {
+	s.Lock()
+	cursors, ok := s.curstack.Pop()
+	s.Unlock()
+	if ok {
+		s.ShowCursors(cursors...)
+	}
+}
+
+// cssColor returns the CSS form of the color, or def if it has none.
+func cssColor(c Color, def string) string {
+	if v := c.Hex(); v >= 0 {
+		return fmt.Sprintf("#%06x", v)
+	}
+	return def
+}
+
+// cssStyle returns the CSS properties to display the style.
+func (s *jsScreen) cssStyle(style Style) string {
+	fg, bg, attrs := style.Decompose()
+	fgs, bgs := cssColor(fg, jsDefaultFg), cssColor(bg, jsDefaultBg)
+	if attrs&AttrReverse != 0 {
+		fgs, bgs = bgs, fgs
+	}
+	css := &strings.Builder{}
+	fmt.Fprintf(css, "color:%s;background-color:%s;", fgs, bgs)
+	if attrs&AttrBold != 0 {
+		css.WriteString("font-weight:bold;")
+	}
+	if attrs&AttrItalic != 0 {
+		css.WriteString("font-style:italic;")
+	}
+	if attrs&AttrDim != 0 {
+		css.WriteString("opacity:0.6;")
+	}
+	var deco []string
+	if attrs&AttrUnderline != 0 {
+		deco = append(deco, "underline")
+	}
+	if attrs&AttrStrikeThrough != 0 {
+		deco = append(deco, "line-through")
+	}
+	if len(deco) > 0 {
+		css.WriteString("text-decoration:" + strings.Join(deco, " ") + ";")
+	}
+	return css.String()
+}
+
+func (s *jsScreen) drawCell(x, y int) int {
+	mainc, combc, style, width := s.cells.GetContent(x, y)
+	if !s.cells.Dirty(x, y) {
+		return width
+	}
+	if style == StyleDefault {
+		style = s.style
+	}
+	style = s.hl.apply(x, y, width, style)
+	style = s.sel.apply(x, y, width, style)
+	if x > s.w-width {
+		mainc, combc, width = ' ', nil, 1
+	}
+	text := string(append([]rune{mainc}, combc...))
+	if x == s.cursorx && y == s.cursory {
+		style = s.cshape.apply(style)
+	} else {
+		style = s.extra.apply(x, y, style)
+	}
+
+	el := s.grid[y][x]
+	el.Set("textContent", text)
+	el.Call("setAttribute", "style", s.cssStyle(style))
+	if width > 1 && x+1 < s.w {
+		// The wide character covers the next cell, which is
+		// hidden until it is drawn again.
+		s.grid[y][x+1].Set("textContent", "")
+		s.cells.SetDirty(x+1, y, true)
+	}
+	s.cells.SetDirty(x, y, false)
+	return width
+}
+
+func (s *jsScreen) draw() {
+	if s.minsz.Small() {
+		// Draw the notice instead, without the cursor.
+		cx, cy := s.cursorx, s.cursory
+		s.cursorx, s.cursory = -1, -1
+		s.minsz.Swap(&s.cells)
+		defer func() {
+			s.minsz.Swap(&s.cells)
+			s.cursorx, s.cursory = cx, cy
+		}()
+	}
+	for y := 0; y < s.h && y < len(s.grid); y++ {
+		for x := 0; x < s.w; x++ {
+			width := s.drawCell(x, y)
+			x += width - 1
+		}
+	}
+	s.diffs.Frame(&s.cells)
+}
+
+func (s *jsScreen) Show() {
+	s.Lock()
+	if !s.fini {
+		s.resize()
+		if s.relayout() {
+			s.draw()
+		}
+	}
+	notify := s.textw.Check(&s.cells, &s.regions)
+	s.Unlock()
+	if notify != nil {
+		notify()
+	}
+}
+
+func (s *jsScreen) Sync() {
+	s.Lock()
+	if !s.fini {
+		s.resize()
+		s.cells.Invalidate()
+		s.minsz.Invalidate()
+		if s.relayout() {
+			s.draw()
+		}
+	}
+	notify := s.textw.Check(&s.cells, &s.regions)
+	s.Unlock()
+	if notify != nil {
+		notify()
+	}
+}
+
+func (s *jsScreen) Invalidate(rect Rect) {
+	s.Lock()
+	s.cells.InvalidateRect(rect)
+	s.minsz.Invalidate()
+	s.Unlock()
+}
+
+func (s *jsScreen) Size() (int, int) {
+	s.Lock()
+	w, h := s.w, s.h
+	s.Unlock()
+	return w, h
+}
+
+func (s *jsScreen) Colors() int {
+	return 1 << 24
+}
+
+func (s *jsScreen) SupportedAttrs() AttrMask {
+	return AttrBold | AttrReverse | AttrUnderline | AttrDim | AttrItalic |
+		AttrStrikeThrough
+}
+
+func (s *jsScreen) CharacterSet() string {
+	return "UTF-8"
+}
+
+func (s *jsScreen) SetCharset(charset string) error {
+	if normalizeCharset(charset) != "UTF-8" {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (s *jsScreen) SetInputEncoding(charset string) error {
+	return s.SetCharset(charset)
+}
+
+func (s *jsScreen) SetOutputEncoding(charset string) error {
+	return s.SetCharset(charset)
+}
+
+func (s *jsScreen) RegisterEncoding(string, encoding.Encoding) {}
+func (s *jsScreen) SetEncodingFallback(EncodingFallback)       {}
+
+func (s *jsScreen) EnableMouse() {
+	s.Lock()
+	s.mouse = true
+	s.Unlock()
+}
+
+func (s *jsScreen) DisableMouse() {
+	s.Lock()
+	s.mouse = false
+	s.Unlock()
+}
+
+func (s *jsScreen) MouseEnabled() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.mouse
+}
+
+func (s *jsScreen) EnablePaste() {
+	s.SetPaste(true)
+}
+
+func (s *jsScreen) DisablePaste() {
+	s.SetPaste(false)
+}
+
+func (s *jsScreen) PasteEnabled() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.paste
+}
+
+func (s *jsScreen) HasMouse() bool {
+	return true
+}
+
+func (s *jsScreen) Has(c Capability) bool {
+	switch c {
+	case CapMouse, CapPaste:
+		return true
+	case CapTrueColor:
+		return s.Colors() >= 1<<24
+	}
+	return false
+}
+
+func (s *jsScreen) PollEvent() Event {
+	select {
+	case <-s.quit:
+		return nil
+	case ev := <-s.evch:
+		return ev
+	}
+}
+
+func (s *jsScreen) PostEventWait(ev Event) {
+	s.regions.Annotate(ev)
+	select {
+	case s.evch <- ev:
+		s.cliphist.Note(ev)
+		s.subs.Publish(ev)
+	case <-s.quit:
+	}
+}
+
+func (s *jsScreen) PostEvent(ev Event) error {
+	s.regions.Annotate(ev)
+	select {
+	case s.evch <- ev:
+		s.cliphist.Note(ev)
+		s.subs.Publish(ev)
+		return nil
+	default:
+		return ErrEventQFull
+	}
+}
+
+func (s *jsScreen) InjectKey(key Key, ch rune, mod ModMask) error {
+	return s.PostEvent(newSyntheticKey(key, ch, mod))
+}
+
+func (s *jsScreen) InjectMouse(x, y int, buttons ButtonMask, mod ModMask) error {
+	return s.PostEvent(newSyntheticMouse(x, y, buttons, mod))
+}
+
+func (s *jsScreen) StartTicker(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.ticks.Set(d)
+	if s.quit != nil && !s.fini {
+		s.ticks.Run(s.quit, s.postTick)
+	}
+}
+
+func (s *jsScreen) postTick(ev Event) error {
+	if len(s.evch) > 0 {
+		return ErrEventQFull
+	}
+	return s.PostEvent(ev)
+}
+
+func (s *jsScreen) Mirror(io.Writer) error {
+	return ErrNotSupported
+}
+
+func (s *jsScreen) Unmirror(io.Writer) {}
+
+func (s *jsScreen) RegisterRegion(id string, r Rect) {
+	s.regions.Register(id, r)
+}
+
+func (s *jsScreen) MirrorDiffs(w io.Writer) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fini {
+		return ErrNoScreen
+	}
+	s.diffs.Add(w, &s.cells)
+	return nil
+}
+
+func (s *jsScreen) UnmirrorDiffs(w io.Writer) {
+	s.diffs.Remove(w)
+}
+
+func (s *jsScreen) UnregisterRegion(id string) {
+	s.regions.Unregister(id)
+}
+
+func (s *jsScreen) Subscribe(size int) <-chan Event {
+	return s.subs.Subscribe(size)
+}
+
+func (s *jsScreen) Unsubscribe(ch <-chan Event) {
+	s.subs.Unsubscribe(ch)
+}
+
+// jsKeys maps the names of browser keys to our keys.
+var jsKeys = map[string]Key{
+	"Enter":      KeyEnter,
+	"Backspace":  KeyBackspace2,
+	"Tab":        KeyTab,
+	"Escape":     KeyEscape,
+	"ArrowUp":    KeyUp,
+	"ArrowDown":  KeyDown,
+	"ArrowLeft":  KeyLeft,
+	"ArrowRight": KeyRight,
+	"Home":       KeyHome,
+	"End":        KeyEnd,
+	"PageUp":     KeyPgUp,
+	"PageDown":   KeyPgDn,
+	"Insert":     KeyInsert,
+	"Delete":     KeyDelete,
+	"Pause":      KeyPause,
+	"Clear":      KeyClear,
+	"F1":         KeyF1,
+	"F2":         KeyF2,
+	"F3":         KeyF3,
+	"F4":         KeyF4,
+	"F5":         KeyF5,
+	"F6":         KeyF6,
+	"F7":         KeyF7,
+	"F8":         KeyF8,
+	"F9":         KeyF9,
+	"F10":        KeyF10,
+	"F11":        KeyF11,
+	"F12":        KeyF12,
+
+	"PrintScreen": KeyPrint,
+	"ScrollLock":  KeyScrollLock,
+	"ContextMenu": KeyMenu,
+}
+
+func jsMods(ev js.Value) ModMask {
+	mod := ModNone
+	if ev.Get("shiftKey").Bool() {
+		mod |= ModShift
+	}
+	if ev.Get("ctrlKey").Bool() {
+		mod |= ModCtrl
+	}
+	if ev.Get("altKey").Bool() {
+		mod |= ModAlt
+	}
+	if ev.Get("metaKey").Bool() {
+		mod |= ModMeta
+	}
+	return mod
+}
+
+// jsLocks returns the state of the lock keys, for EventKey.Locks.
+func jsLocks(ev js.Value) ModMask {
+	locks := ModNone
+	if ev.Call("getModifierState", "CapsLock").Bool() {
+		locks |= ModCapsLock
+	}
+	if ev.Call("getModifierState", "NumLock").Bool() {
+		locks |= ModNumLock
+	}
+	return locks
+}
+
+// postKey posts a key event, with the state of the lock keys taken from
+// the browser's event.
+func (s *jsScreen) postKey(ev js.Value, k Key, r rune, mod ModMask) {
+	kev := NewEventKey(k, r, mod, "")
+	kev.locks = jsLocks(ev)
+	s.PostEvent(kev)
+}
+
+func (s *jsScreen) onKey(ev js.Value) {
+	name := ev.Get("key").String()
+	mod := jsMods(ev)
+
+	if k, ok := jsKeys[name]; ok {
+		if k == KeyTab && mod&ModShift != 0 {
+			k, mod = KeyBacktab, mod&^ModShift
+		}
+		// Location 3 is the numeric keypad.
+		if k == KeyEnter && ev.Get("location").Int() == 3 {
+			k = KeyKPEnter
+		}
+		ev.Call("preventDefault")
+		s.postKey(ev, k, 0, mod)
+		return
+	}
+
+	// Anything else that is not a single character, such as a bare
+	// modifier key, is of no interest.
+	r, n := utf8.DecodeRuneInString(name)
+	if n != len(name) || r == utf8.RuneError {
+		return
+	}
+	// Leave the browser's own paste shortcut alone.
+	if mod&(ModCtrl|ModMeta) != 0 && (r == 'v' || r == 'V') && s.paste {
+		return
+	}
+	ev.Call("preventDefault")
+
+	// Shift is already reflected in the character itself.
+	mod &^= ModShift
+	if mod&ModCtrl != 0 {
+		switch {
+		case r >= 'a' && r <= 'z':
+			s.postKey(ev, KeyCtrlA+Key(r-'a'), 0, mod)
+			return
+		case r >= 'A' && r <= 'Z':
+			s.postKey(ev, KeyCtrlA+Key(r-'A'), 0, mod)
+			return
+		}
+	}
+	s.postKey(ev, KeyRune, r, mod)
+}
+
+func (s *jsScreen) onMouse(ev js.Value) {
+	if !s.mouse {
+		return
+	}
+	ev.Call("preventDefault")
+
+	rect := s.term.Call("getBoundingClientRect")
+	px := ev.Get("clientX").Float() - rect.Get("left").Float()
+	py := ev.Get("clientY").Float() - rect.Get("top").Float()
+	cw, ch := s.cellSize()
+	x, y := 0, 0
+	if cw > 0 && ch > 0 {
+		x, y = int(px/cw), int(py/ch)
+	}
+
+	btn := ButtonNone
+	b := ev.Get("buttons").Int()
+	if b&1 != 0 {
+		btn |= Button1
+	}
+	if b&2 != 0 {
+		btn |= Button2
+	}
+	if b&4 != 0 {
+		btn |= Button3
+	}
+	if ev.Get("type").String() == "wheel" {
+		if dy := ev.Get("deltaY").Float(); dy < 0 {
+			btn |= WheelUp
+		} else if dy > 0 {
+			btn |= WheelDown
+		}
+		if dx := ev.Get("deltaX").Float(); dx < 0 {
+			btn |= WheelLeft
+		} else if dx > 0 {
+			btn |= WheelRight
+		}
+	}
+	s.PostEvent(NewEventMouse(x, y, btn, jsMods(ev), ""))
+}
+
+func (s *jsScreen) onPaste(ev js.Value) {
+	if !s.paste {
+		return
+	}
+	ev.Call("preventDefault")
+	text := ev.Get("clipboardData").Call("getData", "text/plain").String()
+	s.PostEvent(NewEventPaste(text, ""))
+}
+
+func (s *jsScreen) RegisterRuneFallback(rune, string) {}
+func (s *jsScreen) UnregisterRuneFallback(rune)       {}
+
+func (s *jsScreen) CanDisplay(r rune, checkFallbacks bool) bool {
+	return true
+}
+
+func (s *jsScreen) Resize(int, int, int, int) {}
+
+func (s *jsScreen) OnResize(fn func(w, h int)) {
+	s.Lock()
+	s.onresize = fn
+	s.laidw, s.laidh = s.w, s.h
+	s.Unlock()
+}
+
+func (s *jsScreen) Linearize() []TextBlock {
+	s.Lock()
+	defer s.Unlock()
+	return linearize(&s.cells, &s.regions)
+}
+
+func (s *jsScreen) OnTextChange(fn func([]TextBlock)) {
+	s.Lock()
+	s.textw.Set(fn)
+	s.Unlock()
+}
+
+func (s *jsScreen) SetMinSize(w, h int) {
+	s.Lock()
+	s.minsz.Set(w, h)
+	s.checkMinSize()
+	s.Unlock()
+}
+
+func (s *jsScreen) RequestResize(int, int) error {
+	// The grid always fills the page.
+	return ErrNotSupported
+}
+
+func (s *jsScreen) HasKey(k Key) bool {
+	if k == KeyRune {
+		return true
+	}
+	for _, v := range jsKeys {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsScreen) AddInput(io.Reader) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (s *jsScreen) RegisterRawSeq(string)        {}
+func (s *jsScreen) SetInputLimits(int, int)      {}
+func (s *jsScreen) SetRestricted(bool)           {}
+func (s *jsScreen) SetResizeDelay(time.Duration) {}
+func (s *jsScreen) SetSizePoll(time.Duration)    {}
+func (s *jsScreen) SetFixedSize(int, int)        {}
+func (s *jsScreen) SetIdleTimeout(time.Duration) {}
+func (s *jsScreen) SetSoftBlink(time.Duration)   {}
+func (s *jsScreen) SetBoldAsBright(bool)         {}
+func (s *jsScreen) SetManualPump(bool)           {}
+func (s *jsScreen) ProcessInput([]byte)          {}
+func (s *jsScreen) Tick()                        {}
+func (s *jsScreen) SetInline(int)                {}
+func (s *jsScreen) SetCombining(bool)            {}
+func (s *jsScreen) SetOutputBudget(int, Degrade) {}
+func (s *jsScreen) SetGlyphPolicy(GlyphPolicy)   {}
+func (s *jsScreen) SetPadding(Padding, int)      {}
+func (s *jsScreen) SetFlushSize(int)             {}
+func (s *jsScreen) SetUTF8Policy(UTF8Policy)     {}
+func (s *jsScreen) SetCaptureEscSeq(bool)        {}
+func (s *jsScreen) SetNormalizeBackspace(bool)   {}
+func (s *jsScreen) SetEscapeAlt(bool)            {}
+func (s *jsScreen) SetMouseSupport(bool)         {}
+func (s *jsScreen) SetSystemColors(bool)         {}
+func (s *jsScreen) SetRGBSeparator(RGBSeparator) {}
+
+func (s *jsScreen) SetMetrics(func(Metric, time.Duration)) {}
+
+func (s *jsScreen) SetAnimation(Style, AnimatedStyle) {}
+
+func (s *jsScreen) SetPaletteColor(int, Color) error { return ErrNotSupported }
+func (s *jsScreen) ResetPalette()                    {}
+
+func (s *jsScreen) BindSequence(string, Key, ModMask) {}
+func (s *jsScreen) UnbindSequence(string)             {}
+func (s *jsScreen) KeySequences() []KeySequence       { return nil }
+func (s *jsScreen) KeyConflicts() []KeyConflict       { return nil }
+func (s *jsScreen) Pasting() bool                     { return false }
+
+// Browser pastes are already exact.
+func (s *jsScreen) SetRawPaste(bool) {}
+
+func (s *jsScreen) SetPaste(p bool) {
+	s.Lock()
+	s.paste = p
+	s.Unlock()
+}
+
+func (s *jsScreen) Println(string) error {
+	return ErrNotSupported
+}
+
+func (s *jsScreen) GetClipboard(ClipboardRegister) error {
+	return ErrNotSupported
+}
+
+func (s *jsScreen) SetClipboard(string, ClipboardRegister) error {
+	return ErrNotSupported
+}
+
+func (s *jsScreen) HasClipboard(ClipboardRegister) bool {
+	return false
+}
+
+func (s *jsScreen) SetClipboardHistory(entries, size int) {
+	s.cliphist.SetLimits(entries, size)
+}
+
+func (s *jsScreen) ClipboardHistory() []string {
+	return s.cliphist.Texts()
+}
+
+func (s *jsScreen) QueryCursorPosition(time.Duration) (int, int, error) {
+	return 0, 0, ErrNotSupported
+}
+
+func (s *jsScreen) QueryDefaultColors(time.Duration) (Color, Color, error) {
+	return ColorDefault, ColorDefault, ErrNotSupported
+}
+
+func (s *jsScreen) QueryPaletteColor(int, time.Duration) (Color, error) {
+	return ColorDefault, ErrNotSupported
+}
+
+func (s *jsScreen) QueryTermcap(string, time.Duration) (string, bool, error) {
+	return "", false, ErrNotSupported
+}
+
+func (s *jsScreen) Beep() error {
+	return ErrNotSupported
+}
@@ -1,4 +1,4 @@
-// +build !windows
+// +build !windows,!js
 
 // Copyright 2015 The TCell Authors
 //
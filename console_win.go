@@ -19,12 +19,17 @@ package tcell
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 	"unicode/utf16"
 	"unsafe"
+
+	"golang.org/x/text/encoding"
 )
 
 type cScreen struct {
@@ -37,6 +42,9 @@ type cScreen struct {
 	quit       chan struct{}
 	curx       int
 	cury       int
+	cshape     CursorStyle
+	softcur    bool
+	extra      cursorSet
 	style      Style
 	clear      bool
 	fini       bool
@@ -51,6 +59,28 @@ type cScreen struct {
 	oimode  uint32
 	oomode  uint32
 	cells   CellBuffer
+	subs    subscribers
+	diffs   diffMirrors
+	regions regions
+	sel     selection
+	hl      selection
+	ticks   ticker
+	minsz   minSize
+	palette []Color
+	colors  map[Color]uint16
+
+	onresize func(int, int)
+	laidw    int
+	laidh    int
+
+	mouseon  bool
+	mousex   int
+	mousey   int
+	mousebtn ButtonMask
+	curstack cursorStack
+	cblink   cursorBlink
+	cliphist clipHistory
+	textw    textWatch
 
 	finiOnce sync.Once
 
@@ -159,6 +189,7 @@ func (s *cScreen) Init() error {
 	s.evch = make(chan Event, 10)
 	s.quit = make(chan struct{})
 	s.scandone = make(chan struct{})
+	s.finiOnce = sync.Once{}
 
 	in, e := syscall.Open("CONIN$", syscall.O_RDWR, 0)
 	if e != nil {
@@ -215,6 +246,7 @@ func (s *cScreen) Init() error {
 
 	s.fini = false
 	s.setInMode(modeResizeEn | modeExtndFlg)
+	s.mouseon = false
 
 	// 24-bit color is opt-in for now, because we can't figure out
 	// to make it work consistently.
@@ -229,10 +261,12 @@ func (s *cScreen) Init() error {
 		}
 	} else {
 		s.setOutMode(0)
+		s.loadPalette()
 	}
 
 	s.clearScreen(s.style)
 	s.hideCursor()
+	s.ticks.Run(s.quit, s.postTick)
 	s.Unlock()
 	go s.scanInput()
 
@@ -240,18 +274,53 @@ func (s *cScreen) Init() error {
 }
 
 func (s *cScreen) CharacterSet() string {
-	// We are always UTF-16LE on Windows
-	return "UTF-16LE"
+	// The console is always Unicode, which we translate to and from UTF-8
+	return "UTF-8"
+}
+
+func (s *cScreen) SetCharset(charset string) error {
+	if normalizeCharset(charset) != "UTF-8" {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+func (s *cScreen) SetInputEncoding(charset string) error {
+	return s.SetCharset(charset)
+}
+
+func (s *cScreen) SetOutputEncoding(charset string) error {
+	return s.SetCharset(charset)
 }
 
+func (s *cScreen) RegisterEncoding(string, encoding.Encoding) {}
+func (s *cScreen) SetEncodingFallback(EncodingFallback)       {}
+
 func (s *cScreen) EnableMouse() {
 	s.setInMode(modeResizeEn | modeMouseEn | modeExtndFlg)
+	s.Lock()
+	s.mouseon = true
+	s.Unlock()
 }
 
 func (s *cScreen) DisableMouse() {
 	s.setInMode(modeResizeEn | modeExtndFlg)
+	s.Lock()
+	s.mouseon = false
+	s.Unlock()
+}
+
+func (s *cScreen) MouseEnabled() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.mouseon
 }
 
+// The console does not mark pasted text, so these do nothing.
+func (s *cScreen) EnablePaste()       {}
+func (s *cScreen) DisablePaste()      {}
+func (s *cScreen) PasteEnabled() bool { return false }
+
 func (s *cScreen) Fini() {
 	s.finiOnce.Do(s.finish)
 }
@@ -262,7 +331,13 @@ func (s *cScreen) finish() {
 	s.curx = -1
 	s.cury = -1
 	s.fini = true
+	if s.vten && (s.cshape != CursorStyleDefault || s.cblink != blinkDefault) {
+		s.emitVtString(fmt.Sprintf(cursorShape, 0))
+		s.flushOutBuffer()
+	}
+	s.cshape = CursorStyleDefault
 	s.vten = false
+	s.ticks.Stop()
 	s.Unlock()
 
 	s.setCursorInfo(&s.ocursor)
@@ -276,27 +351,102 @@ func (s *cScreen) finish() {
 		uintptr(s.mapStyle(StyleDefault)))
 
 	close(s.quit)
+	s.subs.Close()
+	s.diffs.Close()
 	procSetEvent.Call(uintptr(s.cancelflag))
 	// Block until scanInput returns; this prevents a race condition on Win 8+
 	// which causes syscall.Close to block until another keypress is read.
 	<-s.scandone
 	syscall.Close(s.in)
 	syscall.Close(s.out)
+	syscall.CloseHandle(s.cancelflag)
+
+	// Start afresh if initialized again.
+	s.w, s.h = 0, 0
 }
 
 func (s *cScreen) PostEventWait(ev Event) {
-	s.evch <- ev
+	s.regions.Annotate(ev)
+	select {
+	case s.evch <- ev:
+		s.cliphist.Note(ev)
+		s.subs.Publish(ev)
+	case <-s.quit:
+	}
 }
 
 func (s *cScreen) PostEvent(ev Event) error {
+	s.regions.Annotate(ev)
 	select {
 	case s.evch <- ev:
+		s.cliphist.Note(ev)
+		s.subs.Publish(ev)
 		return nil
 	default:
 		return ErrEventQFull
 	}
 }
 
+func (s *cScreen) InjectKey(key Key, ch rune, mod ModMask) error {
+	return s.PostEvent(newSyntheticKey(key, ch, mod))
+}
+
+func (s *cScreen) InjectMouse(x, y int, buttons ButtonMask, mod ModMask) error {
+	return s.PostEvent(newSyntheticMouse(x, y, buttons, mod))
+}
+
+func (s *cScreen) StartTicker(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.ticks.Set(d)
+	if s.quit != nil && !s.fini {
+		s.ticks.Run(s.quit, s.postTick)
+	}
+}
+
+func (s *cScreen) postTick(ev Event) error {
+	if len(s.evch) > 0 {
+		return ErrEventQFull
+	}
+	return s.PostEvent(ev)
+}
+
+func (s *cScreen) Mirror(io.Writer) error {
+	return ErrNotSupported
+}
+
+func (s *cScreen) Unmirror(io.Writer) {}
+
+func (s *cScreen) RegisterRegion(id string, r Rect) {
+	s.regions.Register(id, r)
+}
+
+func (s *cScreen) MirrorDiffs(w io.Writer) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fini {
+		return ErrNoScreen
+	}
+	s.diffs.Add(w, &s.cells)
+	return nil
+}
+
+func (s *cScreen) UnmirrorDiffs(w io.Writer) {
+	s.diffs.Remove(w)
+}
+
+func (s *cScreen) UnregisterRegion(id string) {
+	s.regions.Unregister(id)
+}
+
+func (s *cScreen) Subscribe(size int) <-chan Event {
+	return s.subs.Subscribe(size)
+}
+
+func (s *cScreen) Unsubscribe(ch <-chan Event) {
+	s.subs.Unsubscribe(ch)
+}
+
 func (s *cScreen) PollEvent() Event {
 	select {
 	case <-s.quit:
@@ -335,7 +485,10 @@ func (s *cScreen) emitVtString(vs string) {
 
 func (s *cScreen) showCursor() {
 	if s.vten {
+		s.emitVtString(fmt.Sprintf(cursorShape, s.cshape.blinking(s.cblink)))
 		s.emitVtString(vtShowCursor)
+	} else if s.cshape == CursorStyleUnderline {
+		s.setCursorInfo(&cursorInfo{size: 15, visible: 1})
 	} else {
 		s.setCursorInfo(&cursorInfo{size: 100, visible: 1})
 	}
@@ -350,20 +503,62 @@ func (s *cScreen) hideCursor() {
 }
 
 func (s *cScreen) ShowCursor(x, y int) {
+	s.ShowCursorStyle(x, y, CursorStyleDefault)
+}
+
+func (s *cScreen) ShowCursorStyle(x, y int, cs CursorStyle) {
+	s.ShowCursors(Cursor{X: x, Y: y, Style: cs})
+}
+
+func (s *cScreen) ShowCursors(cursors ...Cursor) {
+	c := Cursor{X: -1, Y: -1}
+	if len(cursors) > 0 {
+		c = cursors[0]
+	}
 	s.Lock()
 	if !s.fini {
-		s.curx = x
-		s.cury = y
+		s.markCursor()
+		s.curx = c.X
+		s.cury = c.Y
+		s.cshape = c.Style
+		s.extra = secondary(cursors)
+		s.markCursor()
 	}
 	s.doCursor()
 	s.flushOutBuffer()
 	s.Unlock()
 }
 
+// The legacy console cannot make the cursor blink or not.
+func (s *cScreen) SetCursorBlink(blink bool) {
+	s.Lock()
+	s.cblink = blinkFor(blink)
+	s.Unlock()
+}
+
+func (s *cScreen) SetSoftCursor(on bool) {
+	s.Lock()
+	s.markCursor()
+	s.softcur = on
+	s.markCursor()
+	if !s.fini {
+		s.doCursor()
+		s.flushOutBuffer()
+	}
+	s.Unlock()
+}
+
+func (s *cScreen) markCursor() {
+	if s.softcur {
+		s.cells.SetDirty(s.curx, s.cury, true)
+	}
+	s.extra.mark(&s.cells)
+}
+
 func (s *cScreen) doCursor() {
 	x, y := s.curx, s.cury
 
-	if x < 0 || y < 0 || x >= s.w || y >= s.h {
+	if x < 0 || y < 0 || x >= s.w || y >= s.h || s.softcur || s.minsz.Small() {
 		s.hideCursor()
 	} else {
 		s.setCursorPos(x, y)
@@ -375,6 +570,21 @@ func (s *cScreen) HideCursor() {
 	s.ShowCursor(-1, -1)
 }
 
+func (s *cScreen) PushCursorState() {
+	s.Lock()
+	s.curstack.Push(Cursor{X: s.curx, Y: s.cury, Style: s.cshape}, s.extra)
+	s.Unlock()
+}
+
+func (s *cScreen) PopCursorState() {
+	s.Lock()
+	cursors, ok := s.curstack.Pop()
+	s.Unlock()
+	if ok {
+		s.ShowCursors(cursors...)
+	}
+}
+
 type inputRecord struct {
 	typ  uint16
 	_    uint16
@@ -404,11 +614,6 @@ const (
 	mouseMoved       uint32 = 0x1
 )
 
-type resizeRecord struct {
-	x int16
-	y int16
-}
-
 type keyRecord struct {
 	isdown int32
 	repeat uint16
@@ -437,11 +642,12 @@ const (
 	vkUp     = 0x26
 	vkRight  = 0x27
 	vkDown   = 0x28
-	vkPrint  = 0x2a
-	vkPrtScr = 0x2c
+	vkPrint  = 0x2a // VK_PRINT, not on most keyboards
+	vkPrtScr = 0x2c // VK_SNAPSHOT, the PrintScreen key
 	vkInsert = 0x2d
 	vkDelete = 0x2e
 	vkHelp   = 0x2f
+	vkApps   = 0x5d // Menu
 	vkF1     = 0x70
 	vkF2     = 0x71
 	vkF3     = 0x72
@@ -466,6 +672,7 @@ const (
 	vkF22    = 0x85
 	vkF23    = 0x86
 	vkF24    = 0x87
+	vkScroll = 0x91
 )
 
 var vkKeys = map[uint16]Key{
@@ -475,7 +682,7 @@ var vkKeys = map[uint16]Key{
 	vkClear:  KeyClear,
 	vkPause:  KeyPause,
 	vkPrint:  KeyPrint,
-	vkPrtScr: KeyPrint,
+	vkPrtScr: KeyPrtScr,
 	vkPrior:  KeyPgUp,
 	vkNext:   KeyPgDn,
 	vkReturn: KeyEnter,
@@ -488,6 +695,8 @@ var vkKeys = map[uint16]Key{
 	vkInsert: KeyInsert,
 	vkDelete: KeyDelete,
 	vkHelp:   KeyHelp,
+	vkApps:   KeyMenu,
+	vkScroll: KeyScrollLock,
 	vkF1:     KeyF1,
 	vkF2:     KeyF2,
 	vkF3:     KeyF3,
@@ -548,6 +757,73 @@ func mod2mask(cks uint32) ModMask {
 	return mm
 }
 
+// lock2mask converts the state of the lock keys in a dwControlKeyState
+// to the mask that EventKey.Locks returns.
+func lock2mask(cks uint32) ModMask {
+	mm := ModNone
+	if (cks & 0x0080) != 0 {
+		mm |= ModCapsLock
+	}
+	if (cks & 0x0020) != 0 {
+		mm |= ModNumLock
+	}
+	return mm
+}
+
+// Windows reports AltGr, used to compose characters on many keyboard
+// layouts, as the right Alt key together with the left Ctrl key.
+const altGr = 0x0001 | 0x0008
+
+// Windows marks keys that are duplicated on the keypad or in the cursor
+// block as enhanced.  For Enter, that is the one on the keypad.
+const enhancedKey = 0x0100
+
+// krec2key translates a key record for a character, or for a letter or
+// digit key, into our terms, so that the results agree with what a POSIX
+// terminal would deliver.  It returns false for records that should not
+// produce an event, such as a dead key or a modifier alone.
+func krec2key(krec *keyRecord) (Key, rune, ModMask, bool) {
+	mod := mod2mask(krec.mod)
+	ch := rune(krec.ch)
+
+	switch {
+	case ch == 0:
+		// Ctrl or Alt held with a letter or digit, where the
+		// layout has no character for the combination.
+		if mod&(ModCtrl|ModAlt) == 0 {
+			return KeyNUL, 0, ModNone, false
+		}
+		ch = rune(krec.kcode)
+		if ch >= 'A' && ch <= 'Z' {
+			if mod&ModCtrl != 0 {
+				return KeyCtrlA + Key(ch-'A'), 0, mod &^ ModShift, true
+			}
+			if mod&ModShift == 0 {
+				ch += 'a' - 'A'
+			}
+		}
+		return KeyRune, ch, mod &^ ModShift, true
+
+	case krec.kcode == vkReturn && krec.mod&enhancedKey != 0:
+		return KeyKPEnter, 0, mod, true
+
+	case ch == vkTab && mod == ModShift:
+		// convert shift+tab to backtab
+		return KeyBacktab, 0, ModNone, true
+
+	case ch < ' ' || ch == 0x7f:
+		// NewEventKey turns these into their key codes.
+		return KeyRune, ch, mod &^ ModShift, true
+	}
+
+	// A character composed with AltGr carries no modifiers of its own,
+	// and shift is already reflected in the character itself.
+	if krec.mod&altGr == altGr {
+		mod &^= ModCtrl | ModAlt
+	}
+	return KeyRune, ch, mod &^ ModShift, true
+}
+
 func mrec2btns(mbtns, flags uint32) ButtonMask {
 	btns := ButtonNone
 	if mbtns&0x1 != 0 {
@@ -592,6 +868,50 @@ func mrec2btns(mbtns, flags uint32) ButtonMask {
 	return btns
 }
 
+// mouseEvent translates a mouse record into an event like those from a
+// POSIX terminal, or returns nil if a terminal would report nothing.
+// Double clicks are reported as ordinary presses.
+func (s *cScreen) mouseEvent(mrec *mouseRecord) *EventMouse {
+	btns := mrec2btns(mrec.btns, mrec.flags)
+	if mrec.flags&(mouseVWheeled|mouseHWheeled) != 0 {
+		// Terminals report a turn of the wheel alone, whatever
+		// buttons are held.
+		btns &= WheelUp | WheelDown | WheelLeft | WheelRight
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	x, y := int(mrec.x), int(mrec.y)
+	if x > s.w-1 {
+		x = s.w - 1
+	}
+	if y > s.h-1 {
+		y = s.h - 1
+	}
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+
+	if mrec.flags&mouseMoved != 0 {
+		// Terminals only report motion while a button is held,
+		// and the console also reports the mouse as moving when
+		// it has not, as when the window gains the focus.
+		if btns == ButtonNone {
+			return nil
+		}
+		if x == s.mousex && y == s.mousey && btns == s.mousebtn {
+			return nil
+		}
+	}
+	if btns&(WheelUp|WheelDown|WheelLeft|WheelRight) == 0 {
+		s.mousex, s.mousey, s.mousebtn = x, y, btns
+	}
+	return NewEventMouse(x, y, btns, mod2mask(mrec.mod), "")
+}
+
 func (s *cScreen) getConsoleInput() error {
 	// cancelFlag comes first as WaitForMultipleObjects returns the lowest index
 	// in the event that both events are signalled.
@@ -637,17 +957,16 @@ func (s *cScreen) getConsoleInput() error {
 				// its a key release event, ignore it
 				return nil
 			}
-			if krec.ch != 0 {
+			if krec.ch != 0 || krec.kcode >= '0' && krec.kcode <= 'Z' {
 				// synthesized key code
+				key, ch, mod, ok := krec2key(krec)
+				if !ok {
+					return nil
+				}
 				for krec.repeat > 0 {
-					// convert shift+tab to backtab
-					if mod2mask(krec.mod) == ModShift && krec.ch == vkTab {
-						s.PostEventWait(NewEventKey(KeyBacktab, 0,
-							ModNone, ""))
-					} else {
-						s.PostEventWait(NewEventKey(KeyRune, rune(krec.ch),
-							mod2mask(krec.mod), ""))
-					}
+					ev := NewEventKey(key, ch, mod, "")
+					ev.locks = lock2mask(krec.mod)
+					s.PostEventWait(ev)
 					krec.repeat--
 				}
 				return nil
@@ -658,8 +977,9 @@ func (s *cScreen) getConsoleInput() error {
 				return nil
 			}
 			for krec.repeat > 0 {
-				s.PostEventWait(NewEventKey(key, rune(krec.ch),
-					mod2mask(krec.mod), ""))
+				ev := NewEventKey(key, rune(krec.ch), mod2mask(krec.mod), "")
+				ev.locks = lock2mask(krec.mod)
+				s.PostEventWait(ev)
 				krec.repeat--
 			}
 
@@ -670,16 +990,26 @@ func (s *cScreen) getConsoleInput() error {
 			mrec.btns = getu32(rec.data[4:])
 			mrec.mod = getu32(rec.data[8:])
 			mrec.flags = getu32(rec.data[12:])
-			btns := mrec2btns(mrec.btns, mrec.flags)
-			// we ignore double click, events are delivered normally
-			s.PostEventWait(NewEventMouse(int(mrec.x), int(mrec.y), btns,
-				mod2mask(mrec.mod), ""))
+			if ev := s.mouseEvent(&mrec); ev != nil {
+				s.PostEventWait(ev)
+			}
 
 		case resizeEvent:
-			var rrec resizeRecord
-			rrec.x = geti16(rec.data[0:])
-			rrec.y = geti16(rec.data[2:])
-			s.PostEventWait(NewEventResize(int(rrec.x), int(rrec.y)))
+			// This reports the size of the screen buffer, not the
+			// window, and arrives for changes to either.  We check
+			// the window size, and report it if it has changed,
+			// just as we do for SIGWINCH on POSIX systems.
+			s.Lock()
+			if !s.fini {
+				s.cells.Invalidate()
+				s.minsz.Invalidate()
+				s.hideCursor()
+				s.resize()
+				s.draw()
+				s.doCursor()
+				s.flushOutBuffer()
+			}
+			s.Unlock()
 
 		default:
 		}
@@ -707,6 +1037,15 @@ func (s *cScreen) Colors() int {
 	return 16
 }
 
+// The legacy console only has bright colors for bold, and swaps the
+// colors itself for reverse.
+func (s *cScreen) SupportedAttrs() AttrMask {
+	if s.vten {
+		return AttrBold | AttrBlink | AttrReverse | AttrUnderline
+	}
+	return AttrBold | AttrReverse
+}
+
 var vgaColors = map[Color]uint16{
 	ColorBlack:   0,
 	ColorMaroon:  0x4,
@@ -750,10 +1089,10 @@ func (s *cScreen) mapStyle(style Style) uint16 {
 	fa := s.oscreen.attrs & 0xf
 	ba := (s.oscreen.attrs) >> 4 & 0xf
 	if f != ColorDefault && f != ColorReset {
-		fa = mapColor2RGB(f)
+		fa = s.mapColor(f)
 	}
 	if b != ColorDefault && b != ColorReset {
-		ba = mapColor2RGB(b)
+		ba = s.mapColor(b)
 	}
 	var attr uint16
 	// We simulate reverse by doing the color swap ourselves.
@@ -803,6 +1142,43 @@ func (s *cScreen) GetContent(x, y int) (rune, []rune, Style, int) {
 	return mainc, combc, style, width
 }
 
+func (s *cScreen) SetTag(x, y int, tag uint32) {
+	s.Lock()
+	s.cells.SetTag(x, y, tag)
+	s.Unlock()
+}
+
+func (s *cScreen) GetTag(x, y int) uint32 {
+	s.Lock()
+	tag := s.cells.GetTag(x, y)
+	s.Unlock()
+	return tag
+}
+
+func (s *cScreen) SetSelection(rects []Rect, style Style) {
+	s.Lock()
+	s.sel.set(&s.cells, rects, style)
+	s.Unlock()
+}
+
+func (s *cScreen) SelectedText() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.cells.Text(s.sel.rects...)
+}
+
+func (s *cScreen) SetHighlight(rects []Rect, style Style) {
+	s.Lock()
+	s.hl.set(&s.cells, rects, style)
+	s.Unlock()
+}
+
+func (s *cScreen) Find(re *regexp.Regexp) []Rect {
+	s.Lock()
+	defer s.Unlock()
+	return s.cells.Find(re)
+}
+
 func (s *cScreen) sendVtStyle(style Style) {
 	esc := &strings.Builder{}
 
@@ -871,6 +1247,11 @@ func (s *cScreen) draw() {
 		s.clearScreen(s.style)
 		s.clear = false
 		s.cells.Invalidate()
+		s.minsz.Invalidate()
+	}
+	if s.minsz.Small() {
+		s.minsz.Swap(&s.cells)
+		defer s.minsz.Swap(&s.cells)
 	}
 	buf := make([]uint16, 0, s.w)
 	wcs := buf[:]
@@ -886,6 +1267,13 @@ func (s *cScreen) draw() {
 			if style == StyleDefault {
 				style = s.style
 			}
+			style = s.hl.apply(x, y, width, style)
+			style = s.sel.apply(x, y, width, style)
+			if s.softcur && x == s.curx && y == s.cury {
+				style = s.cshape.apply(style)
+			} else {
+				style = s.extra.apply(x, y, style)
+			}
 
 			if !dirty || style != lstyle {
 				// write out any data queued thus far
@@ -922,6 +1310,7 @@ func (s *cScreen) draw() {
 		wcs = buf[0:0]
 		lstyle = styleInvalid
 	}
+	s.diffs.Frame(&s.cells)
 }
 
 func (s *cScreen) Show() {
@@ -929,23 +1318,43 @@ func (s *cScreen) Show() {
 	if !s.fini {
 		s.hideCursor()
 		s.resize()
-		s.draw()
-		s.doCursor()
-		s.flushOutBuffer()
+		if s.relayout() {
+			s.draw()
+			s.doCursor()
+			s.flushOutBuffer()
+		}
 	}
+	notify := s.textw.Check(&s.cells, &s.regions)
 	s.Unlock()
+	if notify != nil {
+		notify()
+	}
 }
 
 func (s *cScreen) Sync() {
 	s.Lock()
 	if !s.fini {
 		s.cells.Invalidate()
+		s.minsz.Invalidate()
 		s.hideCursor()
 		s.resize()
-		s.draw()
-		s.doCursor()
-		s.flushOutBuffer()
+		if s.relayout() {
+			s.draw()
+			s.doCursor()
+			s.flushOutBuffer()
+		}
+	}
+	notify := s.textw.Check(&s.cells, &s.regions)
+	s.Unlock()
+	if notify != nil {
+		notify()
 	}
+}
+
+func (s *cScreen) Invalidate(rect Rect) {
+	s.Lock()
+	s.cells.InvalidateRect(rect)
+	s.minsz.Invalidate()
 	s.Unlock()
 }
 
@@ -957,6 +1366,69 @@ type consoleInfo struct {
 	maxsz coord
 }
 
+// This is only present on Vista and later, so must be checked for.
+var procGetConsoleScreenBufferInfoEx = k32.NewProc("GetConsoleScreenBufferInfoEx")
+
+// consoleInfoEx is CONSOLE_SCREEN_BUFFER_INFOEX, which adds the color
+// table, in the form 0x00BBGGRR, to the basic information.
+type consoleInfoEx struct {
+	cbsize  uint32
+	size    coord
+	pos     coord
+	attrs   uint16
+	win     rect
+	maxsz   coord
+	popup   uint16
+	fullscr int32
+	colors  [16]uint32
+}
+
+// loadPalette obtains the colors actually used for each of the sixteen
+// console attributes.  These vary with the version of Windows and with
+// the user's settings, and can be quite unlike the VGA colors.  If they
+// cannot be obtained, the VGA colors are assumed.
+func (s *cScreen) loadPalette() {
+	info := consoleInfoEx{}
+	info.cbsize = uint32(unsafe.Sizeof(info))
+	s.palette = nil
+	s.colors = make(map[Color]uint16)
+	if e := procGetConsoleScreenBufferInfoEx.Find(); e != nil {
+		return
+	}
+	rv, _, _ := procGetConsoleScreenBufferInfoEx.Call(
+		uintptr(s.out),
+		uintptr(unsafe.Pointer(&info)))
+	if rv == 0 {
+		return
+	}
+	s.palette = make([]Color, len(info.colors))
+	for i, v := range info.colors {
+		s.palette[i] = NewRGBColor(int32(v&0xff), int32(v>>8&0xff), int32(v>>16&0xff))
+	}
+}
+
+// mapColor returns the attribute for the color.  The sixteen basic
+// colors map directly to their attributes.  Others, including 24-bit
+// colors, map to the attribute whose actual color is closest.
+func (s *cScreen) mapColor(c Color) uint16 {
+	if _, ok := vgaColors[c]; ok || s.palette == nil {
+		return mapColor2RGB(c)
+	}
+	if v, ok := s.colors[c]; ok {
+		return v
+	}
+	var attr uint16
+	best := FindColor(c, s.palette)
+	for i, p := range s.palette {
+		if p == best {
+			attr = uint16(i)
+			break
+		}
+	}
+	s.colors[c] = attr
+	return attr
+}
+
 func (s *cScreen) getConsoleInfo(info *consoleInfo) {
 	procGetConsoleScreenBufferInfo.Call(
 		uintptr(s.out),
@@ -1024,6 +1496,36 @@ func (s *cScreen) resize() {
 		uintptr(1),
 		uintptr(unsafe.Pointer(&r)))
 	s.PostEvent(NewEventResize(w, h))
+	s.checkMinSize()
+}
+
+// relayout calls the OnResize callback if the size has changed since it
+// was last called, as for tScreen.relayout.  The caller holds the lock.
+func (s *cScreen) relayout() bool {
+	for s.onresize != nil && !s.fini {
+		w, h := s.w, s.h
+		if w == s.laidw && h == s.laidh {
+			break
+		}
+		fn := s.onresize
+		s.laidw, s.laidh = w, h
+		s.Unlock()
+		fn(w, h)
+		s.Lock()
+		if s.fini {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMinSize posts an EventTooSmall if the screen has crossed its
+// minimum size.
+func (s *cScreen) checkMinSize() {
+	if ev := s.minsz.Check(s.w, s.h); ev != nil {
+		s.clear = true
+		s.PostEvent(ev)
+	}
 }
 
 func (s *cScreen) Clear() {
@@ -1038,6 +1540,22 @@ func (s *cScreen) Fill(r rune, style Style) {
 	s.Unlock()
 }
 
+func (s *cScreen) ClearRect(x, y, w, h int, style Style) {
+	s.Lock()
+	if !s.fini {
+		s.cells.FillRect(Rect{X: x, Y: y, Width: w, Height: h}, ' ', style)
+	}
+	s.Unlock()
+}
+
+func (s *cScreen) ClearLine(y int) {
+	s.Lock()
+	if !s.fini {
+		s.cells.FillRect(Rect{X: 0, Y: y, Width: s.w, Height: 1}, ' ', s.style)
+	}
+	s.Unlock()
+}
+
 func (s *cScreen) clearScreen(style Style) {
 	if s.vten {
 		s.sendVtStyle(style)
@@ -1142,8 +1660,78 @@ func (s *cScreen) HasMouse() bool {
 	return true
 }
 
+func (s *cScreen) Has(c Capability) bool {
+	switch c {
+	case CapMouse, CapRequestResize:
+		return true
+	case CapTrueColor:
+		return s.Colors() >= 1<<24
+	}
+	return false
+}
+
 func (s *cScreen) Resize(int, int, int, int) {}
 
+func (s *cScreen) OnResize(fn func(w, h int)) {
+	s.Lock()
+	s.onresize = fn
+	s.laidw, s.laidh = s.w, s.h
+	s.Unlock()
+}
+
+func (s *cScreen) Linearize() []TextBlock {
+	s.Lock()
+	defer s.Unlock()
+	return linearize(&s.cells, &s.regions)
+}
+
+func (s *cScreen) OnTextChange(fn func([]TextBlock)) {
+	s.Lock()
+	s.textw.Set(fn)
+	s.Unlock()
+}
+
+func (s *cScreen) SetMinSize(w, h int) {
+	s.Lock()
+	s.minsz.Set(w, h)
+	s.checkMinSize()
+	s.Unlock()
+}
+
+func (s *cScreen) RequestResize(w, h int) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fini {
+		return ErrNoScreen
+	}
+	if w <= 0 || h <= 0 {
+		return ErrNotSupported
+	}
+
+	// The window must always fit within the buffer, so the buffer is
+	// grown before the window changes, and shrunk after.
+	bw, bh := w, h
+	if s.w > bw {
+		bw = s.w
+	}
+	if s.h > bh {
+		bh = s.h
+	}
+	s.setBufferSize(bw, bh)
+	r := rect{0, 0, int16(w - 1), int16(h - 1)}
+	if rv, _, _ := procSetConsoleWindowInfo.Call(
+		uintptr(s.out),
+		uintptr(1),
+		uintptr(unsafe.Pointer(&r))); rv == 0 {
+		// Probably larger than the display allows.
+		s.setBufferSize(s.w, s.h)
+		return ErrNotSupported
+	}
+	s.setBufferSize(w, h)
+	s.resize()
+	return nil
+}
+
 func (s *cScreen) HasKey(k Key) bool {
 	// Microsoft has codes for some keys, but they are unusual,
 	// so we don't include them.  We include all the typical
@@ -1178,22 +1766,102 @@ func (s *cScreen) HasKey(k Key) bool {
 		KeyF11:       true,
 		KeyF12:       true,
 		KeyRune:      true,
+
+		KeyKPEnter:    true,
+		KeyScrollLock: true,
+		KeyMenu:       true,
 	}
 
 	return valid[k]
 }
 
-func (s *cScreen) RegisterRawSeq(string) {}
-func (s *cScreen) SetPaste(bool)         {}
-
-func (s *cScreen) GetClipboard(string) error {
+func (s *cScreen) AddInput(io.Reader) (int, error) {
+	// The console delivers input records, not bytes, so there
+	// is no parser to feed additional streams into.
+	return 0, ErrNotSupported
+}
+
+func (s *cScreen) RegisterRawSeq(string)        {}
+func (s *cScreen) SetInputLimits(int, int)      {}
+func (s *cScreen) SetRestricted(bool)           {}
+func (s *cScreen) SetResizeDelay(time.Duration) {}
+func (s *cScreen) SetSizePoll(time.Duration)    {}
+func (s *cScreen) SetFixedSize(int, int)        {}
+func (s *cScreen) SetIdleTimeout(time.Duration) {}
+func (s *cScreen) SetSoftBlink(time.Duration)   {}
+func (s *cScreen) SetBoldAsBright(bool)         {}
+func (s *cScreen) SetManualPump(bool)           {}
+func (s *cScreen) ProcessInput([]byte)          {}
+func (s *cScreen) Tick()                        {}
+func (s *cScreen) SetInline(int)                {}
+func (s *cScreen) SetPaste(bool)                {}
+func (s *cScreen) SetRawPaste(bool)             {}
+func (s *cScreen) SetCombining(bool)            {}
+func (s *cScreen) SetOutputBudget(int, Degrade) {}
+func (s *cScreen) SetGlyphPolicy(GlyphPolicy)   {}
+func (s *cScreen) SetPadding(Padding, int)      {}
+func (s *cScreen) SetFlushSize(int)             {}
+func (s *cScreen) SetUTF8Policy(UTF8Policy)     {}
+func (s *cScreen) SetCaptureEscSeq(bool)        {}
+func (s *cScreen) SetNormalizeBackspace(bool)   {}
+func (s *cScreen) SetEscapeAlt(bool)            {}
+func (s *cScreen) SetMouseSupport(bool)         {}
+func (s *cScreen) SetSystemColors(bool)         {}
+func (s *cScreen) SetRGBSeparator(RGBSeparator) {}
+
+func (s *cScreen) SetMetrics(func(Metric, time.Duration)) {}
+
+func (s *cScreen) SetAnimation(Style, AnimatedStyle) {}
+
+func (s *cScreen) SetPaletteColor(int, Color) error { return ErrNotSupported }
+func (s *cScreen) ResetPalette()                    {}
+
+func (s *cScreen) BindSequence(string, Key, ModMask) {}
+func (s *cScreen) UnbindSequence(string)             {}
+func (s *cScreen) KeySequences() []KeySequence       { return nil }
+func (s *cScreen) KeyConflicts() []KeyConflict       { return nil }
+func (s *cScreen) Pasting() bool                     { return false }
+
+func (s *cScreen) Println(string) error {
+	return ErrNotSupported
+}
+
+func (s *cScreen) GetClipboard(ClipboardRegister) error {
 	return errors.New("Not supported on Windows")
 }
 
-func (s *cScreen) SetClipboard(string, string) error {
+func (s *cScreen) SetClipboard(string, ClipboardRegister) error {
 	return errors.New("Not supported on Windows")
 }
 
+func (s *cScreen) HasClipboard(ClipboardRegister) bool {
+	return false
+}
+
+func (s *cScreen) SetClipboardHistory(entries, size int) {
+	s.cliphist.SetLimits(entries, size)
+}
+
+func (s *cScreen) ClipboardHistory() []string {
+	return s.cliphist.Texts()
+}
+
+func (s *cScreen) QueryCursorPosition(time.Duration) (int, int, error) {
+	return 0, 0, ErrNotSupported
+}
+
+func (s *cScreen) QueryDefaultColors(time.Duration) (Color, Color, error) {
+	return ColorDefault, ColorDefault, ErrNotSupported
+}
+
+func (s *cScreen) QueryPaletteColor(int, time.Duration) (Color, error) {
+	return ColorDefault, ErrNotSupported
+}
+
+func (s *cScreen) QueryTermcap(string, time.Duration) (string, bool, error) {
+	return "", false, ErrNotSupported
+}
+
 func (s *cScreen) Beep() error {
 	// A simple beep. If the sound card is not available, the sound is generated
 	// using the speaker.
@@ -0,0 +1,90 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"context"
+	"sync"
+)
+
+// contextScreen finalizes a screen when its context is cancelled.
+type contextScreen struct {
+	Screen
+	ctx  context.Context
+	stop chan struct{}
+	lk   sync.Mutex
+}
+
+// NewScreenWithContext is like NewScreen, but the screen is tied to
+// the context.  Cancelling the context finalizes the screen, which
+// restores the terminal and stops the screen's goroutines; PollEvent
+// then returns nil, ending the application's event loop.  Init fails
+// with the context's error if it is already done.
+func NewScreenWithContext(ctx context.Context) (Screen, error) {
+	s, e := NewScreen()
+	if e != nil {
+		return nil, e
+	}
+	return WithContext(ctx, s), nil
+}
+
+// NewTerminfoScreenWithContext is like NewTerminfoScreen, but the screen
+// is tied to the context, as described for NewScreenWithContext.
+func NewTerminfoScreenWithContext(ctx context.Context) (Screen, error) {
+	s, e := NewTerminfoScreen()
+	if e != nil {
+		return nil, e
+	}
+	return WithContext(ctx, s), nil
+}
+
+// WithContext ties an uninitialized screen to the context, as described
+// for NewScreenWithContext.  The returned screen must be used in place
+// of the original.
+func WithContext(ctx context.Context, s Screen) Screen {
+	return &contextScreen{Screen: s, ctx: ctx}
+}
+
+func (s *contextScreen) Init() error {
+	if e := s.ctx.Err(); e != nil {
+		return e
+	}
+	if e := s.Screen.Init(); e != nil {
+		return e
+	}
+	s.lk.Lock()
+	s.stop = make(chan struct{})
+	go s.watch(s.stop)
+	s.lk.Unlock()
+	return nil
+}
+
+func (s *contextScreen) Fini() {
+	s.lk.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.lk.Unlock()
+	s.Screen.Fini()
+}
+
+func (s *contextScreen) watch(stop chan struct{}) {
+	select {
+	case <-s.ctx.Done():
+		s.Fini()
+	case <-stop:
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := WithContext(ctx, NewSimulationScreen(""))
+	if e := s.Init(); e != nil {
+		t.Fatalf("Failed to init: %v", e)
+	}
+
+	done := make(chan Event)
+	go func() {
+		done <- s.PollEvent()
+	}()
+	cancel()
+	select {
+	case ev := <-done:
+		if ev != nil {
+			t.Errorf("Expected nil event, got %v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Screen not finalized")
+	}
+
+	if e := s.Init(); e != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", e)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+)
+
+// ControlServer lets another process drive a Screen, in the manner of
+// "tmux send-keys".  This is intended for end-to-end testing and scripting
+// of applications.  Clients connect and send JSON commands, one per line,
+// and receive one JSON reply line for each.  The following commands are
+// understood:
+//
+//	{"cmd":"key","key":"Enter"}            inject a named key (see KeyNames)
+//	{"cmd":"key","rune":"x","mod":4}       inject a rune, with modifiers
+//	{"cmd":"mouse","x":1,"y":2,"buttons":1} inject a mouse event
+//	{"cmd":"paste","text":"hello"}         inject a paste
+//	{"cmd":"snapshot"}                     return the screen contents
+//	{"cmd":"show"}                         call Show on the screen
+//	{"cmd":"sync"}                         call Sync on the screen
+//
+// Replies have "ok" set to true on success, or an "error" string.  The
+// reply to snapshot also carries the "width", "height", and the text of
+// each row in "lines".
+//
+// Note that anyone able to connect can control the application, so the
+// listener should only be reachable by trusted users.
+type ControlServer struct {
+	s     Screen
+	l     net.Listener
+	conns map[net.Conn]struct{}
+	lk    sync.Mutex
+}
+
+type controlRequest struct {
+	Cmd     string     `json:"cmd"`
+	Key     string     `json:"key,omitempty"`
+	Rune    string     `json:"rune,omitempty"`
+	Mod     ModMask    `json:"mod,omitempty"`
+	X       int        `json:"x,omitempty"`
+	Y       int        `json:"y,omitempty"`
+	Buttons ButtonMask `json:"buttons,omitempty"`
+	Text    string     `json:"text,omitempty"`
+}
+
+type controlReply struct {
+	OK     bool     `json:"ok"`
+	Error  string   `json:"error,omitempty"`
+	Width  int      `json:"width,omitempty"`
+	Height int      `json:"height,omitempty"`
+	Lines  []string `json:"lines,omitempty"`
+}
+
+// NewControlServer returns a ControlServer for the screen, which will
+// accept clients on the given listener once Serve is called.  Any kind
+// of listener may be used, such as a Unix domain socket, or a named pipe
+// on Windows.
+func NewControlServer(s Screen, l net.Listener) *ControlServer {
+	return &ControlServer{s: s, l: l, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenControl is a convenience that creates a ControlServer listening
+// on a Unix domain socket at the given path.
+func ListenControl(s Screen, path string) (*ControlServer, error) {
+	l, e := net.Listen("unix", path)
+	if e != nil {
+		return nil, e
+	}
+	return NewControlServer(s, l), nil
+}
+
+// Serve accepts and services clients until the server is closed.  Each
+// client is handled in its own goroutine.
+func (cs *ControlServer) Serve() error {
+	for {
+		c, e := cs.l.Accept()
+		if e != nil {
+			return e
+		}
+		cs.lk.Lock()
+		cs.conns[c] = struct{}{}
+		cs.lk.Unlock()
+		go cs.serveConn(c)
+	}
+}
+
+// Close stops the server, disconnecting any clients.
+func (cs *ControlServer) Close() error {
+	e := cs.l.Close()
+	cs.lk.Lock()
+	for c := range cs.conns {
+		c.Close()
+	}
+	cs.lk.Unlock()
+	return e
+}
+
+func (cs *ControlServer) serveConn(c net.Conn) {
+	defer func() {
+		cs.lk.Lock()
+		delete(cs.conns, c)
+		cs.lk.Unlock()
+		c.Close()
+	}()
+
+	scanner := bufio.NewScanner(c)
+	enc := json.NewEncoder(c)
+	for scanner.Scan() {
+		var req controlRequest
+		var rep controlReply
+		if e := json.Unmarshal(scanner.Bytes(), &req); e != nil {
+			rep.Error = e.Error()
+		} else if e := cs.handle(&req, &rep); e != nil {
+			rep.Error = e.Error()
+		} else {
+			rep.OK = true
+		}
+		if enc.Encode(&rep) != nil {
+			return
+		}
+	}
+}
+
+func (cs *ControlServer) handle(req *controlRequest, rep *controlReply) error {
+	s := cs.s
+	switch req.Cmd {
+	case "key":
+		if req.Key != "" {
+			for k, name := range KeyNames {
+				if name == req.Key {
+					return s.PostEvent(NewEventKey(k, 0, req.Mod, ""))
+				}
+			}
+			return errors.New("unknown key " + req.Key)
+		}
+		for _, r := range req.Rune {
+			return s.PostEvent(NewEventKey(KeyRune, r, req.Mod, ""))
+		}
+		return errors.New("no key or rune given")
+	case "mouse":
+		return s.PostEvent(NewEventMouse(req.X, req.Y, req.Buttons, req.Mod, ""))
+	case "paste":
+		return s.PostEvent(NewEventPaste(req.Text, ""))
+	case "snapshot":
+		rep.Width, rep.Height = s.Size()
+		for y := 0; y < rep.Height; y++ {
+			line := &strings.Builder{}
+			for x := 0; x < rep.Width; {
+				mainc, combc, _, width := s.GetContent(x, y)
+				line.WriteRune(mainc)
+				for _, r := range combc {
+					line.WriteRune(r)
+				}
+				x += width
+			}
+			rep.Lines = append(rep.Lines, line.String())
+		}
+		return nil
+	case "show":
+		s.Show()
+		return nil
+	case "sync":
+		s.Sync()
+		return nil
+	}
+	return errors.New("unknown command " + req.Cmd)
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestControlServer(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+	s.SetSize(4, 2)
+	s.Show()
+	s.SetContent(0, 0, 'h', nil, StyleDefault)
+	s.SetContent(1, 0, 'i', nil, StyleDefault)
+
+	cs := NewControlServer(s, nil)
+	client, server := net.Pipe()
+	defer client.Close()
+	go cs.serveConn(server)
+
+	rd := bufio.NewReader(client)
+	call := func(req string) controlReply {
+		var rep controlReply
+		if _, e := client.Write([]byte(req + "\n")); e != nil {
+			t.Fatalf("Write failed: %v", e)
+		}
+		line, e := rd.ReadBytes('\n')
+		if e != nil {
+			t.Fatalf("Read failed: %v", e)
+		}
+		if e = json.Unmarshal(line, &rep); e != nil {
+			t.Fatalf("Bad reply %q: %v", line, e)
+		}
+		return rep
+	}
+
+	if rep := call(`{"cmd":"key","key":"Enter"}`); !rep.OK {
+		t.Errorf("Key command failed: %s", rep.Error)
+	}
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Key() != KeyEnter {
+		t.Errorf("Expected Enter key event")
+	}
+	if rep := call(`{"cmd":"key","rune":"q","mod":2}`); !rep.OK {
+		t.Errorf("Rune command failed: %s", rep.Error)
+	}
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Rune() != 'q' || ev.Modifiers() != ModCtrl {
+		t.Errorf("Expected Ctrl+q key event")
+	}
+	if rep := call(`{"cmd":"bogus"}`); rep.OK || rep.Error == "" {
+		t.Errorf("Bogus command should fail")
+	}
+	rep := call(`{"cmd":"snapshot"}`)
+	if !rep.OK || rep.Width != 4 || rep.Height != 2 || len(rep.Lines) != 2 {
+		t.Fatalf("Bad snapshot: %+v", rep)
+	}
+	if rep.Lines[0] != "hi  " {
+		t.Errorf("Bad snapshot line %q", rep.Lines[0])
+	}
+}
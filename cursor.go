@@ -0,0 +1,144 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// CursorStyle is the shape of the cursor.
+type CursorStyle int
+
+const (
+	// CursorStyleDefault is whatever the terminal normally shows.
+	CursorStyleDefault CursorStyle = iota
+	CursorStyleBlock
+	CursorStyleUnderline
+	CursorStyleBar
+)
+
+// cursorShape is the DECSCUSR sequence to select a cursor style.
+const cursorShape = "\x1b[%d q"
+
+// decscusr returns the parameter of DECSCUSR for the style.
+func (cs CursorStyle) decscusr() int {
+	switch cs {
+	case CursorStyleBlock:
+		return 2
+	case CursorStyleUnderline:
+		return 4
+	case CursorStyleBar:
+		return 6
+	}
+	return 0
+}
+
+// cursorBlink is whether the cursor blinks, as set by SetCursorBlink.
+type cursorBlink int
+
+const (
+	blinkDefault cursorBlink = iota
+	blinkOn
+	blinkOff
+)
+
+// blinkFor returns the cursorBlink for SetCursorBlink.
+func blinkFor(on bool) cursorBlink {
+	if on {
+		return blinkOn
+	}
+	return blinkOff
+}
+
+// blinking returns the parameter of DECSCUSR for the style, blinking or
+// steady as asked.  The default style is then a block, as DECSCUSR has
+// no way to ask for the default shape with a particular blink.
+func (cs CursorStyle) blinking(b cursorBlink) int {
+	p := cs.decscusr()
+	if b == blinkDefault {
+		return p
+	}
+	if p == 0 {
+		p = 2
+	}
+	if b == blinkOn {
+		p--
+	}
+	return p
+}
+
+// apply returns the style to draw a software cursor over a cell of the
+// given style.  An underline cursor underlines the cell, and the others
+// reverse it, as a bar cannot be drawn within a cell.
+func (cs CursorStyle) apply(style Style) Style {
+	if cs == CursorStyleUnderline {
+		return style.Underline(style.attrs&AttrUnderline == 0)
+	}
+	return style.Reverse(style.attrs&AttrReverse == 0)
+}
+
+// Cursor is the location and shape of a cursor, for ShowCursors.
+type Cursor struct {
+	X     int
+	Y     int
+	Style CursorStyle
+}
+
+// cursorSet is a set of cursors drawn in software.  This is used by
+// Screen implementors for the secondary cursors of ShowCursors.
+type cursorSet []Cursor
+
+// mark marks the cells under the cursors dirty.
+func (cs cursorSet) mark(cb *CellBuffer) {
+	for _, c := range cs {
+		cb.SetDirty(c.X, c.Y, true)
+	}
+}
+
+// apply returns the style to draw the cell at x, y with, which is that
+// of a cursor if there is one there.
+func (cs cursorSet) apply(x, y int, style Style) Style {
+	for _, c := range cs {
+		if c.X == x && c.Y == y {
+			return c.Style.apply(style)
+		}
+	}
+	return style
+}
+
+// cursorStack holds the cursors saved by PushCursorState, for Screen
+// implementors.  The zero value is empty.
+type cursorStack [][]Cursor
+
+// Push saves the primary cursor and the secondary cursors.
+func (cs *cursorStack) Push(c Cursor, extra cursorSet) {
+	*cs = append(*cs, append([]Cursor{c}, extra...))
+}
+
+// Pop returns the cursors saved last, or false if none are.
+func (cs *cursorStack) Pop() ([]Cursor, bool) {
+	n := len(*cs)
+	if n == 0 {
+		return nil, false
+	}
+	c := (*cs)[n-1]
+	*cs = (*cs)[:n-1]
+	return c, true
+}
+
+// secondary returns the cursors after the first, which are the ones that
+// are always drawn in software.
+func secondary(cursors []Cursor) cursorSet {
+	if len(cursors) < 2 {
+		return nil
+	}
+	return append(cursorSet(nil), cursors[1:]...)
+}
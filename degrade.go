@@ -0,0 +1,50 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// Degrade is a set of ways in which a frame may be drawn more simply, to
+// reduce the amount of output, when it would exceed the budget given to
+// SetOutputBudget.  The values may be combined.
+type Degrade int
+
+const (
+	// DegradeTruecolor draws 24-bit colors using the nearest color of
+	// the terminal's palette instead.
+	DegradeTruecolor Degrade = 1 << iota
+
+	// DegradeAttrs drops all the attributes other than reverse video,
+	// which is kept because selections and cursors often depend on it.
+	DegradeAttrs
+
+	// DegradeAll uses every available means.
+	DegradeAll = DegradeTruecolor | DegradeAttrs
+)
+
+// apply returns the simplified style, using fit to find the nearest
+// color of the palette, if there is one.
+func (d Degrade) apply(style Style, fit func(Color) Color) Style {
+	if d&DegradeTruecolor != 0 && fit != nil {
+		if style.fg.IsRGB() {
+			style.fg = fit(style.fg)
+		}
+		if style.bg.IsRGB() {
+			style.bg = fit(style.bg)
+		}
+	}
+	if d&DegradeAttrs != 0 {
+		style.attrs &= AttrReverse
+	}
+	return style
+}
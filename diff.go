@@ -0,0 +1,238 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// The diff stream is a compact binary encoding of the cells that change
+// from one frame to the next, independent of any terminal.  It is meant
+// for displaying a screen somewhere else, such as in a web page or in
+// another process, and for snapshot tests.
+//
+// Every number is an unsigned varint, as written by encoding/binary.
+// Each frame is the byte 'F', followed by the width and height of the
+// screen, the number of runs of changed cells, and then the runs.  Each
+// run is the column and row of its first cell and the number of cells
+// in it, followed by the cells.  Each cell is its rune shifted left one
+// bit, with the low bit set if the style differs from that of the
+// previous cell in the frame (which starts out as StyleDefault); then
+// the new foreground color, background color and attributes, if the
+// style changed; and then the number of combining runes, and the runes.
+//
+// A frame whose size differs from the previous one resizes the buffer,
+// as CellBuffer.Resize would, before the runs are applied.
+
+// diffFrame marks the start of a frame in the diff stream.
+const diffFrame = 'F'
+
+// diffCellsMax is the most cells a frame may have.  It keeps a corrupt
+// or hostile stream from making DecodeDiff allocate a huge buffer.
+const diffCellsMax = 1 << 20
+
+// DiffEncoder writes the diff stream for a CellBuffer.  It remembers
+// what it last encoded, so that each frame only carries what changed.
+// The zero value is ready to use, and its first frame contains every
+// cell.
+type DiffEncoder struct {
+	shadow CellBuffer
+	buf    []byte
+}
+
+// Reset forgets what was last encoded, so that the next frame contains
+// every cell.
+func (e *DiffEncoder) Reset() {
+	e.shadow.Resize(0, 0)
+}
+
+// Encode writes a frame with the cells of cb that have changed since
+// the last frame.
+func (e *DiffEncoder) Encode(w io.Writer, cb *CellBuffer) error {
+	e.shadow.Resize(cb.w, cb.h)
+
+	type run struct{ x, y, n int }
+	var runs []run
+	for y := 0; y < cb.h; y++ {
+		r, s := &cb.rows[y], &e.shadow.rows[y]
+		for x := 0; x < cb.w; x++ {
+			if s.currMain[x] == r.currMain[x] && s.currStyle[x] == r.currStyle[x] &&
+				runesEqual(s.currComb[x], r.currComb[x]) {
+				continue
+			}
+			if n := len(runs); n > 0 && runs[n-1].y == y && runs[n-1].x+runs[n-1].n == x {
+				runs[n-1].n++
+			} else {
+				runs = append(runs, run{x, y, 1})
+			}
+		}
+	}
+
+	b := append(e.buf[:0], diffFrame)
+	b = appendInts(b, cb.w, cb.h, len(runs))
+	style := StyleDefault
+	for _, rn := range runs {
+		b = appendInts(b, rn.x, rn.y, rn.n)
+		r, s := &cb.rows[rn.y], &e.shadow.rows[rn.y]
+		for x := rn.x; x < rn.x+rn.n; x++ {
+			mainc, st := r.currMain[x], r.currStyle[x]
+			if st != style {
+				b = appendUvarint(b, uint64(mainc)<<1|1)
+				b = appendUvarint(b, uint64(st.fg))
+				b = appendUvarint(b, uint64(st.bg))
+				b = appendUvarint(b, uint64(st.attrs))
+				style = st
+			} else {
+				b = appendUvarint(b, uint64(mainc)<<1)
+			}
+			b = appendUvarint(b, uint64(len(r.currComb[x])))
+			for _, c := range r.currComb[x] {
+				b = appendUvarint(b, uint64(c))
+			}
+
+			s.currMain[x] = mainc
+			s.currStyle[x] = st
+			s.currComb[x] = append(s.currComb[x][:0], r.currComb[x]...)
+		}
+	}
+	e.buf = b
+	_, err := w.Write(b)
+	return err
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+func appendInts(b []byte, vals ...int) []byte {
+	for _, v := range vals {
+		b = appendUvarint(b, uint64(v))
+	}
+	return b
+}
+
+// DecodeDiff reads one frame of the diff stream, and applies it to the
+// CellBuffer.  The cells changed are marked dirty in the usual way.  It
+// returns io.EOF if the stream ends cleanly before the frame starts, and
+// ErrBadDiff if the frame is malformed.
+func DecodeDiff(r io.ByteReader, cb *CellBuffer) error {
+	c, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if c != diffFrame {
+		return ErrBadDiff
+	}
+	var hdr [3]uint64
+	for i := range hdr {
+		if hdr[i], err = binary.ReadUvarint(r); err != nil {
+			return ErrBadDiff
+		}
+	}
+	w, h := int(hdr[0]), int(hdr[1])
+	if hdr[0] > 1<<16 || hdr[1] > 1<<16 || hdr[0]*hdr[1] > diffCellsMax {
+		return ErrBadDiff
+	}
+	cb.Resize(w, h)
+
+	style := StyleDefault
+	var comb []rune
+	for i := uint64(0); i < hdr[2]; i++ {
+		var rn [3]uint64
+		for j := range rn {
+			if rn[j], err = binary.ReadUvarint(r); err != nil {
+				return ErrBadDiff
+			}
+		}
+		x, y, n := int(rn[0]), int(rn[1]), int(rn[2])
+		if rn[0] > uint64(w) || rn[1] >= uint64(h) || rn[2] > uint64(w)-rn[0] {
+			return ErrBadDiff
+		}
+		for j := 0; j < n; j++ {
+			v, err := binary.ReadUvarint(r)
+			if err != nil {
+				return ErrBadDiff
+			}
+			if v&1 != 0 {
+				var st [3]uint64
+				for k := range st {
+					if st[k], err = binary.ReadUvarint(r); err != nil {
+						return ErrBadDiff
+					}
+				}
+				style = Style{fg: Color(st[0]), bg: Color(st[1]), attrs: AttrMask(st[2])}
+			}
+			nc, err := binary.ReadUvarint(r)
+			if err != nil || nc > 64 {
+				return ErrBadDiff
+			}
+			comb = comb[:0]
+			for k := uint64(0); k < nc; k++ {
+				c, err := binary.ReadUvarint(r)
+				if err != nil {
+					return ErrBadDiff
+				}
+				comb = append(comb, rune(c))
+			}
+			cb.SetContent(x+j, y, rune(v>>1), comb, style)
+		}
+	}
+	return nil
+}
+
+// diffMirrors sends the diff stream of a screen to the writers added
+// with MirrorDiffs.  Like mirrors, each writer is serviced by its own
+// goroutine, and is dropped if it fails or falls behind.  The zero
+// value is ready to use.  The owning screen serializes the calls.
+type diffMirrors struct {
+	enc   DiffEncoder
+	sinks mirrors
+}
+
+// Add starts sending frames to the writer.  The first frame contains
+// every cell, as of the last frame sent to the others.
+func (d *diffMirrors) Add(w io.Writer, cb *CellBuffer) {
+	if d.sinks.Len() == 0 {
+		d.enc.Reset()
+		d.enc.Encode(ioutil.Discard, cb)
+	}
+	var full DiffEncoder
+	var buf bytes.Buffer
+	full.Encode(&buf, &d.enc.shadow)
+	d.sinks.Add(w, buf.Bytes())
+}
+
+func (d *diffMirrors) Remove(w io.Writer) {
+	d.sinks.Remove(w)
+}
+
+// Frame sends what has changed in the buffer since the last frame.
+func (d *diffMirrors) Frame(cb *CellBuffer) {
+	if d.sinks.Len() == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	d.enc.Encode(&buf, cb)
+	d.sinks.Write(buf.Bytes())
+}
+
+func (d *diffMirrors) Close() {
+	d.sinks.Close()
+}
@@ -101,7 +101,9 @@ const (
 
 // SetEncodingFallback changes the behavior of GetEncoding when a suitable
 // encoding is not found.  The default is EncodingFallbackFail, which
-// causes GetEncoding to simply return nil.
+// causes GetEncoding to simply return nil.  This is also the fallback of
+// screens that have not been given one of their own with their
+// SetEncodingFallback method.
 func SetEncodingFallback(fb EncodingFallback) {
 	encodingLk.Lock()
 	encodingFallback = fb
@@ -112,14 +114,30 @@ func SetEncodingFallback(fb EncodingFallback) {
 // for the given character set name.  Note that this will return nil for
 // either the Unicode (UTF-8) or ASCII encodings, since we don't use
 // encodings for them but instead have our own native methods.
+//
+// RegisterEncoding, SetEncodingFallback and GetEncoding may be called
+// from any goroutine.
 func GetEncoding(charset string) encoding.Encoding {
-	charset = strings.ToLower(charset)
 	encodingLk.Lock()
-	defer encodingLk.Unlock()
-	if enc, ok := encodings[charset]; ok {
+	fb := encodingFallback
+	encodingLk.Unlock()
+	return lookupEncoding(strings.ToLower(charset), nil, fb)
+}
+
+// lookupEncoding finds the encoding for the lower case character set,
+// among the screen's own encodings and then the registered ones, or
+// returns the fallback.
+func lookupEncoding(charset string, own map[string]encoding.Encoding, fb EncodingFallback) encoding.Encoding {
+	if enc, ok := own[charset]; ok {
+		return enc
+	}
+	encodingLk.Lock()
+	enc, ok := encodings[charset]
+	encodingLk.Unlock()
+	if ok {
 		return enc
 	}
-	switch encodingFallback {
+	switch fb {
 	case EncodingFallbackASCII:
 		return gencoding.ASCII
 	case EncodingFallbackUTF8:
@@ -128,6 +146,44 @@ func GetEncoding(charset string) encoding.Encoding {
 	return nil
 }
 
+// screenEncodings holds the encodings registered with a screen, and its
+// fallback, so that screens with different needs do not interfere with
+// each other through the package's registry.  Encodings registered with
+// the screen take precedence over those registered with the package.
+// The zero value has none, and uses the package's fallback.  The owning
+// screen serializes calls to the methods.
+type screenEncodings struct {
+	encs  map[string]encoding.Encoding
+	fb    EncodingFallback
+	fbset bool
+}
+
+// Register adds an encoding for the character set, as RegisterEncoding
+// does, for this screen only.
+func (se *screenEncodings) Register(charset string, enc encoding.Encoding) {
+	if se.encs == nil {
+		se.encs = make(map[string]encoding.Encoding)
+	}
+	se.encs[strings.ToLower(charset)] = enc
+}
+
+// SetFallback sets the fallback, in place of the package's.
+func (se *screenEncodings) SetFallback(fb EncodingFallback) {
+	se.fb = fb
+	se.fbset = true
+}
+
+// Get is like GetEncoding, but uses the screen's encodings and fallback.
+func (se *screenEncodings) Get(charset string) encoding.Encoding {
+	fb := se.fb
+	if !se.fbset {
+		encodingLk.Lock()
+		fb = encodingFallback
+		encodingLk.Unlock()
+	}
+	return lookupEncoding(strings.ToLower(charset), se.encs, fb)
+}
+
 func init() {
 	// We always support UTF-8 and ASCII.
 	encodings = make(map[string]encoding.Encoding)
@@ -45,9 +45,46 @@ var (
 	// the environment is UTF-8 or UTF-16.
 	ErrNoCharset = errors.New("character set not supported")
 
+	// ErrNotSupported indicates that the requested operation is not
+	// supported by the screen or the terminal.
+	ErrNotSupported = errors.New("operation not supported")
+
 	// ErrEventQFull indicates that the event queue is full, and
 	// cannot accept more events.
 	ErrEventQFull = errors.New("event queue full")
+
+	// ErrInputOverflow indicates that an incomplete escape sequence or
+	// paste exceeded the configured input limits, and was abandoned.
+	// It is delivered as the payload of an EventError.
+	ErrInputOverflow = errors.New("input sequence too long")
+
+	// ErrRestricted indicates that the operation would require querying
+	// the terminal, which is not permitted in restricted mode.
+	ErrRestricted = errors.New("not permitted in restricted mode")
+
+	// ErrBadRegister indicates that a clipboard register is not valid.
+	ErrBadRegister = errors.New("invalid clipboard register")
+
+	// ErrBadDiff indicates that a diff stream is malformed.
+	ErrBadDiff = errors.New("malformed diff stream")
+
+	// ErrEventType indicates that an event is of a type that cannot be
+	// serialized, such as one defined by an application.
+	ErrEventType = errors.New("event type cannot be serialized")
+
+	// ErrBadEvent indicates that a serialized event is malformed.
+	ErrBadEvent = errors.New("malformed event")
+
+	// ErrBadTtyrec indicates that a ttyrec frame is malformed, as when
+	// it is longer than any frame a terminal session would produce.
+	ErrBadTtyrec = errors.New("malformed ttyrec frame")
+
+	// ErrNoMacro indicates that there is no macro with the given name.
+	ErrNoMacro = errors.New("no such macro")
+
+	// ErrQueryTimeout indicates that the terminal did not reply to a
+	// query in time, as happens when it does not support the query.
+	ErrQueryTimeout = errors.New("no reply from terminal")
 )
 
 // An EventError is an event representing some sort of error, and carries
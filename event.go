@@ -48,6 +48,15 @@ func (e *EventTime) SetEventNow() {
 	e.SetEventTime(time.Now())
 }
 
+// originSetter is implemented by events parsed from an input stream, so
+// that the screen can record which stream they came from, when their
+// first byte was read, and when they were posted.
+type originSetter interface {
+	setOrigin(int)
+	setReceived(time.Time)
+	setPosted(time.Time)
+}
+
 // EventHandler is anything that handles events.  If the handler has
 // consumed the event, it should return true.  False otherwise.
 type EventHandler interface {
@@ -15,6 +15,10 @@
 package tcell
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
 	"testing"
 	"time"
 )
@@ -68,3 +72,123 @@ func TestMouseEvents(t *testing.T) {
 		t.Errorf("Modifiers should be control")
 	}
 }
+
+func TestSubscribe(t *testing.T) {
+	s := mkTestScreen(t, "")
+
+	sub := s.Subscribe(4)
+	s.InjectKey(KeyRune, 'a', ModNone)
+
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Rune() != 'a' {
+		t.Errorf("Main loop did not get the event")
+	}
+	select {
+	case ev := <-sub:
+		if ek, ok := ev.(*EventKey); !ok || ek.Rune() != 'a' {
+			t.Errorf("Subscriber got wrong event %v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Subscriber did not get the event")
+	}
+
+	s.Fini()
+	if _, ok := <-sub; ok {
+		t.Errorf("Subscriber channel not closed by Fini")
+	}
+}
+
+type appEvent struct {
+	EventTime
+}
+
+func (*appEvent) EscSeq() string { return "" }
+
+func TestEventSerialization(t *testing.T) {
+	when := time.Unix(1600000000, 123456789)
+	key := NewEventKey(KeyRune, 'e', ModAlt, "\x1be")
+	key.comb = []rune{'\u0301'}
+	bracketed := &EventPaste{raw: []byte("a\rb"), crlf: true, origin: 2}
+	idle := &EventIdle{idle: true, since: when.Add(-time.Minute)}
+	events := []Event{
+		key,
+		NewEventKey(KeyF5, 0, ModShift, "\x1b[15;2~"),
+		NewEventMouse(0, 7, Button1|WheelUp, ModCtrl, "\x1b[<0;1;8M"),
+		newSyntheticMouse(3, 4, Button2, ModNone),
+		NewEventResize(80, 24),
+		NewEventPaste("hello", ""),
+		bracketed,
+		NewEventError(ErrInputOverflow),
+		NewEventError(errors.New("other")),
+		NewEventRaw("\x1b[?1;2c"),
+		&EventTick{skipped: 3},
+		idle,
+		&EventTooSmall{small: true, w: 10, h: 4},
+	}
+
+	var bin bytes.Buffer
+	var want [][]byte
+	for i, ev := range events {
+		switch ev := ev.(type) {
+		case *EventPaste:
+			ev.t = when
+		case *EventTick:
+			ev.t = when
+		case *EventIdle:
+			ev.t = when
+		case *EventTooSmall:
+			ev.t = when
+		}
+		j, err := MarshalEvent(ev)
+		if err != nil {
+			t.Fatalf("Event %d: %v", i, err)
+		}
+		want = append(want, j)
+		if err := EncodeEvent(&bin, ev); err != nil {
+			t.Fatalf("Event %d: %v", i, err)
+		}
+
+		back, err := UnmarshalEvent(j)
+		if err != nil {
+			t.Fatalf("Event %d: %v", i, err)
+		}
+		if !back.When().Equal(ev.When()) || back.EscSeq() != ev.EscSeq() {
+			t.Errorf("Event %d: JSON round trip lost time or escape", i)
+		}
+		if j2, _ := MarshalEvent(back); !bytes.Equal(j, j2) {
+			t.Errorf("Event %d: JSON round trip %s, want %s", i, j2, j)
+		}
+	}
+
+	r := bufio.NewReader(&bin)
+	for i := range events {
+		ev, err := DecodeEvent(r)
+		if err != nil {
+			t.Fatalf("Event %d: %v", i, err)
+		}
+		if j, _ := MarshalEvent(ev); !bytes.Equal(j, want[i]) {
+			t.Errorf("Event %d: binary round trip %s, want %s", i, j, want[i])
+		}
+	}
+	if _, err := DecodeEvent(r); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+
+	if ev, _ := UnmarshalEvent(want[0]); ev.(*EventKey).Runes()[1] != '\u0301' {
+		t.Errorf("Combining rune lost")
+	}
+	if ev, _ := UnmarshalEvent(want[6]); ev.(*EventPaste).Text() != "a\nb" {
+		t.Errorf("Bracketed paste text lost")
+	}
+	if ev, _ := UnmarshalEvent(want[7]); ev.(*EventError).Err() != ErrInputOverflow {
+		t.Errorf("Known error not restored")
+	}
+	if _, err := MarshalEvent(&appEvent{}); err != ErrEventType {
+		t.Errorf("Expected ErrEventType, got %v", err)
+	}
+	if _, err := UnmarshalEvent([]byte(`{"type":"focus"}`)); err != ErrBadEvent {
+		t.Errorf("Expected ErrBadEvent, got %v", err)
+	}
+	if _, err := DecodeEvent(bufio.NewReader(bytes.NewReader([]byte("E\x03\x00\x05ab")))); err != ErrBadEvent {
+		t.Errorf("Expected ErrBadEvent for short string, got %v", err)
+	}
+}
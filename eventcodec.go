@@ -0,0 +1,340 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Events can be written in two forms, so that they can be logged, sent
+// to another process, or saved to be replayed later.  MarshalEvent and
+// UnmarshalEvent use JSON, which is easy to read in a bug report, while
+// EncodeEvent and DecodeEvent use a compact binary form for recordings.
+// Both carry the same information: the kind of event, its time, and
+// what the event's methods report, including the escape sequence, the
+// input stream it was read from, and whether it was synthetic.
+//
+// Key, mouse, resize, paste, error, raw, tick, idle and too small
+// events can be serialized.  Events of other types, such as
+// those defined by applications, cannot be.  An error event is decoded
+// with an error that has the same message; if that is one of the errors
+// of this package, then it is that error.  The region of a mouse event is not kept, as
+// it is filled in by the screen that delivers the event.
+//
+// In the binary form, each event is the byte 'E', a byte for the kind
+// of event, and then its fields.  Numbers are varints, as written by
+// encoding/binary, with times in nanoseconds since the Unix epoch, or
+// zero if not set.  Strings are their length followed by their bytes.
+
+// eventMark marks the start of an event in the binary form.
+const eventMark = 'E'
+
+// maxEventString limits the strings that DecodeEvent will accept, so
+// that a corrupt stream cannot make it allocate without bound.
+const maxEventString = 1 << 26
+
+// eventRecord holds the fields of any event that can be serialized.
+type eventRecord struct {
+	Type     string     `json:"type"`
+	When     time.Time  `json:"when"`
+	Key      int        `json:"key,omitempty"`
+	Buttons  int        `json:"buttons,omitempty"`
+	Mod      int        `json:"mod,omitempty"`
+	X        int        `json:"x,omitempty"`
+	Y        int        `json:"y,omitempty"`
+	Width    int        `json:"width,omitempty"`
+	Height   int        `json:"height,omitempty"`
+	Text     string     `json:"text,omitempty"`
+	Skipped  int        `json:"skipped,omitempty"`
+	Idle     bool       `json:"idle,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
+	TooSmall bool       `json:"toosmall,omitempty"`
+	Esc      string     `json:"esc,omitempty"`
+	Origin   int        `json:"origin,omitempty"`
+	Synth    bool       `json:"synthetic,omitempty"`
+}
+
+// eventKinds are the kinds of event, in the order of their binary codes.
+var eventKinds = []string{
+	"key", "mouse", "resize", "paste", "error",
+	"raw", "tick", "idle", "toosmall",
+}
+
+// fields returns pointers to the fields used by the kind of event, in
+// the order they appear in the binary form.
+func (rec *eventRecord) fields() []interface{} {
+	switch rec.Type {
+	case "key":
+		return []interface{}{&rec.Key, &rec.Mod, &rec.Text, &rec.Esc, &rec.Origin, &rec.Synth}
+	case "mouse":
+		return []interface{}{&rec.X, &rec.Y, &rec.Buttons, &rec.Mod, &rec.Esc, &rec.Origin, &rec.Synth}
+	case "resize":
+		return []interface{}{&rec.Width, &rec.Height}
+	case "paste":
+		return []interface{}{&rec.Text, &rec.Esc, &rec.Origin}
+	case "error":
+		return []interface{}{&rec.Text}
+	case "raw":
+		return []interface{}{&rec.Esc, &rec.Origin}
+	case "tick":
+		return []interface{}{&rec.Skipped}
+	case "idle":
+		return []interface{}{&rec.Idle, &rec.Since}
+	case "toosmall":
+		return []interface{}{&rec.TooSmall, &rec.Width, &rec.Height}
+	}
+	return nil
+}
+
+// recordEvent fills in a record from an event.
+func recordEvent(ev Event) (*eventRecord, error) {
+	rec := &eventRecord{When: ev.When()}
+	switch ev := ev.(type) {
+	case *EventKey:
+		rec.Type = "key"
+		rec.Key, rec.Mod, rec.Esc, rec.Origin = int(ev.key), int(ev.mod), ev.esc, ev.origin
+		rec.Synth = ev.synth
+		if ev.ch != 0 || len(ev.comb) != 0 {
+			rec.Text = string(ev.Runes())
+		}
+	case *EventMouse:
+		rec.Type = "mouse"
+		rec.X, rec.Y, rec.Buttons, rec.Mod = ev.x, ev.y, int(ev.btn), int(ev.mod)
+		rec.Esc, rec.Origin, rec.Synth = ev.esc, ev.origin, ev.synth
+	case *EventResize:
+		rec.Type = "resize"
+		rec.Width, rec.Height = ev.w, ev.h
+	case *EventPaste:
+		rec.Type = "paste"
+		rec.Text, rec.Esc, rec.Origin = ev.Text(), ev.EscSeq(), ev.origin
+	case *EventError:
+		rec.Type = "error"
+		rec.Text = ev.Error()
+	case *EventRaw:
+		rec.Type = "raw"
+		rec.Esc, rec.Origin = ev.esc, ev.origin
+	case *EventTick:
+		rec.Type = "tick"
+		rec.Skipped = ev.skipped
+	case *EventIdle:
+		rec.Type = "idle"
+		rec.Idle = ev.idle
+		if !ev.since.IsZero() {
+			since := ev.since
+			rec.Since = &since
+		}
+	case *EventTooSmall:
+		rec.Type = "toosmall"
+		rec.TooSmall, rec.Width, rec.Height = ev.small, ev.w, ev.h
+	default:
+		return nil, ErrEventType
+	}
+	return rec, nil
+}
+
+// knownErrors are the errors that are restored by identity, rather than
+// by message, when an error event is decoded.
+var knownErrors = []error{
+	ErrTermNotFound, ErrNoScreen, ErrNoCharset, ErrNotSupported,
+	ErrEventQFull, ErrInputOverflow, ErrRestricted, ErrBadRegister,
+	ErrBadDiff, ErrEventType, ErrBadEvent, ErrBadTtyrec,
+}
+
+// event makes the event described by the record.
+func (rec *eventRecord) event() (Event, error) {
+	t := rec.When
+	switch rec.Type {
+	case "key":
+		ev := &EventKey{t: t, key: Key(rec.Key), mod: ModMask(rec.Mod), esc: rec.Esc, origin: rec.Origin, synth: rec.Synth}
+		if r := []rune(rec.Text); len(r) > 0 {
+			ev.ch = r[0]
+			if len(r) > 1 {
+				ev.comb = r[1:]
+			}
+		}
+		return ev, nil
+	case "mouse":
+		return &EventMouse{t: t, x: rec.X, y: rec.Y, btn: ButtonMask(rec.Buttons),
+			mod: ModMask(rec.Mod), esc: rec.Esc, origin: rec.Origin, synth: rec.Synth}, nil
+	case "resize":
+		return &EventResize{t: t, w: rec.Width, h: rec.Height}, nil
+	case "paste":
+		return &EventPaste{t: t, text: rec.Text, esc: rec.Esc, origin: rec.Origin}, nil
+	case "error":
+		err := errors.New(rec.Text)
+		for _, e := range knownErrors {
+			if e.Error() == rec.Text {
+				err = e
+				break
+			}
+		}
+		return &EventError{t: t, err: err}, nil
+	case "raw":
+		return &EventRaw{t: t, esc: rec.Esc, origin: rec.Origin}, nil
+	case "tick":
+		return &EventTick{t: t, skipped: rec.Skipped}, nil
+	case "idle":
+		ev := &EventIdle{t: t, idle: rec.Idle}
+		if rec.Since != nil {
+			ev.since = *rec.Since
+		}
+		return ev, nil
+	case "toosmall":
+		return &EventTooSmall{t: t, small: rec.TooSmall, w: rec.Width, h: rec.Height}, nil
+	}
+	return nil, ErrBadEvent
+}
+
+// MarshalEvent returns the JSON form of the event.  It returns
+// ErrEventType if the event cannot be serialized.
+func MarshalEvent(ev Event) ([]byte, error) {
+	rec, err := recordEvent(ev)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rec)
+}
+
+// UnmarshalEvent returns the event whose JSON form is data, as written
+// by MarshalEvent.  It returns ErrBadEvent if the kind of event is not
+// known.
+func UnmarshalEvent(data []byte) (Event, error) {
+	rec := &eventRecord{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, err
+	}
+	return rec.event()
+}
+
+// EncodeEvent writes the binary form of the event.  It returns
+// ErrEventType if the event cannot be serialized.
+func EncodeEvent(w io.Writer, ev Event) error {
+	rec, err := recordEvent(ev)
+	if err != nil {
+		return err
+	}
+	b := []byte{eventMark, 0}
+	for i, k := range eventKinds {
+		if k == rec.Type {
+			b[1] = byte(i)
+		}
+	}
+	b = appendTime(b, rec.When)
+	for _, f := range rec.fields() {
+		switch f := f.(type) {
+		case *int:
+			b = appendVarint(b, int64(*f))
+		case *bool:
+			if *f {
+				b = append(b, 1)
+			} else {
+				b = append(b, 0)
+			}
+		case *string:
+			b = appendUvarint(b, uint64(len(*f)))
+			b = append(b, *f...)
+		case **time.Time:
+			if *f == nil {
+				b = append(b, 0)
+			} else {
+				b = appendTime(b, **f)
+			}
+		}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// DecodeEvent reads the binary form of one event, as written by
+// EncodeEvent.  It returns io.EOF if the stream ends cleanly before
+// the event starts, and ErrBadEvent if the event is malformed.
+func DecodeEvent(r io.ByteReader) (Event, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if c != eventMark {
+		return nil, ErrBadEvent
+	}
+	if c, err = r.ReadByte(); err != nil || int(c) >= len(eventKinds) {
+		return nil, ErrBadEvent
+	}
+	rec := &eventRecord{Type: eventKinds[c]}
+	if rec.When, err = readTime(r); err != nil {
+		return nil, ErrBadEvent
+	}
+	for _, f := range rec.fields() {
+		switch f := f.(type) {
+		case *int:
+			v, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, ErrBadEvent
+			}
+			*f = int(v)
+		case *bool:
+			v, err := r.ReadByte()
+			if err != nil || v > 1 {
+				return nil, ErrBadEvent
+			}
+			*f = v == 1
+		case *string:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > maxEventString {
+				return nil, ErrBadEvent
+			}
+			s := make([]byte, n)
+			for i := range s {
+				if s[i], err = r.ReadByte(); err != nil {
+					return nil, ErrBadEvent
+				}
+			}
+			*f = string(s)
+		case **time.Time:
+			t, err := readTime(r)
+			if err != nil {
+				return nil, ErrBadEvent
+			}
+			if !t.IsZero() {
+				*f = &t
+			}
+		}
+	}
+	return rec.event()
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(b, tmp[:n]...)
+}
+
+func appendTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return appendVarint(b, 0)
+	}
+	return appendVarint(b, t.UnixNano())
+}
+
+func readTime(r io.ByteReader) (time.Time, error) {
+	v, err := binary.ReadVarint(r)
+	if err != nil || v == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(0, v), nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"time"
+)
+
+// FrameInfo describes a frame drawn by ShowFrame or SyncFrame, so that an
+// application can log slow frames, or draw less when frames are costly.
+type FrameInfo struct {
+	// Cells is the number of cells that were drawn, because they had
+	// changed since the last frame.
+	Cells int
+
+	// Bytes is the number of bytes written to the terminal.  It is zero
+	// for the simulation screen, which writes nothing.
+	Bytes int
+
+	// Duration is the time taken to draw the frame and write it.
+	Duration time.Duration
+
+	// Degraded is true if the frame was drawn more simply, because it
+	// would have exceeded the budget set by SetOutputBudget.
+	Degraded bool
+}
+
+// FrameScreen is a Screen that can describe the frames it draws.  The
+// terminal and simulation screens are FrameScreens; as other screens
+// need not be, applications should test for it with a type assertion:
+//
+//	if fs, ok := s.(tcell.FrameScreen); ok {
+//	    info := fs.ShowFrame()
+//	    ...
+//	} else {
+//	    s.Show()
+//	}
+type FrameScreen interface {
+	// ShowFrame is Show, but also returns a description of the frame.
+	ShowFrame() FrameInfo
+
+	// SyncFrame is Sync, but also returns a description of the frame.
+	SyncFrame() FrameInfo
+
+	Screen
+}
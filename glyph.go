@@ -0,0 +1,96 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"github.com/zyedidia/tcell/v2/terminfo"
+)
+
+// GlyphPolicy describes the characters that a terminal cannot display,
+// even though its character set has them, and what to show in their
+// place.  Characters that are not displayed are replaced as though the
+// character set lacked them: with the alternate character set if the
+// terminal has one, then with the fallbacks (see RegisterRuneFallback),
+// and otherwise with a question mark.
+type GlyphPolicy struct {
+	// ASCII limits output to 7-bit characters, for terminals that
+	// cannot display anything else, whatever the locale says.
+	ASCII bool
+
+	// Replace maps characters that the terminal would mangle to what
+	// should be shown instead.  This takes precedence over everything
+	// else, and the replacement is sent as is.
+	Replace map[rune]string
+
+	// Marks selects what is shown for a character whose combining marks
+	// cannot all be displayed.
+	Marks MarkPolicy
+}
+
+// MarkPolicy selects what is shown for a character with combining marks
+// that the terminal's character set lacks.
+type MarkPolicy int
+
+const (
+	// MarksElide shows the character, and leaves out the marks that
+	// cannot be displayed.  This is the default.
+	MarksElide MarkPolicy = iota
+
+	// MarksFallback shows the precomposed form of the character and its
+	// marks if the character set has that, as a Latin-1 terminal has é.
+	// Otherwise it shows the character followed by each of the marks,
+	// with the fallback registered by RegisterRuneFallback for those that
+	// cannot be displayed.  Such fallbacks should take no space, such as
+	// another combining mark; marks without one are left out.
+	MarksFallback
+
+	// MarksCluster shows the precomposed form of the character and its
+	// marks if the character set has that.  Otherwise the whole cluster
+	// is replaced: with the fallback registered for its precomposed form,
+	// if there is one, and otherwise with a question mark, so that the
+	// marks are not lost without trace.
+	MarksCluster
+)
+
+// glyphTerms are the default glyph policies for terminals that are known
+// to need one.  Hazeltine terminals use the tilde to introduce commands,
+// so it cannot be displayed, and like the VT52 they predate anything but
+// ASCII.  Emulators commonly claim to be other old terminals, like the
+// VT100, but display Unicode quite well, so those are left alone.
+var glyphTerms = []struct {
+	name   string
+	policy GlyphPolicy
+}{
+	{"hz", GlyphPolicy{ASCII: true, Replace: map[rune]string{'~': "-"}}},
+	{"vt52", GlyphPolicy{ASCII: true}},
+}
+
+// glyphPolicy returns the default glyph policy for the terminal.
+func glyphPolicy(ti *terminfo.Terminfo) GlyphPolicy {
+	for _, g := range glyphTerms {
+		if termIs(ti, []string{g.name}) {
+			return g.policy
+		}
+	}
+	return GlyphPolicy{}
+}
+
+// allows reports whether the policy permits the rune to be sent as is.
+func (p *GlyphPolicy) allows(r rune) bool {
+	if _, ok := p.Replace[r]; ok {
+		return false
+	}
+	return !p.ASCII || r < 0x80
+}
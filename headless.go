@@ -0,0 +1,85 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sync/atomic"
+)
+
+// HeadlessScreen is a Screen that does everything that it would for a
+// terminal, down to producing the escape sequences, but has no terminal.
+// The output is counted and thrown away.  This is for benchmarks, of an
+// application's drawing or of tcell's own, that give the same results
+// wherever they are run.
+//
+// There is no input loop, as with SetManualPump, so input can only be
+// given with ProcessInput, and events are only delivered by PollEvent
+// while they are queued.
+type HeadlessScreen interface {
+	// BytesWritten returns the number of bytes of output so far.
+	BytesWritten() int64
+
+	// SetSize changes the size of the screen, as though the terminal
+	// had been resized.  The new size takes effect, and an EventResize
+	// is posted, straight away.
+	SetSize(width, height int)
+
+	Screen
+}
+
+// NewHeadlessScreen returns a HeadlessScreen for the named terminal, of
+// the given size.
+func NewHeadlessScreen(term string, width, height int) (HeadlessScreen, error) {
+	t, e := newTScreen(term)
+	if e != nil {
+		return nil, e
+	}
+	t.nulltty = &nullTty{w: width, h: height}
+	t.manual = true
+	return &headlessScreen{t}, nil
+}
+
+type headlessScreen struct {
+	*tScreen
+}
+
+func (h *headlessScreen) BytesWritten() int64 {
+	return atomic.LoadInt64(&h.nulltty.n)
+}
+
+func (h *headlessScreen) SetSize(width, height int) {
+	h.Lock()
+	h.nulltty.w, h.nulltty.h = width, height
+	if h.quit != nil && !h.fini {
+		h.resize()
+	}
+	h.Unlock()
+}
+
+// nullTty stands in for the terminal of a headless screen.
+type nullTty struct {
+	n    int64 // first, for atomic access on 32-bit systems
+	w, h int
+}
+
+func (n *nullTty) Write(b []byte) (int, error) {
+	atomic.AddInt64(&n.n, int64(len(b)))
+	return len(b), nil
+}
+
+// Size returns the size of the terminal, as getWinSize does.
+func (n *nullTty) Size() (int, int, error) {
+	return n.w, n.h, nil
+}
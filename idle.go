@@ -0,0 +1,50 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"time"
+)
+
+// EventIdle is sent when no input has arrived for the time given to
+// SetIdleTimeout, and again, just before the input that ends the idle
+// period, to wake the application.  Applications can use this to stop
+// animations or polling while nobody is looking.
+type EventIdle struct {
+	t     time.Time
+	idle  bool
+	since time.Time
+}
+
+// When returns the time when the Event was created.
+func (ev *EventIdle) When() time.Time {
+	return ev.t
+}
+
+// Idle returns true if the screen has become idle, and false if it has
+// just woken up.
+func (ev *EventIdle) Idle() bool {
+	return ev.idle
+}
+
+// Since returns the time when input was last received, before the idle
+// period began.
+func (ev *EventIdle) Since() time.Time {
+	return ev.since
+}
+
+func (ev *EventIdle) EscSeq() string {
+	return ""
+}
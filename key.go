@@ -43,15 +43,22 @@ import (
 // overly much on availability of modifiers, or the availability of any
 // specific keys.
 type EventKey struct {
-	t   time.Time
-	mod ModMask
-	key Key
-	esc string
-	ch  rune
+	t      time.Time
+	mod    ModMask
+	key    Key
+	esc    string
+	ch     rune
+	comb   []rune
+	locks  ModMask
+	origin int
+	lat    time.Duration
+	synth  bool
 }
 
 // When returns the time when this Event was created, which should closely
-// match the time when the key was pressed.
+// match the time when the key was pressed.  For a key read from input,
+// it is when the first byte of its sequence was read, and carries the
+// monotonic clock reading, so that it can be compared with time.Now.
 func (ev *EventKey) When() time.Time {
 	return ev.t
 }
@@ -62,6 +69,15 @@ func (ev *EventKey) Rune() rune {
 	return ev.ch
 }
 
+// Runes returns the rune for the key press, followed by any combining
+// marks that were typed after it.  Marks are only gathered this way if
+// the screen was asked to with SetCombining; otherwise they arrive as key
+// events of their own.  The result is only defined if the value of Key()
+// is KeyRune.
+func (ev *EventKey) Runes() []rune {
+	return append([]rune{ev.ch}, ev.comb...)
+}
+
 // Key returns a virtual key code.  We use this to identify specific key
 // codes, such as KeyEnter, etc.  Most control and function keys are reported
 // with unique Key values.  Normal alphanumeric and punctuation keys will
@@ -79,6 +95,15 @@ func (ev *EventKey) Modifiers() ModMask {
 	return ev.mod
 }
 
+// Locks returns the lock keys, ModCapsLock and ModNumLock, that were on
+// when the key was pressed.  These are kept apart from the modifiers, as
+// a lock that is on, as Num Lock usually is, does not change which key
+// was pressed.  Only the Windows console, browsers, and terminals that use
+// the kitty keyboard protocol report them; elsewhere this is ModNone.
+func (ev *EventKey) Locks() ModMask {
+	return ev.locks
+}
+
 // KeyNames holds the written names of special keys. Useful to echo back a key
 // name, or to look up a key from a string value.
 var KeyNames = map[Key]string{
@@ -172,6 +197,9 @@ var KeyNames = map[Key]string{
 	KeyF62:            "F62",
 	KeyF63:            "F63",
 	KeyF64:            "F64",
+	KeyKPEnter:        "KPEnter",
+	KeyScrollLock:     "ScrollLock",
+	KeyMenu:           "Menu",
 	KeyCtrlA:          "Ctrl-A",
 	KeyCtrlB:          "Ctrl-B",
 	KeyCtrlC:          "Ctrl-C",
@@ -241,6 +269,44 @@ func (ev *EventKey) EscSeq() string {
 	return ev.esc
 }
 
+// Origin returns the input stream the event was read from.  Zero is the
+// terminal itself; other values are those returned by Screen.AddInput.
+func (ev *EventKey) Origin() int {
+	return ev.origin
+}
+
+func (ev *EventKey) setOrigin(origin int) {
+	ev.origin = origin
+}
+
+func (ev *EventKey) setReceived(at time.Time) {
+	ev.t = at
+}
+
+func (ev *EventKey) setPosted(at time.Time) {
+	ev.lat = at.Sub(ev.t)
+}
+
+// Latency returns the time from the first byte of the event being read,
+// to the event being posted, which includes the time spent waiting for
+// the rest of the input.  It is zero for events not read from input.
+func (ev *EventKey) Latency() time.Duration {
+	return ev.lat
+}
+
+// Synthetic returns true if the event was made by Screen.InjectKey,
+// rather than typed.
+func (ev *EventKey) Synthetic() bool {
+	return ev.synth
+}
+
+// newSyntheticKey makes the event for Screen.InjectKey.
+func newSyntheticKey(key Key, r rune, mod ModMask) *EventKey {
+	ev := NewEventKey(key, r, mod, "")
+	ev.synth = true
+	return ev
+}
+
 // NewEventKey attempts to create a suitable event.  It parses the various
 // ASCII control sequences if KeyRune is passed for Key, but if the caller
 // has more precise information it should set that specifically.  Callers
@@ -272,11 +338,16 @@ type ModMask int16
 // with Meta, and the lack of support for it on many/most platforms, the
 // current implementations never use it.  Instead, they use ModAlt, even for
 // events that could possibly have been distinguished from ModAlt.
+//
+// ModCapsLock and ModNumLock are the lock keys, as reported by
+// EventKey.Locks.  They are never among the modifiers of an event.
 const (
 	ModShift ModMask = 1 << iota
 	ModCtrl
 	ModAlt
 	ModMeta
+	ModCapsLock
+	ModNumLock
 	ModNone ModMask = 0
 )
 
@@ -378,6 +449,9 @@ const (
 	KeyF62
 	KeyF63
 	KeyF64
+	KeyKPEnter
+	KeyScrollLock
+	KeyMenu
 )
 
 // These are the control keys.  Note that they overlap with other keys,
@@ -466,4 +540,6 @@ const (
 	KeyEscape     = KeyESC
 	KeyEnter      = KeyCR
 	KeyBackspace2 = KeyDEL
+	KeyPrtScr     = KeyPrint
+	KeyBreak      = KeyPause
 )
@@ -0,0 +1,68 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sort"
+	"strings"
+)
+
+// KeySequence is an input sequence that a screen reports as a key.
+type KeySequence struct {
+	Seq string
+	Key Key
+	Mod ModMask
+}
+
+// KeyConflict describes two key sequences that get in each other's way,
+// which is usually why a key does not work with a particular terminal.
+// If Prefix is false, the sequences are the same, and only Seq is ever
+// reported; Other is not.  If Prefix is true, Seq is a prefix of Other,
+// and input meant as one may be taken for the other.
+type KeyConflict struct {
+	Seq    KeySequence
+	Other  KeySequence
+	Prefix bool
+}
+
+// keyConflicts returns the conflicts between the key codes, after those
+// already found while they were prepared, in order of sequence.
+func keyConflicts(codes map[string]*tKeyCode, dups []KeyConflict) []KeyConflict {
+	seqs := keySequences(codes)
+	res := append([]KeyConflict(nil), dups...)
+	for i, ks := range seqs {
+		// Sorted, any sequence that has this one as a prefix follows
+		// it directly.
+		for _, other := range seqs[i+1:] {
+			if !strings.HasPrefix(other.Seq, ks.Seq) {
+				break
+			}
+			res = append(res, KeyConflict{Seq: ks, Other: other, Prefix: true})
+		}
+	}
+	return res
+}
+
+// keySequences returns the key codes, in order of sequence.
+func keySequences(codes map[string]*tKeyCode) []KeySequence {
+	seqs := make([]KeySequence, 0, len(codes))
+	for seq, k := range codes {
+		seqs = append(seqs, KeySequence{Seq: seq, Key: k.key, Mod: k.mod})
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i].Seq < seqs[j].Seq
+	})
+	return seqs
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// macroBuffer is the size of the subscription used to record a macro.
+// Input arrives at the speed of a person typing, so this need only cover
+// a large paste of keys, or the application being briefly busy.
+const macroBuffer = 1024
+
+// Macros records the input posted to a screen, and replays it later, so
+// that applications can offer keyboard macros.  Each macro has a name,
+// and holds the key, mouse and paste events posted while it was being
+// recorded, along with when they were posted.
+//
+// Recording works by subscribing to the screen, so it sees events as they
+// are posted, rather than as the application reads them.  The event that
+// leads the application to stop recording is therefore normally the last
+// one recorded; Trim removes it.
+//
+// A Macros is safe to use from multiple goroutines.
+type Macros struct {
+	s      Screen
+	macros map[string][]Event
+	name   string
+	sub    <-chan Event
+	done   chan []Event
+	lk     sync.Mutex
+}
+
+// NewMacros returns a Macros for the screen, with no macros.
+func NewMacros(s Screen) *Macros {
+	return &Macros{s: s, macros: make(map[string][]Event)}
+}
+
+// StartRecording begins recording the macro with the given name, which
+// replaces any macro of that name when recording stops.  If another macro
+// is being recorded, it is stopped first.
+func (m *Macros) StartRecording(name string) {
+	m.StopRecording()
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.name = name
+	m.sub = m.s.Subscribe(macroBuffer)
+	m.done = make(chan []Event, 1)
+	go m.record(m.sub, m.done)
+}
+
+func (m *Macros) record(sub <-chan Event, done chan<- []Event) {
+	var events []Event
+	for ev := range sub {
+		switch ev.(type) {
+		case *EventKey, *EventMouse, *EventPaste:
+			events = append(events, ev)
+		}
+	}
+	done <- events
+}
+
+// StopRecording stops recording, and saves the macro.  It returns the
+// name of the macro, and false if no macro was being recorded.
+func (m *Macros) StopRecording() (string, bool) {
+	m.lk.Lock()
+	name, sub, done := m.name, m.sub, m.done
+	m.sub, m.done = nil, nil
+	m.lk.Unlock()
+	if sub == nil {
+		return "", false
+	}
+
+	// Events posted before now are already in the subscription's
+	// buffer, and are delivered before it is closed.
+	m.s.Unsubscribe(sub)
+	events := <-done
+
+	m.lk.Lock()
+	m.macros[name] = events
+	m.lk.Unlock()
+	return name, true
+}
+
+// Recording returns the name of the macro being recorded, and false if
+// there is none.
+func (m *Macros) Recording() (string, bool) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if m.sub == nil {
+		return "", false
+	}
+	return m.name, true
+}
+
+// Trim removes up to n events from the end of the macro, such as the key
+// that stopped recording.
+func (m *Macros) Trim(name string, n int) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if events, ok := m.macros[name]; ok {
+		if n > len(events) {
+			n = len(events)
+		}
+		m.macros[name] = events[:len(events)-n]
+	}
+}
+
+// Names returns the names of the macros, in sorted order.
+func (m *Macros) Names() []string {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	names := make([]string, 0, len(m.macros))
+	for name := range m.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Events returns the events of the macro, or nil if there is no such
+// macro.  The events must not be modified.
+func (m *Macros) Events(name string) []Event {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return m.macros[name]
+}
+
+// Delete removes the macro.
+func (m *Macros) Delete(name string) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	delete(m.macros, name)
+}
+
+// Replay posts the events of the macro to the screen again, from another
+// goroutine, and returns without waiting for them to be delivered.  The
+// events are new copies, with the current time; key and mouse events are
+// marked synthetic, as by InjectKey.  The events are spaced out as they
+// were recorded, divided by the speed factor, so that 2 replays at double
+// speed.  A speed of zero or less posts them with no delay.  ErrNoMacro
+// is returned if there is no such macro.
+func (m *Macros) Replay(name string, speed float64) error {
+	m.lk.Lock()
+	events, ok := m.macros[name]
+	m.lk.Unlock()
+	if !ok {
+		return ErrNoMacro
+	}
+	go m.replay(events, speed)
+	return nil
+}
+
+func (m *Macros) replay(events []Event, speed float64) {
+	for i, ev := range events {
+		if i > 0 && speed > 0 {
+			d := ev.When().Sub(events[i-1].When())
+			time.Sleep(time.Duration(float64(d) / speed))
+		}
+		rec, err := recordEvent(ev)
+		if err != nil {
+			continue
+		}
+		rec.When = time.Now()
+		rec.Synth = true
+		if ev, err = rec.event(); err == nil {
+			m.s.PostEventWait(ev)
+		}
+	}
+}
+
+// Save writes the macros to w, as a JSON object with a member for each
+// macro, holding the events in the form written by MarshalEvent.
+func (m *Macros) Save(w io.Writer) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	out := make(map[string][]json.RawMessage, len(m.macros))
+	for name, events := range m.macros {
+		list := make([]json.RawMessage, 0, len(events))
+		for _, ev := range events {
+			b, err := MarshalEvent(ev)
+			if err != nil {
+				return err
+			}
+			list = append(list, b)
+		}
+		out[name] = list
+	}
+	return json.NewEncoder(w).Encode(out)
+}
+
+// Load reads macros written by Save, replacing any macros of the same
+// names.  Nothing is changed if an error is returned.
+func (m *Macros) Load(r io.Reader) error {
+	var in map[string][]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return err
+	}
+	macros := make(map[string][]Event, len(in))
+	for name, list := range in {
+		events := make([]Event, 0, len(list))
+		for _, b := range list {
+			ev, err := UnmarshalEvent(b)
+			if err != nil {
+				return err
+			}
+			events = append(events, ev)
+		}
+		macros[name] = events
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	for name, events := range macros {
+		m.macros[name] = events
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"fmt"
+)
+
+// Metric identifies a timing measurement reported to the function
+// given to SetMetrics.
+type Metric int
+
+const (
+	// MetricInputLatency is the time from input bytes being read,
+	// to the events decoded from them being posted.
+	MetricInputLatency Metric = iota
+
+	// MetricKeyTimeout is reported, in addition to MetricInputLatency,
+	// when events were only posted once the escape sequence timer
+	// expired.  This is the usual cause of a delayed escape key.
+	MetricKeyTimeout
+
+	// MetricShowLatency is the time from Show or Sync being called,
+	// to the output being written to the terminal.
+	MetricShowLatency
+)
+
+// String returns a name for the metric.
+func (m Metric) String() string {
+	switch m {
+	case MetricInputLatency:
+		return "input-latency"
+	case MetricKeyTimeout:
+		return "key-timeout"
+	case MetricShowLatency:
+		return "show-latency"
+	}
+	return fmt.Sprintf("metric-%d", int(m))
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventTooSmall is sent when the screen becomes smaller than the size
+// given to SetMinSize, and again when it is large enough once more.
+// While it is too small, the screen shows a notice instead of what the
+// application draws; the application's cells are kept, and are shown
+// again when the screen is large enough.
+type EventTooSmall struct {
+	t     time.Time
+	small bool
+	w, h  int
+}
+
+// When returns the time when the Event was created.
+func (ev *EventTooSmall) When() time.Time {
+	return ev.t
+}
+
+// TooSmall returns true if the screen has become too small, and false
+// if it is large enough again.
+func (ev *EventTooSmall) TooSmall() bool {
+	return ev.small
+}
+
+// Size returns the size of the screen, as width, height in character
+// cells.
+func (ev *EventTooSmall) Size() (int, int) {
+	return ev.w, ev.h
+}
+
+func (ev *EventTooSmall) EscSeq() string {
+	return ""
+}
+
+// minSize tracks whether a screen is smaller than its minimum size, and
+// holds the notice that is drawn in place of its cells while it is.  The
+// zero value has no minimum.  The owning screen serializes the calls.
+type minSize struct {
+	w, h   int
+	small  bool
+	notice CellBuffer
+}
+
+// Set changes the minimum size.
+func (m *minSize) Set(w, h int) {
+	m.w, m.h = w, h
+}
+
+// Check updates the state for a screen of the given size, and returns
+// the event to post if it has crossed the minimum, or nil.  When it has
+// become large enough again, the screen must redraw all of its cells.
+func (m *minSize) Check(w, h int) *EventTooSmall {
+	small := w < m.w || h < m.h
+	if small {
+		if nw, nh := m.notice.Size(); !m.small || nw != w || nh != h {
+			m.layout(w, h)
+		}
+	}
+	if small == m.small {
+		return nil
+	}
+	m.small = small
+	return &EventTooSmall{t: time.Now(), small: small, w: w, h: h}
+}
+
+// Small reports whether the screen is too small.
+func (m *minSize) Small() bool {
+	return m.small
+}
+
+// Swap exchanges the notice with the screen's cells.  It is called
+// before and after drawing while the screen is too small.
+func (m *minSize) Swap(cb *CellBuffer) {
+	*cb, m.notice = m.notice, *cb
+}
+
+// Invalidate marks the notice to be drawn in full, as when the screen
+// has been cleared.
+func (m *minSize) Invalidate() {
+	m.notice.Invalidate()
+}
+
+// layout fills the notice for a screen of the given size, wrapped at
+// word boundaries and centered.
+func (m *minSize) layout(w, h int) {
+	m.notice.Resize(w, h)
+	m.notice.Fill(' ', StyleDefault)
+	m.notice.Invalidate()
+
+	msg := fmt.Sprintf("terminal too small (need %dx%d)", m.w, m.h)
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(msg) {
+		if line != "" && len(line)+1+len(word) > w {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	lines = append(lines, line)
+
+	top := 0
+	if len(lines) < h {
+		top = (h - len(lines)) / 2
+	}
+	for i, line := range lines {
+		if len(line) > w {
+			line = line[:w]
+		}
+		left := (w - len(line)) / 2
+		for j, r := range line {
+			m.notice.SetContent(left+j, top+i, r, nil, StyleDefault)
+		}
+	}
+}
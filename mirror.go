@@ -0,0 +1,134 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// mirrorBacklog is the number of frames that may be waiting to be sent
+// to a mirror, before it is considered too slow and is dropped.
+const mirrorBacklog = 64
+
+// mirrors copies the output sent to the terminal to other writers, so
+// that others can watch.  Each writer is serviced by its own goroutine,
+// so that a slow or stalled one cannot hold up the application.  A writer
+// that fails, or falls too far behind, is removed (and closed, if it is
+// an io.Closer).  The zero value is ready to use.
+type mirrors struct {
+	sinks map[io.Writer]chan []byte
+	lk    sync.Mutex
+}
+
+// Add starts copying output to the writer, first sending it the given
+// data to bring it up to date.
+func (m *mirrors) Add(w io.Writer, init []byte) {
+	ch := make(chan []byte, mirrorBacklog)
+	if len(init) > 0 {
+		ch <- append([]byte{}, init...)
+	}
+	m.lk.Lock()
+	if m.sinks == nil {
+		m.sinks = make(map[io.Writer]chan []byte)
+	}
+	if _, ok := m.sinks[w]; ok {
+		m.lk.Unlock()
+		return
+	}
+	m.sinks[w] = ch
+	m.lk.Unlock()
+
+	go func() {
+		for b := range ch {
+			if _, e := w.Write(b); e != nil {
+				m.Remove(w)
+				for range ch {
+				}
+				return
+			}
+		}
+	}()
+}
+
+// Remove stops copying output to the writer.
+func (m *mirrors) Remove(w io.Writer) {
+	m.lk.Lock()
+	m.remove(w)
+	m.lk.Unlock()
+}
+
+func (m *mirrors) remove(w io.Writer) {
+	if ch, ok := m.sinks[w]; ok {
+		delete(m.sinks, w)
+		close(ch)
+		if c, ok := w.(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// Write sends a copy of the data to every writer.
+func (m *mirrors) Write(b []byte) {
+	m.lk.Lock()
+	if len(m.sinks) > 0 && len(b) > 0 {
+		b = append([]byte{}, b...)
+		for w, ch := range m.sinks {
+			select {
+			case ch <- b:
+			default:
+				m.remove(w)
+			}
+		}
+	}
+	m.lk.Unlock()
+}
+
+// Len returns the number of writers.
+func (m *mirrors) Len() int {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	return len(m.sinks)
+}
+
+// Close removes all the writers.
+func (m *mirrors) Close() {
+	m.lk.Lock()
+	for w := range m.sinks {
+		m.remove(w)
+	}
+	m.lk.Unlock()
+}
+
+// ServeMirror accepts connections on the listener, and mirrors the
+// screen's output to each of them, until the listener is closed.  The
+// connections are read-only; nothing sent by the other end is read.
+// Someone wishing to watch can simply copy what they receive to a
+// terminal of the same type and size, for example with:
+//
+//	socat UNIX-CONNECT:/path/to/socket STDOUT
+func ServeMirror(s Screen, l net.Listener) error {
+	for {
+		c, e := l.Accept()
+		if e != nil {
+			return e
+		}
+		if e = s.Mirror(c); e != nil {
+			c.Close()
+			return e
+		}
+	}
+}
@@ -35,15 +35,22 @@ import (
 // Applications can inspect the time between events to resolve double or
 // triple clicks.
 type EventMouse struct {
-	t   time.Time
-	btn ButtonMask
-	mod ModMask
-	x   int
-	y   int
-	esc string
+	t      time.Time
+	btn    ButtonMask
+	mod    ModMask
+	x      int
+	y      int
+	esc    string
+	origin int
+	lat    time.Duration
+	region string
+	rx     int
+	ry     int
+	synth  bool
 }
 
-// When returns the time when this EventMouse was created.
+// When returns the time when this EventMouse was created.  For an event
+// read from input, it is when the first byte of its sequence was read.
 func (ev *EventMouse) When() time.Time {
 	return ev.t
 }
@@ -69,6 +76,61 @@ func (ev *EventMouse) EscSeq() string {
 	return ev.esc
 }
 
+// Region returns the id of the topmost region registered with
+// Screen.RegisterRegion that the event falls in, or the empty string
+// if there is none.
+func (ev *EventMouse) Region() string {
+	return ev.region
+}
+
+// RegionPosition returns the mouse position relative to the upper left
+// corner of the region given by Region.  If the event is not in any
+// region, this is the same as Position.
+func (ev *EventMouse) RegionPosition() (int, int) {
+	if ev.region == "" {
+		return ev.x, ev.y
+	}
+	return ev.rx, ev.ry
+}
+
+// Origin returns the input stream the event was read from.  Zero is the
+// terminal itself; other values are those returned by Screen.AddInput.
+func (ev *EventMouse) Origin() int {
+	return ev.origin
+}
+
+func (ev *EventMouse) setOrigin(origin int) {
+	ev.origin = origin
+}
+
+func (ev *EventMouse) setReceived(at time.Time) {
+	ev.t = at
+}
+
+func (ev *EventMouse) setPosted(at time.Time) {
+	ev.lat = at.Sub(ev.t)
+}
+
+// Latency returns the time from the first byte of the event being read,
+// to the event being posted, which includes the time spent waiting for
+// the rest of the input.  It is zero for events not read from input.
+func (ev *EventMouse) Latency() time.Duration {
+	return ev.lat
+}
+
+// Synthetic returns true if the event was made by Screen.InjectMouse,
+// rather than by the mouse.
+func (ev *EventMouse) Synthetic() bool {
+	return ev.synth
+}
+
+// newSyntheticMouse makes the event for Screen.InjectMouse.
+func newSyntheticMouse(x, y int, btn ButtonMask, mod ModMask) *EventMouse {
+	ev := NewEventMouse(x, y, btn, mod, "")
+	ev.synth = true
+	return ev
+}
+
 // NewEventMouse is used to create a new mouse event.  Applications
 // shouldn't need to use this; its mostly for screen implementors.
 func NewEventMouse(x, y int, btn ButtonMask, mod ModMask, esc string) *EventMouse {
@@ -0,0 +1,56 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// Padding selects how the delays that terminfo asks for after some
+// capabilities, written as $<n>, are dealt with.
+type Padding int
+
+const (
+	// PaddingSleep pauses for each delay, unless the terminal has no
+	// pad character.  This is the default.
+	PaddingSleep Padding = iota
+
+	// PaddingNone ignores the delays.  No terminal emulator needs
+	// them, and they only slow things down.
+	PaddingNone
+
+	// PaddingStrict sends pad characters to fill each delay at the
+	// baud rate of the line, as curses does, so that the delay holds
+	// however the output is buffered.  This is for real terminals on
+	// serial lines.
+	PaddingStrict
+)
+
+// padChars returns a function for Terminfo.TPutsFunc that writes enough
+// pad characters to take the delay at the given baud rate.  Each
+// character takes ten bits on the line, counting start and stop bits.
+func padChars(baud int, pad string) func(io.Writer, time.Duration) {
+	if pad == "" {
+		pad = "\x00"
+	}
+	return func(w io.Writer, d time.Duration) {
+		n := (int64(d)*int64(baud) + int64(10*time.Second) - 1) / int64(10*time.Second)
+		if n > 0 {
+			io.WriteString(w, strings.Repeat(pad, int(n)))
+		}
+	}
+}
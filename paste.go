@@ -14,30 +14,139 @@
 
 package tcell
 
-import "time"
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
 
 // EventPaste represents a bracketed paste event.
+//
+// Pastes can be large, so a bracketed paste keeps just the bytes the
+// terminal sent, and its text is produced on demand.  Applications that
+// handle large pastes can avoid copying them at all by using Reader or
+// Lines instead of Text.
 type EventPaste struct {
-	t    time.Time
-	text string
-	esc  string
+	t      time.Time
+	text   string
+	esc    string
+	raw    []byte
+	crlf   bool // carriage returns in raw read as newlines
+	noseq  bool // the screen was not capturing escape sequences
+	origin int
+	lat    time.Duration
 }
 
 // When returns the time when this Event was created, which should closely
-// match the time when the paste was made.
+// match the time when the paste was made.  For a paste read from input,
+// it is when the first byte of the paste was read.
 func (e *EventPaste) When() time.Time {
 	return e.t
 }
 
-// Text returns the text that was pasted
+// Text returns the text that was pasted.  Each call makes a new copy.
 func (e *EventPaste) Text() string {
-	return e.text
+	if e.raw == nil {
+		return e.text
+	}
+	if !e.crlf {
+		return string(e.raw)
+	}
+	var sb strings.Builder
+	sb.Grow(len(e.raw))
+	b := e.raw
+	for {
+		i := bytes.IndexByte(b, '\r')
+		if i < 0 {
+			sb.Write(b)
+			return sb.String()
+		}
+		sb.Write(b[:i])
+		sb.WriteByte('\n')
+		b = b[i+1:]
+	}
+}
+
+// Reader returns a reader for the text that was pasted, the same as
+// Text, but without making a copy.
+func (e *EventPaste) Reader() io.Reader {
+	switch {
+	case e.raw == nil:
+		return strings.NewReader(e.text)
+	case e.crlf:
+		return &crReader{b: e.raw}
+	}
+	return bytes.NewReader(e.raw)
+}
+
+// Lines returns the lines of the text that was pasted, without their
+// line endings.  The lines share the event's storage, so they must not
+// be modified.
+func (e *EventPaste) Lines() [][]byte {
+	b := e.raw
+	if b == nil {
+		b = []byte(e.text)
+	}
+	var lines [][]byte
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if e.crlf {
+			if j := bytes.IndexByte(b, '\r'); j >= 0 && (i < 0 || j < i) {
+				i = j
+			}
+		}
+		if i < 0 {
+			return append(lines, b)
+		}
+		lines = append(lines, b[:i])
+		b = b[i+1:]
+	}
+}
+
+// Raw returns the exact bytes that were pasted, as sent by the terminal.
+// For a bracketed paste, this has the carriage returns that Text turns
+// into newlines (unless the screen was asked for raw pastes with
+// SetRawPaste).  For other pastes, it is the same as Text.
+func (e *EventPaste) Raw() []byte {
+	if e.raw == nil {
+		return []byte(e.text)
+	}
+	return e.raw
 }
 
 func (e *EventPaste) EscSeq() string {
+	if e.esc == "" && e.raw != nil && !e.noseq {
+		return pasteBegin + string(e.raw) + pasteEnd
+	}
 	return e.esc
 }
 
+// Origin returns the input stream the paste was read from.  Zero is the
+// terminal itself; other values are those returned by Screen.AddInput.
+func (e *EventPaste) Origin() int {
+	return e.origin
+}
+
+func (e *EventPaste) setOrigin(origin int) {
+	e.origin = origin
+}
+
+func (e *EventPaste) setReceived(at time.Time) {
+	e.t = at
+}
+
+func (e *EventPaste) setPosted(at time.Time) {
+	e.lat = at.Sub(e.t)
+}
+
+// Latency returns the time from the first byte of the event being read,
+// to the event being posted, which includes the time spent waiting for
+// the rest of the input.  It is zero for events not read from input.
+func (e *EventPaste) Latency() time.Duration {
+	return e.lat
+}
+
 // NewEventPaste creates a new paste event from the given text
 func NewEventPaste(text string, esc string) *EventPaste {
 	return &EventPaste{
@@ -46,3 +155,22 @@ func NewEventPaste(text string, esc string) *EventPaste {
 		esc:  esc,
 	}
 }
+
+// crReader reads bytes, turning carriage returns into newlines.
+type crReader struct {
+	b []byte
+}
+
+func (r *crReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	for i := range p[:n] {
+		if p[i] == '\r' {
+			p[i] = '\n'
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultQueryTimeout is how long a query waits for the terminal when
+// no timeout is given.
+const defaultQueryTimeout = time.Second
+
+// queries matches the replies from the terminal to the queries waiting
+// for them.  This is used by Screen implementors to provide the Query
+// methods.  The zero value is ready to use.
+type queries struct {
+	list []*query
+	lk   sync.Mutex
+}
+
+// query is a request waiting for its reply.
+type query struct {
+	match func(Event) bool
+	fn    func(Event)
+	timer *time.Timer
+}
+
+// Add registers a query, which takes the first event the match function
+// accepts.  The function fn is called once, with the reply, or with nil
+// if none arrives within the timeout, or the queries are canceled.  It
+// is called from whatever goroutine delivers the reply, or from a timer.
+func (qs *queries) Add(match func(Event) bool, timeout time.Duration, fn func(Event)) {
+	if timeout <= 0 {
+		timeout = defaultQueryTimeout
+	}
+	q := &query{match: match, fn: fn}
+	qs.lk.Lock()
+	qs.list = append(qs.list, q)
+	q.timer = time.AfterFunc(timeout, func() {
+		if qs.remove(q) {
+			q.fn(nil)
+		}
+	})
+	qs.lk.Unlock()
+}
+
+// remove takes the query out of the list, and returns false if it was
+// already gone, as when its reply and its timeout race.
+func (qs *queries) remove(q *query) bool {
+	qs.lk.Lock()
+	defer qs.lk.Unlock()
+	for i, q2 := range qs.list {
+		if q2 == q {
+			qs.list = append(qs.list[:i], qs.list[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Waiting returns true if any query is waiting for its reply.
+func (qs *queries) Waiting() bool {
+	qs.lk.Lock()
+	defer qs.lk.Unlock()
+	return len(qs.list) > 0
+}
+
+// Deliver offers the event to the waiting queries, oldest first, and
+// returns true if one of them took it, in which case it should not be
+// posted.
+func (qs *queries) Deliver(ev Event) bool {
+	qs.lk.Lock()
+	var q *query
+	for i, q2 := range qs.list {
+		if q2.match(ev) {
+			q = q2
+			qs.list = append(qs.list[:i], qs.list[i+1:]...)
+			break
+		}
+	}
+	qs.lk.Unlock()
+	if q == nil {
+		return false
+	}
+	q.timer.Stop()
+	q.fn(ev)
+	return true
+}
+
+// Cancel ends all the waiting queries without a reply.  This is called
+// when the screen is finalized.
+func (qs *queries) Cancel() {
+	qs.lk.Lock()
+	list := qs.list
+	qs.list = nil
+	qs.lk.Unlock()
+	for _, q := range list {
+		q.timer.Stop()
+		q.fn(nil)
+	}
+}
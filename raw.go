@@ -6,11 +6,14 @@ import "time"
 // parse the escape sequence, so the escape sequence is
 // sent directly to the application
 type EventRaw struct {
-	t   time.Time
-	esc string // The escape code
+	t      time.Time
+	esc    string // The escape code
+	origin int
+	lat    time.Duration
 }
 
-// When returns the time when this EventMouse was created.
+// When returns the time when this EventRaw was created.  For an event
+// read from input, it is when the first byte of its sequence was read.
 func (ev *EventRaw) When() time.Time {
 	return ev.t
 }
@@ -19,6 +22,31 @@ func (ev *EventRaw) EscSeq() string {
 	return ev.esc
 }
 
+// Origin returns the input stream the event was read from.  Zero is the
+// terminal itself; other values are those returned by Screen.AddInput.
+func (ev *EventRaw) Origin() int {
+	return ev.origin
+}
+
+func (ev *EventRaw) setOrigin(origin int) {
+	ev.origin = origin
+}
+
+func (ev *EventRaw) setReceived(at time.Time) {
+	ev.t = at
+}
+
+func (ev *EventRaw) setPosted(at time.Time) {
+	ev.lat = at.Sub(ev.t)
+}
+
+// Latency returns the time from the first byte of the event being read,
+// to the event being posted, which includes the time spent waiting for
+// the rest of the input.  It is zero for events not read from input.
+func (ev *EventRaw) Latency() time.Duration {
+	return ev.lat
+}
+
 func NewEventRaw(code string) *EventRaw {
 	return &EventRaw{
 		t:   time.Now(),
@@ -0,0 +1,60 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// Rect is a rectangular area of cells, with its upper left corner at
+// (X, Y).  A Rect with a Width or Height less than one is empty.
+type Rect struct {
+	X      int
+	Y      int
+	Width  int
+	Height int
+}
+
+// Empty returns true if the rectangle contains no cells.
+func (r Rect) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// Contains returns true if the cell at (x, y) lies within the rectangle.
+func (r Rect) Contains(x, y int) bool {
+	return x >= r.X && y >= r.Y && x < r.X+r.Width && y < r.Y+r.Height
+}
+
+// Intersect returns the area common to both rectangles.  If they do not
+// overlap, the result is empty.
+func (r Rect) Intersect(o Rect) Rect {
+	x0, y0 := r.X, r.Y
+	x1, y1 := r.X+r.Width, r.Y+r.Height
+	if o.X > x0 {
+		x0 = o.X
+	}
+	if o.Y > y0 {
+		y0 = o.Y
+	}
+	if e := o.X + o.Width; e < x1 {
+		x1 = e
+	}
+	if e := o.Y + o.Height; e < y1 {
+		y1 = e
+	}
+	if x1 < x0 {
+		x1 = x0
+	}
+	if y1 < y0 {
+		y1 = y0
+	}
+	return Rect{X: x0, Y: y0, Width: x1 - x0, Height: y1 - y0}
+}
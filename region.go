@@ -0,0 +1,77 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sync"
+)
+
+// region is a named area of the screen.
+type region struct {
+	id string
+	r  Rect
+}
+
+// regions is a registry of named areas of the screen, used to tell
+// which one a mouse event falls in.  This is used by Screen implementors
+// to provide RegisterRegion and UnregisterRegion.  Regions registered
+// later are on top of those registered earlier.  The zero value is ready
+// to use.
+type regions struct {
+	list []region
+	lk   sync.Mutex
+}
+
+// Register adds a region, or moves an existing one, placing it on top.
+func (rg *regions) Register(id string, r Rect) {
+	rg.lk.Lock()
+	rg.remove(id)
+	rg.list = append(rg.list, region{id: id, r: r})
+	rg.lk.Unlock()
+}
+
+// Unregister removes a region.
+func (rg *regions) Unregister(id string) {
+	rg.lk.Lock()
+	rg.remove(id)
+	rg.lk.Unlock()
+}
+
+func (rg *regions) remove(id string) {
+	for i := range rg.list {
+		if rg.list[i].id == id {
+			rg.list = append(rg.list[:i], rg.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// Annotate records in a mouse event the topmost region it falls in.
+// Other events are left alone.
+func (rg *regions) Annotate(ev Event) {
+	mev, ok := ev.(*EventMouse)
+	if !ok {
+		return
+	}
+	rg.lk.Lock()
+	for i := len(rg.list) - 1; i >= 0; i-- {
+		if r := rg.list[i].r; r.Contains(mev.x, mev.y) {
+			mev.region = rg.list[i].id
+			mev.rx, mev.ry = mev.x-r.X, mev.y-r.Y
+			break
+		}
+	}
+	rg.lk.Unlock()
+}
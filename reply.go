@@ -0,0 +1,359 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Terminals reply to some queries with control sequences, which are
+// delivered as the events below, rather than as keys or EventRaw, unless
+// they answer one of the Query methods of the screen.  A
+// reply that looks like a key the terminal has is delivered as the key,
+// as there is no telling them apart; on xterm, a cursor position report
+// for the fifth column of the first row is the same as Ctrl-F3.
+
+// EventCursorReport is the terminal's reply to a request for the cursor
+// position (DSR 6, or the DEC form, DSR ?6).
+type EventCursorReport struct {
+	t    time.Time
+	esc  string
+	x, y int
+}
+
+// When returns the time when the reply was read.
+func (ev *EventCursorReport) When() time.Time {
+	return ev.t
+}
+
+// EscSeq returns the reply as it was received.
+func (ev *EventCursorReport) EscSeq() string {
+	return ev.esc
+}
+
+// Position returns the position of the cursor, counted from zero at the
+// top left of the terminal.  In inline mode, that is not the top left
+// of the screen.
+func (ev *EventCursorReport) Position() (int, int) {
+	return ev.x, ev.y
+}
+
+// EventDeviceAttributes is the terminal's reply to a request for its
+// primary (DA1) or secondary (DA2) device attributes.
+type EventDeviceAttributes struct {
+	t         time.Time
+	esc       string
+	secondary bool
+	attrs     []int
+}
+
+// When returns the time when the reply was read.
+func (ev *EventDeviceAttributes) When() time.Time {
+	return ev.t
+}
+
+// EscSeq returns the reply as it was received.
+func (ev *EventDeviceAttributes) EscSeq() string {
+	return ev.esc
+}
+
+// Secondary returns true for a reply to a request for the secondary
+// device attributes, which identify the terminal and its version.
+func (ev *EventDeviceAttributes) Secondary() bool {
+	return ev.secondary
+}
+
+// Attributes returns the parameters of the reply.  For the primary
+// attributes, the first is the conformance level, and the rest are the
+// features the terminal has, such as 4 for sixel graphics.  For the
+// secondary attributes, they are the terminal type, its version, and
+// the ROM cartridge number, usually zero.
+func (ev *EventDeviceAttributes) Attributes() []int {
+	return ev.attrs
+}
+
+// ModeSetting is the state of a mode, as reported by the terminal.
+type ModeSetting int
+
+// These are the states that a terminal reports for a mode.
+const (
+	ModeUnknown          ModeSetting = iota // The terminal does not know the mode.
+	ModeSet                                 // The mode is set.
+	ModeReset                               // The mode is reset.
+	ModePermanentlySet                      // The mode is set, and cannot be changed.
+	ModePermanentlyReset                    // The mode is reset, and cannot be changed.
+)
+
+// EventModeReport is the terminal's reply to a request for the state of
+// a mode (DECRQM).
+type EventModeReport struct {
+	t       time.Time
+	esc     string
+	mode    int
+	private bool
+	setting ModeSetting
+}
+
+// When returns the time when the reply was read.
+func (ev *EventModeReport) When() time.Time {
+	return ev.t
+}
+
+// EscSeq returns the reply as it was received.
+func (ev *EventModeReport) EscSeq() string {
+	return ev.esc
+}
+
+// Mode returns the number of the mode, and true if it is a private (DEC)
+// mode, such as 2004 for bracketed paste, rather than an ANSI mode.
+func (ev *EventModeReport) Mode() (int, bool) {
+	return ev.mode, ev.private
+}
+
+// Setting returns the state of the mode.
+func (ev *EventModeReport) Setting() ModeSetting {
+	return ev.setting
+}
+
+// EventColorReport is the terminal's reply to a request for one of its
+// colors: the default foreground (OSC 10) or background (OSC 11), or an
+// entry of the palette (OSC 4).
+type EventColorReport struct {
+	t     time.Time
+	esc   string
+	index int
+	bg    bool
+	color Color
+}
+
+// When returns the time when the reply was read.
+func (ev *EventColorReport) When() time.Time {
+	return ev.t
+}
+
+// EscSeq returns the reply as it was received.
+func (ev *EventColorReport) EscSeq() string {
+	return ev.esc
+}
+
+// Color returns the color, as an RGB color.
+func (ev *EventColorReport) Color() Color {
+	return ev.color
+}
+
+// Index returns the index of the palette entry, or -1 if the reply is
+// for the default foreground or background color.
+func (ev *EventColorReport) Index() int {
+	return ev.index
+}
+
+// Background returns true if the reply is for the default background
+// color.
+func (ev *EventColorReport) Background() bool {
+	return ev.bg
+}
+
+// EventTermcapReport is the terminal's reply to a request for one of its
+// terminfo capabilities (XTGETTCAP).
+type EventTermcapReport struct {
+	t     time.Time
+	esc   string
+	name  string
+	value string
+	valid bool
+}
+
+// When returns the time when the reply was read.
+func (ev *EventTermcapReport) When() time.Time {
+	return ev.t
+}
+
+// EscSeq returns the reply as it was received.
+func (ev *EventTermcapReport) EscSeq() string {
+	return ev.esc
+}
+
+// Name returns the name of the capability.  Some terminals leave it out
+// of their reply when they do not know the capability.
+func (ev *EventTermcapReport) Name() string {
+	return ev.name
+}
+
+// Value returns the value of the capability, and false if the terminal
+// does not know it.  Boolean capabilities have an empty value.
+func (ev *EventTermcapReport) Value() (string, bool) {
+	return ev.value, ev.valid
+}
+
+// replyPrefixes are the starts of the OSC and DCS replies that have
+// events, so that input which cannot be one is not held back waiting for
+// the rest of a string.
+var replyPrefixes = []string{
+	"\x1b]4;",
+	"\x1b]10;",
+	"\x1b]11;",
+	"\x1bP1+r",
+	"\x1bP0+r",
+}
+
+// mayBeReply returns true if the input is, or could become, a control
+// sequence that replyEvent understands.  Two bytes, such as Alt-P, are
+// not taken for the start of a string, so that keys are not delayed.
+func mayBeReply(b []byte) bool {
+	if bytes.HasPrefix(b, []byte("\x1b[")) {
+		return true
+	}
+	for _, p := range replyPrefixes {
+		if bytes.HasPrefix(b, []byte(p)) || (len(b) > 2 && strings.HasPrefix(p, string(b))) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyEvent returns the event for a reply, or nil if the control sequence
+// is not one.
+func replyEvent(seq string) Event {
+	if len(seq) < 3 || seq[0] != '\x1b' {
+		return nil
+	}
+	switch seq[1] {
+	case '[':
+		return csiReply(seq)
+	case ']':
+		return oscReply(seq, strings.TrimSuffix(strings.TrimSuffix(seq[2:], "\a"), "\x1b\\"))
+	case 'P':
+		return dcsReply(seq, strings.TrimSuffix(seq[2:], "\x1b\\"))
+	}
+	return nil
+}
+
+func csiReply(seq string) Event {
+	body, final := seq[2:len(seq)-1], seq[len(seq)-1]
+	var lead byte
+	if len(body) > 0 && (body[0] == '?' || body[0] == '>') {
+		lead, body = body[0], body[1:]
+	}
+	dollar := strings.HasSuffix(body, "$")
+	if dollar {
+		body = body[:len(body)-1]
+	}
+	var params []int
+	if body != "" {
+		for _, p := range strings.Split(body, ";") {
+			v, err := strconv.Atoi(p)
+			if err != nil || v < 0 {
+				return nil
+			}
+			params = append(params, v)
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case final == 'R' && lead != '>' && !dollar && (len(params) == 2 || (lead == '?' && len(params) == 3)):
+		if params[0] < 1 || params[1] < 1 {
+			return nil
+		}
+		return &EventCursorReport{t: now, esc: seq, x: params[1] - 1, y: params[0] - 1}
+	case final == 'c' && lead != 0 && !dollar && len(params) > 0:
+		return &EventDeviceAttributes{t: now, esc: seq, secondary: lead == '>', attrs: params}
+	case final == 'y' && lead != '>' && dollar && len(params) == 2 && params[1] <= int(ModePermanentlyReset):
+		return &EventModeReport{t: now, esc: seq, mode: params[0], private: lead == '?',
+			setting: ModeSetting(params[1])}
+	}
+	return nil
+}
+
+// oscReply parses the color replies, such as "11;rgb:0000/0000/0000".
+func oscReply(seq, body string) Event {
+	ev := &EventColorReport{t: time.Now(), esc: seq, index: -1}
+	parts := strings.Split(body, ";")
+	switch {
+	case len(parts) == 3 && parts[0] == "4":
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 || n > 255 {
+			return nil
+		}
+		ev.index = n
+	case len(parts) == 2 && (parts[0] == "10" || parts[0] == "11"):
+		ev.bg = parts[0] == "11"
+	default:
+		return nil
+	}
+	if ev.color = parseRGBSpec(parts[len(parts)-1]); ev.color == ColorDefault {
+		return nil
+	}
+	return ev
+}
+
+// parseRGBSpec parses an X11 color of the form "rgb:r/g/b", where each
+// component has from one to four hex digits, as terminals report them.
+// It returns ColorDefault if the color is malformed.
+func parseRGBSpec(spec string) Color {
+	if !strings.HasPrefix(spec, "rgb:") {
+		return ColorDefault
+	}
+	comps := strings.Split(spec[4:], "/")
+	if len(comps) != 3 {
+		return ColorDefault
+	}
+	var rgb [3]int32
+	for i, c := range comps {
+		if len(c) < 1 || len(c) > 4 {
+			return ColorDefault
+		}
+		v, err := strconv.ParseUint(c, 16, 16)
+		if err != nil {
+			return ColorDefault
+		}
+		max := uint64(1)<<(4*uint(len(c))) - 1
+		rgb[i] = int32((v*255 + max/2) / max)
+	}
+	return NewRGBColor(rgb[0], rgb[1], rgb[2])
+}
+
+// dcsReply parses the XTGETTCAP replies, such as "1+r636f6c6f7273=323536"
+// for a capability the terminal knows, or "0+r" for one it does not.
+func dcsReply(seq, body string) Event {
+	if len(body) < 3 || body[1:3] != "+r" || (body[0] != '0' && body[0] != '1') {
+		return nil
+	}
+	ev := &EventTermcapReport{t: time.Now(), esc: seq, valid: body[0] == '1'}
+	// Only one capability is asked for at a time, so any others are
+	// ignored.
+	body = strings.SplitN(body[3:], ";", 2)[0]
+	hname, hvalue := body, ""
+	if i := strings.IndexByte(body, '='); i >= 0 {
+		hname, hvalue = body[:i], body[i+1:]
+	}
+	name, err := hex.DecodeString(hname)
+	if err != nil {
+		return nil
+	}
+	value, err := hex.DecodeString(hvalue)
+	if err != nil {
+		return nil
+	}
+	ev.name, ev.value = string(name), string(value)
+	if ev.valid && ev.name == "" {
+		return nil
+	}
+	return ev
+}
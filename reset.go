@@ -0,0 +1,64 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/zyedidia/tcell/v2/terminfo"
+)
+
+// TerminalResetString returns the bytes that restore a terminal after a
+// Screen has been using it: they leave the alternate screen, show the
+// cursor in its usual shape, turn off text attributes, keypad mode and
+// mouse reporting, and disable bracketed paste.  The terminal is named
+// by term, or by $TERM if that is empty.
+//
+// This is for when Fini cannot be called, such as in a crash handler, or
+// in a parent process whose child left the terminal in a bad state.  The
+// string can be computed ahead of time, so that nothing needs to be
+// looked up when it is needed.  Note that it cannot restore the terminal
+// modes (such as echo) that are set with termios; that needs the
+// original settings, which only the Screen has.
+func TerminalResetString(term string) (string, error) {
+	if term == "" {
+		term = os.Getenv("TERM")
+	}
+	ti, e := terminfo.LookupTerminfo(term)
+	if e != nil {
+		if ti, e = loadDynamicTerminfo(term); e != nil {
+			return "", e
+		}
+	}
+	return resetString(ti), nil
+}
+
+// resetString returns the sequences to undo what Init does to a terminal,
+// as finish does for a full screen session.
+func resetString(ti *terminfo.Terminfo) string {
+	buf := &bytes.Buffer{}
+	if termIs(ti, cursorTerms) {
+		fmt.Fprintf(buf, cursorShape, 0)
+	}
+	ti.TPuts(buf, ti.ShowCursor)
+	ti.TPuts(buf, ti.AttrOff)
+	ti.TPuts(buf, ti.ExitCA)
+	ti.TPuts(buf, ti.ExitKeypad)
+	ti.TPuts(buf, ti.TParm(ti.MouseMode, 0))
+	buf.WriteString(pasteDisable)
+	return buf.String()
+}
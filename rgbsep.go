@@ -0,0 +1,34 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// RGBSeparator selects how the parts of a 24-bit color are separated in
+// the sequences sent to the terminal.  Most terminals accept either
+// form, but some only understand one of them.
+type RGBSeparator int
+
+const (
+	// RGBSepAuto uses the terminal database, unless the terminal is
+	// known to need colons.  This is the default.
+	RGBSepAuto RGBSeparator = iota
+
+	// RGBSepSemicolon uses semicolons, as in ESC [ 38;2;R;G;B m, the
+	// form that older terminals understand.
+	RGBSepSemicolon
+
+	// RGBSepColon uses colons, as in ESC [ 38:2::R:G:B m, the form
+	// that ITU T.416 describes.
+	RGBSepColon
+)
@@ -70,6 +70,11 @@ const (
 // or change or even remove these mappings with Screen.RegisterRuneFallback
 // Screen.UnregisterRuneFallback methods.
 //
+// Each screen takes its own copy of this map when it is created, so that
+// the methods of one screen do not affect another, and changes to the map
+// only affect screens created afterwards.  As for any map, it must not be
+// changed while a screen is being created on another goroutine.
+//
 // Note that Unicode is presumed to be able to display all glyphs.
 // This is a pretty poor assumption, but there is no easy way to
 // figure out which glyphs are supported in a given font.  Hence,
@@ -14,14 +14,26 @@
 
 package tcell
 
+import (
+	"io"
+	"regexp"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
 // Screen represents the physical (or emulated) screen.
 // This can be a terminal window or a physical console.  Platforms implement
 // this differerently.
 type Screen interface {
-	// Init initializes the screen for use.
+	// Init initializes the screen for use.  A screen that has been
+	// finalized with Fini may be initialized again, for example to
+	// switch between full screen and plain output.
 	Init() error
 
-	// Fini finalizes the screen also releasing resources.
+	// Fini finalizes the screen also releasing resources.  Any streams
+	// added with AddInput are dropped, and must be added again after a
+	// later Init.
 	Fini()
 
 	// Clear erases the screen.  The contents of any screen buffers
@@ -32,6 +44,15 @@ type Screen interface {
 	// Fill fills the screen with the given character and style.
 	Fill(rune, Style)
 
+	// ClearRect fills the given area of the screen with spaces in the
+	// given style.  It is cheaper than calling SetContent for each
+	// cell, and terminals may be sent an erase sequence for the area
+	// instead of the spaces themselves.
+	ClearRect(x, y, w, h int, style Style)
+
+	// ClearLine clears row y of the screen, as Clear does.
+	ClearLine(y int)
+
 	// SetCell is an older API, and will be removed.  Please use
 	// SetContent instead; SetCell is implemented in terms of SetContent.
 	SetCell(x int, y int, style Style, ch ...rune)
@@ -60,6 +81,42 @@ type Screen interface {
 	// last column will be replaced with a single width space on output.
 	SetContent(x int, y int, mainc rune, combc []rune, style Style)
 
+	// SetTag attaches an opaque application value to the given cell, so
+	// that a screen position can be mapped back to what was drawn there,
+	// for example to find the item under the mouse.  Tags are not
+	// displayed; see CellBuffer.SetTag for how they behave.
+	SetTag(x, y int, tag uint32)
+
+	// GetTag returns the tag for the given cell, or zero if there is none.
+	GetTag(x, y int) uint32
+
+	// SetSelection highlights the cells within the rectangles, replacing
+	// any previous selection.  The highlight is drawn over the content
+	// when the screen is shown, and does not change the cells themselves,
+	// so it follows whatever is drawn beneath it.  With a style of
+	// StyleDefault the selection is shown in reverse video; otherwise the
+	// colors of the style replace those of the cells, and its attributes
+	// are added.  Passing no rectangles clears the selection.  See
+	// LinearSelection for a selection that runs from line to line.
+	SetSelection(rects []Rect, style Style)
+
+	// SelectedText returns the text of the selection, suitable for
+	// placing on the clipboard.  See CellBuffer.Text for details.
+	SelectedText() string
+
+	// SetHighlight highlights the cells within the rectangles, as
+	// SetSelection does, but independently of the selection, which is
+	// drawn over it.  This is meant for showing the matches of a search,
+	// such as those returned by Find.  Passing no rectangles clears the
+	// highlight.
+	SetHighlight(rects []Rect, style Style)
+
+	// Find searches the content of the screen for the regular expression,
+	// and returns the cells of each match.  This is the content as set,
+	// including any changes that have not been shown yet.  See
+	// CellBuffer.Find for details.
+	Find(re *regexp.Regexp) []Rect
+
 	// SetStyle sets the default style to use when clearing the screen
 	// or when StyleDefault is specified.  If it is also StyleDefault,
 	// then whatever system/terminal default is relevant will be used.
@@ -70,10 +127,46 @@ type Screen interface {
 	// dimensions of the screen, the cursor will be hidden.
 	ShowCursor(x int, y int)
 
+	// ShowCursorStyle is like ShowCursor, but also selects the shape of
+	// the cursor.  If the terminal is not known to be able to change the
+	// shape, a software cursor is drawn instead.  ShowCursor is the same
+	// as using CursorStyleDefault.
+	ShowCursorStyle(x int, y int, cs CursorStyle)
+
+	// ShowCursors displays several cursors at once, as for editing in
+	// more than one place.  The first is the primary cursor, shown as by
+	// ShowCursorStyle.  The others are always drawn in software, over the
+	// cells they are on.  Calling ShowCursor, or ShowCursors with just
+	// one cursor, removes the others.  With no cursors at all, the cursor
+	// is hidden.
+	ShowCursors(cursors ...Cursor)
+
+	// SetCursorBlink selects a blinking or a steady cursor, whatever its
+	// shape, rather than the terminal's default.  Where the terminal can
+	// change the shape of the cursor, the default shape is then a block.
+	// Elsewhere, the terminal's very visible cursor is used to blink, if
+	// it has one.
+	SetCursorBlink(blink bool)
+
+	// SetSoftCursor selects a software cursor, drawn by the screen as part
+	// of the content rather than by the terminal.  An underline cursor
+	// underlines the cell it is on, and other shapes reverse it.  This is
+	// useful for terminals whose cursor is hard to see, or that cannot
+	// show the cursor where it is wanted.
+	SetSoftCursor(bool)
+
 	// HideCursor is used to hide the cursor.  Its an alias for
 	// ShowCursor(-1, -1).
 	HideCursor()
 
+	// PushCursorState saves the cursors: their positions, and so whether
+	// they are shown, and their styles.  PopCursorState shows them again
+	// as they were, so that something like a popup can move or hide the
+	// cursor without knowing where it was.  PopCursorState does nothing
+	// if there is nothing saved.
+	PushCursorState()
+	PopCursorState()
+
 	// Size returns the screen size as width, height.  This changes in
 	// response to a call to Clear or Flush.
 	Size() (int, int)
@@ -98,28 +191,160 @@ type Screen interface {
 	// Goroutine is recommended to ensure no deadlock can occur.
 	PostEventWait(ev Event)
 
+	// InjectKey posts a key event, as if the key had been pressed, for
+	// automation, macro playback and tests.  The event is made as by
+	// NewEventKey, so control characters given as KeyRune become their
+	// keys, and its Synthetic method returns true.  Like PostEvent, this
+	// returns ErrEventQFull if the event queue is full.
+	InjectKey(key Key, r rune, mod ModMask) error
+
+	// InjectMouse posts a mouse event, as InjectKey does for keys.  The
+	// event is delivered whether or not the mouse is enabled, and is
+	// given a region in the usual way.
+	InjectMouse(x, y int, buttons ButtonMask, mod ModMask) error
+
+	// Subscribe returns a new channel on which a copy of every event
+	// subsequently posted to the screen is delivered, without removing
+	// it from the queue read by PollEvent.  This lets observers, such as
+	// debugging overlays or macro recorders, see events alongside the
+	// main application.  Each subscriber has its own buffer of the given
+	// size; delivery never blocks, so a subscriber that falls behind by
+	// more than that simply misses events.  The channel is closed by
+	// Unsubscribe, or when the screen is finalized.
+	Subscribe(size int) <-chan Event
+
+	// Unsubscribe stops delivery of events to a channel obtained from
+	// Subscribe, and closes it.
+	Unsubscribe(ch <-chan Event)
+
+	// RegisterRegion registers a named area of the screen, such as a
+	// widget, or moves it if it already exists.  Mouse events falling
+	// in a region report its id from EventMouse.Region, and positions
+	// relative to it from EventMouse.RegionPosition, so the application
+	// need not test every widget itself.  Where regions overlap, the
+	// one registered last wins.
+	RegisterRegion(id string, r Rect)
+
+	// UnregisterRegion removes a region registered with RegisterRegion.
+	UnregisterRegion(id string)
+
+	// Mirror starts copying the output sent to the terminal to the
+	// writer, so that others can watch the session, for example over
+	// a network connection (see ServeMirror).  The new viewer is first
+	// sent a full repaint of what was last shown, so that it starts with
+	// a complete picture; the terminal itself is not redrawn.
+	// A writer that returns an error, or falls too far behind, stops
+	// receiving output, and is closed if it is an io.Closer.
+	// This is only supported for terminals; other screens return
+	// ErrNotSupported.
+	Mirror(w io.Writer) error
+
+	// Unmirror stops copying output to a writer given to Mirror.
+	Unmirror(w io.Writer)
+
+	// MirrorDiffs is like Mirror, but sends the diff stream (see
+	// DiffEncoder) instead of terminal output.  This describes just
+	// the cells, so it can be displayed by something other than a
+	// terminal, using DecodeDiff.  The first frame has every cell, and
+	// each later one has the cells changed since.  Cursors, selections
+	// and the like are not included.
+	MirrorDiffs(w io.Writer) error
+
+	// UnmirrorDiffs stops sending the diff stream to a writer given to
+	// MirrorDiffs.
+	UnmirrorDiffs(w io.Writer)
+
 	// EnableMouse enables the mouse.  (If your terminal supports it.)
 	EnableMouse()
 
 	// DisableMouse disables the mouse.
 	DisableMouse()
 
+	// EnablePaste enables bracketed paste, where the terminal marks
+	// pasted text so that it is delivered as a single EventPaste, rather
+	// than as keystrokes.  This is the default, where supported, and the
+	// setting is kept across Fini and Init.  While bracketed paste is
+	// disabled, only the heuristic selected with SetPaste applies.
+	EnablePaste()
+
+	// DisablePaste disables bracketed paste.  Pasted text is then
+	// delivered as keystrokes, as if typed, unless SetPaste is used.
+	DisablePaste()
+
+	// MouseEnabled returns true if the mouse is enabled, as by
+	// EnableMouse, so that code that changes it can put it back.
+	MouseEnabled() bool
+
+	// PasteEnabled returns true if bracketed paste is enabled, as by
+	// EnablePaste.
+	PasteEnabled() bool
+
+	// Pasting returns true while a bracketed paste has begun but not yet
+	// ended, so that an application can hold off work that the rest of
+	// the paste would make pointless.  If the start of another paste
+	// arrives first, the one in progress is taken to end there.
+	Pasting() bool
+
 	// HasMouse returns true if the terminal (apparently) supports a
 	// mouse.  Note that the a return value of true doesn't guarantee that
 	// a mouse/pointing device is present; a false return definitely
 	// indicates no mouse support is available.
 	HasMouse() bool
 
+	// Has returns true if the screen has the capability, so that an
+	// application can test for a feature before using it.
+	Has(c Capability) bool
+
 	// Colors returns the number of colors.  All colors are assumed to
 	// use the ANSI color map.  If a terminal is monochrome, it will
 	// return 0.
 	Colors() int
 
+	// SupportedAttrs returns the attributes that the screen can display.
+	// Attributes that are not in the mask are accepted, but show as
+	// nothing, so an application may want to use others in their place,
+	// such as reverse instead of italic.  For a terminal, this is based on
+	// its terminfo entry, corrected for terminals known to ignore some of
+	// the attributes it lists.
+	SupportedAttrs() AttrMask
+
+	// SetPaletteColor changes the color the terminal shows for an index
+	// of its palette, using the xterm OSC 4 sequence.  Colors already
+	// on the screen that were fitted to the palette are fitted again.
+	// It returns ErrNotSupported if the index is not in the palette, or
+	// the color has no RGB value.  The palette is restored by Fini.
+	// Not defined for non-posix systems
+	SetPaletteColor(index int, c Color) error
+
+	// ResetPalette restores the palette changed by SetPaletteColor.
+	// Not defined for non-posix systems
+	ResetPalette()
+
+	// SetSystemColors selects whether the 16 standard colors, ColorBlack
+	// through ColorWhite, are always sent as the SGR 30-37 and 90-97
+	// sequences (40-47 and 100-107 for backgrounds), rather than as the
+	// terminal database describes, which is often as an index of the 256
+	// color palette.  Many terminal themes only change the colors of the
+	// former, so this shows those colors as the user's theme has them.
+	// Terminals with fewer than 16 colors only get the first eight this
+	// way, and the bright ones are fitted to the palette as usual.
+	// Not defined for non-posix systems
+	SetSystemColors(on bool)
+
+	// SetRGBSeparator selects how the parts of 24-bit colors are
+	// separated in the sequences sent to the terminal.  The default,
+	// RGBSepAuto, suits nearly every terminal.  $TCELL_RGBSEP, set to
+	// "colon" or "semicolon", overrides it, for the user whose terminal
+	// is not known to need one form or the other.
+	// Not defined for non-posix systems
+	SetRGBSeparator(sep RGBSeparator)
+
 	// Show makes all the content changes made using SetContent() visible
 	// on the display.
 	//
 	// It does so in the most efficient and least visually disruptive
-	// manner possible.
+	// manner possible.  Screens that are also FrameScreens can report
+	// how much was drawn, and how long it took, with ShowFrame instead.
 	Show()
 
 	// Sync works like Show(), but it updates every visible cell on the
@@ -132,6 +357,14 @@ type Screen interface {
 	// or during a resize event.
 	Sync()
 
+	// Invalidate marks the cells within the rectangle to be drawn again
+	// by the next Show, as Sync would draw every cell.  This is for when
+	// the application knows that something else has written over part
+	// of the screen, such as another process sharing the terminal.  The
+	// terminal's cursor position and attributes are assumed to have
+	// changed as well.
+	Invalidate(rect Rect)
+
 	// CharacterSet returns information about the character set.
 	// This isn't the full locale, but it does give us the input/output
 	// character set.  Note that this is just for diagnostic purposes,
@@ -139,6 +372,72 @@ type Screen interface {
 	// what the user's environment is.
 	CharacterSet() string
 
+	// SetCharset overrides the character set that would otherwise be
+	// determined from the environment (the locale on POSIX systems).  It
+	// must be called before Init, and returns ErrNoCharset if there is no
+	// encoding registered for the character set.  Screens that can only
+	// use one character set return ErrNotSupported for any other.
+	SetCharset(string) error
+
+	// SetInputEncoding and SetOutputEncoding override the character set
+	// in one direction only, for environments where the input is not
+	// encoded as the output is, such as some Windows code pages over
+	// SSH.  They take precedence over SetCharset, and must likewise be
+	// called before Init.  CharacterSet reports the output character
+	// set.
+	SetInputEncoding(charset string) error
+	SetOutputEncoding(charset string) error
+
+	// RegisterEncoding is like the package's RegisterEncoding, but the
+	// encoding is only for this screen, and takes precedence over one
+	// registered with the package.  SetEncodingFallback likewise sets
+	// the fallback for this screen only; until it is called, the
+	// package's is used.  They must be called before the character set
+	// is chosen, with SetCharset or Init.  Screens that can only use
+	// one character set ignore them.
+	RegisterEncoding(charset string, enc encoding.Encoding)
+	SetEncodingFallback(fb EncodingFallback)
+
+	// SetUTF8Policy selects what becomes of input that cannot be decoded,
+	// instead of quietly discarding it.
+	// Not defined for non-posix systems
+	SetUTF8Policy(policy UTF8Policy)
+
+	// SetCaptureEscSeq controls whether key, mouse and paste events keep
+	// the input they were parsed from, for their EscSeq methods.  It is
+	// on by default; turning it off saves making a copy of the input for
+	// every event, which adds up with mouse motion, and EscSeq returns
+	// the empty string instead.  EventRaw always keeps its input.
+	// Not defined for non-posix systems
+	SetCaptureEscSeq(on bool)
+
+	// SetNormalizeBackspace makes both of the characters that terminals
+	// variously send for the backspace key, BS and DEL, be reported as
+	// KeyBackspace.  The one that the terminal database names is the
+	// plain key; the other is reported with ModCtrl, since that is what
+	// terminals send when control is held.  The character itself is
+	// still available from the event's Rune method.
+	// Not defined for non-posix systems
+	SetNormalizeBackspace(on bool)
+
+	// SetEscapeAlt controls whether ESC followed by a printable character
+	// is taken to be that character with ModAlt, as terminals send when
+	// the meta key is held.  It is on by default.  With it off, the ESC
+	// is reported as KeyEsc, and the character as a key of its own, for
+	// users whose terminals send ESC and a key for other purposes.
+	// Not defined for non-posix systems
+	SetEscapeAlt(on bool)
+
+	// SetMouseSupport overrides the terminal database as to whether the
+	// terminal has a mouse.  Many terminals support the SGR mouse even
+	// though their entries say nothing of it, and it is used for those
+	// known to, and for any terminal where this is called with true.
+	// With false, the mouse is never used.  EnableMouse and DisableMouse
+	// may be called any number of times, and the mouse stays enabled
+	// across Fini and Init.
+	// Not defined for non-posix systems
+	SetMouseSupport(support bool)
+
 	// RegisterRuneFallback adds a fallback for runes that are not
 	// part of the character set -- for example one coudld register
 	// o as a fallback for ø.  This should be done cautiously for
@@ -168,6 +467,20 @@ type Screen interface {
 	// by your terminal except by changing the terminal database.
 	UnregisterRuneFallback(r rune)
 
+	// SetGlyphPolicy sets which characters the terminal cannot display
+	// even though its character set has them, and what to show instead.
+	// A default policy is chosen for terminals known to need one, such
+	// as the Hazeltine terminals, which cannot display a tilde.
+	// Not defined for non-posix systems
+	SetGlyphPolicy(policy GlyphPolicy)
+
+	// SetPadding selects how the delays that the terminal database asks
+	// for after some output are dealt with, and the baud rate of the
+	// line for PaddingStrict.  Without a baud rate, PaddingStrict sleeps
+	// instead, as PaddingSleep does.
+	// Not defined for non-posix systems
+	SetPadding(mode Padding, baud int)
+
 	// CanDisplay returns true if the given rune can be displayed on
 	// this screen.  Note that this is a best guess effort -- whether
 	// your fonts support the character or not may be questionable.
@@ -181,9 +494,52 @@ type Screen interface {
 
 	// Resize does nothing, since its generally not possible to
 	// ask a screen to resize, but it allows the Screen to implement
-	// the View interface.
+	// the View interface.  Use RequestResize to ask for a new size.
 	Resize(int, int, int, int)
 
+	// RequestResize asks for the screen to be given a new size.  The
+	// simulation screen is resized at once.  Terminals known to support
+	// it (those compatible with xterm) are asked to resize their window,
+	// and a Windows console resizes its window and buffer.  In either
+	// case the change is reported by EventResize as usual, and the
+	// terminal is free to decline or adjust it.  ErrNotSupported is
+	// returned when the screen has no way to make the request.
+	RequestResize(width, height int) error
+
+	// SetMinSize sets the smallest size at which the application can
+	// be drawn.  While the screen is smaller than that, it shows a
+	// notice saying so in place of the application's cells, which are
+	// kept, and shown again once the screen is large enough.  An
+	// EventTooSmall is posted each time the screen crosses the minimum.
+	// A size of zero (the default) has no minimum.
+	SetMinSize(width, height int)
+
+	// OnResize sets a function to be called when the screen size has
+	// changed, before anything is drawn at the new size, so that the
+	// application can lay out its content again first.  Otherwise the
+	// old content is drawn at the new size until the application has
+	// handled the EventResize.  The function is called without the
+	// screen locked, so it may set content, but it must not call Show
+	// or Sync.  The EventResize is posted as usual.
+	OnResize(fn func(width, height int))
+
+	// Linearize returns the text that has been drawn on the screen, in
+	// reading order, for assistive technology such as screen readers
+	// and braille displays.  Each region registered with RegisterRegion
+	// is a block of its own, labeled with its id, made of the cells
+	// where it is the topmost region.  The text in no region is gathered
+	// into a block for each run of rows with text.  The blocks are in
+	// order of their upper left corners, from the top and then the left.
+	Linearize() []TextBlock
+
+	// OnTextChange sets a function to be called with the text of the
+	// screen, as returned by Linearize, whenever Show or Sync changes it,
+	// so that assistive front ends can follow what is displayed.  It is
+	// first called at the next Show or Sync.  The function is called
+	// without the screen locked, from the goroutine calling Show or Sync.
+	// Passing nil stops the calls.
+	OnTextChange(fn func([]TextBlock))
+
 	// HasKey returns true if the keyboard is believed to have the
 	// key.  In some cases a keyboard may have keys with this name
 	// but no support for them, while in others a key may be reported
@@ -199,20 +555,275 @@ type Screen interface {
 	// Not defined for non-posix systems
 	RegisterRawSeq(string)
 
+	// BindSequence makes the input sequence report the given key and
+	// modifiers, replacing whatever the terminal database says it is,
+	// so that keys can be fixed for terminals whose entries are wrong.
+	// UnbindSequence removes the sequence, however it was defined.
+	// Not defined for non-posix systems
+	BindSequence(seq string, key Key, mod ModMask)
+	UnbindSequence(seq string)
+
+	// KeySequences returns the input sequences that are reported as
+	// keys, in order.  KeyConflicts returns those that get in the way
+	// of one another: the same sequence given for different keys in
+	// the terminal database, where only the first is used, and one
+	// sequence that is a prefix of another.  These let an application
+	// explain why a key does not work with a particular terminal.
+	// Not defined for non-posix systems
+	KeySequences() []KeySequence
+	KeyConflicts() []KeyConflict
+
+	// AddInput adds another stream from which input is read, for example
+	// a FIFO used for remote control or automation.  Data from the stream
+	// is parsed in the same way as data from the terminal, and the
+	// resulting key, mouse, paste and raw events carry the returned
+	// origin value (see EventKey.Origin, for example).  The terminal
+	// itself is origin zero.  The stream is read until it returns an
+	// error; io.EOF ends the stream quietly, while any other error is
+	// posted as an EventError.
+	AddInput(r io.Reader) (int, error)
+
+	// SetInputLimits sets the maximum number of bytes that will be
+	// buffered while waiting for an escape sequence, or a bracketed
+	// or OSC 52 paste, to complete.  When a limit is exceeded the
+	// sequence is abandoned, and an EventError (with ErrInputOverflow)
+	// is posted, followed by an EventRaw holding the truncated data.
+	// A limit of zero or less disables the corresponding check.
+	// Not defined for non-posix systems
+	SetInputLimits(seq int, paste int)
+
+	// SetRestricted enables or disables restricted mode.  This is meant
+	// for applications that render untrusted content, and want to keep
+	// the escape sequence attack surface to a minimum.  In restricted
+	// mode the screen never sends queries to the terminal (operations
+	// that would, such as GetClipboard, return ErrRestricted instead),
+	// and any replies from the terminal, which can only be unsolicited,
+	// are discarded rather than delivered as events.  Bracketed paste
+	// is not used either, so pasted text arrives as keys.
+	SetRestricted(bool)
+
+	// SetResizeDelay sets how long the screen waits for the window size
+	// to stop changing before it resizes, so that dragging a window edge
+	// produces a single EventResize with the final size, rather than one
+	// for every intermediate step.  Show also leaves the size alone while
+	// it is settling.  The default is 50 milliseconds.  A delay of zero
+	// or less reports every change as it happens.
+	// Not defined for non-posix systems
+	SetResizeDelay(d time.Duration)
+
+	// SetMetrics sets a function to receive timing measurements, such
+	// as the latency of input and output (see Metric), which can help
+	// to find why an application feels sluggish.  It is called from
+	// the screen's own goroutines, and without the screen locked, but
+	// should return quickly.  Nil stops the measurements.  Setting the
+	// TCELL_TRACE environment variable to the name of a file also logs
+	// each time the escape sequence timer delays input, to that file.
+	// If TCELL_AUDIT is set as well, a report of the terminfo
+	// capabilities that were sent, including any that were missing or
+	// padded, is added to the file when the screen is finalized.  If
+	// TCELL_VALIDATE is set, the output is checked as it is sent, and
+	// malformed escape sequences, unterminated strings, and cursor moves
+	// outside the screen are logged to the file.
+	// Not defined for non-posix systems
+	SetMetrics(fn func(Metric, time.Duration))
+
+	// SetSizePoll makes the screen check the window size at the given
+	// interval, and resize if it has changed.  This is for connections
+	// that do not deliver SIGWINCH, such as serial lines and some
+	// containers.  A second or so is usually frequent enough.  An
+	// interval of zero or less (the default) turns this off again.
+	// Not defined for non-posix systems
+	SetSizePoll(interval time.Duration)
+
+	// SetFixedSize gives the screen a size that it keeps, whatever the
+	// terminal reports, for hardware terminals and serial lines whose
+	// size cannot be detected, or is detected wrongly.  ($LINES and
+	// $COLUMNS are only used when the terminal reports no size at all.)
+	// The screen is resized at once if it is running.  A width or height
+	// of zero or less (the default) detects the size again.
+	// Not defined for non-posix systems
+	SetFixedSize(width, height int)
+
+	// SetOutputBudget limits how much is sent to draw a frame, for slow
+	// links where a large update would otherwise stall the display.  A
+	// frame that would take more than n bytes is drawn again, simplified
+	// in the given ways, and the simpler version is sent instead.  The
+	// cells drawn that way stay simplified until they change, or Sync
+	// is called.  A budget of zero or less (the default) is unlimited.
+	// Not defined for non-posix systems
+	SetOutputBudget(n int, degrade Degrade)
+
+	// SetFlushSize limits the size of each write to the terminal.  A
+	// frame that is larger is sent in several writes, for transports
+	// that deal poorly with very large ones.  The writes are split
+	// between escape sequences where possible.  A size of zero or less
+	// (the default) sends each frame in a single write.
+	// Not defined for non-posix systems
+	SetFlushSize(n int)
+
+	// SetIdleTimeout makes the screen post an EventIdle when no input
+	// has arrived for the given time, so that an application can stop
+	// animating when nobody is using it.  When input next arrives, it
+	// is preceded by another EventIdle, for which Idle returns false.
+	// A timeout of zero or less (the default) turns this off again.
+	// Not defined for non-posix systems
+	SetIdleTimeout(d time.Duration)
+
+	// StartTicker makes the screen post an EventTick at the given
+	// interval, for animations that would otherwise need a goroutine
+	// of their own.  Ticks are not queued behind other events; if the
+	// queue is busy they are dropped, and the next EventTick reports
+	// how many were skipped.  Calling it again changes the interval,
+	// and an interval of zero or less stops the ticks.  In manual pump
+	// mode, ticks are posted from Tick, so they are only as accurate
+	// as the calls to it.
+	StartTicker(d time.Duration)
+
+	// SetSoftBlink makes the screen implement blinking text itself, for
+	// terminals where the blink attributes do nothing.  Cells with
+	// AttrBlink are shown for the given interval, then hidden for the
+	// same interval; cells with AttrRapidBlink at twice that rate.
+	// The terminal's own blink attributes are not used while this is
+	// in effect.  An interval of zero or less turns this off again.
+	// Not defined for non-posix systems
+	SetSoftBlink(interval time.Duration)
+
+	// SetAnimation makes cells set to the given style cycle through
+	// the styles of the animation, so that cursors and alerts can
+	// blink, or pulse in color, without the application setting their
+	// content again.  The style itself is only used to identify the
+	// cells.  An animation with fewer than two styles stops animating
+	// cells with that style.
+	// Not defined for non-posix systems
+	SetAnimation(style Style, anim AnimatedStyle)
+
+	// SetBoldAsBright enables or disables rendering the bright palette
+	// colors (8 through 15) as the corresponding base color with the
+	// bold attribute, which is how many legacy consoles display them.
+	// This only has an effect on terminals with fewer than 16 colors.
+	// Not defined for non-posix systems
+	SetBoldAsBright(bool)
+
+	// SetManualPump selects manual pump mode, which must be done before
+	// Init.  In this mode the screen starts no goroutines of its own,
+	// and never blocks, which suits js/wasm and embedding into event
+	// loops that do their own I/O.  Instead, the application reads its
+	// input, passes it to ProcessInput, and calls Tick periodically
+	// (every 50 milliseconds or so).  PollEvent returns nil rather than
+	// waiting when no event is queued, and the event queue is unbounded.
+	// AddInput is not supported in this mode.
+	// Not defined for non-posix systems
+	SetManualPump(bool)
+
+	// ProcessInput parses input data in manual pump mode, queueing
+	// any events found.  Incomplete escape sequences are held until
+	// more data arrives, or until a later Tick finds they have timed out.
+	ProcessInput(p []byte)
+
+	// Tick performs the periodic work that is otherwise done by the
+	// screen's own goroutines in manual pump mode: timing out escape
+	// sequences, handling window size changes, and software blink.
+	Tick()
+
+	// SetInline selects inline mode, which must be done before Init.
+	// Rather than taking over the alternate screen, the screen is just
+	// the bottom rows lines of the terminal, drawn below its existing
+	// contents, and left behind in the scrollback on Fini.  This suits
+	// REPLs and log followers that want a status area.  Zero restores
+	// the normal full screen mode.
+	// Not defined for non-posix systems
+	SetInline(rows int)
+
+	// Println commits text to the terminal's scrollback, above the live
+	// region in inline mode.  Each line of text becomes a line of
+	// output, after which the live region is redrawn below it.  Lines
+	// wider than the terminal wrap.  The text should not contain other
+	// control characters.  This returns ErrNotSupported if the screen
+	// is not in inline mode.
+	Println(text string) error
+
 	// SetPaste sets whether or not this screen should be expecting paste
 	// events. When paste is true, all key events with multiple bytes
 	// will be treated as pastes rather than as the user typing really
 	// fast. This is to enable a feature similar to Vim's "paste" option.
 	SetPaste(bool)
 
+	// SetRawPaste selects whether bracketed pastes are delivered exactly
+	// as sent by the terminal.  Normally the carriage returns that the
+	// terminal sends for line breaks are turned into newlines, as most
+	// applications expect, but multiplexers and REPLs may want the
+	// original bytes.  These are always available from EventPaste.Raw.
+	// Not defined for non-posix systems
+	SetRawPaste(bool)
+
+	// SetCombining selects whether combining marks typed after a rune
+	// are attached to its key event, where they can be found with
+	// EventKey.Runes, rather than being delivered as key events of their
+	// own.  To make this possible each rune is held back briefly, until
+	// more input arrives or the escape sequence timeout passes.
+	// Not defined for non-posix systems
+	SetCombining(bool)
+
 	// GetClipboard sends an OSC 52 escape sequence to the tty requesting
-	// that the clipboard contents be sent in base64 encoding.
-	GetClipboard(string) error
+	// that the contents of the register be sent in base64 encoding.  It
+	// returns ErrBadRegister if the register is not valid.
+	GetClipboard(ClipboardRegister) error
 
 	// SetClipboard sends an OSC 52 escape sequence to the tty with a base64
 	// encoded string requesting that the string be decoded and placed into
+	// the register.  It returns ErrBadRegister if the register is not valid.
+	SetClipboard(string, ClipboardRegister) error
+
+	// HasClipboard returns true if the screen is able to access the
+	// register.  For terminals this is a best guess, as there is no way
+	// to discover whether a terminal honors OSC 52, and many only offer
 	// the system clipboard.
-	SetClipboard(string, string) error
+	HasClipboard(ClipboardRegister) bool
+
+	// SetClipboardHistory keeps a history of the texts placed in the
+	// clipboard with SetClipboard, and of the text of pasted events as
+	// they are posted, so that applications can offer to paste from it.
+	// At most entries texts are kept, taking at most size bytes in all;
+	// the oldest are dropped to make room.  The history is off by
+	// default, and a limit of zero turns it off again, and empties it.
+	SetClipboardHistory(entries, size int)
+
+	// ClipboardHistory returns the texts in the clipboard history, most
+	// recent first.  A text that recurs is moved to the front, rather
+	// than being listed twice.
+	ClipboardHistory() []string
+
+	// QueryCursorPosition asks the terminal where the cursor is, and
+	// waits for the reply, for at most the timeout (a timeout of zero
+	// or less waits for a second).  It returns ErrQueryTimeout if the
+	// terminal does not reply in time, and ErrRestricted in restricted
+	// mode.  In inline mode, the position is relative to the top of the
+	// screen's rows.  The reply is read by the screen, not by the
+	// application, so this must not be called where it would stop input
+	// being read, as by the only caller of ProcessInput with a manual
+	// pump.
+	// Not defined for non-posix systems
+	QueryCursorPosition(timeout time.Duration) (x, y int, err error)
+
+	// QueryDefaultColors is like QueryCursorPosition, but asks the
+	// terminal for its default foreground and background colors, which
+	// are returned as RGB colors.  This can tell, for example, whether
+	// the background is light or dark.
+	// Not defined for non-posix systems
+	QueryDefaultColors(timeout time.Duration) (fg, bg Color, err error)
+
+	// QueryPaletteColor is like QueryDefaultColors, but asks for the
+	// color of an entry of the palette, from 0 to 255.
+	// Not defined for non-posix systems
+	QueryPaletteColor(index int, timeout time.Duration) (Color, error)
+
+	// QueryTermcap is like QueryCursorPosition, but asks the terminal
+	// for the value of one of its terminfo capabilities, such as "Tc"
+	// or "colors", with XTGETTCAP.  It returns false if the terminal
+	// does not know the capability.  Values are returned as they are
+	// sent, so a number is in decimal, and a string is not unescaped.
+	// Not defined for non-posix systems
+	QueryTermcap(name string, timeout time.Duration) (value string, ok bool, err error)
 
 	// Beep attempts to sound an OS-dependent audible alert and returns an error
 	// when unsuccessful.
@@ -0,0 +1,78 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Find searches each row of the buffer for the regular expression, and
+// returns the cells of each match, in order from the top left.  A row is
+// searched as a line of text, with each wide character once, combining
+// characters after the characters they belong to, and no newline; so
+// matches never span rows, and each is a Rect one row high.  The Rect
+// covers both cells of a wide character that is part of the match.
+// Empty matches are not returned.  The result can be passed to
+// SetHighlight or SetSelection.
+func (cb *CellBuffer) Find(re *regexp.Regexp) []Rect {
+	var rects []Rect
+	var sb strings.Builder
+	var starts, cells []int
+	for y := 0; y < cb.h; y++ {
+		// Record where the text of each cell starts.
+		sb.Reset()
+		starts, cells = starts[:0], cells[:0]
+		for x := 0; x < cb.w; {
+			mainc, combc, _, width := cb.GetContent(x, y)
+			starts = append(starts, sb.Len())
+			cells = append(cells, x)
+			sb.WriteRune(mainc)
+			for _, r := range combc {
+				sb.WriteRune(r)
+			}
+			x += width
+		}
+		starts = append(starts, sb.Len())
+		cells = append(cells, cb.w)
+
+		for _, m := range re.FindAllStringIndex(sb.String(), -1) {
+			if m[0] == m[1] {
+				continue
+			}
+			first, last := 0, 0
+			for i := range starts {
+				if starts[i] <= m[0] {
+					first = i
+				}
+				if starts[i] < m[1] {
+					last = i
+				}
+			}
+			rects = append(rects, Rect{
+				X:      cells[first],
+				Y:      y,
+				Width:  cells[last+1] - cells[first],
+				Height: 1,
+			})
+		}
+	}
+	return rects
+}
+
+// FindString is like Find, but searches for the literal text s.
+func (cb *CellBuffer) FindString(s string) []Rect {
+	return cb.Find(regexp.MustCompile(regexp.QuoteMeta(s)))
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"strings"
+	"unicode"
+)
+
+// selection is a highlight drawn over the contents of a CellBuffer,
+// without changing them.  This is used by Screen implementors to provide
+// SetSelection.  It has no lock of its own, as it is only used with the
+// screen's lock held.  The zero value has nothing selected.
+type selection struct {
+	rects []Rect
+	style Style
+}
+
+// set replaces the selection, marking the cells that change dirty.
+func (sel *selection) set(cb *CellBuffer, rects []Rect, style Style) {
+	sel.mark(cb)
+	sel.rects = append([]Rect(nil), rects...)
+	sel.style = style
+	sel.mark(cb)
+}
+
+// mark marks the selected cells dirty.  The cell to the left of each
+// rectangle is included, in case it is a wide character that overlaps.
+func (sel *selection) mark(cb *CellBuffer) {
+	w, h := cb.Size()
+	for _, r := range sel.rects {
+		r.X--
+		r.Width++
+		r = r.Intersect(Rect{Width: w, Height: h})
+		for y := r.Y; y < r.Y+r.Height; y++ {
+			for x := r.X; x < r.X+r.Width; x++ {
+				cb.SetDirty(x, y, true)
+			}
+		}
+	}
+}
+
+func (sel *selection) contains(x, y int) bool {
+	for _, r := range sel.rects {
+		if r.Contains(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the style to draw the cell at x, y with.  A selection
+// style of StyleDefault shows the selection in reverse video; otherwise
+// its colors replace those of the cell, and its attributes are added.
+func (sel *selection) apply(x, y, width int, style Style) Style {
+	if len(sel.rects) == 0 {
+		return style
+	}
+	if !sel.contains(x, y) && (width < 2 || !sel.contains(x+1, y)) {
+		return style
+	}
+	if sel.style == StyleDefault {
+		return style.Reverse(style.attrs&AttrReverse == 0)
+	}
+	if sel.style.fg != ColorDefault {
+		style.fg = sel.style.fg
+	}
+	if sel.style.bg != ColorDefault {
+		style.bg = sel.style.bg
+	}
+	style.attrs |= sel.style.attrs
+	return style
+}
+
+// Text returns the text of the cells within the rectangles, with a line
+// for each row that has any, in order from the top.  A wide character is
+// included if either of its cells is.  Combining characters are kept,
+// and spaces at the ends of lines are removed.
+func (cb *CellBuffer) Text(rects ...Rect) string {
+	sel := selection{rects: rects}
+	var lines []string
+	var sb strings.Builder
+	for y := 0; y < cb.h; y++ {
+		found := false
+		sb.Reset()
+		for x := 0; x < cb.w; x++ {
+			mainc, combc, _, width := cb.GetContent(x, y)
+			if sel.contains(x, y) || (width > 1 && sel.contains(x+1, y)) {
+				found = true
+				sb.WriteRune(mainc)
+				for _, r := range combc {
+					sb.WriteRune(r)
+				}
+			}
+			x += width - 1
+		}
+		if found {
+			lines = append(lines, strings.TrimRight(sb.String(), " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LinearSelection returns the rectangles covering the text from (x0, y0)
+// through (x1, y1) inclusive, running from one line to the next as text
+// does, on a screen of the given width.  The two ends may be given in
+// either order.  This is the usual form of a selection made by dragging
+// the mouse, and the result can be passed to SetSelection.
+func LinearSelection(x0, y0, x1, y1, width int) []Rect {
+	if y1 < y0 || (y1 == y0 && x1 < x0) {
+		x0, y0, x1, y1 = x1, y1, x0, y0
+	}
+	if y0 == y1 {
+		return []Rect{{X: x0, Y: y0, Width: x1 - x0 + 1, Height: 1}}
+	}
+	rects := []Rect{{X: x0, Y: y0, Width: width - x0, Height: 1}}
+	if y1-y0 > 1 {
+		rects = append(rects, Rect{X: 0, Y: y0 + 1, Width: width, Height: y1 - y0 - 1})
+	}
+	return append(rects, Rect{X: 0, Y: y1, Width: x1 + 1, Height: 1})
+}
+
+// LineSelection returns the rectangle covering whole lines from y0 through
+// y1 inclusive, in either order, on a screen of the given width.  This is
+// the usual form of a selection made with a triple click.
+func LineSelection(y0, y1, width int) []Rect {
+	if y1 < y0 {
+		y0, y1 = y1, y0
+	}
+	return []Rect{{X: 0, Y: y0, Width: width, Height: y1 - y0 + 1}}
+}
+
+// Line returns the text of row y, as Text would for a selection of the
+// whole row.  Each wide character appears once.
+func (cb *CellBuffer) Line(y int) string {
+	return cb.Text(Rect{Y: y, Width: cb.w, Height: 1})
+}
+
+// wordClass returns the class of a rune for WordSelection.  Letters,
+// digits, combining marks and the runes of wordchars are all part of
+// words; so too are blanks, which form words of spaces.  Any other rune
+// is a class of its own, so that a run of the same punctuation is a word.
+func wordClass(r rune, wordchars string) rune {
+	switch {
+	case r == ' ' || unicode.IsSpace(r):
+		return ' '
+	case unicode.In(r, unicode.Letter, unicode.Digit, unicode.Mark):
+		return 'a'
+	case strings.ContainsRune(wordchars, r):
+		return 'a'
+	}
+	return r
+}
+
+// WordSelection returns the rectangle covering the word that the cell at
+// (x, y) is part of, on that row.  This is the usual form of a selection
+// made with a double click.  A word is a run of letters, digits and the
+// runes of wordchars, such as "_-./" to take in file names; a run of
+// blanks; or a run of some other single rune.  A wide character counts as
+// one rune, and the rectangle covers both of its cells.  The result is
+// empty if the cell is not in the buffer.
+func (cb *CellBuffer) WordSelection(x, y int, wordchars string) Rect {
+	if x < 0 || y < 0 || x >= cb.w || y >= cb.h {
+		return Rect{}
+	}
+
+	// Find the start of each glyph on the row, and the one at x.
+	type glyph struct {
+		x     int
+		class rune
+	}
+	var glyphs []glyph
+	at := 0
+	for cx := 0; cx < cb.w; {
+		mainc, _, _, width := cb.GetContent(cx, y)
+		if cx <= x {
+			at = len(glyphs)
+		}
+		glyphs = append(glyphs, glyph{cx, wordClass(mainc, wordchars)})
+		cx += width
+	}
+
+	class := glyphs[at].class
+	first, last := at, at
+	for first > 0 && glyphs[first-1].class == class {
+		first--
+	}
+	for last < len(glyphs)-1 && glyphs[last+1].class == class {
+		last++
+	}
+	end := cb.w
+	if last < len(glyphs)-1 {
+		end = glyphs[last+1].x
+	}
+	return Rect{X: glyphs[first].x, Y: y, Width: end - glyphs[first].x, Height: 1}
+}
@@ -0,0 +1,315 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"fmt"
+	"time"
+)
+
+// SelfTestResult is the outcome of testing a feature with SelfTest.
+type SelfTestResult struct {
+	// Feature names the feature, such as "italic" or "mouse".
+	Feature string
+
+	// Expected is true if the screen reports having the feature, with
+	// Has, Colors, SupportedAttrs or CanDisplay.
+	Expected bool
+
+	// Works is true if the feature was seen to work.
+	Works bool
+
+	// Skipped is true if the feature was not tested, because the user
+	// skipped it, or stopped the test before it.
+	Skipped bool
+}
+
+// String describes the result, noting where it differs from what the
+// screen reports.
+func (r SelfTestResult) String() string {
+	switch {
+	case r.Skipped:
+		return r.Feature + ": skipped"
+	case r.Works && !r.Expected:
+		return r.Feature + ": works, but is not reported"
+	case r.Works:
+		return r.Feature + ": works"
+	case r.Expected:
+		return r.Feature + ": does not work, but is reported"
+	}
+	return r.Feature + ": does not work"
+}
+
+// selfTestClipWait is how long SelfTest waits for the terminal to send
+// the clipboard, as terminals that do not support it say nothing.
+const selfTestClipWait = 2 * time.Second
+
+// SelfTest tests the features of the screen interactively, and returns
+// what it found, so that an application can offer it as a diagnostic
+// mode, such as a --term-test option, for users to run when something
+// looks wrong.  Colors, attributes and wide characters are drawn, and
+// the user is asked whether they look right; the mouse, paste and the
+// clipboard are tested by asking the user to use them.  Each result
+// records whether the screen claims to have the feature, so that where
+// its detection is wrong can be reported.
+//
+// The screen must be initialized, and the application must not read
+// events while the test runs.  The user can skip a feature with Esc, or
+// stop the test with Ctrl-C.  The mouse and bracketed paste are enabled
+// for their tests, and then put back as they were, and the screen is left
+// cleared.
+func SelfTest(s Screen) []SelfTestResult {
+	st := &selfTest{s: s}
+	defer s.Clear()
+
+	n := s.Colors()
+	if n > 16 {
+		n = 16
+	}
+	st.ask("16 colors", s.Colors() >= 16,
+		fmt.Sprintf("Are there %d different colors?", n), func(y int) {
+			for i := 0; i < n; i++ {
+				st.put(i*3, y, "   ", StyleDefault.Background(PaletteColor(i)))
+			}
+		})
+	st.ask("256 colors", s.Colors() >= 256,
+		"Is this a smooth ramp of grays?", func(y int) {
+			for i := 232; i < 256; i++ {
+				st.put((i-232)*2, y, "  ", StyleDefault.Background(PaletteColor(i)))
+			}
+		})
+	st.ask("24-bit color", s.Has(CapTrueColor),
+		"Is this a smooth ramp, without bands?", func(y int) {
+			w, _ := s.Size()
+			for x := 0; x < w; x++ {
+				v := int32(x * 255 / w)
+				st.put(x, y, " ", StyleDefault.Background(NewRGBColor(v, 0, 255-v)))
+			}
+		})
+
+	supported := s.SupportedAttrs()
+	for _, a := range []struct {
+		name string
+		attr AttrMask
+	}{
+		{"bold", AttrBold},
+		{"dim", AttrDim},
+		{"italic", AttrItalic},
+		{"underline", AttrUnderline},
+		{"reverse", AttrReverse},
+		{"blink", AttrBlink},
+		{"rapid blink", AttrRapidBlink},
+		{"strikethrough", AttrStrikeThrough},
+	} {
+		attr := a.attr
+		st.ask(a.name, supported&attr != 0,
+			fmt.Sprintf("Is the second sample %s?", a.name), func(y int) {
+				st.put(0, y, "Sample text", StyleDefault)
+				st.put(14, y, "Sample text", StyleDefault.setAttrs(attr, true))
+			})
+	}
+
+	st.ask("wide characters", s.CanDisplay('世', false),
+		"Do the bars line up?", func(y int) {
+			st.put(0, y, "|世界|", StyleDefault)
+			st.put(0, y+1, "|1234|", StyleDefault)
+		})
+
+	mouse := s.MouseEnabled()
+	s.EnableMouse()
+	st.await("mouse", s.Has(CapMouse), "Click anywhere.", func(ev Event) bool {
+		ev2, ok := ev.(*EventMouse)
+		return ok && ev2.Buttons()&(Button1|Button2|Button3) != 0
+	}, nil)
+	if !mouse {
+		s.DisableMouse()
+	}
+
+	paste := s.PasteEnabled()
+	s.EnablePaste()
+	st.await("paste", s.Has(CapPaste), "Paste some text.", func(ev Event) bool {
+		_, ok := ev.(*EventPaste)
+		return ok
+	}, nil)
+	if !paste {
+		s.DisablePaste()
+	}
+
+	// Terminals deliver the clipboard as a paste.
+	text := fmt.Sprintf("tcell self test %d", time.Now().Unix())
+	st.await("clipboard", s.Has(CapClipboard), "Reading the clipboard...", func(ev Event) bool {
+		ev2, ok := ev.(*EventPaste)
+		return ok && ev2.Text() == text
+	}, func() error {
+		if err := s.SetClipboard(text, ClipboardSystem); err != nil {
+			return err
+		}
+		if err := s.GetClipboard(ClipboardSystem); err != nil {
+			return err
+		}
+		step := st.step
+		st.timer = time.AfterFunc(selfTestClipWait, func() {
+			s.PostEvent(&selfTestTimeout{t: time.Now(), step: step})
+		})
+		return nil
+	})
+	if st.timer != nil {
+		st.timer.Stop()
+	}
+
+	return st.results
+}
+
+type selfTest struct {
+	s       Screen
+	results []SelfTestResult
+	step    int
+	quit    bool
+	timer   *time.Timer
+}
+
+// selfTestTimeout ends a step of SelfTest that waits for the terminal.
+type selfTestTimeout struct {
+	t    time.Time
+	step int
+}
+
+func (ev *selfTestTimeout) When() time.Time {
+	return ev.t
+}
+
+func (ev *selfTestTimeout) EscSeq() string {
+	return ""
+}
+
+// put draws the string, with a cell for each character.
+func (st *selfTest) put(x, y int, str string, style Style) {
+	for _, r := range str {
+		st.s.SetContent(x, y, r, nil, style)
+		x += RuneWidth(r)
+	}
+}
+
+// show draws a step: the feature's name, the sample drawn by the
+// function, and the prompt.
+func (st *selfTest) show(feature, prompt, keys string, sample func(y int)) {
+	st.s.Clear()
+	st.put(0, 0, fmt.Sprintf("Terminal test %d: %s", st.step, feature), StyleDefault.Bold(true))
+	if sample != nil {
+		sample(2)
+	}
+	st.put(0, 5, prompt, StyleDefault)
+	st.put(0, 6, keys, StyleDefault.Dim(true))
+	st.s.Show()
+}
+
+// next reads the next event of the step, redrawing the step after a
+// resize.  It returns the event, and false if the step was skipped, or
+// the test stopped, in which case the result has been recorded.
+func (st *selfTest) next(res *SelfTestResult, redraw func()) (Event, bool) {
+	for {
+		ev := st.s.PollEvent()
+		switch ev := ev.(type) {
+		case nil:
+			st.quit = true
+		case *EventResize:
+			st.s.Sync()
+			redraw()
+			continue
+		case *EventKey:
+			switch ev.Key() {
+			case KeyCtrlC:
+				st.quit = true
+			case KeyEsc:
+				res.Skipped = true
+				st.results = append(st.results, *res)
+				return nil, false
+			}
+		}
+		if st.quit {
+			res.Skipped = true
+			st.results = append(st.results, *res)
+			return nil, false
+		}
+		return ev, true
+	}
+}
+
+// ask shows a sample of the feature, and asks the user whether it looks
+// right.
+func (st *selfTest) ask(feature string, expected bool, question string, sample func(y int)) {
+	st.step++
+	res := SelfTestResult{Feature: feature, Expected: expected, Skipped: st.quit}
+	if st.quit {
+		st.results = append(st.results, res)
+		return
+	}
+	redraw := func() {
+		st.show(feature, question, "y: yes  n: no  Esc: skip  Ctrl-C: stop", sample)
+	}
+	redraw()
+	for {
+		ev, ok := st.next(&res, redraw)
+		if !ok {
+			return
+		}
+		if ev, ok := ev.(*EventKey); ok && ev.Key() == KeyRune {
+			switch ev.Rune() {
+			case 'y', 'Y':
+				res.Works = true
+				fallthrough
+			case 'n', 'N':
+				st.results = append(st.results, res)
+				return
+			}
+		}
+	}
+}
+
+// await asks the user to use the feature, and waits for an event that
+// shows it working.  The start function, if not nil, is called once the
+// prompt is shown; if it fails, the feature does not work, and there is
+// nothing to wait for.
+func (st *selfTest) await(feature string, expected bool, prompt string, match func(Event) bool, start func() error) {
+	st.step++
+	res := SelfTestResult{Feature: feature, Expected: expected, Skipped: st.quit}
+	if st.quit {
+		st.results = append(st.results, res)
+		return
+	}
+	redraw := func() {
+		st.show(feature, prompt, "Esc: skip  Ctrl-C: stop", nil)
+	}
+	redraw()
+	if start != nil && start() != nil {
+		st.results = append(st.results, res)
+		return
+	}
+	for {
+		ev, ok := st.next(&res, redraw)
+		if !ok {
+			return
+		}
+		if to, ok := ev.(*selfTestTimeout); ok && to.step == st.step {
+			st.results = append(st.results, res)
+			return
+		}
+		if match(ev) {
+			res.Works = true
+			st.results = append(st.results, res)
+			return
+		}
+	}
+}
@@ -15,7 +15,14 @@
 package tcell
 
 import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"regexp"
 	"testing"
+
+	"golang.org/x/text/encoding/charmap"
 )
 
 func mkTestScreen(t *testing.T, charset string) SimulationScreen {
@@ -110,6 +117,187 @@ func TestResize(t *testing.T) {
 	}
 }
 
+func TestRequestResize(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	if e := s.RequestResize(0, 12); e != ErrNotSupported {
+		t.Errorf("Expected ErrNotSupported for zero width, got %v", e)
+	}
+	if e := s.RequestResize(40, 12); e != nil {
+		t.Fatalf("RequestResize failed: %v", e)
+	}
+	if w, h := s.Size(); w != 40 || h != 12 {
+		t.Errorf("Size should be 40, 12, was %v, %v", w, h)
+	}
+	ev, ok := s.PollEvent().(*EventResize)
+	if !ok {
+		t.Fatalf("Expected resize event")
+	}
+	if w, h := ev.Size(); w != 40 || h != 12 {
+		t.Errorf("Resize event should be 40, 12, was %v, %v", w, h)
+	}
+}
+
+func TestReinit(t *testing.T) {
+	s := mkTestScreen(t, "")
+	s.Fini()
+	s.Fini() // harmless
+
+	if e := s.Init(); e != nil {
+		t.Fatalf("Failed to reinitialize: %v", e)
+	}
+	defer s.Fini()
+	if x, y := s.Size(); x != 80 || y != 25 {
+		t.Errorf("Size should be 80, 25, was %v, %v", x, y)
+	}
+	s.InjectKey(KeyEnter, 0, ModNone)
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Key() != KeyEnter {
+		t.Errorf("Expected enter key, got %v", ev)
+	}
+}
+
+func TestMouseRegions(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.RegisterRegion("list", Rect{X: 0, Y: 0, Width: 20, Height: 10})
+	s.RegisterRegion("popup", Rect{X: 5, Y: 5, Width: 10, Height: 3})
+
+	check := func(x, y int, id string, rx, ry int) {
+		t.Helper()
+		s.InjectMouse(x, y, Button1, ModNone)
+		ev, ok := s.PollEvent().(*EventMouse)
+		if !ok {
+			t.Fatalf("Expected mouse event")
+		}
+		if ev.Region() != id {
+			t.Errorf("At %d,%d expected region %q, got %q", x, y, id, ev.Region())
+		}
+		if x, y := ev.RegionPosition(); x != rx || y != ry {
+			t.Errorf("Expected region position %d,%d, got %d,%d", rx, ry, x, y)
+		}
+	}
+	check(1, 1, "list", 1, 1)
+	check(6, 6, "popup", 1, 1)
+	check(30, 2, "", 30, 2)
+
+	s.UnregisterRegion("popup")
+	check(6, 6, "list", 6, 6)
+}
+
+func TestClipboard(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.InjectClipboard("outside", ClipboardSystem)
+	if e := s.SetClipboard("yanked", ClipboardPrimary); e != nil {
+		t.Fatalf("SetClipboard failed: %v", e)
+	}
+	if s.GetClipboardContents(ClipboardPrimary) != "yanked" {
+		t.Errorf("Primary selection not stored")
+	}
+
+	for reg, text := range map[ClipboardRegister]string{
+		ClipboardSystem:  "outside",
+		ClipboardPrimary: "yanked",
+		ClipboardCut0:    "",
+	} {
+		if e := s.GetClipboard(reg); e != nil {
+			t.Fatalf("GetClipboard failed: %v", e)
+		}
+		ev, ok := s.PollEvent().(*EventPaste)
+		if !ok {
+			t.Fatalf("Expected paste event")
+		}
+		if ev.Text() != text {
+			t.Errorf("Expected %q in %q, got %q", text, reg, ev.Text())
+		}
+	}
+
+	if s.HasClipboard("x") || s.GetClipboard("x") != ErrBadRegister {
+		t.Errorf("Invalid register accepted")
+	}
+}
+
+func TestSelection(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetSize(10, 3)
+	s.SetContent(0, 0, 'a', nil, StyleDefault)
+	s.SetContent(1, 0, 'b', nil, StyleDefault)
+	s.SetContent(2, 0, '世', nil, StyleDefault)
+	s.SetContent(4, 0, 'c', nil, StyleDefault)
+	s.SetContent(5, 0, 'd', nil, StyleDefault)
+	s.SetContent(0, 1, 'e', []rune{'\u0301'}, StyleDefault)
+	s.SetContent(1, 1, 'f', nil, StyleDefault)
+	s.Show()
+
+	// Only the right half of the wide character is selected.
+	s.SetSelection(LinearSelection(3, 0, 0, 1, 10), StyleDefault)
+	s.Show()
+	cells, w, _ := s.GetContents()
+	if _, _, a := cells[2].Style.Decompose(); a&AttrReverse == 0 {
+		t.Errorf("Wide character not highlighted")
+	}
+	if _, _, a := cells[w].Style.Decompose(); a&AttrReverse == 0 {
+		t.Errorf("Second line not highlighted")
+	}
+	if _, _, a := cells[w+1].Style.Decompose(); a&AttrReverse != 0 {
+		t.Errorf("Unselected cell highlighted")
+	}
+	if _, _, st, _ := s.GetContent(2, 0); st != StyleDefault {
+		t.Errorf("Selection changed the cell style")
+	}
+	if txt := s.SelectedText(); txt != "世cd\ne\u0301" {
+		t.Errorf("Bad selected text %q", txt)
+	}
+
+	s.SetSelection(nil, StyleDefault)
+	s.Show()
+	cells, _, _ = s.GetContents()
+	if _, _, a := cells[2].Style.Decompose(); a&AttrReverse != 0 {
+		t.Errorf("Highlight not removed")
+	}
+	if s.SelectedText() != "" {
+		t.Errorf("Expected no selected text")
+	}
+}
+
+func TestMultipleCursors(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetSize(5, 2)
+	s.ShowCursors(
+		Cursor{X: 0, Y: 0},
+		Cursor{X: 2, Y: 0, Style: CursorStyleBlock},
+		Cursor{X: 3, Y: 1, Style: CursorStyleUnderline})
+	s.Show()
+
+	if x, y, vis := s.GetCursor(); x != 0 || y != 0 || !vis {
+		t.Errorf("Bad primary cursor %d,%d %v", x, y, vis)
+	}
+	cells, w, _ := s.GetContents()
+	if _, _, a := cells[2].Style.Decompose(); a&AttrReverse == 0 {
+		t.Errorf("Block cursor not drawn")
+	}
+	if _, _, a := cells[w+3].Style.Decompose(); a&AttrUnderline == 0 {
+		t.Errorf("Underline cursor not drawn")
+	}
+	if _, _, a := cells[0].Style.Decompose(); a != 0 {
+		t.Errorf("Primary cursor should not be drawn in software")
+	}
+
+	s.ShowCursor(1, 1)
+	s.Show()
+	cells, _, _ = s.GetContents()
+	if _, _, a := cells[2].Style.Decompose(); a != 0 {
+		t.Errorf("Secondary cursor not removed")
+	}
+}
+
 func TestBeep(t *testing.T) {
 	s := mkTestScreen(t, "")
 	defer s.Fini()
@@ -150,3 +338,496 @@ func TestBeep(t *testing.T) {
 		}
 	}
 }
+
+func TestMirrorDiffs(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetContent(1, 1, 'a', nil, StyleDefault)
+	s.Show()
+	pr, pw := io.Pipe()
+	if e := s.MirrorDiffs(pw); e != nil {
+		t.Fatalf("MirrorDiffs failed: %v", e)
+	}
+	s.SetContent(2, 1, 'b', nil, StyleDefault.Italic(true))
+	s.Show()
+
+	var cb CellBuffer
+	r := bufio.NewReader(pr)
+	for i := 0; i < 2; i++ {
+		if e := DecodeDiff(r, &cb); e != nil {
+			t.Fatalf("Frame %d: %v", i, e)
+		}
+	}
+	if m, _, _, _ := cb.GetContent(1, 1); m != 'a' {
+		t.Errorf("Initial frame missing content, got %q", m)
+	}
+	if m, _, st, _ := cb.GetContent(2, 1); m != 'b' || st != StyleDefault.Italic(true) {
+		t.Errorf("Change not sent, got %q %v", m, st)
+	}
+	s.UnmirrorDiffs(pw)
+}
+
+func TestMinSize(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetSize(20, 5)
+	s.SetContent(0, 0, 'a', nil, StyleDefault)
+	s.SetMinSize(30, 5)
+	if ev, ok := s.PollEvent().(*EventTooSmall); !ok || !ev.TooSmall() {
+		t.Fatalf("No event for becoming too small")
+	}
+	s.Show()
+	row := func(y int) string {
+		cells, w, _ := s.GetContents()
+		str := ""
+		for _, c := range cells[y*w : (y+1)*w] {
+			str += string(c.Runes)
+		}
+		return str
+	}
+	if got := row(1); got != " terminal too small " {
+		t.Errorf("Notice not shown: %q", got)
+	}
+	if got := row(2); got != "    (need 30x5)     " {
+		t.Errorf("Notice not wrapped: %q", got)
+	}
+	if got := row(0); got[0] != ' ' {
+		t.Errorf("Application drawn while too small: %q", got)
+	}
+
+	s.SetSize(30, 5)
+	s.Show()
+	if ev, ok := s.PollEvent().(*EventTooSmall); !ok || ev.TooSmall() {
+		t.Fatalf("No event for becoming large enough")
+	}
+	if got := row(0); got[0] != 'a' || row(1)[1] == 't' {
+		t.Errorf("Application not restored: %q %q", got, row(1))
+	}
+}
+
+func TestOnResize(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	calls := 0
+	s.OnResize(func(w, h int) {
+		calls++
+		s.Clear()
+		s.SetContent(w-1, h-1, 'z', nil, StyleDefault)
+	})
+	s.Show()
+	if calls != 0 {
+		t.Errorf("Called without a change of size")
+	}
+	s.SetSize(10, 4)
+	s.Show()
+	if calls != 1 {
+		t.Fatalf("Called %d times, expected once", calls)
+	}
+	cells, w, h := s.GetContents()
+	if r := cells[w*h-1].Runes; len(r) != 1 || r[0] != 'z' {
+		t.Errorf("Layout not drawn with the new size: %q", r)
+	}
+	s.Show()
+	if calls != 1 {
+		t.Errorf("Called again without a change of size")
+	}
+}
+
+func TestSplitEncodings(t *testing.T) {
+	s := NewSimulationScreen("UTF-8")
+	if e := s.SetOutputEncoding("US-ASCII"); e != nil {
+		t.Fatalf("SetOutputEncoding failed: %v", e)
+	}
+	if e := s.SetInputEncoding("no-such-charset"); e != ErrNoCharset {
+		t.Errorf("Unknown charset accepted: %v", e)
+	}
+	if e := s.Init(); e != nil {
+		t.Fatalf("Failed to initialize screen: %v", e)
+	}
+	defer s.Fini()
+
+	if cs := s.CharacterSet(); cs != "US-ASCII" {
+		t.Errorf("Character set %q, not the output one", cs)
+	}
+	s.SetContent(0, 0, 'é', nil, StyleDefault)
+	s.Show()
+	if cells, _, _ := s.GetContents(); string(cells[0].Bytes) == "é" {
+		t.Errorf("Output not encoded as US-ASCII: %q", cells[0].Bytes)
+	}
+	s.InjectKeyBytes([]byte("é"))
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Rune() != 'é' {
+		t.Errorf("Input not decoded as UTF-8: %v", ev)
+	}
+}
+
+func TestCursorState(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetSize(5, 2)
+	s.ShowCursors(Cursor{X: 1, Y: 1}, Cursor{X: 3, Y: 0, Style: CursorStyleBlock})
+	s.PushCursorState()
+	s.PushCursorState()
+	s.HideCursor()
+	s.Show()
+	if _, _, vis := s.GetCursor(); vis {
+		t.Errorf("Cursor not hidden")
+	}
+
+	s.PopCursorState()
+	s.Show()
+	if x, y, vis := s.GetCursor(); x != 1 || y != 1 || !vis {
+		t.Errorf("Bad restored cursor %d,%d %v", x, y, vis)
+	}
+	cells, _, _ := s.GetContents()
+	if _, _, a := cells[3].Style.Decompose(); a&AttrReverse == 0 {
+		t.Errorf("Secondary cursor not restored")
+	}
+
+	s.HideCursor()
+	s.PopCursorState()
+	s.PopCursorState()
+	s.Show()
+	if x, y, vis := s.GetCursor(); x != 1 || y != 1 || !vis {
+		t.Errorf("Bad cursor after popping too often %d,%d %v", x, y, vis)
+	}
+}
+
+func TestSimulationState(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.ShowCursorStyle(1, 1, CursorStyleBar)
+	if cs := s.GetCursorStyle(); cs != CursorStyleBar {
+		t.Errorf("Bad cursor style %v", cs)
+	}
+	if _, set := s.GetCursorBlink(); set {
+		t.Errorf("Cursor blink set by default")
+	}
+	s.SetCursorBlink(true)
+	if blink, set := s.GetCursorBlink(); !blink || !set {
+		t.Errorf("Cursor blink not recorded")
+	}
+
+	s.EnableMouse()
+	s.EnablePaste()
+	if !s.MouseEnabled() || !s.PasteEnabled() {
+		t.Errorf("Mouse or paste not enabled")
+	}
+	s.DisableMouse()
+	if s.MouseEnabled() {
+		t.Errorf("Mouse not disabled")
+	}
+
+	s.InjectPaste("hello")
+	if ev, ok := s.PollEvent().(*EventPaste); !ok || ev.Text() != "hello" {
+		t.Errorf("Bad paste event %v", ev)
+	}
+
+	s.Beep()
+	s.Beep()
+	if n := s.Beeps(); n != 2 {
+		t.Errorf("Expected 2 beeps, got %d", n)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	m := NewMacros(s)
+	if _, ok := m.StopRecording(); ok {
+		t.Errorf("Stopped a recording that was not started")
+	}
+	m.StartRecording("q")
+	if name, ok := m.Recording(); !ok || name != "q" {
+		t.Errorf("Bad recording state %q %v", name, ok)
+	}
+	s.InjectKey(KeyRune, 'a', ModNone)
+	s.InjectResize()
+	s.InjectMouse(1, 2, Button1, ModNone)
+	s.InjectKey(KeyEsc, 0, ModNone)
+	for i := 0; i < 4; i++ {
+		s.PollEvent()
+	}
+	if name, ok := m.StopRecording(); !ok || name != "q" {
+		t.Errorf("Bad stop %q %v", name, ok)
+	}
+	if n := len(m.Events("q")); n != 3 {
+		t.Fatalf("Expected 3 events recorded, got %d", n)
+	}
+	m.Trim("q", 1)
+
+	var buf bytes.Buffer
+	if err := m.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	m2 := NewMacros(s)
+	if err := m2.Load(&buf); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if names := m2.Names(); len(names) != 1 || names[0] != "q" {
+		t.Errorf("Bad names after load %v", names)
+	}
+
+	if err := m2.Replay("x", 0); err != ErrNoMacro {
+		t.Errorf("Expected ErrNoMacro, got %v", err)
+	}
+	if err := m2.Replay("q", 0); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Rune() != 'a' || !ev.Synthetic() {
+		t.Errorf("Bad replayed key %v", ev)
+	}
+	if ev, ok := s.PollEvent().(*EventMouse); !ok || ev.Buttons() != Button1 {
+		t.Errorf("Bad replayed mouse %v", ev)
+	}
+}
+
+func TestClipboardHistory(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetClipboard("off", ClipboardSystem)
+	if h := s.ClipboardHistory(); len(h) != 0 {
+		t.Errorf("History kept while off: %q", h)
+	}
+
+	s.SetClipboardHistory(3, 10)
+	s.SetClipboard("one", ClipboardSystem)
+	s.PostEvent(NewEventPaste("two", ""))
+	s.SetClipboard("one", ClipboardPrimary)
+	s.SetClipboard("much too long", ClipboardSystem)
+	if h := s.ClipboardHistory(); !reflect.DeepEqual(h, []string{"one", "two"}) {
+		t.Errorf("Bad history %q", h)
+	}
+
+	// The total size limit drops the oldest first.
+	s.SetClipboard("three", ClipboardSystem)
+	if h := s.ClipboardHistory(); !reflect.DeepEqual(h, []string{"three", "one"}) {
+		t.Errorf("Bad history after size limit %q", h)
+	}
+	s.SetClipboardHistory(1, 10)
+	if h := s.ClipboardHistory(); !reflect.DeepEqual(h, []string{"three"}) {
+		t.Errorf("Bad history after count limit %q", h)
+	}
+	s.SetClipboardHistory(0, 0)
+	if h := s.ClipboardHistory(); len(h) != 0 {
+		t.Errorf("History not emptied: %q", h)
+	}
+
+	// A paste that could not be posted was never seen, so is not kept.
+	s.SetClipboardHistory(3, 10)
+	for s.PostEvent(NewEventPaste("", "")) == nil {
+	}
+	if e := s.PostEvent(NewEventPaste("lost", "")); e != ErrEventQFull {
+		t.Fatalf("Expected ErrEventQFull, got %v", e)
+	}
+	if h := s.ClipboardHistory(); len(h) != 0 {
+		t.Errorf("Unposted paste in history: %q", h)
+	}
+}
+
+func TestFindHighlight(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetSize(10, 2)
+	for i, r := range "log: err" {
+		s.SetContent(i, 0, r, nil, StyleDefault)
+	}
+	for i, r := range "error x" {
+		s.SetContent(i, 1, r, nil, StyleDefault)
+	}
+	s.Show()
+
+	found := s.Find(regexp.MustCompile(`err\w*`))
+	want := []Rect{{X: 5, Y: 0, Width: 3, Height: 1}, {X: 0, Y: 1, Width: 5, Height: 1}}
+	if !reflect.DeepEqual(found, want) {
+		t.Fatalf("Bad matches %v, want %v", found, want)
+	}
+
+	hl := StyleDefault.Background(ColorYellow)
+	s.SetHighlight(found, hl)
+	s.SetSelection([]Rect{{X: 0, Y: 1, Width: 1, Height: 1}}, StyleDefault)
+	s.Show()
+	cells, w, _ := s.GetContents()
+	if _, bg, _ := cells[5].Style.Decompose(); bg != ColorYellow {
+		t.Errorf("Match not highlighted")
+	}
+	if _, bg, a := cells[w].Style.Decompose(); bg != ColorYellow || a&AttrReverse == 0 {
+		t.Errorf("Selection not drawn over highlight")
+	}
+	if _, bg, _ := cells[4].Style.Decompose(); bg == ColorYellow {
+		t.Errorf("Cell outside match highlighted")
+	}
+
+	s.SetHighlight(nil, hl)
+	s.Show()
+	cells, _, _ = s.GetContents()
+	if _, bg, _ := cells[5].Style.Decompose(); bg == ColorYellow {
+		t.Errorf("Highlight not removed")
+	}
+}
+
+func TestLinearize(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+
+	s.SetSize(12, 4)
+	put := func(x, y int, text string) {
+		for i, r := range text {
+			s.SetContent(x+i, y, r, nil, StyleDefault)
+		}
+	}
+	put(0, 0, "Title")
+	put(0, 1, "menu")
+	put(6, 1, "body")
+	put(0, 2, "quit")
+	put(6, 2, "more")
+	s.RegisterRegion("menu", Rect{X: 0, Y: 1, Width: 5, Height: 3})
+
+	var got [][]TextBlock
+	s.OnTextChange(func(blocks []TextBlock) {
+		got = append(got, blocks)
+	})
+	s.Show()
+	want := []TextBlock{
+		{Area: Rect{X: 0, Y: 0, Width: 12, Height: 3}, Text: "Title\nbody\nmore"},
+		{Region: "menu", Area: Rect{X: 0, Y: 1, Width: 5, Height: 3}, Text: "menu\nquit"},
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Fatalf("Bad text %v, want %v", got, want)
+	}
+	if blocks := s.Linearize(); !reflect.DeepEqual(blocks, want) {
+		t.Errorf("Bad linearization %v", blocks)
+	}
+
+	// Only changes to the text are reported.
+	s.SetContent(11, 3, ' ', nil, StyleDefault.Bold(true))
+	s.Show()
+	if len(got) != 1 {
+		t.Errorf("Unchanged text reported")
+	}
+	put(6, 1, "text")
+	s.Show()
+	if len(got) != 2 || got[1][0].Text != "Title\ntext\nmore" {
+		t.Errorf("Change not reported: %v", got)
+	}
+
+	s.OnTextChange(nil)
+	put(6, 1, "gone")
+	s.Show()
+	if len(got) != 2 {
+		t.Errorf("Reported after removal")
+	}
+}
+
+func TestSimFrameInfo(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+	s.SetSize(10, 2)
+	fs := s.(FrameScreen)
+	fs.Show()
+
+	s.SetContent(0, 0, 'x', nil, StyleDefault)
+	if info := fs.ShowFrame(); info.Cells != 1 || info.Bytes != 0 {
+		t.Errorf("Bad frame %+v", info)
+	}
+	if info := fs.SyncFrame(); info.Cells != 20 {
+		t.Errorf("Bad frame for sync %+v", info)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	s := mkTestScreen(t, "")
+	defer s.Fini()
+	s.SetSize(80, 10)
+
+	// The answers are posted in advance: the color steps, the
+	// attributes, and then wide characters, which are skipped.
+	var evs []Event
+	for _, r := range "yny" + "yyyynyyy" {
+		evs = append(evs, newSyntheticKey(KeyRune, r, ModNone))
+	}
+	evs = append(evs, newSyntheticKey(KeyEsc, 0, ModNone),
+		newSyntheticMouse(3, 3, Button1, ModNone), NewEventPaste("pasted", ""))
+	go func() {
+		for _, ev := range evs {
+			s.PostEventWait(ev)
+		}
+	}()
+
+	s.EnablePaste()
+	results := SelfTest(s)
+	if s.MouseEnabled() || !s.PasteEnabled() {
+		t.Errorf("Mouse and paste not restored")
+	}
+	if len(results) != 15 {
+		t.Fatalf("Expected 15 results, got %d: %v", len(results), results)
+	}
+	want := map[string]string{
+		"16 colors":       "16 colors: works",
+		"256 colors":      "256 colors: does not work, but is reported",
+		"24-bit color":    "24-bit color: works, but is not reported",
+		"reverse":         "reverse: does not work, but is reported",
+		"strikethrough":   "strikethrough: works",
+		"wide characters": "wide characters: skipped",
+		"mouse":           "mouse: works, but is not reported",
+		"paste":           "paste: works",
+		"clipboard":       "clipboard: works",
+	}
+	for _, r := range results {
+		if w, ok := want[r.Feature]; ok && r.String() != w {
+			t.Errorf("Bad result %q, expected %q", r, w)
+		}
+	}
+
+	// Stopping skips the rest.
+	s.InjectKey(KeyRune, 'y', ModNone)
+	s.InjectKey(KeyCtrlC, 0, ModNone)
+	results = SelfTest(s)
+	if len(results) != 15 || !results[0].Works || !results[1].Skipped || !results[14].Skipped {
+		t.Errorf("Bad results after stopping: %v", results)
+	}
+}
+
+func TestScreenEncodings(t *testing.T) {
+	s1 := NewSimulationScreen("")
+	s2 := NewSimulationScreen("")
+
+	s1.RegisterEncoding("X-Latin-Test", charmap.ISO8859_1)
+	if e := s1.SetCharset("X-Latin-Test"); e != nil {
+		t.Errorf("Encoding not registered: %v", e)
+	}
+	if e := s2.SetCharset("X-Latin-Test"); e != ErrNoCharset {
+		t.Errorf("Encoding shared with other screen: %v", e)
+	}
+	if GetEncoding("X-Latin-Test") != nil {
+		t.Errorf("Encoding registered with package")
+	}
+
+	s2.SetEncodingFallback(EncodingFallbackASCII)
+	if e := s2.SetCharset("X-Unknown"); e != nil {
+		t.Errorf("Fallback not used: %v", e)
+	}
+	if e := s1.SetCharset("X-Unknown"); e != ErrNoCharset {
+		t.Errorf("Fallback shared with other screen: %v", e)
+	}
+
+	// Fallbacks can be registered before Init, and are not shared.
+	s1.RegisterRuneFallback('€', "E")
+	if e := s1.Init(); e != nil {
+		t.Fatalf("Failed to initialize screen: %v", e)
+	}
+	defer s1.Fini()
+	if !s1.CanDisplay('€', true) || s1.CanDisplay('€', false) {
+		t.Errorf("Fallback not kept across Init")
+	}
+	if _, ok := RuneFallbacks['€']; ok {
+		t.Errorf("Fallback registered with package")
+	}
+}
@@ -15,9 +15,13 @@
 package tcell
 
 import (
+	"io"
+	"regexp"
 	"sync"
+	"time"
 	"unicode/utf8"
 
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/transform"
 )
 
@@ -28,6 +32,10 @@ func NewSimulationScreen(charset string) SimulationScreen {
 		charset = "UTF-8"
 	}
 	s := &simscreen{charset: charset}
+	s.fallback = make(map[rune]string)
+	for k, v := range RuneFallbacks {
+		s.fallback[k] = v
+	}
 	return s
 }
 
@@ -42,13 +50,6 @@ type SimulationScreen interface {
 	// fully converted are discarded.
 	InjectKeyBytes(buf []byte) bool
 
-	// InjectKey injects a key event.  The rune is a UTF-8 rune, post
-	// any translation.
-	InjectKey(key Key, r rune, mod ModMask)
-
-	// InjectMouse injects a mouse event.
-	InjectMouse(x, y int, buttons ButtonMask, mod ModMask)
-
 	// InjectResize injects a resize event
 	InjectResize()
 
@@ -68,6 +69,30 @@ type SimulationScreen interface {
 	// GetCursor returns the cursor details.
 	GetCursor() (x int, y int, visible bool)
 
+	// GetCursorStyle returns the shape of the primary cursor.
+	GetCursorStyle() CursorStyle
+
+	// GetCursorBlink returns whether the cursor was made to blink with
+	// SetCursorBlink, and false for set if it was left as it is.
+	GetCursorBlink() (blink bool, set bool)
+
+	// InjectPaste injects a paste event, as the screen delivers pasted
+	// text when bracketed paste is enabled.  The event is delivered even
+	// if paste is disabled, as a terminal would if the application had
+	// only just disabled bracketed paste.
+	InjectPaste(text string)
+
+	// Beeps returns how many times Beep has been called.
+	Beeps() int
+
+	// InjectClipboard places text in a clipboard register, as though
+	// another application had copied it.  No event is delivered.
+	InjectClipboard(text string, reg ClipboardRegister)
+
+	// GetClipboardContents returns the text in a clipboard register,
+	// such as was stored by SetClipboard.
+	GetClipboardContents(reg ClipboardRegister) string
+
 	Screen
 }
 
@@ -99,13 +124,38 @@ type simscreen struct {
 	cursorx   int
 	cursory   int
 	cursorvis bool
+	cshape    CursorStyle
+	softcur   bool
+	extra     cursorSet
+	curstack  cursorStack
 	mouse     bool
+	pasteon   bool
+	cblink    cursorBlink
+	beeps     int
 	charset   string
+	incs      string
+	outcs     string
 	encoder   transform.Transformer
 	decoder   transform.Transformer
 	fillchar  rune
 	fillstyle Style
 	fallback  map[rune]string
+	encs      screenEncodings
+	inputs    int
+	subs      subscribers
+	diffs     diffMirrors
+	regions   regions
+	sel       selection
+	hl        selection
+	clipboard map[ClipboardRegister]string
+	cliphist  clipHistory
+	ticks     ticker
+	minsz     minSize
+	onresize  func(int, int)
+	textw     textWatch
+	laidw     int
+	laidh     int
+	frame     FrameInfo
 
 	sync.Mutex
 }
@@ -113,6 +163,7 @@ type simscreen struct {
 func (s *simscreen) Init() error {
 	s.evch = make(chan Event, 10)
 	s.quit = make(chan struct{})
+	s.fini = false
 	s.fillchar = 'X'
 	s.fillstyle = StyleDefault
 	s.mouse = false
@@ -122,32 +173,43 @@ func (s *simscreen) Init() error {
 	s.cursory = -1
 	s.style = StyleDefault
 
-	if enc := GetEncoding(s.charset); enc != nil {
-		s.encoder = enc.NewEncoder()
-		s.decoder = enc.NewDecoder()
-	} else {
+	incs := s.charset
+	if s.incs != "" {
+		incs = s.incs
+	}
+	if s.outcs != "" {
+		s.charset = s.outcs
+	}
+	enc, dec := s.encs.Get(s.charset), s.encs.Get(incs)
+	if enc == nil || dec == nil {
 		return ErrNoCharset
 	}
+	s.encoder = enc.NewEncoder()
+	s.decoder = dec.NewDecoder()
 
 	s.front = make([]SimCell, s.physw*s.physh)
 	s.back.Resize(80, 25)
-
-	// default fallbacks
-	s.fallback = make(map[rune]string)
-	for k, v := range RuneFallbacks {
-		s.fallback[k] = v
-	}
+	s.Lock()
+	s.ticks.Run(s.quit, s.postTick)
+	s.Unlock()
 	return nil
 }
 
 func (s *simscreen) Fini() {
 	s.Lock()
+	if s.fini {
+		s.Unlock()
+		return
+	}
 	s.fini = true
 	s.back.Resize(0, 0)
+	s.ticks.Stop()
 	s.Unlock()
 	if s.quit != nil {
 		close(s.quit)
 	}
+	s.subs.Close()
+	s.diffs.Close()
 	s.physw = 0
 	s.physh = 0
 	s.front = nil
@@ -169,6 +231,18 @@ func (s *simscreen) Fill(r rune, style Style) {
 	s.Unlock()
 }
 
+func (s *simscreen) ClearRect(x, y, w, h int, style Style) {
+	s.Lock()
+	s.back.FillRect(Rect{X: x, Y: y, Width: w, Height: h}, ' ', style)
+	s.Unlock()
+}
+
+func (s *simscreen) ClearLine(y int) {
+	s.Lock()
+	s.back.FillRect(Rect{X: 0, Y: y, Width: s.physw, Height: 1}, ' ', s.style)
+	s.Unlock()
+}
+
 func (s *simscreen) SetCell(x, y int, style Style, ch ...rune) {
 
 	if len(ch) > 0 {
@@ -196,6 +270,43 @@ func (s *simscreen) GetContent(x, y int) (rune, []rune, Style, int) {
 	return mainc, combc, style, width
 }
 
+func (s *simscreen) SetTag(x, y int, tag uint32) {
+	s.Lock()
+	s.back.SetTag(x, y, tag)
+	s.Unlock()
+}
+
+func (s *simscreen) GetTag(x, y int) uint32 {
+	s.Lock()
+	tag := s.back.GetTag(x, y)
+	s.Unlock()
+	return tag
+}
+
+func (s *simscreen) SetSelection(rects []Rect, style Style) {
+	s.Lock()
+	s.sel.set(&s.back, rects, style)
+	s.Unlock()
+}
+
+func (s *simscreen) SelectedText() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.back.Text(s.sel.rects...)
+}
+
+func (s *simscreen) SetHighlight(rects []Rect, style Style) {
+	s.Lock()
+	s.hl.set(&s.back, rects, style)
+	s.Unlock()
+}
+
+func (s *simscreen) Find(re *regexp.Regexp) []Rect {
+	s.Lock()
+	defer s.Unlock()
+	return s.back.Find(re)
+}
+
 func (s *simscreen) drawCell(x, y int) int {
 
 	mainc, combc, style, width := s.back.GetContent(x, y)
@@ -210,6 +321,13 @@ func (s *simscreen) drawCell(x, y int) int {
 	if style == StyleDefault {
 		style = s.style
 	}
+	style = s.hl.apply(x, y, width, style)
+	style = s.sel.apply(x, y, width, style)
+	if s.softcur && x == s.cursorx && y == s.cursory {
+		style = s.cshape.apply(style)
+	} else {
+		style = s.extra.apply(x, y, style)
+	}
 	simc.Style = style
 	simc.Runes = append([]rune{mainc}, combc...)
 
@@ -258,16 +376,65 @@ func (s *simscreen) drawCell(x, y int) int {
 }
 
 func (s *simscreen) ShowCursor(x, y int) {
+	s.ShowCursorStyle(x, y, CursorStyleDefault)
+}
+
+// The simulated terminal can show any shape of cursor, so the software
+// cursor is only used when asked for.
+
+func (s *simscreen) ShowCursorStyle(x, y int, cs CursorStyle) {
+	s.ShowCursors(Cursor{X: x, Y: y, Style: cs})
+}
+
+func (s *simscreen) ShowCursors(cursors ...Cursor) {
+	c := Cursor{X: -1, Y: -1}
+	if len(cursors) > 0 {
+		c = cursors[0]
+	}
 	s.Lock()
-	s.cursorx, s.cursory = x, y
+	s.markCursor()
+	s.cursorx, s.cursory = c.X, c.Y
+	s.cshape = c.Style
+	s.extra = secondary(cursors)
+	s.markCursor()
 	s.showCursor()
 	s.Unlock()
 }
 
+func (s *simscreen) SetSoftCursor(on bool) {
+	s.Lock()
+	s.markCursor()
+	s.softcur = on
+	s.markCursor()
+	s.Unlock()
+}
+
+func (s *simscreen) markCursor() {
+	if s.softcur {
+		s.back.SetDirty(s.cursorx, s.cursory, true)
+	}
+	s.extra.mark(&s.back)
+}
+
 func (s *simscreen) HideCursor() {
 	s.ShowCursor(-1, -1)
 }
 
+func (s *simscreen) PushCursorState() {
+	s.Lock()
+	s.curstack.Push(Cursor{X: s.cursorx, Y: s.cursory, Style: s.cshape}, s.extra)
+	s.Unlock()
+}
+
+func (s *simscreen) PopCursorState() {
+	s.Lock()
+	cursors, ok := s.curstack.Pop()
+	s.Unlock()
+	if ok {
+		s.ShowCursors(cursors...)
+	}
+}
+
 func (s *simscreen) showCursor() {
 
 	x, y := s.cursorx, s.cursory
@@ -284,10 +451,25 @@ func (s *simscreen) hideCursor() {
 }
 
 func (s *simscreen) Show() {
+	s.ShowFrame()
+}
+
+func (s *simscreen) ShowFrame() FrameInfo {
+	start := time.Now()
 	s.Lock()
+	s.frame = FrameInfo{}
 	s.resize()
-	s.draw()
+	if s.relayout() {
+		s.draw()
+	}
+	frame := s.frame
+	notify := s.textw.Check(&s.back, &s.regions)
 	s.Unlock()
+	frame.Duration = time.Since(start)
+	if notify != nil {
+		notify()
+	}
+	return frame
 }
 
 func (s *simscreen) clearScreen() {
@@ -304,24 +486,67 @@ func (s *simscreen) draw() {
 	s.hideCursor()
 	if s.clear {
 		s.clearScreen()
+		s.minsz.Invalidate()
+	}
+	if s.minsz.Small() {
+		s.minsz.Swap(&s.back)
+		defer s.minsz.Swap(&s.back)
 	}
 
 	w, h := s.back.Size()
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
+			if s.back.Dirty(x, y) {
+				s.frame.Cells++
+			}
 			width := s.drawCell(x, y)
 			x += width - 1
 		}
 	}
-	s.showCursor()
+	if !s.minsz.Small() {
+		s.showCursor()
+	}
+	s.diffs.Frame(&s.back)
 }
 
 func (s *simscreen) EnableMouse() {
+	s.Lock()
 	s.mouse = true
+	s.Unlock()
 }
 
 func (s *simscreen) DisableMouse() {
+	s.Lock()
 	s.mouse = false
+	s.Unlock()
+}
+
+func (s *simscreen) MouseEnabled() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.mouse
+}
+
+func (s *simscreen) EnablePaste() {
+	s.Lock()
+	s.pasteon = true
+	s.Unlock()
+}
+
+func (s *simscreen) DisablePaste() {
+	s.Lock()
+	s.pasteon = false
+	s.Unlock()
+}
+
+func (s *simscreen) PasteEnabled() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.pasteon
+}
+
+func (s *simscreen) InjectPaste(text string) {
+	s.PostEvent(NewEventPaste(text, pasteBegin+text+pasteEnd))
 }
 
 func (s *simscreen) Size() (int, int) {
@@ -339,12 +564,49 @@ func (s *simscreen) resize() {
 		ev := NewEventResize(w, h)
 		s.PostEvent(ev)
 	}
+	s.checkMinSize()
+}
+
+// relayout calls the OnResize callback if the size has changed since it
+// was last called, as for tScreen.relayout.  The caller holds the lock.
+func (s *simscreen) relayout() bool {
+	for s.onresize != nil && !s.fini {
+		w, h := s.back.Size()
+		if w == s.laidw && h == s.laidh {
+			break
+		}
+		fn := s.onresize
+		s.laidw, s.laidh = w, h
+		s.Unlock()
+		fn(w, h)
+		s.Lock()
+		if s.fini {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMinSize posts an EventTooSmall if the screen has crossed its
+// minimum size.
+func (s *simscreen) checkMinSize() {
+	w, h := s.back.Size()
+	if ev := s.minsz.Check(w, h); ev != nil {
+		s.clear = true
+		s.back.Invalidate()
+		s.PostEvent(ev)
+	}
 }
 
 func (s *simscreen) Colors() int {
 	return 256
 }
 
+func (s *simscreen) SupportedAttrs() AttrMask {
+	return AttrBold | AttrBlink | AttrReverse | AttrUnderline | AttrDim |
+		AttrItalic | AttrStrikeThrough | AttrRapidBlink
+}
+
 func (s *simscreen) PollEvent() Event {
 	select {
 	case <-s.quit:
@@ -355,29 +617,92 @@ func (s *simscreen) PollEvent() Event {
 }
 
 func (s *simscreen) PostEventWait(ev Event) {
-	s.evch <- ev
+	s.regions.Annotate(ev)
+	select {
+	case s.evch <- ev:
+		s.cliphist.Note(ev)
+		s.subs.Publish(ev)
+	case <-s.quit:
+	}
 }
 
 func (s *simscreen) PostEvent(ev Event) error {
+	s.regions.Annotate(ev)
 	select {
 	case s.evch <- ev:
+		s.cliphist.Note(ev)
+		s.subs.Publish(ev)
 		return nil
 	default:
 		return ErrEventQFull
 	}
 }
 
-func (s *simscreen) InjectMouse(x, y int, buttons ButtonMask, mod ModMask) {
-	ev := NewEventMouse(x, y, buttons, mod, "")
-	s.PostEvent(ev)
+func (s *simscreen) StartTicker(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.ticks.Set(d)
+	if !s.fini {
+		s.ticks.Run(s.quit, s.postTick)
+	}
 }
 
-func (s *simscreen) InjectKey(key Key, r rune, mod ModMask) {
-	ev := NewEventKey(key, r, mod, "")
-	s.PostEvent(ev)
+func (s *simscreen) postTick(ev Event) error {
+	if len(s.evch) > 0 {
+		return ErrEventQFull
+	}
+	return s.PostEvent(ev)
+}
+
+func (s *simscreen) Mirror(io.Writer) error {
+	return ErrNotSupported
+}
+
+func (s *simscreen) Unmirror(io.Writer) {}
+
+func (s *simscreen) RegisterRegion(id string, r Rect) {
+	s.regions.Register(id, r)
+}
+
+func (s *simscreen) MirrorDiffs(w io.Writer) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fini {
+		return ErrNoScreen
+	}
+	s.diffs.Add(w, &s.back)
+	return nil
+}
+
+func (s *simscreen) UnmirrorDiffs(w io.Writer) {
+	s.diffs.Remove(w)
+}
+
+func (s *simscreen) UnregisterRegion(id string) {
+	s.regions.Unregister(id)
+}
+
+func (s *simscreen) Subscribe(size int) <-chan Event {
+	return s.subs.Subscribe(size)
+}
+
+func (s *simscreen) Unsubscribe(ch <-chan Event) {
+	s.subs.Unsubscribe(ch)
+}
+
+func (s *simscreen) InjectMouse(x, y int, buttons ButtonMask, mod ModMask) error {
+	return s.PostEvent(newSyntheticMouse(x, y, buttons, mod))
+}
+
+func (s *simscreen) InjectKey(key Key, ch rune, mod ModMask) error {
+	return s.PostEvent(newSyntheticKey(key, ch, mod))
 }
 
 func (s *simscreen) InjectKeyBytes(b []byte) bool {
+	return s.injectKeyBytes(b, 0)
+}
+
+func (s *simscreen) injectKeyBytes(b []byte, origin int) bool {
 	failed := false
 
 outer:
@@ -385,6 +710,7 @@ outer:
 		if b[0] >= ' ' && b[0] <= 0x7F {
 			// printable ASCII easy to deal with -- no encodings
 			ev := NewEventKey(KeyRune, rune(b[0]), ModNone, "")
+			ev.origin = origin
 			s.PostEvent(ev)
 			b = b[1:]
 			continue
@@ -397,19 +723,22 @@ outer:
 				mod = ModCtrl
 			}
 			ev := NewEventKey(Key(b[0]), 0, mod, "")
+			ev.origin = origin
 			s.PostEvent(ev)
+			b = b[1:]
 			continue
 		}
 
 		utfb := make([]byte, len(b)*4) // worst case
-		for l := 1; l < len(b); l++ {
+		for l := 1; l <= len(b); l++ {
 			s.decoder.Reset()
-			nout, nin, _ := s.decoder.Transform(utfb, b[:l], true)
+			nout, nin, _ := s.decoder.Transform(utfb, b[:l], l == len(b))
 
 			if nout != 0 {
 				r, _ := utf8.DecodeRune(utfb[:nout])
 				if r != utf8.RuneError {
 					ev := NewEventKey(KeyRune, r, ModNone, "")
+					ev.origin = origin
 					s.PostEvent(ev)
 				}
 				b = b[nin:]
@@ -424,6 +753,27 @@ outer:
 	return !failed
 }
 
+func (s *simscreen) AddInput(r io.Reader) (int, error) {
+	s.Lock()
+	s.inputs++
+	origin := s.inputs
+	s.Unlock()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, e := r.Read(buf)
+			if n > 0 {
+				s.injectKeyBytes(buf[:n], origin)
+			}
+			if e != nil {
+				return
+			}
+		}
+	}()
+	return origin, nil
+}
+
 func (s *simscreen) InjectResize() {
 	w, h := s.physw, s.physh
 	ev := NewEventResize(w, h)
@@ -431,11 +781,33 @@ func (s *simscreen) InjectResize() {
 }
 
 func (s *simscreen) Sync() {
+	s.SyncFrame()
+}
+
+func (s *simscreen) SyncFrame() FrameInfo {
+	start := time.Now()
 	s.Lock()
+	s.frame = FrameInfo{}
 	s.clear = true
 	s.resize()
 	s.back.Invalidate()
-	s.draw()
+	if s.relayout() {
+		s.draw()
+	}
+	frame := s.frame
+	notify := s.textw.Check(&s.back, &s.regions)
+	s.Unlock()
+	frame.Duration = time.Since(start)
+	if notify != nil {
+		notify()
+	}
+	return frame
+}
+
+func (s *simscreen) Invalidate(rect Rect) {
+	s.Lock()
+	s.back.InvalidateRect(rect)
+	s.minsz.Invalidate()
 	s.Unlock()
 }
 
@@ -472,6 +844,69 @@ func (s *simscreen) GetCursor() (int, int, bool) {
 	return x, y, vis
 }
 
+func (s *simscreen) GetCursorStyle() CursorStyle {
+	s.Lock()
+	defer s.Unlock()
+	return s.cshape
+}
+
+func (s *simscreen) GetCursorBlink() (bool, bool) {
+	s.Lock()
+	defer s.Unlock()
+	return s.cblink == blinkOn, s.cblink != blinkDefault
+}
+
+func (s *simscreen) SetCursorBlink(blink bool) {
+	s.Lock()
+	s.cblink = blinkFor(blink)
+	s.Unlock()
+}
+
+func (s *simscreen) SetCharset(charset string) error {
+	charset = normalizeCharset(charset)
+	s.Lock()
+	defer s.Unlock()
+	if s.encs.Get(charset) == nil {
+		return ErrNoCharset
+	}
+	s.charset = charset
+	return nil
+}
+
+func (s *simscreen) SetInputEncoding(charset string) error {
+	charset = normalizeCharset(charset)
+	s.Lock()
+	defer s.Unlock()
+	if s.encs.Get(charset) == nil {
+		return ErrNoCharset
+	}
+	s.incs = charset
+	return nil
+}
+
+func (s *simscreen) SetOutputEncoding(charset string) error {
+	charset = normalizeCharset(charset)
+	s.Lock()
+	defer s.Unlock()
+	if s.encs.Get(charset) == nil {
+		return ErrNoCharset
+	}
+	s.outcs = charset
+	return nil
+}
+
+func (s *simscreen) RegisterEncoding(charset string, enc encoding.Encoding) {
+	s.Lock()
+	s.encs.Register(charset, enc)
+	s.Unlock()
+}
+
+func (s *simscreen) SetEncodingFallback(fb EncodingFallback) {
+	s.Lock()
+	s.encs.SetFallback(fb)
+	s.Unlock()
+}
+
 func (s *simscreen) RegisterRuneFallback(r rune, subst string) {
 	s.Lock()
 	s.fallback[r] = subst
@@ -485,6 +920,8 @@ func (s *simscreen) UnregisterRuneFallback(r rune) {
 }
 
 func (s *simscreen) CanDisplay(r rune, checkFallbacks bool) bool {
+	s.Lock()
+	defer s.Unlock()
 
 	if enc := s.encoder; enc != nil {
 		nb := make([]byte, 6)
@@ -510,15 +947,174 @@ func (s *simscreen) HasMouse() bool {
 	return false
 }
 
+func (s *simscreen) Has(c Capability) bool {
+	switch c {
+	case CapPaste, CapClipboard, CapRequestResize:
+		return true
+	}
+	return false
+}
+
 func (s *simscreen) Resize(int, int, int, int) {}
 
+func (s *simscreen) RequestResize(w, h int) error {
+	if w <= 0 || h <= 0 {
+		return ErrNotSupported
+	}
+	s.SetSize(w, h)
+	s.PostEvent(NewEventResize(w, h))
+	return nil
+}
+
+func (s *simscreen) OnResize(fn func(w, h int)) {
+	s.Lock()
+	s.onresize = fn
+	s.laidw, s.laidh = s.back.Size()
+	s.Unlock()
+}
+
+func (s *simscreen) Linearize() []TextBlock {
+	s.Lock()
+	defer s.Unlock()
+	return linearize(&s.back, &s.regions)
+}
+
+func (s *simscreen) OnTextChange(fn func([]TextBlock)) {
+	s.Lock()
+	s.textw.Set(fn)
+	s.Unlock()
+}
+
+func (s *simscreen) SetMinSize(w, h int) {
+	s.Lock()
+	s.minsz.Set(w, h)
+	s.checkMinSize()
+	s.Unlock()
+}
+
 func (s *simscreen) HasKey(Key) bool {
 	return true
 }
 
-func (s *simscreen) RegisterRawSeq(string) {}
-func (s *simscreen) SetPaste(bool)         {}
+func (s *simscreen) RegisterRawSeq(string)        {}
+func (s *simscreen) SetInputLimits(int, int)      {}
+func (s *simscreen) SetRestricted(bool)           {}
+func (s *simscreen) SetResizeDelay(time.Duration) {}
+func (s *simscreen) SetSizePoll(time.Duration)    {}
+func (s *simscreen) SetFixedSize(int, int)        {}
+func (s *simscreen) SetIdleTimeout(time.Duration) {}
+func (s *simscreen) SetSoftBlink(time.Duration)   {}
+func (s *simscreen) SetBoldAsBright(bool)         {}
+func (s *simscreen) SetManualPump(bool)           {}
+func (s *simscreen) Tick()                        {}
+func (s *simscreen) SetInline(int)                {}
+func (s *simscreen) SetPaste(bool)                {}
+func (s *simscreen) SetRawPaste(bool)             {}
+func (s *simscreen) SetCombining(bool)            {}
+func (s *simscreen) SetOutputBudget(int, Degrade) {}
+func (s *simscreen) SetGlyphPolicy(GlyphPolicy)   {}
+func (s *simscreen) SetPadding(Padding, int)      {}
+func (s *simscreen) SetFlushSize(int)             {}
+func (s *simscreen) SetUTF8Policy(UTF8Policy)     {}
+func (s *simscreen) SetCaptureEscSeq(bool)        {}
+func (s *simscreen) SetNormalizeBackspace(bool)   {}
+func (s *simscreen) SetEscapeAlt(bool)            {}
+func (s *simscreen) SetMouseSupport(bool)         {}
+func (s *simscreen) SetSystemColors(bool)         {}
+func (s *simscreen) SetRGBSeparator(RGBSeparator) {}
+
+func (s *simscreen) SetMetrics(func(Metric, time.Duration)) {}
+
+func (s *simscreen) SetAnimation(Style, AnimatedStyle) {}
+
+func (s *simscreen) SetPaletteColor(int, Color) error { return ErrNotSupported }
+func (s *simscreen) ResetPalette()                    {}
+
+func (s *simscreen) BindSequence(string, Key, ModMask) {}
+func (s *simscreen) UnbindSequence(string)             {}
+func (s *simscreen) KeySequences() []KeySequence       { return nil }
+func (s *simscreen) KeyConflicts() []KeyConflict       { return nil }
+func (s *simscreen) Pasting() bool                     { return false }
+
+func (s *simscreen) ProcessInput(p []byte) {
+	s.InjectKeyBytes(p)
+}
+
+func (s *simscreen) Println(string) error {
+	return ErrNotSupported
+}
 
-func (s *simscreen) GetClipboard(string) error         { return nil }
-func (s *simscreen) SetClipboard(string, string) error { return nil }
-func (s *simscreen) Beep() error                       { return nil }
+func (s *simscreen) Beep() error {
+	s.Lock()
+	s.beeps++
+	s.Unlock()
+	return nil
+}
+
+func (s *simscreen) Beeps() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.beeps
+}
+
+// GetClipboard replies with an EventPaste, as terminals do.  The
+// clipboard is kept in memory, and outlives Fini, much as the system
+// clipboard outlives a terminal application.
+func (s *simscreen) GetClipboard(reg ClipboardRegister) error {
+	if !reg.Valid() {
+		return ErrBadRegister
+	}
+	return s.PostEvent(NewEventPaste(s.GetClipboardContents(reg), ""))
+}
+
+func (s *simscreen) SetClipboard(text string, reg ClipboardRegister) error {
+	if !reg.Valid() {
+		return ErrBadRegister
+	}
+	s.cliphist.Add(text)
+	s.InjectClipboard(text, reg)
+	return nil
+}
+
+func (s *simscreen) HasClipboard(reg ClipboardRegister) bool {
+	return reg.Valid()
+}
+
+func (s *simscreen) SetClipboardHistory(entries, size int) {
+	s.cliphist.SetLimits(entries, size)
+}
+
+func (s *simscreen) ClipboardHistory() []string {
+	return s.cliphist.Texts()
+}
+
+func (s *simscreen) QueryCursorPosition(time.Duration) (int, int, error) {
+	return 0, 0, ErrNotSupported
+}
+
+func (s *simscreen) QueryDefaultColors(time.Duration) (Color, Color, error) {
+	return ColorDefault, ColorDefault, ErrNotSupported
+}
+
+func (s *simscreen) QueryPaletteColor(int, time.Duration) (Color, error) {
+	return ColorDefault, ErrNotSupported
+}
+
+func (s *simscreen) QueryTermcap(string, time.Duration) (string, bool, error) {
+	return "", false, ErrNotSupported
+}
+
+func (s *simscreen) InjectClipboard(text string, reg ClipboardRegister) {
+	s.Lock()
+	if s.clipboard == nil {
+		s.clipboard = make(map[ClipboardRegister]string)
+	}
+	s.clipboard[reg] = text
+	s.Unlock()
+}
+
+func (s *simscreen) GetClipboardContents(reg ClipboardRegister) string {
+	s.Lock()
+	defer s.Unlock()
+	return s.clipboard[reg]
+}
@@ -33,9 +33,9 @@ package tcell
 //
 // To use Style, just declare a variable of its type.
 type Style struct {
-	fg       Color
-	bg       Color
-	attrs    AttrMask
+	fg    Color
+	bg    Color
+	attrs AttrMask
 }
 
 // StyleDefault represents a default style, based upon the context.
@@ -48,21 +48,15 @@ var styleInvalid = Style{attrs: AttrInvalid}
 // Foreground returns a new style based on s, with the foreground color set
 // as requested.  ColorDefault can be used to select the global default.
 func (s Style) Foreground(c Color) Style {
-	return Style{
-		fg:    c,
-		bg:    s.bg,
-		attrs: s.attrs,
-	}
+	s.fg = c
+	return s
 }
 
 // Background returns a new style based on s, with the background color set
 // as requested.  ColorDefault can be used to select the global default.
 func (s Style) Background(c Color) Style {
-	return Style{
-		fg:    s.fg,
-		bg:    c,
-		attrs: s.attrs,
-	}
+	s.bg = c
+	return s
 }
 
 // Decompose breaks a style up, returning the foreground, background,
@@ -73,25 +67,17 @@ func (s Style) Decompose() (fg Color, bg Color, attr AttrMask) {
 
 func (s Style) setAttrs(attrs AttrMask, on bool) Style {
 	if on {
-		return Style{
-			fg:    s.fg,
-			bg:    s.bg,
-			attrs: s.attrs | attrs,
-		}
-	}
-	return Style{
-		fg:    s.fg,
-		bg:    s.bg,
-		attrs: s.attrs &^ attrs,
+		s.attrs |= attrs
+	} else {
+		s.attrs &^= attrs
 	}
+	return s
 }
 
 // Normal returns the style with all attributes disabled.
 func (s Style) Normal() Style {
-	return Style{
-		fg: s.fg,
-		bg: s.bg,
-	}
+	s.attrs = AttrNone
+	return s
 }
 
 // Bold returns a new style based on s, with the bold attribute set
@@ -106,6 +92,13 @@ func (s Style) Blink(on bool) Style {
 	return s.setAttrs(AttrBlink, on)
 }
 
+// RapidBlink returns a new style based on s, with the rapid blink
+// attribute (SGR 6) set as requested.  Few terminals distinguish this
+// from ordinary blink.
+func (s Style) RapidBlink(on bool) Style {
+	return s.setAttrs(AttrRapidBlink, on)
+}
+
 // Dim returns a new style based on s, with the dim attribute set
 // as requested.
 func (s Style) Dim(on bool) Style {
@@ -135,3 +128,57 @@ func (s Style) Underline(on bool) Style {
 func (s Style) StrikeThrough(on bool) Style {
 	return s.setAttrs(AttrStrikeThrough, on)
 }
+
+// MergeOver returns the style s layered over base, as when a widget's own
+// style is drawn within the style of the widget that contains it.  A color
+// of s that is ColorDefault is unset, and is inherited from base; to use
+// the terminal's default color regardless of base, use ColorReset.  The
+// attributes are those of s together with those of base; to turn off an
+// attribute of base, use Without.
+//
+// Styles should be merged from the outside in, as in
+// child.MergeOver(parent.MergeOver(root)).
+func (s Style) MergeOver(base Style) Style {
+	return StyleLayer{Style: s}.MergeOver(base)
+}
+
+// Without returns a layer of the style s, with the given attributes
+// disabled, both in s and in the style the layer is merged over.
+func (s Style) Without(attrs AttrMask) StyleLayer {
+	return StyleLayer{Style: s}.Without(attrs)
+}
+
+// StyleLayer is a style to be merged over another, together with the
+// attributes that it turns off in that other style, rather than inherits
+// from it.  This is kept out of Style, so that styles that look the same
+// are equal, and can be compared and used as map keys.
+type StyleLayer struct {
+	// Style is the style of the layer.
+	Style Style
+
+	// Off holds the attributes turned off in the style the layer is
+	// merged over.  Those set in Style are set regardless.
+	Off AttrMask
+}
+
+// Without returns the layer with the given attributes disabled, both in
+// its style and in the style it is merged over.
+func (l StyleLayer) Without(attrs AttrMask) StyleLayer {
+	l.Style = l.Style.setAttrs(attrs, false)
+	l.Off |= attrs
+	return l
+}
+
+// MergeOver returns the style of the layer merged over base, as for
+// Style.MergeOver, but without the attributes the layer turns off.
+func (l StyleLayer) MergeOver(base Style) Style {
+	s := l.Style
+	if s.fg == ColorDefault {
+		s.fg = base.fg
+	}
+	if s.bg == ColorDefault {
+		s.bg = base.bg
+	}
+	s.attrs |= base.attrs &^ l.Off
+	return s
+}
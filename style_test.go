@@ -39,3 +39,36 @@ func TestStyle(t *testing.T) {
 		t.Errorf("Bad custom style (%v, %v, %v)", fg, bg, attr)
 	}
 }
+
+func TestStyleMergeOver(t *testing.T) {
+	root := StyleDefault.Foreground(ColorWhite).Background(ColorBlue).Bold(true)
+	parent := StyleDefault.Background(ColorGray).Underline(true)
+	child := StyleDefault.Foreground(ColorReset).Without(AttrBold)
+
+	st := parent.MergeOver(root)
+	if st != StyleDefault.Foreground(ColorWhite).Background(ColorGray).Bold(true).Underline(true) {
+		t.Errorf("Bad parent style %v", st)
+	}
+	st = child.MergeOver(st)
+	if fg, bg, attr := st.Decompose(); fg != ColorReset || bg != ColorGray || attr != AttrUnderline {
+		t.Errorf("Bad child style (%v, %v, %v)", fg, bg, attr)
+	}
+	if st != StyleDefault.Foreground(ColorReset).Background(ColorGray).Underline(true) {
+		t.Errorf("Bad merged style: %v", st)
+	}
+
+	// An attribute set in the layer's style is kept.
+	child.Style = child.Style.Bold(true)
+	st = child.MergeOver(root)
+	if _, _, attr := st.Decompose(); attr != AttrBold {
+		t.Errorf("Bad attributes %v", attr)
+	}
+	if st := StyleDefault.MergeOver(root); st != root {
+		t.Errorf("Default did not inherit: %v", st)
+	}
+
+	// Turning an attribute off does not change the style.
+	if StyleDefault.Without(AttrBold).Style != StyleDefault {
+		t.Errorf("Style changed by Without")
+	}
+}
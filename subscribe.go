@@ -0,0 +1,75 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"sync"
+)
+
+// subscribers fans out a copy of every event posted to a screen, to
+// observers other than the main application loop.  This is used by Screen
+// implementors to provide Subscribe and Unsubscribe.  The zero value is
+// ready to use.
+type subscribers struct {
+	chans map[<-chan Event]chan Event
+	lk    sync.Mutex
+}
+
+// Subscribe registers a new observer with its own buffer of the given
+// size, returning the channel on which it will receive events.
+func (sb *subscribers) Subscribe(size int) <-chan Event {
+	ch := make(chan Event, size)
+	sb.lk.Lock()
+	if sb.chans == nil {
+		sb.chans = make(map[<-chan Event]chan Event)
+	}
+	sb.chans[ch] = ch
+	sb.lk.Unlock()
+	return ch
+}
+
+// Unsubscribe removes the observer, and closes its channel.
+func (sb *subscribers) Unsubscribe(ch <-chan Event) {
+	sb.lk.Lock()
+	if c, ok := sb.chans[ch]; ok {
+		delete(sb.chans, ch)
+		close(c)
+	}
+	sb.lk.Unlock()
+}
+
+// Publish delivers the event to every observer.  This never blocks; an
+// observer whose buffer is full simply misses the event.
+func (sb *subscribers) Publish(ev Event) {
+	sb.lk.Lock()
+	for _, c := range sb.chans {
+		select {
+		case c <- ev:
+		default:
+		}
+	}
+	sb.lk.Unlock()
+}
+
+// Close removes all observers, closing their channels.  This is called
+// when the screen is finalized.
+func (sb *subscribers) Close() {
+	sb.lk.Lock()
+	for ch, c := range sb.chans {
+		delete(sb.chans, ch)
+		close(c)
+	}
+	sb.lk.Unlock()
+}
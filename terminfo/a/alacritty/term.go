@@ -17,6 +17,7 @@ func init() {
 		EnterCA:       "\x1b[?1049h\x1b[22;0;0t",
 		ExitCA:        "\x1b[?1049l\x1b[23;0;0t",
 		ShowCursor:    "\x1b[?12l\x1b[?25h",
+		VisCursor:     "\x1b[?12;25h",
 		HideCursor:    "\x1b[?25l",
 		AttrOff:       "\x1b(B\x1b[m",
 		Underline:     "\x1b[4m",
@@ -63,6 +64,7 @@ func init() {
 		KeyF10:        "\x1b[21~",
 		KeyF11:        "\x1b[23~",
 		KeyF12:        "\x1b[24~",
+		KeyEnter:      "\x1bOM",
 		KeyBacktab:    "\x1b[Z",
 		Modifiers:     1,
 	})
@@ -163,6 +163,7 @@ func LoadTerminfo(name string) (*terminfo.Terminfo, string, error) {
 	t.EnterCA = tc.getstr("smcup")
 	t.ExitCA = tc.getstr("rmcup")
 	t.ShowCursor = tc.getstr("cnorm")
+	t.VisCursor = tc.getstr("cvvis")
 	t.HideCursor = tc.getstr("civis")
 	t.AttrOff = tc.getstr("sgr0")
 	t.Underline = tc.getstr("smul")
@@ -259,6 +260,7 @@ func LoadTerminfo(name string) (*terminfo.Terminfo, string, error) {
 	t.KeyPrint = tc.getstr("kprt")
 	t.KeyHelp = tc.getstr("khlp")
 	t.KeyClear = tc.getstr("kclr")
+	t.KeyEnter = tc.getstr("kent")
 	t.AltChars = tc.getstr("acsc")
 	t.EnterAcs = tc.getstr("smacs")
 	t.ExitAcs = tc.getstr("rmacs")
@@ -13,6 +13,7 @@ func init() {
 		Bell:         "\a",
 		Clear:        "\x1b[H\x1b[J",
 		ShowCursor:   "\x1b[?25h\x1b[?0c",
+		VisCursor:    "\x1b[?25h\x1b[?8c",
 		HideCursor:   "\x1b[?25l\x1b[?1c",
 		AttrOff:      "\x1b[m\x0f",
 		Underline:    "\x1b[4m",
@@ -222,6 +222,7 @@ func getinfo(name string) (*terminfo.Terminfo, string, error) {
 	t.EnterCA = tc.getstr("smcup")
 	t.ExitCA = tc.getstr("rmcup")
 	t.ShowCursor = tc.getstr("cnorm")
+	t.VisCursor = tc.getstr("cvvis")
 	t.HideCursor = tc.getstr("civis")
 	t.AttrOff = tc.getstr("sgr0")
 	t.Underline = tc.getstr("smul")
@@ -267,6 +268,7 @@ func getinfo(name string) (*terminfo.Terminfo, string, error) {
 	t.KeyPrint = tc.getstr("kprt")
 	t.KeyHelp = tc.getstr("khlp")
 	t.KeyClear = tc.getstr("kclr")
+	t.KeyEnter = tc.getstr("kent")
 	t.AltChars = tc.getstr("acsc")
 	t.EnterAcs = tc.getstr("smacs")
 	t.ExitAcs = tc.getstr("rmacs")
@@ -499,6 +501,7 @@ func dotGoInfo(w io.Writer, terms []*TData) {
 		dotGoAddStr(w, "EnterCA", t.EnterCA)
 		dotGoAddStr(w, "ExitCA", t.ExitCA)
 		dotGoAddStr(w, "ShowCursor", t.ShowCursor)
+		dotGoAddStr(w, "VisCursor", t.VisCursor)
 		dotGoAddStr(w, "HideCursor", t.HideCursor)
 		dotGoAddStr(w, "AttrOff", t.AttrOff)
 		dotGoAddStr(w, "Underline", t.Underline)
@@ -609,6 +612,7 @@ func dotGoInfo(w io.Writer, terms []*TData) {
 		dotGoAddStr(w, "KeyExit", t.KeyExit)
 		dotGoAddStr(w, "KeyHelp", t.KeyHelp)
 		dotGoAddStr(w, "KeyClear", t.KeyClear)
+		dotGoAddStr(w, "KeyEnter", t.KeyEnter)
 		dotGoAddStr(w, "KeyBacktab", t.KeyBacktab)
 		dotGoAddStr(w, "KeyShfLeft", t.KeyShfLeft)
 		dotGoAddStr(w, "KeyShfRight", t.KeyShfRight)
@@ -94,6 +94,7 @@ func init() {
 		KeyF42:       "\x1b[34^",
 		KeyF43:       "\x1b[23@",
 		KeyF44:       "\x1b[24@",
+		KeyEnter:     "\x1bOM",
 		KeyBacktab:   "\x1b[Z",
 		KeyShfLeft:   "\x1b[d",
 		KeyShfRight:  "\x1b[c",
@@ -198,6 +199,7 @@ func init() {
 		KeyF42:       "\x1b[34^",
 		KeyF43:       "\x1b[23@",
 		KeyF44:       "\x1b[24@",
+		KeyEnter:     "\x1bOM",
 		KeyBacktab:   "\x1b[Z",
 		KeyShfLeft:   "\x1b[d",
 		KeyShfRight:  "\x1b[c",
@@ -302,6 +304,7 @@ func init() {
 		KeyF42:       "\x1b[34^",
 		KeyF43:       "\x1b[23@",
 		KeyF44:       "\x1b[24@",
+		KeyEnter:     "\x1bOM",
 		KeyBacktab:   "\x1b[Z",
 		KeyShfLeft:   "\x1b[d",
 		KeyShfRight:  "\x1b[c",
@@ -60,6 +60,7 @@ func init() {
 		KeyF10:       "\x1b[21~",
 		KeyF11:       "\x1b[23~",
 		KeyF12:       "\x1b[24~",
+		KeyEnter:     "\x1bOM",
 		KeyBacktab:   "\x1b[Z",
 		Modifiers:    1,
 	})
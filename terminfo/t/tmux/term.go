@@ -17,6 +17,7 @@ func init() {
 		EnterCA:       "\x1b[?1049h",
 		ExitCA:        "\x1b[?1049l",
 		ShowCursor:    "\x1b[34h\x1b[?25h",
+		VisCursor:     "\x1b[34l",
 		HideCursor:    "\x1b[?25l",
 		AttrOff:       "\x1b[m\x0f",
 		Underline:     "\x1b[4m",
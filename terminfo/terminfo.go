@@ -52,6 +52,7 @@ type Terminfo struct {
 	ExitCA       string // rmcup
 	ShowCursor   string // cnorm
 	HideCursor   string // civis
+	VisCursor    string // cvvis
 	AttrOff      string // sgr0
 	Underline    string // smul
 	Bold         string // bold
@@ -149,6 +150,7 @@ type Terminfo struct {
 	KeyClear     string // kclr
 	KeyPrint     string // kprt
 	KeyCancel    string // kcan
+	KeyEnter     string // kent
 	Mouse        string // kmous
 	MouseMode    string // XM
 	AltChars     string // acsc
@@ -635,6 +637,20 @@ func (t *Terminfo) TParm(s string, p ...int) string {
 // by specifying npc - no padding).  All Terminfo based strings should be
 // emitted using this function.
 func (t *Terminfo) TPuts(w io.Writer, s string) {
+	t.TPutsFunc(w, s, func(w io.Writer, d time.Duration) {
+		// Curses historically uses padding to achieve "fine grained"
+		// delays. We have much better clocks these days, and so we
+		// do not rely on padding but simply sleep a bit.
+		if len(t.PadChar) > 0 {
+			time.Sleep(d)
+		}
+	})
+}
+
+// TPutsFunc is like TPuts, but calls pad to deal with each of the delays
+// instead.  The pad function may write padding to w itself.  If pad is
+// nil, the delays are ignored.
+func (t *Terminfo) TPutsFunc(w io.Writer, s string, pad func(io.Writer, time.Duration)) {
 	for {
 		beg := strings.Index(s, "$<")
 		if beg < 0 {
@@ -675,11 +691,8 @@ func (t *Terminfo) TPuts(w io.Writer, s string) {
 			}
 		}
 
-		// Curses historically uses padding to achieve "fine grained"
-		// delays. We have much better clocks these days, and so we
-		// do not rely on padding but simply sleep a bit.
-		if len(t.PadChar) > 0 {
-			time.Sleep(unit * time.Duration(padus))
+		if pad != nil {
+			pad(w, unit*time.Duration(padus))
 		}
 	}
 }
@@ -59,5 +59,6 @@ func init() {
 		KeyF18:       "\x1b[32~",
 		KeyF19:       "\x1b[33~",
 		KeyF20:       "\x1b[34~",
+		KeyEnter:     "\x1bOM",
 	})
 }
@@ -53,6 +53,7 @@ func init() {
 		KeyF15:       "\x01N\r",
 		KeyF16:       "\x01O\r",
 		KeyPrint:     "\x1bP",
+		KeyEnter:     "\x1b7",
 		KeyBacktab:   "\x1bI",
 		KeyShfHome:   "\x1b{",
 	})
@@ -14,6 +14,7 @@ func init() {
 		Bell:         "\a",
 		Clear:        "\x1b[H\x1b[J$<200>",
 		ShowCursor:   "\x1b[34h\x1b[?25h",
+		VisCursor:    "\x1b[34l\x1b[?25h",
 		HideCursor:   "\x1b[?25l",
 		AttrOff:      "\x1b[m\x0f\x1b[\"q",
 		Underline:    "\x1b[4m",
@@ -67,6 +68,7 @@ func init() {
 		Bell:         "\a",
 		Clear:        "\x1b[H\x1b[J$<200>",
 		ShowCursor:   "\x1b[34h\x1b[?25h",
+		VisCursor:    "\x1b[34l\x1b[?25h",
 		HideCursor:   "\x1b[?25l",
 		AttrOff:      "\x1b[m\x0f\x1b[\"q",
 		Underline:    "\x1b[4m",
@@ -0,0 +1,154 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+// ContentSetter is anything that cells can be drawn into, such as a
+// CellBuffer or a Screen.
+type ContentSetter interface {
+	SetContent(x, y int, mainc rune, combc []rune, style Style)
+}
+
+// TextRegion shows a string in a rectangle, wrapped to its width as
+// WrapString does, and scrolled so that a given line is at the top.  It
+// is not a widget: it handles no input, and is only drawn when Draw is
+// called, so the application decides which keys scroll it, and when.
+// The zero value is empty, with nothing to show it in.
+type TextRegion struct {
+	text  string
+	rect  Rect
+	style Style
+	lines []string
+	top   int
+}
+
+// NewTextRegion returns a TextRegion showing the text in the rectangle,
+// scrolled to the top.
+func NewTextRegion(text string, rect Rect, style Style) *TextRegion {
+	tr := &TextRegion{text: text, rect: rect, style: style}
+	tr.wrap()
+	return tr
+}
+
+// wrap breaks the text into lines for the width of the rectangle, and
+// keeps the offset in range.
+func (tr *TextRegion) wrap() {
+	tr.lines = nil
+	if tr.rect.Width > 0 && tr.text != "" {
+		tr.lines = WrapString(tr.text, tr.rect.Width)
+	}
+	tr.SetOffset(tr.top)
+}
+
+// SetText replaces the text.  The offset is kept, as far as the new text
+// allows, so that text can be appended without losing the reader's place.
+func (tr *TextRegion) SetText(text string) {
+	tr.text = text
+	tr.wrap()
+}
+
+// Text returns the text.
+func (tr *TextRegion) Text() string {
+	return tr.text
+}
+
+// SetRect moves the region.  The text is wrapped again if the width has
+// changed.
+func (tr *TextRegion) SetRect(rect Rect) {
+	width := tr.rect.Width
+	tr.rect = rect
+	if rect.Width != width {
+		tr.wrap()
+	} else {
+		tr.SetOffset(tr.top)
+	}
+}
+
+// Rect returns the rectangle the region is shown in.
+func (tr *TextRegion) Rect() Rect {
+	return tr.rect
+}
+
+// SetStyle sets the style the text is drawn in.
+func (tr *TextRegion) SetStyle(style Style) {
+	tr.style = style
+}
+
+// Lines returns the text as it is wrapped.  The lines belong to the
+// region, and must not be modified.
+func (tr *TextRegion) Lines() []string {
+	return tr.lines
+}
+
+// SetOffset scrolls the region so that the line numbered n, counted from
+// zero, is at the top.  The offset is kept within the text, so that the
+// rectangle is full wherever the text is long enough to fill it.
+func (tr *TextRegion) SetOffset(n int) {
+	if max := len(tr.lines) - tr.rect.Height; n > max {
+		n = max
+	}
+	if n < 0 {
+		n = 0
+	}
+	tr.top = n
+}
+
+// Offset returns the number of the line at the top.
+func (tr *TextRegion) Offset() int {
+	return tr.top
+}
+
+// Scroll scrolls the region down by n lines, or up if n is negative.
+func (tr *TextRegion) Scroll(n int) {
+	tr.SetOffset(tr.top + n)
+}
+
+// ScrollToEnd scrolls the region so that the last line is at the bottom.
+func (tr *TextRegion) ScrollToEnd() {
+	tr.SetOffset(len(tr.lines))
+}
+
+// Draw draws the lines that are scrolled into view, and clears the rest
+// of the rectangle.  A combining character is drawn in the cell of the
+// character it follows, and a wide character takes two cells.  Control
+// characters, such as tabs, are drawn as spaces.
+func (tr *TextRegion) Draw(dst ContentSetter) {
+	r := tr.rect
+	var combc []rune
+	for row := 0; row < r.Height; row++ {
+		line := ""
+		if tr.top+row < len(tr.lines) {
+			line = tr.lines[tr.top+row]
+		}
+		x, y := r.X, r.Y+row
+		for len(line) > 0 {
+			var mainc rune
+			var n, width int
+			mainc, combc, n, width = splitCluster(line, combc)
+			if x+width > r.X+r.Width {
+				break
+			}
+			if len(combc) == 0 {
+				dst.SetContent(x, y, mainc, nil, tr.style)
+			} else {
+				dst.SetContent(x, y, mainc, combc, tr.style)
+			}
+			x += width
+			line = line[n:]
+		}
+		for ; x < r.X+r.Width; x++ {
+			dst.SetContent(x, y, ' ', nil, tr.style)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextRegion(t *testing.T) {
+	cb := &CellBuffer{}
+	cb.Resize(10, 4)
+	cb.Fill('#', StyleDefault)
+
+	tr := NewTextRegion("one two three 世界x é̂nd", Rect{X: 1, Y: 1, Width: 5, Height: 2}, StyleDefault)
+	if lines := tr.Lines(); !reflect.DeepEqual(lines, []string{"one", "two", "three", "世界x", "é̂nd"}) {
+		t.Errorf("Bad lines %q", lines)
+	}
+	row := func(y int) string {
+		s := ""
+		for x := 0; x < 10; {
+			mainc, combc, _, w := cb.GetContent(x, y)
+			s += string(mainc) + string(combc)
+			x += w
+		}
+		return s
+	}
+
+	tr.Draw(cb)
+	if r := row(1); r != "#one  ####" {
+		t.Errorf("Bad row 1 %q", r)
+	}
+	if r := row(2); r != "#two  ####" {
+		t.Errorf("Bad row 2 %q", r)
+	}
+	if r := row(3); r != "##########" {
+		t.Errorf("Drew outside the region: %q", r)
+	}
+
+	tr.Scroll(100)
+	if tr.Offset() != 3 {
+		t.Errorf("Bad offset %d", tr.Offset())
+	}
+	tr.Draw(cb)
+	if r := row(1); r != "#世界x####" {
+		t.Errorf("Bad wide row %q", r)
+	}
+	if r := row(2); r != "#é̂nd  ####" {
+		t.Errorf("Bad combining row %q", r)
+	}
+
+	// Narrowing the region wraps again, and keeps the offset in range.
+	tr.SetRect(Rect{X: 1, Y: 1, Width: 3, Height: 3})
+	tr.ScrollToEnd()
+	if n := len(tr.Lines()); tr.Offset() != n-3 {
+		t.Errorf("Bad offset %d for %d lines", tr.Offset(), n)
+	}
+	tr.SetText("short")
+	if tr.Offset() != 0 {
+		t.Errorf("Offset not clamped: %d", tr.Offset())
+	}
+
+	// A wide character that cannot fit is left out.
+	tr = NewTextRegion("世", Rect{Width: 1, Height: 1}, StyleDefault)
+	tr.Draw(cb)
+	if mainc, _, _, _ := cb.GetContent(0, 0); mainc != ' ' {
+		t.Errorf("Wide character drawn in one cell")
+	}
+}
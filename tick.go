@@ -0,0 +1,115 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"time"
+)
+
+// EventTick is posted at the interval given to StartTicker.  It lets
+// spinners, progress bars and the like update from the same loop that
+// handles input, rather than from a goroutine of their own.
+type EventTick struct {
+	t       time.Time
+	skipped int
+}
+
+// When returns the time when the Event was created.
+func (ev *EventTick) When() time.Time {
+	return ev.t
+}
+
+// Skipped returns the number of ticks that were dropped, since the
+// previous one was posted, because the event queue was congested.
+// Animations that step by time rather than by tick can ignore this.
+func (ev *EventTick) Skipped() int {
+	return ev.skipped
+}
+
+func (ev *EventTick) EscSeq() string {
+	return ""
+}
+
+// ticker implements StartTicker for the screens.  A tick is only posted
+// when nothing else is waiting in the event queue; otherwise it is
+// counted and folded into the next one, so that an application that
+// falls behind does not then have a backlog of stale ticks to work
+// through.  The zero value is stopped.  The owning screen serializes
+// calls to the methods.
+type ticker struct {
+	dur     time.Duration
+	stopq   chan struct{}
+	last    time.Time
+	skipped int
+}
+
+// Set changes the interval, stopping any running ticker.  Run must be
+// called again to restart it.
+func (tk *ticker) Set(d time.Duration) {
+	tk.Stop()
+	tk.dur = d
+	tk.last = time.Now()
+	tk.skipped = 0
+}
+
+// Run starts a goroutine posting ticks until Stop is called or quit is
+// closed.  Post must not block, and should fail if the queue is busy.
+func (tk *ticker) Run(quit chan struct{}, post func(Event) error) {
+	if tk.dur > 0 && tk.stopq == nil && quit != nil {
+		tk.stopq = make(chan struct{})
+		go tk.loop(tk.dur, tk.stopq, quit, post)
+	}
+}
+
+func (tk *ticker) Stop() {
+	if tk.stopq != nil {
+		close(tk.stopq)
+		tk.stopq = nil
+	}
+}
+
+// Poll posts a tick if one is due.  It is used instead of Run when the
+// screen is pumped by hand.
+func (tk *ticker) Poll(now time.Time, post func(Event) error) {
+	if tk.dur <= 0 || now.Sub(tk.last) < tk.dur {
+		return
+	}
+	tk.last = now
+	if post(&EventTick{t: now, skipped: tk.skipped}) != nil {
+		tk.skipped++
+		return
+	}
+	tk.skipped = 0
+}
+
+func (tk *ticker) loop(d time.Duration, stop, quit chan struct{}, post func(Event) error) {
+	tick := time.NewTicker(d)
+	defer tick.Stop()
+	skipped := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-quit:
+			return
+		case now := <-tick.C:
+			if post(&EventTick{t: now, skipped: skipped}) != nil {
+				skipped++
+				continue
+			}
+			skipped = 0
+		}
+	}
+}
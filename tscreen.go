@@ -17,18 +17,23 @@ package tcell
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 
 	"github.com/zyedidia/tcell/v2/terminfo"
 
@@ -50,34 +55,128 @@ const (
 
 	pasteOSC52Begin = "\x1b]52;"
 	pasteOSC52End   = "\x1b\\"
+)
+
+// There is no terminfo capability for rapid blink, so we send the
+// ECMA-48 sequence, but only to terminals that claim to blink at all.
+const (
+	rapidBlink = "\x1b[6m"
 
 	setTitle = "\x1b]2;title\a"
 )
 
+// The palette is changed with the xterm OSC 4 sequence, and restored
+// with OSC 104.  Terminals that do not understand these ignore them.
+const (
+	setPalette   = "\x1b]4;%d;rgb:%02x/%02x/%02x\x1b\\"
+	resetPalette = "\x1b]104\x1b\\"
+)
+
+// Inline mode clears just the live region, which needs clear to end of
+// screen.  The terminfo data we carry lacks "ed", but it is universal.
+const clearEOS = "\x1b[J"
+
+// Runs of blank cells left by ClearRect and ClearLine are erased, rather
+// than overwritten with spaces, using the ECMA-48 erase in line and erase
+// character sequences, where the run is long enough to be shorter that
+// way.  These are not in our terminfo data either.  Erase in line is as
+// old as the vt100, so it is sent to terminals that use ECMA-48 sequences
+// to clear the screen, but erase character is only sent to eraseTerms.
+const (
+	clearEOL = "\x1b[K"
+	eraseChr = "\x1b[%dX"
+	eraseMin = 8
+)
+
+// eraseTerms lists the terminals known to have erase character.
+var eraseTerms = []string{
+	"alacritty",
+	"foot",
+	"gnome",
+	"kitty",
+	"konsole",
+	"linux",
+	"mintty",
+	"putty",
+	"rxvt",
+	"screen",
+	"tmux",
+	"vte",
+	"wezterm",
+	"xterm",
+}
+
+// Default limits on the amount of input that will be buffered while
+// waiting for an escape sequence or a paste to complete.  These keep
+// malformed input (such as an OSC that is never terminated) from growing
+// our buffers without bound.
+const (
+	defaultSeqLimit   = 4096
+	defaultPasteLimit = 16 << 20
+)
+
+// While a window is being dragged, the terminal sends a stream of
+// SIGWINCH.  We wait for them to settle this long before resizing.
+const defaultResizeDelay = time.Millisecond * 50
+
+// TermFallbacks lists the terminals tried in turn by NewTerminfoScreen
+// when $TERM is empty, as it often is in containers and under service
+// managers.  The first that can be found is used.  It can be changed
+// before the screen is created, and emptied to fail instead.  There is
+// no point in listing "dumb", which cannot position the cursor.
+var TermFallbacks = []string{
+	"xterm-256color",
+	"ansi",
+}
+
 // NewTerminfoScreen returns a Screen that uses the stock TTY interface
 // and POSIX termios, combined with a terminfo description taken from
 // the $TERM environment variable.  It returns an error if the terminal
-// is not supported for any reason.
+// is not supported for any reason.  If $TERM is empty, the terminals in
+// TermFallbacks are tried instead.
 //
 // For terminals that do not support dynamic resize events, the $LINES
 // $COLUMNS environment variables can be set to the actual window size,
 // otherwise defaults taken from the terminal database are used.
 func NewTerminfoScreen() (Screen, error) {
-	ti, e := terminfo.LookupTerminfo(os.Getenv("TERM"))
+	term := os.Getenv("TERM")
+	if term != "" {
+		return NewTerminfoScreenForTerm(term)
+	}
+	for _, name := range TermFallbacks {
+		if t, e := newTScreen(name); e == nil {
+			return t, nil
+		}
+	}
+	return nil, ErrTermNotFound
+}
+
+// NewTerminfoScreenForTerm is like NewTerminfoScreen, but uses the named
+// terminal, whatever $TERM says, and has no fallbacks.
+func NewTerminfoScreenForTerm(term string) (Screen, error) {
+	t, e := newTScreen(term)
+	if e != nil {
+		return nil, e
+	}
+	return t, nil
+}
+
+// newTScreen returns a screen for the named terminal, which is not yet
+// attached to anything.
+func newTScreen(term string) (*tScreen, error) {
+	ti, e := terminfo.LookupTerminfo(term)
 	if e != nil {
-		ti, e = loadDynamicTerminfo(os.Getenv("TERM"))
+		ti, e = loadDynamicTerminfo(term)
 		if e != nil {
 			return nil, e
 		}
 		terminfo.AddTerminfo(ti)
 	}
-	t := &tScreen{ti: ti}
+	t := &tScreen{ti: ti, sharedti: ti}
 
 	t.keyexist = make(map[Key]bool)
 	t.keycodes = make(map[string]*tKeyCode)
-	if len(ti.Mouse) > 0 {
-		t.mouse = []byte(ti.Mouse)
-	}
+	t.setMouseSupport(len(ti.Mouse) > 0 || termIs(ti, mouseTerms))
 	t.prepareKeys()
 	t.buildAcsMap()
 	t.sigwinch = make(chan os.Signal, 10)
@@ -85,23 +184,317 @@ func NewTerminfoScreen() (Screen, error) {
 	for k, v := range RuneFallbacks {
 		t.fallback[k] = v
 	}
+	t.sgrok, t.sgrpre = t.checkSGR()
+	t.ecma48 = strings.HasPrefix(ti.Clear, "\x1b[")
+	t.ech = t.ecma48 && t.termIs(eraseTerms)
+	t.margin = findMargin(ti)
+	t.glyphs = glyphPolicy(ti)
+	t.seqmax = defaultSeqLimit
+	t.pastemax = defaultPasteLimit
+	t.rsdelay = defaultResizeDelay
+	t.bpaste = true
 
 	return t, nil
 }
 
+// openTrace opens the trace log named by $TCELL_TRACE, along with the
+// capability audit and output validator that write to it.  It is called
+// from Init, since finish closes them all.
+func (t *tScreen) openTrace() {
+	if name := os.Getenv("TCELL_TRACE"); name != "" {
+		f, e := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if e == nil {
+			t.trace = log.New(f, "tcell: ", log.Ltime|log.Lmicroseconds)
+		}
+	}
+	if t.trace == nil {
+		return
+	}
+	if os.Getenv("TERM") == "" {
+		t.trace.Printf("$TERM is empty, using %s", t.ti.Name)
+	}
+	if os.Getenv("TCELL_AUDIT") != "" {
+		t.audit = newCapAudit(t.ti)
+	}
+	if os.Getenv("TCELL_VALIDATE") != "" {
+		t.valid = newOutCheck(t.trace, func() (int, int) { return t.w, t.h })
+	}
+}
+
+// Some terminals only understand the ITU T.416 form of the 24-bit color
+// sequences, which separates the subparameters with colons.  Most accept
+// either, but a few older ones only accept semicolons.
+const (
+	rgbColonFg   = "\x1b[38:2::%p1%d:%p2%d:%p3%dm"
+	rgbColonBg   = "\x1b[48:2::%p1%d:%p2%d:%p3%dm"
+	rgbColonFgBg = "\x1b[38:2::%p1%d:%p2%d:%p3%d;48:2::%p4%d:%p5%d:%p6%dm"
+	rgbSemiFg    = "\x1b[38;2;%p1%d;%p2%d;%p3%dm"
+	rgbSemiBg    = "\x1b[48;2;%p1%d;%p2%d;%p3%dm"
+	rgbSemiFgBg  = "\x1b[38;2;%p1%d;%p2%d;%p3%d;48;2;%p4%d;%p5%d;%p6%dm"
+)
+
+// XTWINOPS can ask the terminal emulator to resize its window, but
+// terminfo says nothing about it, and emulators that do not support it
+// may misbehave, so we only send it to those known to understand it.
+const resizeWindow = "\x1b[8;%d;%dt"
+
+var resizeTerms = []string{
+	"xterm",
+	"mintty",
+	"dtterm",
+}
+
+// sgrMouseMode is the mouse mode that xterm's terminfo entry gives, to
+// report button presses and drags in the SGR form.  Nearly every emulator
+// supports it, including many whose terminfo entries omit the mouse.
+const sgrMouseMode = "%?%p1%{1}%=%t%'h'%Pa%e%'l'%Pa%;\x1b[?1000%ga%c\x1b[?1002%ga%c\x1b[?1006%ga%c"
+
+// mouseTerms lists the terminals known to support the SGR mouse, even
+// where the terminal database says they have none.
+var mouseTerms = []string{
+	"xterm",
+	"rxvt",
+	"screen",
+	"tmux",
+	"alacritty",
+	"kitty",
+	"foot",
+	"mintty",
+	"vte",
+	"gnome",
+	"konsole",
+	"wezterm",
+}
+
+// The kitty keyboard protocol is what reports the lock keys.  We push
+// flags that disambiguate the keys (1), report alternate keys (4), report
+// all keys, even those that produce text, as escape codes (8), and report
+// the text they produce (16).  Without 8 the lock keys are only reported
+// for keys that produce no text.  We then ask for the flags in effect,
+// which only a terminal that has the protocol reports.  Until it does,
+// its sequences are not parsed, lest a reply be taken for a key.
+const (
+	kittyPush  = "\x1b[>29u"
+	kittyQuery = "\x1b[?u"
+	kittyPop   = "\x1b[<u"
+)
+
+// kittyTerms lists the terminals known to have the kitty keyboard
+// protocol.  Others are not sent it, as some take CSI u for restoring
+// the cursor.
+var kittyTerms = []string{
+	"kitty",
+	"foot",
+	"wezterm",
+	"alacritty",
+	"ghostty",
+}
+
+// cursorTerms lists the terminals known to accept DECSCUSR to change the
+// shape of the cursor.  Others get a software cursor for any shape but
+// the default.
+var cursorTerms = []string{
+	"xterm",
+	"rxvt",
+	"screen",
+	"tmux",
+	"alacritty",
+	"kitty",
+	"foot",
+	"mintty",
+	"vte",
+	"gnome",
+	"konsole",
+}
+
+// attrQuirks lists the attributes that terminals are known to ignore,
+// although their terminfo entries have strings for them.
+var attrQuirks = []struct {
+	name  string
+	attrs AttrMask
+}{
+	{"alacritty", AttrBlink | AttrRapidBlink},
+	{"kitty", AttrBlink | AttrRapidBlink},
+}
+
+// rgbColonTerms lists the terminals known to need the colon form.
+var rgbColonTerms = []string{
+	"mintty",
+}
+
+// setRGBForm selects the form of the 24-bit color sequences, as set by
+// SetRGBSeparator.  By default the terminfo strings are used as they
+// are, unless the terminal is known to need the colon form.  The user
+// can force one form or the other, whatever the application chose, by
+// setting $TCELL_RGBSEP to "colon" or "semicolon".
+func (t *tScreen) setRGBForm() {
+	sep := t.rgbsep
+	switch os.Getenv("TCELL_RGBSEP") {
+	case "colon":
+		sep = RGBSepColon
+	case "semicolon":
+		sep = RGBSepSemicolon
+	}
+	if sep == RGBSepAuto && t.termIs(rgbColonTerms) {
+		sep = RGBSepColon
+	}
+
+	// The terminfo entry is shared, so we modify our own copy.
+	ti := *t.sharedti
+	switch sep {
+	case RGBSepColon:
+		ti.SetFgRGB, ti.SetBgRGB, ti.SetFgBgRGB = rgbColonFg, rgbColonBg, rgbColonFgBg
+	case RGBSepSemicolon:
+		ti.SetFgRGB, ti.SetBgRGB, ti.SetFgBgRGB = rgbSemiFg, rgbSemiBg, rgbSemiFgBg
+	}
+	t.ti = &ti
+}
+
+func (t *tScreen) SetRGBSeparator(sep RGBSeparator) {
+	t.Lock()
+	defer t.Unlock()
+	t.rgbsep = sep
+	if t.truecolor && t.quit != nil && !t.fini {
+		t.setRGBForm()
+		t.curstyle = styleInvalid
+		t.cells.Invalidate()
+	}
+}
+
+// marginTerms are the terminals that wrap as soon as the last column is
+// written to (they have "am" without "xenl"), so that writing the bottom
+// right cell scrolls the screen.  The strings start and end inserting a
+// character; like the quirks above, these are not in our terminfo data.
+// Where there is no way to insert, the corner is left blank.
+var marginTerms = []marginQuirk{
+	{"aixterm", "\x1b[4h", "\x1b[4l"},
+	{"ansi", "\x1b[@", ""},
+	{"cygwin", "\x1b[@", ""},
+	{"hpterm", "\x1bQ", "\x1bR"},
+	{"pcansi", "", ""},
+	{"sun", "\x1b[@", ""},
+	{"wy50", "\x1bq", "\x1br"},
+	{"wy60", "\x1bq", "\x1br"},
+}
+
+type marginQuirk struct {
+	name   string
+	insert string
+	endins string
+}
+
+// findMargin returns the margin quirk for the terminal, if it has one.
+func findMargin(ti *terminfo.Terminfo) *marginQuirk {
+	for i := range marginTerms {
+		if termIs(ti, []string{marginTerms[i].name}) {
+			return &marginTerms[i]
+		}
+	}
+	return nil
+}
+
+// termIs reports whether the terminal's name or one of its aliases
+// starts with one of the given names.
+func (t *tScreen) termIs(names []string) bool {
+	return termIs(t.ti, names)
+}
+
+func termIs(ti *terminfo.Terminfo, names []string) bool {
+	for _, name := range append([]string{ti.Name}, ti.Aliases...) {
+		for _, q := range names {
+			if strings.HasPrefix(name, q) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // tKeyCode represents a combination of a key code and modifiers.
 type tKeyCode struct {
 	key Key
 	mod ModMask
 }
 
+// tInput is a stream of input bytes for the parser.  The terminal itself
+// is origin zero; others may be added with AddInput.  Each stream has its
+// own buffer and escape state, so that a partial sequence from one is never
+// spliced together with data from another.
+type tInput struct {
+	origin  int
+	r       io.Reader
+	buf     bytes.Buffer
+	escbuf  bytes.Buffer
+	escaped bool
+	pscan   int
+	expire  time.Time
+	arrived time.Time
+	held    *EventKey
+}
+
+// pending returns true if there is input that has not been delivered.
+func (in *tInput) pending() bool {
+	return in.buf.Len() > 0 || in.held != nil
+}
+
+// combine attaches combining marks to the rune before them.  The last
+// rune is held back, as its marks may not have arrived yet, unless flush
+// is true.
+func (in *tInput) combine(evs []Event, flush bool) []Event {
+	res := make([]Event, 0, len(evs)+1)
+	if in.held != nil {
+		res = append(res, in.held)
+		in.held = nil
+	}
+	for _, ev := range evs {
+		k, ok := ev.(*EventKey)
+		if ok && k.key == KeyRune && unicode.In(k.ch, unicode.Mn, unicode.Me) && len(res) > 0 {
+			if base, ok := res[len(res)-1].(*EventKey); ok && base.key == KeyRune {
+				base.comb = append(base.comb, k.ch)
+				base.esc += k.esc
+				continue
+			}
+		}
+		res = append(res, ev)
+	}
+	if !flush && len(res) > 0 {
+		if k, ok := res[len(res)-1].(*EventKey); ok && k.key == KeyRune {
+			in.held = k
+			res = res[:len(res)-1]
+		}
+	}
+	return res
+}
+
+// addInput adds data read at the given time to the buffer.
+func (in *tInput) addInput(data []byte, at time.Time) {
+	if in.buf.Len() == 0 {
+		in.arrived = at
+	}
+	in.buf.Write(data)
+	in.expire = time.Now().Add(time.Millisecond * 50)
+}
+
+// tChunk is a block of data read from an input stream.
+type tChunk struct {
+	in   *tInput
+	data []byte
+	at   time.Time
+}
+
+// errInputStopped is returned by a terminal reader that was interrupted,
+// because the screen is being finalized.
+var errInputStopped = errors.New("input stopped")
+
 // tScreen represents a screen backed by a terminfo implementation.
 type tScreen struct {
 	ti        *terminfo.Terminfo
+	sharedti  *terminfo.Terminfo // ti as looked up, before setRGBForm
 	h         int
 	w         int
 	fini      bool
 	cells     CellBuffer
+	shown     CellBuffer
 	in        io.Reader
 	out       io.Writer
 	buffering bool // true if we are collecting writes to buf instead of sending directly to out
@@ -114,50 +507,158 @@ type tScreen struct {
 	sigwinch  chan os.Signal
 	quit      chan struct{}
 	indoneq   chan struct{}
+	inputq    chan struct{}
 	keyexist  map[Key]bool
 	keycodes  map[string]*tKeyCode
-	keychan   chan []byte
+	keydups   []KeyConflict
+	keychan   chan tChunk
+	input     *tInput
+	inputs    []*tInput
 	keytimer  *time.Timer
-	keyexpire time.Time
 	cx        int
 	cy        int
 	mouse     []byte
 	clear     bool
 	cursorx   int
 	cursory   int
+	cshape    CursorStyle
+	cshown    int
+	cblink    cursorBlink
+	softreq   bool
+	softcur   bool
+	extra     cursorSet
+	curstack  cursorStack
 	tiosp     *termiosPrivate
+	nulltty   *nullTty
 	wasbtn    bool
 	acs       map[rune]string
 	charset   string
+	usercs    string
+	incs      string
+	outcs     string
+	utf8in    bool
+	utf8pol   UTF8Policy
+	noseq     bool
+	bsnorm    bool
+	noescalt  bool
 	encoder   transform.Transformer
 	decoder   transform.Transformer
 	fallback  map[rune]string
-	colors    map[Color]Color
-	palette   []Color
+	encs      screenEncodings
+	colors    *colorCache
+	palette   []int32
+	palset    bool
+	syscolor  bool
 	truecolor bool
+	rgbsep    RGBSeparator
 	escaped   bool
 	buttondn  bool
 	rawseq    []string
+	seqmax    int
+	pastemax  int
+	restrict  bool
+	blinkdur  time.Duration
+	blinkct   int
+	blinkq    chan struct{}
+	boldbrt   bool
+	sgrok     bool
+	sgrpre    string
+	ecma48    bool
+	ech       bool
+	erased    []Rect
+	margin    *marginQuirk
+	glyphs    GlyphPolicy
+	minsz     minSize
+	onresize  func(int, int)
+	textw     textWatch
+	laidw     int
+	laidh     int
+	budget    int
+	degrade   Degrade
+	degraded  bool
+	manual    bool
+	evq       []Event
+	evlk      sync.Mutex
+	blinkat   time.Time
+	anims     animator
+	animq     chan struct{}
+	padding   Padding
+	baud      int
+	flushsz   int
+	inline    int
+	itop      int
+	rsdelay   time.Duration
+	fixw      int
+	fixh      int
+	rsat      time.Time
+	polldur   time.Duration
+	pollq     chan struct{}
+	pollat    time.Time
+	idledur   time.Duration
+	idleq     chan struct{}
+	lastin    time.Time
+	idle      bool
+	ticks     ticker
+	metrics   func(Metric, time.Duration)
+	trace     *log.Logger
+	audit     *capAudit
+	valid     *outCheck
+	frame     FrameInfo
+	mirrors   mirrors
+	diffs     diffMirrors
+	subs      subscribers
+	regions   regions
+	sel       selection
+	hl        selection
+	cliphist  clipHistory
+	queries   queries
+	bpaste    bool
+	mouseon   bool
+	mousemode string
+	rawpaste  bool
+	kittyon   bool
+	kitty     bool
+	combining bool
+	pscan     int
 	finiOnce  sync.Once
 
 	sync.Mutex
 }
 
 func (t *tScreen) Init() error {
+	// All of this is recreated, so that the screen can be initialized
+	// again after Fini.
 	t.evch = make(chan Event, 10)
+	t.evq = nil
+	t.finiOnce = sync.Once{}
 	t.indoneq = make(chan struct{})
-	t.keychan = make(chan []byte, 10)
+	t.inputq = make(chan struct{})
+	t.keychan = make(chan tChunk, 10)
+	t.input = &tInput{}
+	t.lastin = time.Now()
+	t.idle = false
 	t.rawseq = make([]string, 0, 4)
 	t.keytimer = time.NewTimer(time.Millisecond * 50)
 	t.charset = "UTF-8"
 
 	t.charset = getCharset()
-	if enc := GetEncoding(t.charset); enc != nil {
-		t.encoder = enc.NewEncoder()
-		t.decoder = enc.NewDecoder()
-	} else {
+	if t.usercs != "" {
+		t.charset = t.usercs
+	}
+	incs := t.charset
+	if t.incs != "" {
+		incs = t.incs
+	}
+	if t.outcs != "" {
+		t.charset = t.outcs
+	}
+	enc, dec := t.encs.Get(t.charset), t.encs.Get(incs)
+	if enc == nil || dec == nil {
 		return ErrNoCharset
 	}
+	t.encoder = enc.NewEncoder()
+	t.decoder = dec.NewDecoder()
+	t.utf8in = normalizeCharset(incs) == "UTF-8"
 	ti := t.ti
 
 	// environment overrides
@@ -169,9 +670,12 @@ func (t *tScreen) Init() error {
 	if i, _ := strconv.Atoi(os.Getenv("COLUMNS")); i != 0 {
 		w = i
 	}
-	if e := t.termioInit(); e != nil {
+	if t.nulltty != nil {
+		t.out = t.nulltty
+	} else if e := t.termioInit(); e != nil {
 		return e
 	}
+	t.openTrace()
 
 	if t.ti.SetFgBgRGB != "" || t.ti.SetFgRGB != "" || t.ti.SetBgRGB != "" {
 		t.truecolor = true
@@ -181,23 +685,45 @@ func (t *tScreen) Init() error {
 	if os.Getenv("TCELL_TRUECOLOR") == "disable" {
 		t.truecolor = false
 	}
-	t.colors = make(map[Color]Color)
-	t.palette = make([]Color, t.nColors())
-	for i := 0; i < t.nColors(); i++ {
-		t.palette[i] = Color(i) | ColorValid
-		// identity map for our builtin colors
-		t.colors[Color(i)|ColorValid] = Color(i) | ColorValid
+	if t.truecolor {
+		t.setRGBForm()
 	}
+	t.palette = paletteValues(t.nColors())
+	t.resetColors()
 
-	t.TPuts(ti.EnterCA)
+	if t.inline > 0 {
+		// Make room for the live region below whatever is already
+		// on the terminal, rather than taking over the whole screen.
+		t.TPuts("\r" + strings.Repeat("\n", t.inline-1))
+	} else {
+		t.TPuts(ti.EnterCA)
+	}
 	t.TPuts(ti.HideCursor)
 	t.TPuts(ti.EnableAcs)
-	t.TPuts(ti.Clear)
-	t.TPuts(pasteEnable)
+	if t.inline == 0 {
+		t.TPuts(ti.Clear)
+	}
+	if t.bpaste && t.canPaste() {
+		t.TPuts(pasteEnable)
+	}
+	if t.mouseon {
+		t.TPuts(t.ti.TParm(t.mousemode, 1))
+	}
+	if !t.restrict && t.termIs(kittyTerms) {
+		t.TPuts(kittyPush + kittyQuery)
+		t.kittyon = true
+	}
 
 	t.quit = make(chan struct{})
+	if t.manual {
+		// There is no input loop for termioFini to wait on.
+		close(t.indoneq)
+		close(t.inputq)
+	}
 
 	t.Lock()
+	t.fini = false
+	t.rsat = time.Time{}
 	t.cx = -1
 	t.cy = -1
 	t.style = StyleDefault
@@ -207,111 +733,619 @@ func (t *tScreen) Init() error {
 	t.resize()
 	t.Unlock()
 
+	if t.manual {
+		return nil
+	}
+
 	go t.mainLoop()
 	go t.inputLoop()
 
+	t.Lock()
+	for _, in := range t.inputs {
+		go t.readInput(in)
+	}
+	if t.blinkdur > 0 && t.blinkq == nil {
+		t.blinkq = make(chan struct{})
+		go t.blinkLoop(t.blinkdur/2, t.blinkq, t.quit)
+	}
+	if t.anims.Len() > 0 && t.animq == nil {
+		t.animq = make(chan struct{})
+		go t.animLoop(t.animq, t.quit)
+	}
+	if t.polldur > 0 && t.pollq == nil {
+		t.pollq = make(chan struct{})
+		go t.pollLoop(t.polldur, t.pollq, t.quit)
+	}
+	if t.idledur > 0 && t.idleq == nil {
+		t.idleq = make(chan struct{})
+		go t.idleLoop(t.idledur, t.idleq, t.quit)
+	}
+	t.ticks.Run(t.quit, t.postTick)
+	t.Unlock()
+
 	return nil
 }
 
-func (t *tScreen) SetPaste(p bool) {
-	t.paste = p
+func (t *tScreen) AddInput(r io.Reader) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.manual {
+		return 0, ErrNotSupported
+	}
+	in := &tInput{origin: len(t.inputs) + 1, r: r}
+	t.inputs = append(t.inputs, in)
+	if t.quit != nil && !t.fini {
+		go t.readInput(in)
+	}
+	return in.origin, nil
 }
 
-func (t *tScreen) RegisterRawSeq(r string) {
-	t.rawseq = append(t.rawseq, r)
+func (t *tScreen) SetManualPump(on bool) {
+	t.Lock()
+	if (t.quit == nil || t.fini) && t.nulltty == nil {
+		t.manual = on
+	}
+	t.Unlock()
 }
 
-func (t *tScreen) prepareKeyMod(key Key, mod ModMask, val string) {
-	if val != "" {
-		// Do not override codes that already exist
-		if _, exist := t.keycodes[val]; !exist {
-			t.keyexist[key] = true
-			t.keycodes[val] = &tKeyCode{key: key, mod: mod}
-		}
+func (t *tScreen) ProcessInput(p []byte) {
+	if !t.manual || t.input == nil {
+		return
 	}
+	in := t.input
+	in.addInput(p, time.Now())
+	t.scanInput(in, false)
 }
 
-func (t *tScreen) prepareKeyModReplace(key Key, replace Key, mod ModMask, val string) {
-	if val != "" {
-		// Do not override codes that already exist
-		if old, exist := t.keycodes[val]; !exist || old.key == replace {
-			t.keyexist[key] = true
-			t.keycodes[val] = &tKeyCode{key: key, mod: mod}
-		}
+func (t *tScreen) Tick() {
+	if !t.manual || t.input == nil {
+		return
+	}
+	now := time.Now()
+	t.Lock()
+	select {
+	case <-t.sigwinch:
+		t.rsat = now.Add(t.rsdelay)
+	default:
+	}
+	if !t.rsat.IsZero() && !now.Before(t.rsat) {
+		t.winch()
 	}
+	t.Unlock()
+
+	if in := t.input; in.pending() && now.After(in.expire) {
+		t.scanInput(in, true)
+	}
+
+	t.Lock()
+	if t.blinkdur > 0 && !t.fini && now.Sub(t.blinkat) >= t.blinkdur/2 {
+		t.blinkat = now
+		t.blinkct++
+		t.redraw(markBlinking)
+	}
+	if t.anims.Len() > 0 && !t.fini {
+		t.animate(now)
+	}
+	if t.polldur > 0 && !t.fini && now.Sub(t.pollat) >= t.polldur {
+		t.pollat = now
+		t.pollSize()
+	}
+	if t.idledur > 0 && !t.fini {
+		t.checkIdle(now)
+	}
+	if !t.fini {
+		t.ticks.Poll(now, t.postTick)
+	}
+	t.Unlock()
 }
 
-func (t *tScreen) prepareKeyModXTerm(key Key, val string) {
+func (t *tScreen) SetPaste(p bool) {
+	t.paste = p
+}
 
-	if strings.HasPrefix(val, "\x1b[") && strings.HasSuffix(val, "~") {
+func (t *tScreen) SetRawPaste(raw bool) {
+	t.Lock()
+	t.rawpaste = raw
+	t.Unlock()
+}
 
-		// Drop the trailing ~
-		val = val[:len(val)-1]
+func (t *tScreen) SetCombining(on bool) {
+	t.Lock()
+	t.combining = on
+	t.Unlock()
+}
 
-		// These suffixes are calculated assuming Xterm style modifier suffixes.
-		// Please see https://invisible-island.net/xterm/ctlseqs/ctlseqs.pdf for
-		// more information (specifically "PC-Style Function Keys").
-		t.prepareKeyModReplace(key, key+12, ModShift, val+";2~")
-		t.prepareKeyModReplace(key, key+48, ModAlt, val+";3~")
-		t.prepareKeyModReplace(key, key+60, ModAlt|ModShift, val+";4~")
-		t.prepareKeyModReplace(key, key+24, ModCtrl, val+";5~")
-		t.prepareKeyModReplace(key, key+36, ModCtrl|ModShift, val+";6~")
-		t.prepareKeyMod(key, ModAlt|ModCtrl, val+";7~")
-		t.prepareKeyMod(key, ModShift|ModAlt|ModCtrl, val+";8~")
-		t.prepareKeyMod(key, ModMeta, val+";9~")
-		t.prepareKeyMod(key, ModMeta|ModShift, val+";10~")
-		t.prepareKeyMod(key, ModMeta|ModAlt, val+";11~")
-		t.prepareKeyMod(key, ModMeta|ModAlt|ModShift, val+";12~")
-		t.prepareKeyMod(key, ModMeta|ModCtrl, val+";13~")
-		t.prepareKeyMod(key, ModMeta|ModCtrl|ModShift, val+";14~")
-		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt, val+";15~")
-		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt|ModShift, val+";16~")
-	} else if strings.HasPrefix(val, "\x1bO") && len(val) == 3 {
-		val = val[2:]
-		t.prepareKeyModReplace(key, key+12, ModShift, "\x1b[1;2"+val)
-		t.prepareKeyModReplace(key, key+48, ModAlt, "\x1b[1;3"+val)
-		t.prepareKeyModReplace(key, key+24, ModCtrl, "\x1b[1;5"+val)
-		t.prepareKeyModReplace(key, key+36, ModCtrl|ModShift, "\x1b[1;6"+val)
-		t.prepareKeyModReplace(key, key+60, ModAlt|ModShift, "\x1b[1;4"+val)
-		t.prepareKeyMod(key, ModAlt|ModCtrl, "\x1b[1;7"+val)
-		t.prepareKeyMod(key, ModShift|ModAlt|ModCtrl, "\x1b[1;8"+val)
-		t.prepareKeyMod(key, ModMeta, "\x1b[1;9"+val)
-		t.prepareKeyMod(key, ModMeta|ModShift, "\x1b[1;10"+val)
-		t.prepareKeyMod(key, ModMeta|ModAlt, "\x1b[1;11"+val)
-		t.prepareKeyMod(key, ModMeta|ModAlt|ModShift, "\x1b[1;12"+val)
-		t.prepareKeyMod(key, ModMeta|ModCtrl, "\x1b[1;13"+val)
-		t.prepareKeyMod(key, ModMeta|ModCtrl|ModShift, "\x1b[1;14"+val)
-		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt, "\x1b[1;15"+val)
-		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt|ModShift, "\x1b[1;16"+val)
+func (t *tScreen) RegisterRawSeq(r string) {
+	t.rawseq = append(t.rawseq, r)
+}
+
+func (t *tScreen) SetRestricted(restrict bool) {
+	t.Lock()
+	if t.bpaste && t.ecma48 && restrict != t.restrict && t.quit != nil && !t.fini {
+		if restrict {
+			t.TPuts(pasteDisable)
+		} else {
+			t.TPuts(pasteEnable)
+		}
 	}
+	t.restrict = restrict
+	t.Unlock()
 }
 
-func (t *tScreen) prepareXtermModifiers() {
-	if t.ti.Modifiers != terminfo.ModifiersXTerm {
-		return
+func (t *tScreen) SetSoftBlink(interval time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	if t.blinkq != nil {
+		close(t.blinkq)
+		t.blinkq = nil
+	}
+	t.blinkdur = interval
+	t.blinkct = 0
+	markBlinking(&t.cells)
+	if interval > 0 && t.quit != nil && !t.fini && !t.manual {
+		t.blinkq = make(chan struct{})
+		go t.blinkLoop(interval/2, t.blinkq, t.quit)
 	}
-	t.prepareKeyModXTerm(KeyRight, t.ti.KeyRight)
-	t.prepareKeyModXTerm(KeyLeft, t.ti.KeyLeft)
-	t.prepareKeyModXTerm(KeyUp, t.ti.KeyUp)
-	t.prepareKeyModXTerm(KeyDown, t.ti.KeyDown)
-	t.prepareKeyModXTerm(KeyInsert, t.ti.KeyInsert)
-	t.prepareKeyModXTerm(KeyDelete, t.ti.KeyDelete)
-	t.prepareKeyModXTerm(KeyPgUp, t.ti.KeyPgUp)
-	t.prepareKeyModXTerm(KeyPgDn, t.ti.KeyPgDn)
-	t.prepareKeyModXTerm(KeyHome, t.ti.KeyHome)
-	t.prepareKeyModXTerm(KeyEnd, t.ti.KeyEnd)
-	t.prepareKeyModXTerm(KeyF1, t.ti.KeyF1)
-	t.prepareKeyModXTerm(KeyF2, t.ti.KeyF2)
-	t.prepareKeyModXTerm(KeyF3, t.ti.KeyF3)
-	t.prepareKeyModXTerm(KeyF4, t.ti.KeyF4)
-	t.prepareKeyModXTerm(KeyF5, t.ti.KeyF5)
-	t.prepareKeyModXTerm(KeyF6, t.ti.KeyF6)
-	t.prepareKeyModXTerm(KeyF7, t.ti.KeyF7)
-	t.prepareKeyModXTerm(KeyF8, t.ti.KeyF8)
-	t.prepareKeyModXTerm(KeyF9, t.ti.KeyF9)
-	t.prepareKeyModXTerm(KeyF10, t.ti.KeyF10)
-	t.prepareKeyModXTerm(KeyF11, t.ti.KeyF11)
-	t.prepareKeyModXTerm(KeyF12, t.ti.KeyF12)
+}
+
+// blinkLoop toggles the visibility of blinking cells.  Each tick is a
+// half cycle of rapid blink, so normal blink changes every other tick.
+func (t *tScreen) blinkLoop(tick time.Duration, stop, quit chan struct{}) {
+	if tick <= 0 {
+		tick = 1
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-quit:
+			return
+		case <-ticker.C:
+			t.Lock()
+			if !t.fini {
+				t.blinkct++
+				t.redraw(markBlinking)
+			}
+			t.Unlock()
+		}
+	}
+}
+
+func (t *tScreen) SetAnimation(style Style, anim AnimatedStyle) {
+	t.Lock()
+	defer t.Unlock()
+	if t.animq != nil {
+		close(t.animq)
+		t.animq = nil
+	}
+	t.anims.Set(style, anim, time.Now())
+	markStyle(&t.cells, map[Style]bool{style: true})
+	if t.anims.Len() > 0 && t.quit != nil && !t.fini && !t.manual {
+		t.animq = make(chan struct{})
+		go t.animLoop(t.animq, t.quit)
+	}
+}
+
+// animLoop advances the animations each time one of them changes phase,
+// until they are changed.
+func (t *tScreen) animLoop(stop, quit chan struct{}) {
+	for {
+		t.Lock()
+		d := t.anims.Next(time.Now())
+		t.Unlock()
+		if d <= 0 {
+			return
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+			t.Lock()
+			if !t.fini {
+				t.animate(time.Now())
+			}
+			t.Unlock()
+		}
+	}
+}
+
+// animate advances the animations, and redraws the cells of those that
+// have changed phase.
+func (t *tScreen) animate(now time.Time) {
+	if changed := t.anims.Advance(now); changed != nil {
+		t.redraw(func(cb *CellBuffer) {
+			markStyle(cb, changed)
+		})
+	}
+}
+
+// markStyle marks all cells with the given styles dirty.
+func markStyle(cb *CellBuffer, styles map[Style]bool) {
+	w, h := cb.Size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if _, _, style, _ := cb.GetContent(x, y); styles[style] {
+				cb.SetDirty(x, y, true)
+			}
+		}
+	}
+}
+
+func (t *tScreen) SetMetrics(fn func(Metric, time.Duration)) {
+	t.Lock()
+	t.metrics = fn
+	t.Unlock()
+}
+
+func (t *tScreen) SetSizePoll(interval time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	if t.pollq != nil {
+		close(t.pollq)
+		t.pollq = nil
+	}
+	t.polldur = interval
+	if interval > 0 && t.quit != nil && !t.fini && !t.manual {
+		t.pollq = make(chan struct{})
+		go t.pollLoop(interval, t.pollq, t.quit)
+	}
+}
+
+func (t *tScreen) SetFixedSize(w, h int) {
+	t.Lock()
+	defer t.Unlock()
+	if w <= 0 || h <= 0 {
+		w, h = 0, 0
+	}
+	t.fixw, t.fixh = w, h
+	if t.quit != nil && !t.fini {
+		t.rsat = time.Time{}
+		t.pollSize()
+	}
+}
+
+func (t *tScreen) pollLoop(tick time.Duration, stop, quit chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-quit:
+			return
+		case <-ticker.C:
+			t.Lock()
+			if !t.fini {
+				t.pollSize()
+			}
+			t.Unlock()
+		}
+	}
+}
+
+func (t *tScreen) SetIdleTimeout(d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	if t.idleq != nil {
+		close(t.idleq)
+		t.idleq = nil
+	}
+	t.idledur = d
+	t.lastin = time.Now()
+	t.idle = false
+	if d > 0 && t.quit != nil && !t.fini && !t.manual {
+		t.idleq = make(chan struct{})
+		go t.idleLoop(d, t.idleq, t.quit)
+	}
+}
+
+func (t *tScreen) idleLoop(d time.Duration, stop, quit chan struct{}) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-quit:
+			return
+		case <-timer.C:
+			next := d
+			t.Lock()
+			if !t.fini {
+				next = t.checkIdle(time.Now())
+			}
+			t.Unlock()
+			timer.Reset(next)
+		}
+	}
+}
+
+func (t *tScreen) StartTicker(d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.ticks.Set(d)
+	if t.quit != nil && !t.fini && !t.manual {
+		t.ticks.Run(t.quit, t.postTick)
+	}
+}
+
+// postTick posts an EventTick, unless other events are already waiting,
+// in which case the tick would only add to the backlog.
+func (t *tScreen) postTick(ev Event) error {
+	if t.manual {
+		t.evlk.Lock()
+		busy := len(t.evq) > 0
+		t.evlk.Unlock()
+		if busy {
+			return ErrEventQFull
+		}
+	} else if len(t.evch) > 0 {
+		return ErrEventQFull
+	}
+	return t.PostEvent(ev)
+}
+
+// checkIdle posts an EventIdle if no input has arrived for the idle
+// timeout, and returns how long to wait before checking again.  While
+// idle there is nothing to do until input arrives, but it is simpler to
+// keep checking at the same, infrequent, rate.  If the event cannot be
+// posted, the screen is not idle yet, and the next check tries again.
+// The caller holds the lock.
+func (t *tScreen) checkIdle(now time.Time) time.Duration {
+	if left := t.lastin.Add(t.idledur).Sub(now); left > 0 {
+		return left
+	}
+	if !t.idle && t.PostEvent(&EventIdle{t: now, idle: true, since: t.lastin}) == nil {
+		t.idle = true
+	}
+	return t.idledur
+}
+
+// pollSize checks the window size, in case a change was not signaled,
+// and redraws everything if it has changed.  The caller holds the lock.
+func (t *tScreen) pollSize() {
+	if !t.rsat.IsZero() {
+		return // a signaled change is being handled already
+	}
+	w, h, top := t.w, t.h, t.itop
+	t.resize()
+	if t.w != w || t.h != h || t.itop != top {
+		t.cx = -1
+		t.cy = -1
+		t.redraw((*CellBuffer).Invalidate)
+	}
+}
+
+// markBlinking marks all cells with a blink attribute dirty, so that
+// they are redrawn in their new phase.
+func markBlinking(cb *CellBuffer) {
+	w, h := cb.Size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			_, _, style, _ := cb.GetContent(x, y)
+			if style.attrs&(AttrBlink|AttrRapidBlink) != 0 {
+				cb.SetDirty(x, y, true)
+			}
+		}
+	}
+}
+
+// blinkHidden reports whether text with the given blink attributes is
+// currently in the hidden phase of software blink.
+func (t *tScreen) blinkHidden(attrs AttrMask) bool {
+	if attrs&AttrRapidBlink != 0 {
+		return t.blinkct%2 == 1
+	}
+	return (t.blinkct/2)%2 == 1
+}
+
+func (t *tScreen) SetBoldAsBright(on bool) {
+	t.Lock()
+	t.boldbrt = on
+	t.curstyle = styleInvalid
+	t.cells.Invalidate()
+	t.Unlock()
+}
+
+func (t *tScreen) SetInline(rows int) {
+	t.Lock()
+	if t.quit == nil || t.fini {
+		if rows < 0 {
+			rows = 0
+		}
+		t.inline = rows
+	}
+	t.Unlock()
+}
+
+func (t *tScreen) Println(text string) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.inline == 0 {
+		return ErrNotSupported
+	}
+	if t.quit == nil || t.fini {
+		return ErrNoScreen
+	}
+
+	t.buf.Reset()
+	t.buffering = true
+
+	// Replace the live region with the new lines, which scroll the
+	// terminal as they go.  Then scroll the rest of the way, so that
+	// the lines end just above where the live region belongs.
+	t.hideCursor()
+	t.goTo(0, 0)
+	t.TPuts(t.ti.AttrOff)
+	t.curstyle = styleInvalid
+	t.TPuts(clearEOS)
+	rows := 0
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		// Each character is encoded with its combining marks, as it
+		// would be if it were drawn in a cell.
+		var b []byte
+		var combc []rune
+		for s := line; len(s) > 0; {
+			var mainc rune
+			var n, width int
+			mainc, combc, n, width = splitCluster(s, combc)
+			cb := t.encodeCluster(mainc, combc, nil)
+			if width > 1 && string(cb) == "?" {
+				cb = append(cb, ' ')
+			}
+			b = append(b, cb...)
+			s = s[n:]
+		}
+		t.writeString(string(b) + "\r\n")
+		if n := MeasureString(line); n > t.w && t.w > 0 {
+			rows += (n + t.w - 1) / t.w // wrapped
+		} else {
+			rows++
+		}
+	}
+	if scrolled := rows - (t.h - 1); scrolled > 0 {
+		rows -= scrolled
+	}
+	if rows > 0 {
+		t.goTo(0, t.h-1)
+		t.writeString(strings.Repeat("\n", rows))
+	}
+
+	t.mirrors.Write(t.buf.Bytes())
+	t.flush()
+	t.buffering = false
+
+	t.redraw((*CellBuffer).Invalidate)
+	return nil
+}
+
+func (t *tScreen) SetResizeDelay(d time.Duration) {
+	t.Lock()
+	t.rsdelay = d
+	t.Unlock()
+}
+
+func (t *tScreen) SetInputLimits(seq, paste int) {
+	t.Lock()
+	t.seqmax = seq
+	t.pastemax = paste
+	t.Unlock()
+}
+
+func (t *tScreen) prepareKeyMod(key Key, mod ModMask, val string) {
+	if val != "" {
+		// Do not override codes that already exist
+		if old, exist := t.keycodes[val]; !exist {
+			t.keyexist[key] = true
+			t.keycodes[val] = &tKeyCode{key: key, mod: mod}
+		} else {
+			t.keyConflict(val, old, key, mod)
+		}
+	}
+}
+
+func (t *tScreen) prepareKeyModReplace(key Key, replace Key, mod ModMask, val string) {
+	if val != "" {
+		// Do not override codes that already exist
+		if old, exist := t.keycodes[val]; !exist || old.key == replace {
+			t.keyexist[key] = true
+			t.keycodes[val] = &tKeyCode{key: key, mod: mod}
+		} else {
+			t.keyConflict(val, old, key, mod)
+		}
+	}
+}
+
+// keyConflict records that the key could not be given the sequence,
+// since it already belongs to another.
+func (t *tScreen) keyConflict(val string, old *tKeyCode, key Key, mod ModMask) {
+	if old.key == key && old.mod == mod {
+		return
+	}
+	t.keydups = append(t.keydups, KeyConflict{
+		Seq:   KeySequence{Seq: val, Key: old.key, Mod: old.mod},
+		Other: KeySequence{Seq: val, Key: key, Mod: mod},
+	})
+}
+
+func (t *tScreen) prepareKeyModXTerm(key Key, val string) {
+
+	if strings.HasPrefix(val, "\x1b[") && strings.HasSuffix(val, "~") {
+
+		// Drop the trailing ~
+		val = val[:len(val)-1]
+
+		// These suffixes are calculated assuming Xterm style modifier suffixes.
+		// Please see https://invisible-island.net/xterm/ctlseqs/ctlseqs.pdf for
+		// more information (specifically "PC-Style Function Keys").
+		t.prepareKeyModReplace(key, key+12, ModShift, val+";2~")
+		t.prepareKeyModReplace(key, key+48, ModAlt, val+";3~")
+		t.prepareKeyModReplace(key, key+60, ModAlt|ModShift, val+";4~")
+		t.prepareKeyModReplace(key, key+24, ModCtrl, val+";5~")
+		t.prepareKeyModReplace(key, key+36, ModCtrl|ModShift, val+";6~")
+		t.prepareKeyMod(key, ModAlt|ModCtrl, val+";7~")
+		t.prepareKeyMod(key, ModShift|ModAlt|ModCtrl, val+";8~")
+		t.prepareKeyMod(key, ModMeta, val+";9~")
+		t.prepareKeyMod(key, ModMeta|ModShift, val+";10~")
+		t.prepareKeyMod(key, ModMeta|ModAlt, val+";11~")
+		t.prepareKeyMod(key, ModMeta|ModAlt|ModShift, val+";12~")
+		t.prepareKeyMod(key, ModMeta|ModCtrl, val+";13~")
+		t.prepareKeyMod(key, ModMeta|ModCtrl|ModShift, val+";14~")
+		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt, val+";15~")
+		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt|ModShift, val+";16~")
+	} else if strings.HasPrefix(val, "\x1bO") && len(val) == 3 {
+		val = val[2:]
+		t.prepareKeyModReplace(key, key+12, ModShift, "\x1b[1;2"+val)
+		t.prepareKeyModReplace(key, key+48, ModAlt, "\x1b[1;3"+val)
+		t.prepareKeyModReplace(key, key+24, ModCtrl, "\x1b[1;5"+val)
+		t.prepareKeyModReplace(key, key+36, ModCtrl|ModShift, "\x1b[1;6"+val)
+		t.prepareKeyModReplace(key, key+60, ModAlt|ModShift, "\x1b[1;4"+val)
+		t.prepareKeyMod(key, ModAlt|ModCtrl, "\x1b[1;7"+val)
+		t.prepareKeyMod(key, ModShift|ModAlt|ModCtrl, "\x1b[1;8"+val)
+		t.prepareKeyMod(key, ModMeta, "\x1b[1;9"+val)
+		t.prepareKeyMod(key, ModMeta|ModShift, "\x1b[1;10"+val)
+		t.prepareKeyMod(key, ModMeta|ModAlt, "\x1b[1;11"+val)
+		t.prepareKeyMod(key, ModMeta|ModAlt|ModShift, "\x1b[1;12"+val)
+		t.prepareKeyMod(key, ModMeta|ModCtrl, "\x1b[1;13"+val)
+		t.prepareKeyMod(key, ModMeta|ModCtrl|ModShift, "\x1b[1;14"+val)
+		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt, "\x1b[1;15"+val)
+		t.prepareKeyMod(key, ModMeta|ModCtrl|ModAlt|ModShift, "\x1b[1;16"+val)
+	}
+}
+
+func (t *tScreen) prepareXtermModifiers() {
+	if t.ti.Modifiers != terminfo.ModifiersXTerm {
+		return
+	}
+	t.prepareKeyModXTerm(KeyRight, t.ti.KeyRight)
+	t.prepareKeyModXTerm(KeyLeft, t.ti.KeyLeft)
+	t.prepareKeyModXTerm(KeyUp, t.ti.KeyUp)
+	t.prepareKeyModXTerm(KeyDown, t.ti.KeyDown)
+	t.prepareKeyModXTerm(KeyInsert, t.ti.KeyInsert)
+	t.prepareKeyModXTerm(KeyDelete, t.ti.KeyDelete)
+	t.prepareKeyModXTerm(KeyPgUp, t.ti.KeyPgUp)
+	t.prepareKeyModXTerm(KeyPgDn, t.ti.KeyPgDn)
+	t.prepareKeyModXTerm(KeyHome, t.ti.KeyHome)
+	t.prepareKeyModXTerm(KeyEnd, t.ti.KeyEnd)
+	t.prepareKeyModXTerm(KeyF1, t.ti.KeyF1)
+	t.prepareKeyModXTerm(KeyF2, t.ti.KeyF2)
+	t.prepareKeyModXTerm(KeyF3, t.ti.KeyF3)
+	t.prepareKeyModXTerm(KeyF4, t.ti.KeyF4)
+	t.prepareKeyModXTerm(KeyF5, t.ti.KeyF5)
+	t.prepareKeyModXTerm(KeyF6, t.ti.KeyF6)
+	t.prepareKeyModXTerm(KeyF7, t.ti.KeyF7)
+	t.prepareKeyModXTerm(KeyF8, t.ti.KeyF8)
+	t.prepareKeyModXTerm(KeyF9, t.ti.KeyF9)
+	t.prepareKeyModXTerm(KeyF10, t.ti.KeyF10)
+	t.prepareKeyModXTerm(KeyF11, t.ti.KeyF11)
+	t.prepareKeyModXTerm(KeyF12, t.ti.KeyF12)
 }
 
 func (t *tScreen) prepareKey(key Key, val string) {
@@ -398,6 +1432,7 @@ func (t *tScreen) prepareKeys() {
 	t.prepareKey(KeyHelp, ti.KeyHelp)
 	t.prepareKey(KeyPrint, ti.KeyPrint)
 	t.prepareKey(KeyCancel, ti.KeyCancel)
+	t.prepareKey(KeyKPEnter, ti.KeyEnter)
 	t.prepareKey(KeyExit, ti.KeyExit)
 	t.prepareKey(KeyBacktab, ti.KeyBacktab)
 
@@ -481,6 +1516,7 @@ func (t *tScreen) prepareKeys() {
 		t.prepareKey(KeyRight, "\x1bOC")
 		t.prepareKey(KeyLeft, "\x1bOD")
 		t.prepareKey(KeyHome, "\x1bOH")
+		t.prepareKey(KeyKPEnter, "\x1bOM")
 	}
 
 	t.prepareXtermModifiers()
@@ -511,8 +1547,46 @@ outer:
 	}
 }
 
-func (t *tScreen) Fini() {
-	t.finiOnce.Do(t.finish)
+func (t *tScreen) BindSequence(seq string, key Key, mod ModMask) {
+	if seq == "" {
+		return
+	}
+	t.Lock()
+	t.keycodes[seq] = &tKeyCode{key: key, mod: mod}
+	t.keyexist[key] = true
+	t.Unlock()
+}
+
+func (t *tScreen) KeySequences() []KeySequence {
+	t.Lock()
+	defer t.Unlock()
+	return keySequences(t.keycodes)
+}
+
+func (t *tScreen) KeyConflicts() []KeyConflict {
+	t.Lock()
+	defer t.Unlock()
+	return keyConflicts(t.keycodes, t.keydups)
+}
+
+func (t *tScreen) UnbindSequence(seq string) {
+	t.Lock()
+	defer t.Unlock()
+	k, ok := t.keycodes[seq]
+	if !ok {
+		return
+	}
+	delete(t.keycodes, seq)
+	for _, kc := range t.keycodes {
+		if kc.key == k.key {
+			return
+		}
+	}
+	delete(t.keyexist, k.key)
+}
+
+func (t *tScreen) Fini() {
+	t.finiOnce.Do(t.finish)
 }
 
 func (t *tScreen) finish() {
@@ -521,16 +1595,43 @@ func (t *tScreen) finish() {
 
 	ti := t.ti
 	t.cells.Resize(0, 0)
+	if t.cshown != 0 {
+		t.TPuts(fmt.Sprintf(cursorShape, 0))
+		t.cshown = 0
+	}
 	t.TPuts(ti.ShowCursor)
 	t.TPuts(ti.AttrOff)
-	t.TPuts(ti.Clear)
-	t.TPuts(ti.ExitCA)
+	if t.inline > 0 {
+		// Leave the cursor where the live region was, so that the
+		// shell prompt follows the lines committed with Println.
+		t.goTo(0, 0)
+		t.TPuts(clearEOS)
+	} else {
+		t.TPuts(ti.Clear)
+		t.TPuts(ti.ExitCA)
+	}
 	t.TPuts(ti.ExitKeypad)
-	t.TPuts(ti.TParm(ti.MouseMode, 0))
-	t.TPuts(pasteDisable)
+	if t.mouseon {
+		t.TPuts(ti.TParm(t.mousemode, 0))
+	}
+	if t.bpaste && t.canPaste() {
+		t.TPuts(pasteDisable)
+	}
+	if t.kittyon {
+		t.TPuts(kittyPop)
+		t.kittyon = false
+		t.kitty = false
+	}
+	if t.palset {
+		t.TPuts(resetPalette)
+		t.palset = false
+	}
 	t.curstyle = styleInvalid
 	t.clear = false
 	t.fini = true
+	// Other streams cannot be interrupted, so their readers finish
+	// after their next read, and are not restarted by a later Init.
+	t.inputs = nil
 
 	select {
 	case <-t.quit:
@@ -539,8 +1640,52 @@ func (t *tScreen) finish() {
 	default:
 		close(t.quit)
 	}
+	t.subs.Close()
+	t.queries.Cancel()
+	t.mirrors.Close()
+	t.diffs.Close()
+	if t.blinkq != nil {
+		close(t.blinkq)
+		t.blinkq = nil
+	}
+	if t.animq != nil {
+		close(t.animq)
+		t.animq = nil
+	}
+	if t.pollq != nil {
+		close(t.pollq)
+		t.pollq = nil
+	}
+	if t.idleq != nil {
+		close(t.idleq)
+		t.idleq = nil
+	}
+	t.ticks.Stop()
+	if t.audit != nil && t.trace != nil {
+		t.audit.report(t.ti, t.trace)
+		t.audit = nil
+	}
+	if t.valid != nil {
+		// Check what is still to be flushed before finishing.
+		t.validate(t.buf.Bytes())
+		t.valid.finish()
+		t.valid = nil
+	}
+	if t.trace != nil {
+		if c, ok := t.trace.Writer().(io.Closer); ok {
+			c.Close()
+		}
+		t.trace = nil
+	}
 
-	t.termioFini()
+	// Make sure the terminal has everything before its modes are
+	// restored, or a slow link may leave it only partly restored.
+	t.flush()
+	t.buffering = false
+	if t.nulltty == nil {
+		t.drain()
+		t.termioFini()
+	}
 }
 
 func (t *tScreen) SetStyle(style Style) {
@@ -563,6 +1708,31 @@ func (t *tScreen) Fill(r rune, style Style) {
 	t.Unlock()
 }
 
+func (t *tScreen) ClearRect(x, y, w, h int, style Style) {
+	t.Lock()
+	if !t.fini {
+		t.clearRect(Rect{X: x, Y: y, Width: w, Height: h}, style)
+	}
+	t.Unlock()
+}
+
+func (t *tScreen) ClearLine(y int) {
+	t.Lock()
+	if !t.fini {
+		t.clearRect(Rect{X: 0, Y: y, Width: t.w, Height: 1}, t.style)
+	}
+	t.Unlock()
+}
+
+// clearRect fills the rectangle with spaces, and notes it for eraseRun.
+// The caller holds the lock.
+func (t *tScreen) clearRect(r Rect, style Style) {
+	t.cells.FillRect(r, ' ', style)
+	if r = r.Intersect(Rect{Width: t.w, Height: t.h}); !r.Empty() {
+		t.erased = append(t.erased, r)
+	}
+}
+
 func (t *tScreen) SetContent(x, y int, mainc rune, combc []rune, style Style) {
 	t.Lock()
 	if !t.fini {
@@ -578,6 +1748,43 @@ func (t *tScreen) GetContent(x, y int) (rune, []rune, Style, int) {
 	return mainc, combc, style, width
 }
 
+func (t *tScreen) SetTag(x, y int, tag uint32) {
+	t.Lock()
+	t.cells.SetTag(x, y, tag)
+	t.Unlock()
+}
+
+func (t *tScreen) GetTag(x, y int) uint32 {
+	t.Lock()
+	tag := t.cells.GetTag(x, y)
+	t.Unlock()
+	return tag
+}
+
+func (t *tScreen) SetSelection(rects []Rect, style Style) {
+	t.Lock()
+	t.sel.set(&t.cells, rects, style)
+	t.Unlock()
+}
+
+func (t *tScreen) SelectedText() string {
+	t.Lock()
+	defer t.Unlock()
+	return t.cells.Text(t.sel.rects...)
+}
+
+func (t *tScreen) SetHighlight(rects []Rect, style Style) {
+	t.Lock()
+	t.hl.set(&t.cells, rects, style)
+	t.Unlock()
+}
+
+func (t *tScreen) Find(re *regexp.Regexp) []Rect {
+	t.Lock()
+	defer t.Unlock()
+	return t.cells.Find(re)
+}
+
 func (t *tScreen) SetCell(x, y int, style Style, ch ...rune) {
 	if len(ch) > 0 {
 		t.SetContent(x, y, ch[0], ch[1:], style)
@@ -588,96 +1795,437 @@ func (t *tScreen) SetCell(x, y int, style Style, ch ...rune) {
 
 func (t *tScreen) encodeRune(r rune, buf []byte) []byte {
 
+	if rep, ok := t.glyphs.Replace[r]; ok {
+		if len(buf) == 0 {
+			buf = append(buf, rep...)
+		}
+		return buf
+	}
+	if nb, ok := t.tryEncode(r); ok {
+		buf = append(buf, nb...)
+	} else if len(buf) == 0 {
+		// Combining characters are elided
+		if acs, ok := t.acs[r]; ok {
+			buf = append(buf, []byte(acs)...)
+		} else if fb, ok := t.fallback[r]; ok {
+			buf = append(buf, []byte(fb)...)
+		} else {
+			buf = append(buf, '?')
+		}
+	}
+
+	return buf
+}
+
+// tryEncode returns the rune in the terminal's character set, or false if
+// the character set lacks it, or the glyph policy does not allow it.
+func (t *tScreen) tryEncode(r rune) ([]byte, bool) {
+	enc := t.encoder
+	if enc == nil || !t.glyphs.allows(r) {
+		return nil, false
+	}
 	nb := make([]byte, 6)
 	ob := make([]byte, 6)
 	num := utf8.EncodeRune(ob, r)
-	ob = ob[:num]
-	dst := 0
-	var err error
-	if enc := t.encoder; enc != nil {
-		enc.Reset()
-		dst, _, err = enc.Transform(nb, ob, true)
-	}
+	enc.Reset()
+	dst, _, err := enc.Transform(nb, ob[:num], true)
 	if err != nil || dst == 0 || nb[0] == '\x1a' {
-		// Combining characters are elided
-		if len(buf) == 0 {
-			if acs, ok := t.acs[r]; ok {
-				buf = append(buf, []byte(acs)...)
+		return nil, false
+	}
+	return nb[:dst], true
+}
+
+// encodeCluster encodes a character and its combining marks, dealing with
+// marks that cannot be displayed as the glyph policy says.
+func (t *tScreen) encodeCluster(mainc rune, combc []rune, buf []byte) []byte {
+	if len(combc) == 0 || t.glyphs.Marks == MarksElide {
+		buf = t.encodeRune(mainc, buf)
+		for _, r := range combc {
+			buf = t.encodeRune(r, buf)
+		}
+		return buf
+	}
+
+	runes := append([]rune{mainc}, combc...)
+	if b, ok := t.encodeAll(runes, buf); ok {
+		return b
+	}
+	composed := []rune(norm.NFC.String(string(runes)))
+	if b, ok := t.encodeAll(composed, buf); ok {
+		return b
+	}
+
+	if t.glyphs.Marks == MarksFallback {
+		buf = t.encodeRune(mainc, buf)
+		for _, r := range combc {
+			if nb, ok := t.tryEncode(r); ok {
+				buf = append(buf, nb...)
 			} else if fb, ok := t.fallback[r]; ok {
-				buf = append(buf, []byte(fb)...)
-			} else {
-				buf = append(buf, '?')
+				buf = append(buf, fb...)
 			}
 		}
-	} else {
-		buf = append(buf, nb[:dst]...)
+		return buf
+	}
+	if len(composed) == 1 {
+		if fb, ok := t.fallback[composed[0]]; ok {
+			return append(buf, fb...)
+		}
 	}
+	return append(buf, '?')
+}
 
-	return buf
+// encodeAll appends the runes to buf if all of them can be sent as they
+// are, and otherwise returns buf unchanged and false.
+func (t *tScreen) encodeAll(runes []rune, buf []byte) ([]byte, bool) {
+	n := len(buf)
+	for _, r := range runes {
+		nb, ok := t.tryEncode(r)
+		if !ok {
+			return buf[:n], false
+		}
+		buf = append(buf, nb...)
+	}
+	return buf, true
 }
 
 func (t *tScreen) sendFgBg(fg Color, bg Color) {
+	for _, seq := range t.colorSeqs(fg, bg) {
+		t.TPuts(seq)
+	}
+}
+
+// colorSeqs returns the sequences needed to set the given colors.
+func (t *tScreen) colorSeqs(fg Color, bg Color) []string {
+	var seqs []string
 	ti := t.ti
 	if ti.Colors == 0 {
-		return
+		return nil
 	}
 	if fg == ColorReset || bg == ColorReset {
-		t.TPuts(ti.ResetFgBg)
+		seqs = append(seqs, ti.ResetFgBg)
+	}
+	if t.syscolor {
+		// The bright colors are only there on terminals with 16.
+		last := ColorWhite
+		if ti.Colors < 16 {
+			last = ColorSilver
+		}
+		if fg >= ColorBlack && fg <= last {
+			seqs = append(seqs, systemColor(30, fg))
+			fg = ColorDefault
+		}
+		if bg >= ColorBlack && bg <= last {
+			seqs = append(seqs, systemColor(40, bg))
+			bg = ColorDefault
+		}
 	}
 	if t.truecolor {
 		if ti.SetFgBgRGB != "" && fg.IsRGB() && bg.IsRGB() {
 			r1, g1, b1 := fg.RGB()
 			r2, g2, b2 := bg.RGB()
-			t.TPuts(ti.TParm(ti.SetFgBgRGB,
+			seqs = append(seqs, ti.TParm(ti.SetFgBgRGB,
 				int(r1), int(g1), int(b1),
 				int(r2), int(g2), int(b2)))
-			return
+			return seqs
 		}
 
 		if fg.IsRGB() && ti.SetFgRGB != "" {
 			r, g, b := fg.RGB()
-			t.TPuts(ti.TParm(ti.SetFgRGB, int(r), int(g), int(b)))
+			seqs = append(seqs, ti.TParm(ti.SetFgRGB, int(r), int(g), int(b)))
 			fg = ColorDefault
 		}
 
 		if bg.IsRGB() && ti.SetBgRGB != "" {
 			r, g, b := bg.RGB()
-			t.TPuts(ti.TParm(ti.SetBgRGB,
+			seqs = append(seqs, ti.TParm(ti.SetBgRGB,
 				int(r), int(g), int(b)))
 			bg = ColorDefault
 		}
 	}
 
-	if fg.Valid() {
-		if v, ok := t.colors[fg]; ok {
-			fg = v
+	fg = t.mapColor(fg)
+	bg = t.mapColor(bg)
+
+	if fg.Valid() && bg.Valid() && ti.SetFgBg != "" {
+		seqs = append(seqs, ti.TParm(ti.SetFgBg, int(fg&0xff), int(bg&0xff)))
+	} else {
+		if fg.Valid() && ti.SetFg != "" {
+			seqs = append(seqs, ti.TParm(ti.SetFg, int(fg&0xff)))
+		}
+		if bg.Valid() && ti.SetBg != "" {
+			seqs = append(seqs, ti.TParm(ti.SetBg, int(bg&0xff)))
+		}
+	}
+	return seqs
+}
+
+// systemColor returns the SGR sequence for one of the 16 standard
+// colors, where base is 30 for the foreground, or 40 for the background.
+func systemColor(base int, c Color) string {
+	i := int(c - ColorBlack)
+	if i >= 8 {
+		i += 60 - 8
+	}
+	return fmt.Sprintf("\x1b[%dm", base+i)
+}
+
+func (t *tScreen) SetSystemColors(on bool) {
+	t.Lock()
+	t.syscolor = on
+	t.curstyle = styleInvalid
+	t.cells.Invalidate()
+	t.Unlock()
+}
+
+// parseSGR returns the parameters of s, if it consists solely of one
+// or more ECMA-48 SGR sequences, joined together by semicolons.
+func parseSGR(s string) (string, bool) {
+	var params []string
+	for len(s) > 0 {
+		if !strings.HasPrefix(s, "\x1b[") {
+			return "", false
+		}
+		s = s[2:]
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return (r < '0' || r > '9') && r != ';' && r != ':'
+		})
+		if i < 0 || s[i] != 'm' {
+			return "", false
+		}
+		if i == 0 {
+			params = append(params, "0")
 		} else {
-			v = FindColor(fg, t.palette)
-			t.colors[fg] = v
-			fg = v
+			params = append(params, s[:i])
+		}
+		s = s[i+1:]
+	}
+	return strings.Join(params, ";"), len(params) > 0
+}
+
+// sgrAttrs pairs each attribute with its terminfo string.
+func (t *tScreen) sgrAttrs() []struct {
+	attr AttrMask
+	seq  string
+} {
+	ti := t.ti
+	return []struct {
+		attr AttrMask
+		seq  string
+	}{
+		{AttrBold, ti.Bold},
+		{AttrUnderline, ti.Underline},
+		{AttrReverse, ti.Reverse},
+		{AttrBlink, ti.Blink},
+		{AttrDim, ti.Dim},
+		{AttrItalic, ti.Italic},
+		{AttrStrikeThrough, ti.StrikeThrough},
+	}
+}
+
+// checkSGR determines whether the attributes for this terminal are all
+// plain SGR sequences, so that they can be combined with the colors into
+// a single sequence.  Many terminfo entries prefix the attribute reset
+// with a designation of the ASCII character set, which is returned so it
+// can be kept.
+func (t *tScreen) checkSGR() (bool, string) {
+	off := t.ti.AttrOff
+	pre := ""
+	if strings.HasPrefix(off, "\x1b(B") {
+		pre, off = off[:3], off[3:]
+	}
+	if p, ok := parseSGR(off); !ok || p != "0" {
+		return false, ""
+	}
+	for _, a := range t.sgrAttrs() {
+		if _, ok := parseSGR(a.seq); a.seq != "" && !ok {
+			return false, ""
+		}
+	}
+	return true, pre
+}
+
+// sendSGR sets the style with a single combined SGR sequence.  This
+// avoids interactions between attribute strings and colors on some
+// terminals, and is shorter.  If only some of the style differs from the
+// current one, just that part is changed, when that is shorter than
+// starting again from a reset.  It returns false, having sent nothing, if
+// the colors cannot be expressed this way.
+func (t *tScreen) sendSGR(style Style) bool {
+	fg, bg, attrs := style.Decompose()
+
+	// The reset at the start of the sequence restores default colors.
+	if fg == ColorReset {
+		fg = ColorDefault
+	}
+	if bg == ColorReset {
+		bg = ColorDefault
+	}
+	params := []string{"0"}
+	for _, seq := range t.colorSeqs(fg, bg) {
+		p, ok := parseSGR(seq)
+		if !ok {
+			return false
+		}
+		params = append(params, p)
+	}
+	for _, a := range t.sgrAttrs() {
+		if attrs&a.attr != 0 && a.seq != "" {
+			p, _ := parseSGR(a.seq)
+			params = append(params, p)
+		}
+	}
+	if attrs&AttrRapidBlink != 0 && t.ti.Blink != "" {
+		params = append(params, "6")
+	}
+	seq := t.sgrpre + "\x1b[" + strings.Join(params, ";") + "m"
+	if delta, ok := t.sgrDelta(t.curstyle, style); ok {
+		if len(delta) == 0 {
+			return true
+		}
+		if d := "\x1b[" + strings.Join(delta, ";") + "m"; len(d) < len(seq) {
+			seq = d
 		}
 	}
+	t.TPuts(seq)
+	return true
+}
+
+// sgrCodes are the ECMA-48 parameters that turn each attribute on and
+// off.  Some attributes share the same parameter to turn them off, so
+// turning off one of them means turning the other on again.
+var sgrCodes = []struct {
+	attr   AttrMask
+	on     string
+	off    string
+	shared AttrMask
+}{
+	{AttrBold, "1", "22", AttrDim},
+	{AttrDim, "2", "22", AttrBold},
+	{AttrItalic, "3", "23", 0},
+	{AttrUnderline, "4", "24", 0},
+	{AttrBlink, "5", "25", AttrRapidBlink},
+	{AttrRapidBlink, "6", "25", AttrBlink},
+	{AttrReverse, "7", "27", 0},
+	{AttrStrikeThrough, "9", "29", 0},
+}
+
+// sgrDelta returns the SGR parameters that change the terminal from one
+// style to another, without a reset.  This is only possible if the first
+// style is known, and the terminal uses the standard parameters for the
+// attributes involved.
+func (t *tScreen) sgrDelta(from, to Style) ([]string, bool) {
+	if from == styleInvalid {
+		return nil, false
+	}
+	ffg, fbg, fattrs := from.Decompose()
+	tfg, tbg, tattrs := to.Decompose()
+	if t.ti.Blink == "" {
+		fattrs &^= AttrRapidBlink
+		tattrs &^= AttrRapidBlink
+	}
 
-	if bg.Valid() {
-		if v, ok := t.colors[bg]; ok {
-			bg = v
+	// The terminal's own strings must agree with the codes we use.
+	seqs := map[AttrMask]string{AttrRapidBlink: "6"}
+	for _, a := range t.sgrAttrs() {
+		if a.seq == "" {
+			fattrs &^= a.attr
+			tattrs &^= a.attr
+			continue
+		}
+		seqs[a.attr], _ = parseSGR(a.seq)
+	}
+	for _, c := range sgrCodes {
+		if (fattrs|tattrs)&c.attr != 0 && seqs[c.attr] != c.on {
+			return nil, false
+		}
+	}
+
+	var params []string
+	on := tattrs &^ fattrs
+	for _, c := range sgrCodes {
+		if fattrs&^tattrs&c.attr == 0 {
+			continue
+		}
+		if len(params) == 0 || params[len(params)-1] != c.off {
+			params = append(params, c.off)
+		}
+		on |= tattrs & c.shared
+	}
+	for _, c := range sgrCodes {
+		if on&c.attr != 0 {
+			params = append(params, c.on)
+		}
+	}
+
+	for _, c := range []struct {
+		from, to Color
+		def      string
+		fg       bool
+	}{{ffg, tfg, "39", true}, {fbg, tbg, "49", false}} {
+		if c.from == ColorReset {
+			c.from = ColorDefault
+		}
+		if c.to == ColorReset {
+			c.to = ColorDefault
+		}
+		if c.from == c.to {
+			continue
+		}
+		if c.to == ColorDefault {
+			params = append(params, c.def)
+			continue
+		}
+		var seqs []string
+		if c.fg {
+			seqs = t.colorSeqs(c.to, ColorDefault)
 		} else {
-			v = FindColor(bg, t.palette)
-			t.colors[bg] = v
-			bg = v
+			seqs = t.colorSeqs(ColorDefault, c.to)
+		}
+		for _, seq := range seqs {
+			p, ok := parseSGR(seq)
+			if !ok {
+				return nil, false
+			}
+			params = append(params, p)
 		}
 	}
+	return params, true
+}
 
-	if fg.Valid() && bg.Valid() && ti.SetFgBg != "" {
-		t.TPuts(ti.TParm(ti.SetFgBg, int(fg&0xff), int(bg&0xff)))
+// cellStyle returns the style that a cell is actually drawn with, once
+// animations, the default style, selection, cursors, blinking and so on
+// have been taken into account, and whether its text is hidden by
+// blinking.
+func (t *tScreen) cellStyle(x, y, width int, style Style) (Style, bool) {
+	style = t.anims.Apply(style)
+	if style == StyleDefault {
+		style = t.style
+	}
+	style = t.hl.apply(x, y, width, style)
+	style = t.sel.apply(x, y, width, style)
+	if t.softcur && x == t.cursorx && y == t.cursory {
+		style = t.cshape.apply(style)
 	} else {
-		if fg.Valid() && ti.SetFg != "" {
-			t.TPuts(ti.TParm(ti.SetFg, int(fg&0xff)))
+		style = t.extra.apply(x, y, style)
+	}
+	hidden := false
+	if blink := style.attrs & (AttrBlink | AttrRapidBlink); blink != 0 && t.blinkdur > 0 {
+		hidden = t.blinkHidden(blink)
+		style = style.Blink(false).RapidBlink(false)
+	}
+	if t.boldbrt && t.nColors() < 16 {
+		if fg := style.fg; fg >= ColorValid+8 && fg < ColorValid+16 {
+			style = style.Foreground(fg - 8).Bold(true)
 		}
-		if bg.Valid() && ti.SetBg != "" {
-			t.TPuts(ti.TParm(ti.SetBg, int(bg&0xff)))
+	}
+	if t.degraded {
+		var fit func(Color) Color
+		if len(t.palette) > 0 {
+			fit = t.fitColor
 		}
+		style = t.degrade.apply(style, fit)
 	}
+	return style, hidden
 }
 
 func (t *tScreen) drawCell(x, y int) int {
@@ -689,14 +2237,11 @@ func (t *tScreen) drawCell(x, y int) int {
 		return width
 	}
 
-	if t.cy != y || t.cx != x {
-		t.TPuts(ti.TGoto(x, y))
-		t.cx = x
-		t.cy = y
-	}
+	t.moveTo(x, y)
 
-	if style == StyleDefault {
-		style = t.style
+	style, hidden := t.cellStyle(x, y, width, style)
+	if style != t.curstyle && t.sgrok && t.sendSGR(style) {
+		t.curstyle = style
 	}
 	if style != t.curstyle {
 		fg, bg, attrs := style.Decompose()
@@ -716,6 +2261,9 @@ func (t *tScreen) drawCell(x, y int) int {
 		if attrs&AttrBlink != 0 {
 			t.TPuts(ti.Blink)
 		}
+		if attrs&AttrRapidBlink != 0 && ti.Blink != "" {
+			t.TPuts(rapidBlink)
+		}
 		if attrs&AttrDim != 0 {
 			t.TPuts(ti.Dim)
 		}
@@ -739,10 +2287,7 @@ func (t *tScreen) drawCell(x, y int) int {
 
 	buf := make([]byte, 0, 6)
 
-	buf = t.encodeRune(mainc, buf)
-	for _, r := range combc {
-		buf = t.encodeRune(r, buf)
-	}
+	buf = t.encodeCluster(mainc, combc, buf)
 
 	str = string(buf)
 	if width > 1 && str == "?" {
@@ -751,13 +2296,18 @@ func (t *tScreen) drawCell(x, y int) int {
 		t.cx = -1
 	}
 
-	// XXX: check for hazeltine not being able to display ~
-
-	if x > t.w-width {
+	if x > t.w-width || (t.margin != nil && y == t.h-1 && x == t.w-width && width > 1) {
 		// too wide to fit; emit a single space instead
 		width = 1
 		str = " "
 	}
+	if hidden {
+		str = strings.Repeat(" ", width)
+	}
+	if t.margin != nil && y == t.h-1 && x == t.w-1 && x > 0 {
+		t.drawCorner(x, y, str)
+		return width
+	}
 	t.writeString(str)
 	t.cx += width
 	t.cells.SetDirty(x, y, false)
@@ -768,27 +2318,173 @@ func (t *tScreen) drawCell(x, y int) int {
 	return width
 }
 
+// drawCorner draws the bottom right cell for terminals that would scroll
+// if it were written directly.  It is written one cell to the left, and
+// then pushed into place by inserting the cell that belongs there.  The
+// style for the corner has already been set.
+func (t *tScreen) drawCorner(x, y int, str string) {
+	t.cells.SetDirty(x, y, false)
+	if t.margin.insert == "" {
+		// There is no way to do it; leave the corner alone.
+		return
+	}
+	t.moveTo(x-1, y)
+	t.writeString(str)
+	t.cx = x
+	t.moveTo(x-1, y)
+	t.TPuts(t.margin.insert)
+	t.cells.SetDirty(x-1, y, true)
+	t.drawCell(x-1, y)
+	t.TPuts(t.margin.endins)
+	t.cx = -1
+}
+
+// eraseRun erases the run of blank cells starting at x, within an area
+// cleared by ClearRect or ClearLine, if it is long enough to be worth it,
+// and returns the number of cells erased.  Only cells that would be drawn
+// as spaces with the default background and no attributes are erased,
+// since terminals differ in how they color the cells that they erase.
+func (t *tScreen) eraseRun(x, y int) int {
+	if !t.ecma48 || !t.cells.Dirty(x, y) {
+		return 0
+	}
+	n := 0
+	for x+n < t.w && t.wasErased(x+n, y) && t.blankCell(x+n, y) {
+		n++
+	}
+	if n < eraseMin || (x+n < t.w && !t.ech) {
+		return 0
+	}
+	t.moveTo(x, y)
+	if t.curstyle != StyleDefault {
+		t.TPuts(t.ti.AttrOff)
+		t.curstyle = StyleDefault
+	}
+	if x+n == t.w {
+		t.TPuts(clearEOL)
+	} else {
+		t.TPuts(fmt.Sprintf(eraseChr, n))
+	}
+	for i := 0; i < n; i++ {
+		t.cells.SetDirty(x+i, y, false)
+	}
+	return n
+}
+
+// wasErased reports whether the cell is in an area cleared since the
+// last frame was drawn.
+func (t *tScreen) wasErased(x, y int) bool {
+	for _, r := range t.erased {
+		if r.Contains(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// blankCell reports whether the cell would be drawn as a plain space.
+func (t *tScreen) blankCell(x, y int) bool {
+	mainc, combc, style, _ := t.cells.GetContent(x, y)
+	if mainc != ' ' || len(combc) != 0 {
+		return false
+	}
+	if t.sel.contains(x, y) || t.hl.contains(x, y) || (t.softcur && x == t.cursorx && y == t.cursory) {
+		return false
+	}
+	style, _ = t.cellStyle(x, y, 1, style)
+	return style.bg == ColorDefault && style.attrs == 0
+}
+
 func (t *tScreen) ShowCursor(x, y int) {
+	t.ShowCursorStyle(x, y, CursorStyleDefault)
+}
+
+func (t *tScreen) ShowCursorStyle(x, y int, cs CursorStyle) {
+	t.ShowCursors(Cursor{X: x, Y: y, Style: cs})
+}
+
+func (t *tScreen) ShowCursors(cursors ...Cursor) {
+	c := Cursor{X: -1, Y: -1}
+	if len(cursors) > 0 {
+		c = cursors[0]
+	}
 	t.Lock()
-	t.cursorx = x
-	t.cursory = y
+	t.markCursor()
+	t.cursorx = c.X
+	t.cursory = c.Y
+	t.cshape = c.Style
+	t.softcur = t.softreq || (c.Style != CursorStyleDefault && !t.termIs(cursorTerms))
+	t.extra = secondary(cursors)
+	t.markCursor()
 	t.Unlock()
 }
 
+func (t *tScreen) SetCursorBlink(blink bool) {
+	t.Lock()
+	t.cblink = blinkFor(blink)
+	t.Unlock()
+}
+
+func (t *tScreen) SetSoftCursor(on bool) {
+	t.Lock()
+	t.markCursor()
+	t.softreq = on
+	t.softcur = on || (t.cshape != CursorStyleDefault && !t.termIs(cursorTerms))
+	t.markCursor()
+	t.Unlock()
+}
+
+// markCursor marks the cells under software cursors dirty, so that they
+// are drawn again when the cursors move or change.
+func (t *tScreen) markCursor() {
+	if t.softcur {
+		t.cells.SetDirty(t.cursorx, t.cursory, true)
+	}
+	t.extra.mark(&t.cells)
+}
+
 func (t *tScreen) HideCursor() {
 	t.ShowCursor(-1, -1)
 }
 
+func (t *tScreen) PushCursorState() {
+	t.Lock()
+	t.curstack.Push(Cursor{X: t.cursorx, Y: t.cursory, Style: t.cshape}, t.extra)
+	t.Unlock()
+}
+
+func (t *tScreen) PopCursorState() {
+	t.Lock()
+	cursors, ok := t.curstack.Pop()
+	t.Unlock()
+	if ok {
+		t.ShowCursors(cursors...)
+	}
+}
+
 func (t *tScreen) showCursor() {
 
 	x, y := t.cursorx, t.cursory
 	w, h := t.cells.Size()
-	if x < 0 || y < 0 || x >= w || y >= h {
+	if x < 0 || y < 0 || x >= w || y >= h || t.softcur {
 		t.hideCursor()
 		return
 	}
-	t.TPuts(t.ti.TGoto(x, y))
-	t.TPuts(t.ti.ShowCursor)
+	decscusr := t.termIs(cursorTerms)
+	shape := t.cshape.decscusr()
+	if decscusr {
+		shape = t.cshape.blinking(t.cblink)
+	}
+	if shape != t.cshown {
+		t.TPuts(fmt.Sprintf(cursorShape, shape))
+		t.cshown = shape
+	}
+	t.goTo(x, y)
+	if !decscusr && t.cblink == blinkOn && t.ti.VisCursor != "" {
+		t.TPuts(t.ti.VisCursor)
+	} else {
+		t.TPuts(t.ti.ShowCursor)
+	}
 	t.cx = x
 	t.cy = y
 }
@@ -803,34 +2499,212 @@ func (t *tScreen) writeString(s string) {
 	if t.buffering {
 		io.WriteString(&t.buf, s)
 	} else {
+		t.validate([]byte(s))
 		io.WriteString(t.out, s)
 	}
 }
 
+// validate checks output that is about to be sent, if enabled.
+func (t *tScreen) validate(b []byte) {
+	if t.valid != nil {
+		t.valid.Write(b)
+	}
+}
+
 func (t *tScreen) TPuts(s string) {
+	if t.audit != nil {
+		t.audit.record(s)
+	}
+	w := t.out
 	if t.buffering {
-		t.ti.TPuts(&t.buf, s)
-	} else {
-		t.ti.TPuts(t.out, s)
+		w = &t.buf
+	} else if t.valid != nil {
+		w = io.MultiWriter(t.valid, w)
+	}
+	switch {
+	case t.padding == PaddingNone:
+		t.ti.TPutsFunc(w, s, nil)
+	case t.padding == PaddingStrict && t.baud > 0:
+		t.ti.TPutsFunc(w, s, padChars(t.baud, t.ti.PadChar))
+	default:
+		t.ti.TPuts(w, s)
+	}
+}
+
+// flush sends the buffered output to the terminal, in pieces no larger
+// than the flush size if one is set.  The pieces end before an escape
+// sequence where possible, and never within a UTF-8 character.
+func (t *tScreen) flush() {
+	t.validate(t.buf.Bytes())
+	if t.flushsz <= 0 {
+		t.buf.WriteTo(t.out)
+		return
+	}
+	for t.buf.Len() > 0 {
+		b := t.buf.Bytes()
+		n := len(b)
+		if n > t.flushsz {
+			n = t.flushsz
+			if i := bytes.LastIndexByte(b[:n], '\x1b'); i > 0 {
+				n = i
+			}
+			for n > 1 && !utf8.RuneStart(b[n]) {
+				n--
+			}
+		}
+		if _, err := t.out.Write(t.buf.Next(n)); err != nil {
+			t.buf.Reset()
+			return
+		}
 	}
 }
 
+func (t *tScreen) SetFlushSize(n int) {
+	t.Lock()
+	t.flushsz = n
+	t.Unlock()
+}
+
+func (t *tScreen) SetPadding(mode Padding, baud int) {
+	t.Lock()
+	t.padding = mode
+	t.baud = baud
+	t.Unlock()
+}
+
 func (t *tScreen) Show() {
+	t.ShowFrame()
+}
+
+func (t *tScreen) ShowFrame() FrameInfo {
+	start := time.Now()
 	t.Lock()
+	t.frame = FrameInfo{}
 	if !t.fini {
-		t.resize()
-		t.draw()
+		// Leave the size alone while it is still settling, so
+		// that no intermediate sizes are reported.
+		if t.rsat.IsZero() {
+			t.resize()
+		}
+		if t.relayout() {
+			t.draw()
+			t.snapshot()
+		}
 	}
+	frame := t.frame
+	metrics := t.metrics
+	notify := t.textw.Check(&t.cells, &t.regions)
 	t.Unlock()
+	frame.Duration = time.Since(start)
+	if notify != nil {
+		notify()
+	}
+	if metrics != nil {
+		metrics(MetricShowLatency, time.Since(start))
+	}
+	return frame
 }
 
 func (t *tScreen) clearScreen() {
 	fg, bg, _ := t.style.Decompose()
 	t.sendFgBg(fg, bg)
-	t.TPuts(t.ti.Clear)
+	t.curstyle = styleInvalid
+	if t.inline > 0 {
+		t.goTo(0, 0)
+		t.TPuts(clearEOS)
+	} else {
+		t.TPuts(t.ti.Clear)
+	}
 	t.clear = false
 }
 
+// goTo moves the cursor to the given cell of the screen, which in
+// inline mode is offset from the top of the terminal.
+func (t *tScreen) goTo(x, y int) {
+	t.TPuts(t.ti.TGoto(x, y+t.itop))
+}
+
+// Relative cursor motions, used when they are shorter than addressing
+// the cell directly.  As with clearEOL, these are only used with
+// terminals that clear the screen with ECMA-48 sequences.
+const (
+	cursorFwd = "\x1b[%dC"
+	gapMax    = 4
+)
+
+// moveTo moves the cursor to the given cell, if it is not already there,
+// in whichever way is shortest: directly, relative to where the cursor
+// is, or by writing out again the cells in between.
+func (t *tScreen) moveTo(x, y int) {
+	if t.cx == x && t.cy == y {
+		return
+	}
+	best := t.ti.TGoto(x, y+t.itop)
+	try := func(s string) {
+		if len(s) < len(best) {
+			best = s
+		}
+	}
+	cx, cy := t.cx, t.cy
+	// The cursor position is unknown after a wide character, and at
+	// the right margin the terminal may be waiting to wrap.
+	if t.ecma48 && cx >= 0 && cy >= 0 && cx < t.w && cy < t.h {
+		fwd := func(n int) string {
+			if n == 0 {
+				return ""
+			}
+			return fmt.Sprintf(cursorFwd, n)
+		}
+		switch {
+		case y == cy && x > cx:
+			try(fwd(x - cx))
+			if s, ok := t.gapText(cx, x, y); ok {
+				try(s)
+			}
+		case y == cy:
+			try("\r" + fwd(x))
+			if t.ti.CursorBack1 != "" {
+				try(strings.Repeat(t.ti.CursorBack1, cx-x))
+			}
+		case y == cy+1:
+			// The carriage return is needed anyway if the output
+			// is being processed, as it may be for a mirror.
+			try("\r\n" + fwd(x))
+		case y == cy-1 && x == cx && t.ti.CursorUp1 != "":
+			try(t.ti.CursorUp1)
+		}
+	}
+	if strings.Contains(best, "$<") {
+		t.TPuts(best)
+	} else {
+		t.writeString(best)
+	}
+	t.cx = x
+	t.cy = y
+}
+
+// gapText returns the text of the cells from x0 up to x1, if they are
+// already displayed, and writing them again in the current style
+// leaves them exactly as they are.  That is often shorter than moving
+// the cursor past them.
+func (t *tScreen) gapText(x0, x1, y int) (string, bool) {
+	if x1-x0 > gapMax {
+		return "", false
+	}
+	buf := make([]byte, 0, gapMax)
+	for x := x0; x < x1; x++ {
+		mainc, combc, style, width := t.cells.GetContent(x, y)
+		if t.cells.Dirty(x, y) || width != 1 || len(combc) != 0 || mainc >= 0x80 {
+			return "", false
+		}
+		if style, hidden := t.cellStyle(x, y, width, style); hidden || style != t.curstyle {
+			return "", false
+		}
+		buf = t.encodeRune(mainc, buf)
+	}
+	return string(buf), true
+}
+
 func (t *tScreen) hideCursor() {
 	// does not update cursor position
 	if t.ti.HideCursor != "" {
@@ -839,21 +2713,157 @@ func (t *tScreen) hideCursor() {
 		// No way to hide cursor, stick it
 		// at bottom right of screen
 		t.cx, t.cy = t.cells.Size()
-		t.TPuts(t.ti.TGoto(t.cx, t.cy))
+		t.goTo(t.cx, t.cy)
 	}
 }
 
 func (t *tScreen) draw() {
-	// clobber cursor position, because we're gonna change it all
-	t.cx = -1
-	t.cy = -1
-
 	t.buf.Reset()
 	t.buffering = true
 	defer func() {
 		t.buffering = false
 	}()
 
+	if t.minsz.Small() {
+		// Draw the notice instead, without the cursor.
+		if t.clear {
+			t.minsz.Invalidate()
+		}
+		cx, cy := t.cursorx, t.cursory
+		t.cursorx, t.cursory = -1, -1
+		t.minsz.Swap(&t.cells)
+		defer func() {
+			t.minsz.Swap(&t.cells)
+			t.cursorx, t.cursory = cx, cy
+		}()
+	}
+
+	if t.budget > 0 && t.degrade != 0 {
+		clear, style, shape := t.clear, t.curstyle, t.cshown
+		dirty := t.saveDirty()
+		t.render()
+		if t.buf.Len() > t.budget {
+			// Too much for the link, so draw the frame again, more
+			// simply, from the same starting point.
+			t.buf.Reset()
+			t.restoreDirty(dirty)
+			t.clear, t.curstyle, t.cshown = clear, style, shape
+			t.frame.Cells = 0
+			t.frame.Degraded = true
+			t.degraded = true
+			t.render()
+			t.degraded = false
+		}
+	} else {
+		t.render()
+	}
+
+	t.erased = t.erased[:0]
+	t.frame.Bytes = t.buf.Len()
+	t.mirrors.Write(t.buf.Bytes())
+	t.flush()
+	t.diffs.Frame(&t.cells)
+}
+
+// snapshot records the cells as they have just been shown, for redraw.
+func (t *tScreen) snapshot() {
+	w, h := t.cells.Size()
+	t.shown.Resize(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			mainc, combc, style, _ := t.cells.GetContent(x, y)
+			t.shown.SetContent(x, y, mainc, combc, style)
+			t.shown.SetDirty(x, y, false)
+		}
+	}
+}
+
+// redraw draws the cells as they were last shown, for changes that the
+// application did not make, such as blinking or a new window size.  The
+// cells it has set since then are only drawn when it calls Show or Sync.
+// The mark function marks the cells to draw; it is applied to both
+// buffers, so that the next Show draws them too.  The caller holds the
+// lock.
+func (t *tScreen) redraw(mark func(*CellBuffer)) {
+	mark(&t.cells)
+	w, h := t.cells.Size()
+	if sw, sh := t.shown.Size(); sw != w || sh != h {
+		t.shown.Resize(w, h)
+	}
+	mark(&t.shown)
+	t.cells, t.shown = t.shown, t.cells
+	t.draw()
+	t.cells, t.shown = t.shown, t.cells
+}
+
+// repaint returns the output that paints the cells as they were last
+// shown onto a cleared screen, for a new mirror.  Nothing is sent to the
+// terminal, and what is known about it, such as the current style and
+// which cells need drawing, is left as it was.  The caller holds the
+// lock.
+func (t *tScreen) repaint() []byte {
+	w, h := t.cells.Size()
+	if sw, sh := t.shown.Size(); sw != w || sh != h {
+		t.shown.Resize(w, h)
+	}
+	t.cells, t.shown = t.shown, t.cells
+	cursorx, cursory := t.cursorx, t.cursory
+	if t.minsz.Small() {
+		t.minsz.Swap(&t.cells)
+		t.cursorx, t.cursory = -1, -1
+	}
+	dirty := t.saveDirty()
+	clear, style, shape := t.clear, t.curstyle, t.cshown
+	cx, cy, erased, frame := t.cx, t.cy, t.erased, t.frame
+
+	t.buf.Reset()
+	t.buffering = true
+	t.clear, t.curstyle, t.cshown, t.erased = true, styleInvalid, 0, nil
+	t.cells.Invalidate()
+	t.render()
+	b := append([]byte{}, t.buf.Bytes()...)
+	t.buf.Reset()
+	t.buffering = false
+
+	for i, d := range dirty {
+		t.cells.SetDirty(i%t.w, i/t.w, d)
+	}
+	t.clear, t.curstyle, t.cshown = clear, style, shape
+	t.cx, t.cy, t.erased, t.frame = cx, cy, erased, frame
+	if t.minsz.Small() {
+		t.minsz.Swap(&t.cells)
+	}
+	t.cursorx, t.cursory = cursorx, cursory
+	t.cells, t.shown = t.shown, t.cells
+	return b
+}
+
+// relayout calls the OnResize callback if the size has changed since it
+// was last called, so that the cells are laid out again before they are
+// drawn.  The lock is released during the call, so that the callback can
+// draw, and false is returned if the screen was finalized meanwhile.  It
+// is only called from Show and Sync, so that the callback runs on the
+// application's goroutine.  The caller holds the lock.
+func (t *tScreen) relayout() bool {
+	for t.onresize != nil && !t.fini && (t.w != t.laidw || t.h != t.laidh) {
+		fn, w, h := t.onresize, t.w, t.h
+		t.laidw, t.laidh = w, h
+		t.Unlock()
+		fn(w, h)
+		t.Lock()
+		if t.fini {
+			return false
+		}
+	}
+	return true
+}
+
+// render draws the changed cells into the buffer.
+func (t *tScreen) render() {
+	// clobber cursor position, because we're gonna change it all
+	t.cx = -1
+	t.cy = -1
+
 	// hide the cursor while we move stuff around
 	t.hideCursor()
 
@@ -863,6 +2873,14 @@ func (t *tScreen) draw() {
 
 	for y := 0; y < t.h; y++ {
 		for x := 0; x < t.w; x++ {
+			if n := t.eraseRun(x, y); n > 0 {
+				t.frame.Cells += n
+				x += n - 1
+				continue
+			}
+			if t.cells.Dirty(x, y) {
+				t.frame.Cells++
+			}
 			width := t.drawCell(x, y)
 			if width > 1 {
 				if x+1 < t.w {
@@ -878,51 +2896,285 @@ func (t *tScreen) draw() {
 
 	// restore the cursor
 	t.showCursor()
+}
 
-	t.buf.WriteTo(t.out)
+// saveDirty returns which cells are dirty, for restoreDirty.
+func (t *tScreen) saveDirty() []bool {
+	dirty := make([]bool, 0, t.w*t.h)
+	for y := 0; y < t.h; y++ {
+		for x := 0; x < t.w; x++ {
+			dirty = append(dirty, t.cells.Dirty(x, y))
+		}
+	}
+	return dirty
+}
+
+// restoreDirty marks dirty again the cells that were dirty when
+// saveDirty was called, so that they will be drawn again.
+func (t *tScreen) restoreDirty(dirty []bool) {
+	for i, d := range dirty {
+		if d {
+			t.cells.SetDirty(i%t.w, i/t.w, true)
+		}
+	}
+}
+
+func (t *tScreen) SetOutputBudget(n int, degrade Degrade) {
+	t.Lock()
+	t.budget = n
+	t.degrade = degrade
+	t.Unlock()
 }
 
 func (t *tScreen) EnableMouse() {
-	if len(t.mouse) != 0 {
-		t.TPuts(t.ti.TParm(t.ti.MouseMode, 1))
+	t.Lock()
+	if !t.mouseon && len(t.mouse) != 0 {
+		if t.quit != nil && !t.fini {
+			t.TPuts(t.ti.TParm(t.mousemode, 1))
+		}
+		t.mouseon = true
 	}
+	t.Unlock()
 }
 
 func (t *tScreen) DisableMouse() {
-	if len(t.mouse) != 0 {
-		t.TPuts(t.ti.TParm(t.ti.MouseMode, 0))
+	t.Lock()
+	if t.mouseon {
+		if t.quit != nil && !t.fini {
+			t.TPuts(t.ti.TParm(t.mousemode, 0))
+		}
+		t.mouseon = false
+	}
+	t.Unlock()
+}
+
+func (t *tScreen) MouseEnabled() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.mouseon
+}
+
+func (t *tScreen) SetMouseSupport(support bool) {
+	t.Lock()
+	on := t.mouseon
+	if on && t.quit != nil && !t.fini {
+		t.TPuts(t.ti.TParm(t.mousemode, 0))
+	}
+	t.mouseon = false
+	t.setMouseSupport(support)
+	if on && len(t.mouse) != 0 {
+		if t.quit != nil && !t.fini {
+			t.TPuts(t.ti.TParm(t.mousemode, 1))
+		}
+		t.mouseon = true
+	}
+	t.Unlock()
+}
+
+// setMouseSupport decides whether the mouse is to be used, and how to
+// turn it on and off.  The terminal database is used if it has a mouse,
+// and the SGR mouse otherwise.
+func (t *tScreen) setMouseSupport(support bool) {
+	t.mouse, t.mousemode = nil, ""
+	if !support {
+		return
+	}
+	t.mouse, t.mousemode = []byte(t.ti.Mouse), t.ti.MouseMode
+	if len(t.mouse) == 0 {
+		t.mouse = []byte("\x1b[<")
+	}
+	if t.mousemode == "" {
+		t.mousemode = sgrMouseMode
+	}
+}
+
+// canPaste reports whether bracketed paste can be used.  The mode is an
+// ECMA-48 private mode, so other terminals are not sent it, and it is
+// not used in restricted mode, where pasted text arrives as keys.  The
+// caller holds the lock.
+func (t *tScreen) canPaste() bool {
+	return t.ecma48 && !t.restrict
+}
+
+func (t *tScreen) EnablePaste() {
+	t.Lock()
+	if !t.bpaste && t.canPaste() && t.quit != nil && !t.fini {
+		t.TPuts(pasteEnable)
+	}
+	t.bpaste = true
+	t.Unlock()
+}
+
+func (t *tScreen) DisablePaste() {
+	t.Lock()
+	if t.bpaste && t.canPaste() && t.quit != nil && !t.fini {
+		t.TPuts(pasteDisable)
+	}
+	t.bpaste = false
+	t.Unlock()
+}
+
+func (t *tScreen) PasteEnabled() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.bpaste
+}
+
+func (t *tScreen) Size() (int, int) {
+	t.Lock()
+	w, h := t.w, t.h
+	t.Unlock()
+	return w, h
+}
+
+// winch handles a change to the window size, redrawing everything.
+func (t *tScreen) winch() {
+	t.rsat = time.Time{}
+	t.cx = -1
+	t.cy = -1
+	t.resize()
+	t.redraw((*CellBuffer).Invalidate)
+}
+
+func (t *tScreen) resize() {
+	getWinSize := t.getWinSize
+	if t.nulltty != nil {
+		getWinSize = t.nulltty.Size
+	}
+	w, h, e := getWinSize()
+	if t.fixw > 0 {
+		// The terminal's own idea of its size is not to be trusted.
+		w, h, e = t.fixw, t.fixh, nil
+	}
+	if e == nil {
+		if t.inline > 0 {
+			top := 0
+			if h > t.inline {
+				top = h - t.inline
+				h = t.inline
+			}
+			if top != t.itop {
+				t.itop = top
+				t.clear = true
+				t.cells.Invalidate()
+			}
+		}
+		if w != t.w || h != t.h {
+			t.cx = -1
+			t.cy = -1
+
+			t.cells.Resize(w, h)
+			t.cells.Invalidate()
+			t.h = h
+			t.w = w
+			ev := NewEventResize(w, h)
+			t.PostEvent(ev)
+		}
+		t.checkMinSize()
+	}
+}
+
+// checkMinSize posts an EventTooSmall if the screen has crossed its
+// minimum size.
+func (t *tScreen) checkMinSize() {
+	if ev := t.minsz.Check(t.w, t.h); ev != nil {
+		t.clear = true
+		t.cells.Invalidate()
+		t.PostEvent(ev)
+	}
+}
+
+func (t *tScreen) Colors() int {
+	// this doesn't change, no need for lock
+	if t.truecolor {
+		return 1 << 24
+	}
+	return t.ti.Colors
+}
+
+func (t *tScreen) SupportedAttrs() AttrMask {
+	t.Lock()
+	defer t.Unlock()
+	var attrs AttrMask
+	for _, a := range t.sgrAttrs() {
+		if a.seq != "" {
+			attrs |= a.attr
+		}
+	}
+	if attrs&AttrBlink != 0 {
+		attrs |= AttrRapidBlink
+	}
+	for _, q := range attrQuirks {
+		if t.termIs([]string{q.name}) {
+			attrs &^= q.attrs
+		}
+	}
+	// Soft blinking needs nothing of the terminal.
+	if t.blinkdur > 0 {
+		attrs |= AttrBlink | AttrRapidBlink
+	}
+	return attrs
+}
+
+// resetColors forgets the colors fitted to the palette, so that they are
+// fitted again, and redraws the screen with them.
+func (t *tScreen) resetColors() {
+	t.colors = newColorCache(colorCacheMax)
+	t.curstyle = styleInvalid
+	t.cells.Invalidate()
+}
+
+func (t *tScreen) SetPaletteColor(index int, c Color) error {
+	t.Lock()
+	defer t.Unlock()
+	v := c.Hex()
+	if index < 0 || index >= len(t.palette) || v < 0 {
+		return ErrNotSupported
+	}
+	if t.quit == nil || t.fini {
+		return ErrNoScreen
 	}
+	t.TPuts(fmt.Sprintf(setPalette, index, v>>16&0xff, v>>8&0xff, v&0xff))
+	t.palette[index] = v
+	t.palset = true
+	t.resetColors()
+	return nil
 }
 
-func (t *tScreen) Size() (int, int) {
+func (t *tScreen) ResetPalette() {
 	t.Lock()
-	w, h := t.w, t.h
-	t.Unlock()
-	return w, h
+	defer t.Unlock()
+	if !t.palset || t.fini {
+		return
+	}
+	t.TPuts(resetPalette)
+	t.palset = false
+	t.palette = paletteValues(t.nColors())
+	t.resetColors()
 }
 
-func (t *tScreen) resize() {
-	if w, h, e := t.getWinSize(); e == nil {
-		if w != t.w || h != t.h {
-			t.cx = -1
-			t.cy = -1
-
-			t.cells.Resize(w, h)
-			t.cells.Invalidate()
-			t.h = h
-			t.w = w
-			ev := NewEventResize(w, h)
-			t.PostEvent(ev)
-		}
+// mapColor returns the color of the terminal's palette used to show c.
+// Colors of the palette are used as they are; others are fitted to it,
+// and the result is cached.
+func (t *tScreen) mapColor(c Color) Color {
+	if !c.Valid() || c&^ColorValid < Color(len(t.palette)) {
+		return c
 	}
+	if v, ok := t.colors.Get(c); ok {
+		return v
+	}
+	v := t.fitColor(c)
+	t.colors.Put(c, v)
+	return v
 }
 
-func (t *tScreen) Colors() int {
-	// this doesn't change, no need for lock
-	if t.truecolor {
-		return 1 << 24
+// fitColor returns the color of the terminal's palette that is nearest
+// to c, or ColorDefault if it has none.
+func (t *tScreen) fitColor(c Color) Color {
+	if i := nearestColor(c.Hex(), t.palette); i >= 0 {
+		return PaletteColor(i)
 	}
-	return t.ti.Colors
+	return ColorDefault
 }
 
 // nColors returns the size of the built-in palette.
@@ -933,6 +3185,17 @@ func (t *tScreen) nColors() int {
 }
 
 func (t *tScreen) PollEvent() Event {
+	if t.manual {
+		t.evlk.Lock()
+		defer t.evlk.Unlock()
+		if len(t.evq) == 0 {
+			return nil
+		}
+		ev := t.evq[0]
+		t.evq[0] = nil
+		t.evq = t.evq[1:]
+		return ev
+	}
 	select {
 	case <-t.quit:
 		return nil
@@ -1006,18 +3269,105 @@ func (t *tScreen) buildAcsMap() {
 }
 
 func (t *tScreen) PostEventWait(ev Event) {
-	t.evch <- ev
+	t.regions.Annotate(ev)
+	if t.manual {
+		t.PostEvent(ev)
+		return
+	}
+	select {
+	case t.evch <- ev:
+		t.cliphist.Note(ev)
+		t.subs.Publish(ev)
+	case <-t.quit:
+	}
 }
 
 func (t *tScreen) PostEvent(ev Event) error {
+	t.regions.Annotate(ev)
+	if t.manual {
+		// There is no other goroutine to drain the queue, so it
+		// must not block.
+		t.evlk.Lock()
+		t.evq = append(t.evq, ev)
+		t.evlk.Unlock()
+		t.cliphist.Note(ev)
+		t.subs.Publish(ev)
+		return nil
+	}
 	select {
 	case t.evch <- ev:
+		t.cliphist.Note(ev)
+		t.subs.Publish(ev)
 		return nil
 	default:
 		return ErrEventQFull
 	}
 }
 
+func (t *tScreen) InjectKey(key Key, ch rune, mod ModMask) error {
+	return t.PostEvent(newSyntheticKey(key, ch, mod))
+}
+
+func (t *tScreen) InjectMouse(x, y int, buttons ButtonMask, mod ModMask) error {
+	return t.PostEvent(newSyntheticMouse(x, y, buttons, mod))
+}
+
+func (t *tScreen) Mirror(w io.Writer) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.fini {
+		return ErrNoScreen
+	}
+
+	// Bring the new viewer up to date, with a repaint that only it
+	// sees.  The terminal, and the other viewers, are left alone.
+	ti := t.ti
+	init := &bytes.Buffer{}
+	if t.inline == 0 {
+		ti.TPuts(init, ti.EnterCA)
+	}
+	ti.TPuts(init, ti.EnableAcs)
+	if t.quit != nil {
+		init.Write(t.repaint())
+	}
+	t.mirrors.Add(w, init.Bytes())
+	return nil
+}
+
+func (t *tScreen) Unmirror(w io.Writer) {
+	t.mirrors.Remove(w)
+}
+
+func (t *tScreen) MirrorDiffs(w io.Writer) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.fini {
+		return ErrNoScreen
+	}
+	t.diffs.Add(w, &t.cells)
+	return nil
+}
+
+func (t *tScreen) UnmirrorDiffs(w io.Writer) {
+	t.diffs.Remove(w)
+}
+
+func (t *tScreen) RegisterRegion(id string, r Rect) {
+	t.regions.Register(id, r)
+}
+
+func (t *tScreen) UnregisterRegion(id string) {
+	t.regions.Unregister(id)
+}
+
+func (t *tScreen) Subscribe(size int) <-chan Event {
+	return t.subs.Subscribe(size)
+}
+
+func (t *tScreen) Unsubscribe(ch <-chan Event) {
+	t.subs.Unsubscribe(ch)
+}
+
 func (t *tScreen) clip(x, y int) (int, int) {
 	w, h := t.cells.Size()
 	if x < 0 {
@@ -1093,7 +3443,7 @@ func (t *tScreen) buildMouseEvent(x, y, btn int) *EventMouse {
 	// to the screen in that case.
 	x, y = t.clip(x, y)
 
-	escseq := t.escbuf.String()
+	escseq := t.escSeq()
 	t.escbuf.Reset()
 	return NewEventMouse(x, y, button, mod, escseq)
 }
@@ -1295,16 +3645,19 @@ func (t *tScreen) parseFunctionKey(buf *bytes.Buffer, evs *[]Event) (bool, bool)
 			if len(esc) == 1 {
 				r = rune(b[0])
 			}
-			mod := k.mod
+			key, mod := k.key, k.mod
 			if t.escaped {
 				mod |= ModAlt
 				t.escaped = false
 			}
+			if t.bsnorm && (r == '\b' || r == '\x7f') {
+				key, mod = t.backspace(r, mod)
+			}
 			for i := 0; i < len(esc); i++ {
 				by, _ := buf.ReadByte()
 				t.escbuf.WriteByte(by)
 			}
-			*evs = append(*evs, NewEventKey(k.key, r, mod, t.escbuf.String()))
+			*evs = append(*evs, NewEventKey(key, r, mod, t.escSeq()))
 			t.escbuf.Reset()
 			return true, true
 		}
@@ -1315,7 +3668,204 @@ func (t *tScreen) parseFunctionKey(buf *bytes.Buffer, evs *[]Event) (bool, bool)
 	return partial, false
 }
 
-func (t *tScreen) parseRune(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
+// backspace returns the key and modifiers for a backspace or delete
+// character, when they are being normalized.  The one that the terminal
+// database gives for the backspace key is that key; terminals send the
+// other for the key with control held.
+func (t *tScreen) backspace(r rune, mod ModMask) (Key, ModMask) {
+	if kbs := t.ti.KeyBackspace; len(kbs) == 1 && rune(kbs[0]) != r {
+		mod |= ModCtrl
+	}
+	return KeyBackspace, mod
+}
+
+// kittyKeys maps the codes of the kitty keyboard protocol's functional
+// keys, where they are not characters, to our keys.  Others, such as the
+// modifier keys pressed alone, have no key of ours and are dropped.
+var kittyKeys = map[int]Key{
+	9:     KeyTab,
+	13:    KeyEnter,
+	27:    KeyEscape,
+	127:   KeyBackspace2,
+	57359: KeyScrollLock,
+	57361: KeyPrint,
+	57362: KeyPause,
+	57363: KeyMenu,
+	57414: KeyKPEnter,
+}
+
+// kittyMods converts the modifiers of the kitty keyboard protocol, and of
+// the xterm sequences that it extends, to ours.  Meta and Super both count
+// as ModMeta.
+func kittyMods(m int) ModMask {
+	mod := ModNone
+	m--
+	if m&1 != 0 {
+		mod |= ModShift
+	}
+	if m&2 != 0 {
+		mod |= ModAlt
+	}
+	if m&4 != 0 {
+		mod |= ModCtrl
+	}
+	if m&(8|32) != 0 {
+		mod |= ModMeta
+	}
+	if m&64 != 0 {
+		mod |= ModCapsLock
+	}
+	if m&128 != 0 {
+		mod |= ModNumLock
+	}
+	return mod
+}
+
+// parseLockedKey handles key sequences that carry the state of the lock
+// keys, which terminals using the kitty keyboard protocol send.  These are
+// the protocol's own CSI u sequences, and the usual xterm sequences with
+// the lock keys added to the modifiers, which would otherwise not match.
+// It is only used once the terminal has confirmed the protocol, and it
+// leaves alone the sequences that end as replies to queries do.
+func (t *tScreen) parseLockedKey(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
+	if !t.kitty {
+		return false, false
+	}
+	b := buf.Bytes()
+	if len(b) < 2 || b[0] != '\x1b' || b[1] != '[' {
+		return len(b) == 1 && b[0] == '\x1b', false
+	}
+	end := -1
+	for i := 2; i < len(b); i++ {
+		if c := b[i]; c >= 0x40 && c <= 0x7e {
+			end = i
+			break
+		} else if (c < '0' || c > '9') && c != ';' && c != ':' {
+			return false, false
+		}
+	}
+	if end < 0 {
+		return true, false
+	}
+
+	params := strings.Split(string(b[2:end]), ";")
+	final := b[end]
+	switch final {
+	case 'R', 'n', 'c':
+		// Replies to queries; the protocol sends F3 as CSI 13 ~.
+		return false, false
+	}
+	if len(params) < 2 && final != 'u' {
+		return false, false
+	}
+	m := 1
+	if len(params) > 1 {
+		// The modifiers may be followed by the event type, of
+		// which only presses and repeats are reported.
+		sub := strings.Split(params[1], ":")
+		if n, err := strconv.Atoi(sub[0]); err == nil {
+			m = n
+		}
+		if len(sub) > 1 && sub[1] == "3" {
+			t.consumeLocked(buf, end+1)
+			return true, true
+		}
+	}
+	mod := kittyMods(m)
+	lock := mod & (ModCapsLock | ModNumLock)
+	mod &^= lock
+	if t.escaped {
+		mod |= ModAlt
+	}
+
+	if final != 'u' {
+		// A sequence that would be known without the locks.
+		if lock == 0 {
+			return false, false
+		}
+		seq := "\x1b[" + params[0]
+		if n := (m-1)&^(64|128) + 1; n > 1 {
+			seq += ";" + strconv.Itoa(n)
+		} else if params[0] == "1" && final != '~' {
+			seq = "\x1b["
+		}
+		seq += string(final)
+		k, ok := t.keycodes[seq]
+		if !ok {
+			return false, false
+		}
+		t.consumeLocked(buf, end+1)
+		ev := NewEventKey(k.key, 0, k.mod|mod&ModAlt, t.escSeq())
+		ev.locks = lock
+		*evs = append(*evs, ev)
+		t.escbuf.Reset()
+		return true, true
+	}
+
+	codes := strings.Split(params[0], ":")
+	code, err := strconv.Atoi(codes[0])
+	if err != nil {
+		return false, false
+	}
+	t.consumeLocked(buf, end+1)
+	if k, ok := kittyKeys[code]; ok {
+		if k == KeyTab && mod&ModShift != 0 {
+			k, mod = KeyBacktab, mod&^ModShift
+		}
+		ev := NewEventKey(k, 0, mod, t.escSeq())
+		ev.locks = lock
+		*evs = append(*evs, ev)
+	} else if code >= 57344 && code <= 63743 && len(params) < 3 {
+		// A functional key that we have no name for, and that
+		// produces no text, such as a modifier key on its own.
+	} else {
+		r := rune(code)
+		if len(params) > 2 {
+			// The text that the key produces, if reported.
+			if n, err := strconv.Atoi(strings.Split(params[2], ":")[0]); err == nil {
+				r = rune(n)
+			}
+		} else {
+			if mod&ModShift != 0 {
+				r = unicode.ToUpper(r)
+				if len(codes) > 1 && codes[1] != "" {
+					if n, err := strconv.Atoi(codes[1]); err == nil {
+						r = rune(n)
+					}
+				}
+			}
+			if lock&ModCapsLock != 0 && unicode.IsLetter(r) {
+				if unicode.IsUpper(r) {
+					r = unicode.ToLower(r)
+				} else {
+					r = unicode.ToUpper(r)
+				}
+			}
+		}
+		if l := unicode.ToLower(r); mod&ModCtrl != 0 && l >= 'a' && l <= 'z' {
+			r = l - 'a' + 1
+		}
+		// As for other keys, shift is reflected in the character.
+		mod &^= ModShift
+		ev := NewEventKey(KeyRune, r, mod, t.escSeq())
+		ev.locks = lock
+		*evs = append(*evs, ev)
+	}
+	t.escbuf.Reset()
+	return true, true
+}
+
+// consumeLocked moves the first n bytes of the buffer to the escape
+// sequence of the event being parsed.
+func (t *tScreen) consumeLocked(buf *bytes.Buffer, n int) {
+	t.escaped = false
+	for i := 0; i < n; i++ {
+		by, _ := buf.ReadByte()
+		t.escbuf.WriteByte(by)
+	}
+}
+
+func (t *tScreen) parseRune(buf *bytes.Buffer, evs *[]Event, expire bool) (bool, bool) {
 	b := buf.Bytes()
 	if b[0] >= ' ' && b[0] <= 0x7F {
 		// printable ASCII easy to deal with -- no encodings
@@ -1324,9 +3874,13 @@ func (t *tScreen) parseRune(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
 			mod = ModAlt
 			t.escaped = false
 		}
+		key := KeyRune
+		if t.bsnorm && b[0] == '\x7f' {
+			key, mod = t.backspace(rune(b[0]), mod)
+		}
 		by, _ := buf.ReadByte()
 		t.escbuf.WriteByte(by)
-		*evs = append(*evs, NewEventKey(KeyRune, rune(b[0]), mod, t.escbuf.String()))
+		*evs = append(*evs, NewEventKey(key, rune(b[0]), mod, t.escSeq()))
 		t.escbuf.Reset()
 		return true, true
 	}
@@ -1336,6 +3890,24 @@ func (t *tScreen) parseRune(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
 		return false, false
 	}
 
+	if t.utf8in {
+		if !utf8.FullRune(b) {
+			if !expire {
+				return true, false
+			}
+			// Nothing more is coming to complete it.
+			t.badInput(buf, len(b), evs)
+			return true, true
+		}
+		r, n := utf8.DecodeRune(b)
+		if r == utf8.RuneError && n == 1 {
+			t.badInput(buf, 1, evs)
+		} else {
+			t.runeInput(buf, r, n, evs)
+		}
+		return true, true
+	}
+
 	utfb := make([]byte, 12)
 	for l := 1; l <= len(b); l++ {
 		t.decoder.Reset()
@@ -1344,28 +3916,68 @@ func (t *tScreen) parseRune(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
 			continue
 		}
 		if nout != 0 {
-			r, _ := utf8.DecodeRune(utfb[:nout])
-			if r != utf8.RuneError {
-				mod := ModNone
-				if t.escaped {
-					mod = ModAlt
-					t.escaped = false
-				}
-				*evs = append(*evs, NewEventKey(KeyRune, r, mod, t.escbuf.String()))
-				t.escbuf.Reset()
-			}
-			for nin > 0 {
-				by, _ := buf.ReadByte()
-				t.escbuf.WriteByte(by)
-				nin--
+			if r, _ := utf8.DecodeRune(utfb[:nout]); r != utf8.RuneError {
+				t.runeInput(buf, r, nin, evs)
+			} else {
+				t.badInput(buf, nin, evs)
 			}
 			return true, true
 		}
 	}
+	if expire || len(b) >= utf8.UTFMax {
+		// No character is that long, so the first byte is bad.
+		t.badInput(buf, 1, evs)
+		return true, true
+	}
 	// Looks like potential escape
 	return true, false
 }
 
+// runeInput consumes the n bytes of input that make up the rune.
+func (t *tScreen) runeInput(buf *bytes.Buffer, r rune, n int, evs *[]Event) {
+	mod := ModNone
+	if t.escaped {
+		mod = ModAlt
+		t.escaped = false
+	}
+	for ; n > 0; n-- {
+		by, _ := buf.ReadByte()
+		t.escbuf.WriteByte(by)
+	}
+	*evs = append(*evs, NewEventKey(KeyRune, r, mod, t.escSeq()))
+	t.escbuf.Reset()
+}
+
+// escSeq returns the input that makes up the event being parsed, for
+// its EscSeq method, unless that has been turned off.
+func (t *tScreen) escSeq() string {
+	if t.noseq {
+		return ""
+	}
+	return t.escbuf.String()
+}
+
+// badInput consumes n bytes of input that could not be decoded, and
+// deals with them as the UTF8Policy says.
+func (t *tScreen) badInput(buf *bytes.Buffer, n int, evs *[]Event) {
+	mod := ModNone
+	if t.escaped {
+		mod = ModAlt
+		t.escaped = false
+	}
+	for ; n > 0; n-- {
+		by, _ := buf.ReadByte()
+		t.escbuf.WriteByte(by)
+	}
+	switch t.utf8pol {
+	case UTF8Replace:
+		*evs = append(*evs, NewEventKey(KeyRune, utf8.RuneError, mod, t.escSeq()))
+	case UTF8Raw:
+		*evs = append(*evs, NewEventRaw(t.escbuf.String()))
+	}
+	t.escbuf.Reset()
+}
+
 // This function interprets a block of characters without escapes as a paste
 // Generally the terminal will only send large blocks of text if a paste is
 // occurring, though it may send small blocks of characters together if the user
@@ -1385,7 +3997,7 @@ func (t *tScreen) parsePaste(buf *bytes.Buffer, evs *[]Event) bool {
 				t.escbuf.WriteByte(by)
 			}
 			str := string(bytes.Replace(b, []byte{'\r'}, []byte{'\n'}, -1))
-			*evs = append(*evs, NewEventPaste(str, t.escbuf.String()))
+			*evs = append(*evs, NewEventPaste(str, t.escSeq()))
 			t.escbuf.Reset()
 			return true
 		}
@@ -1409,49 +4021,250 @@ func (t *tScreen) parseOSC52Paste(buf *bytes.Buffer, evs *[]Event) (bool, bool)
 			n, err := base64.StdEncoding.Decode(data, payload)
 			data = data[:n]
 
-			t.escbuf.Write(b)
+			t.escbuf.Write(b)
+
+			if err != nil || t.restrict {
+				// discard the paste since it is invalid (or
+				// we are not accepting terminal replies)
+				t.escbuf.Reset()
+				return true, true
+			}
+
+			*evs = append(*evs, NewEventPaste(string(data), t.escSeq()))
+			t.escbuf.Reset()
+			return true, true
+		}
+		// More still coming
+		return true, false
+	}
+
+	return false, false
+}
+
+// parseBracketedPaste works on the buffer in place, since pastes can be
+// large.  The content is copied once, into the event, and the search for
+// the end resumes where it left off as more data arrives.
+func (t *tScreen) parseBracketedPaste(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
+	b := buf.Bytes()
+	begin, end := []byte(pasteBegin), []byte(pasteEnd)
+	if !bytes.HasPrefix(b, begin) && !bytes.HasPrefix(begin, b) {
+		return false, false
+	}
+	start := len(begin)
+	if t.pscan > start {
+		start = t.pscan
+	}
+	if start > len(b) {
+		return true, false
+	}
+	idx := bytes.Index(b[start:], end)
+	if nest := bytes.Index(b[start:], begin); nest != -1 && (idx == -1 || nest < idx) {
+		// A paste cannot contain the start of another, so the
+		// input is corrupt, or someone is trying to smuggle data
+		// out of the paste.  End this one where the next begins.
+		idx = nest
+		end = nil
+	}
+	if idx == -1 {
+		// There is still more coming
+		t.pscan = start
+		if n := len(b) - len(end) + 1; n > start {
+			t.pscan = n
+		}
+		return true, false
+	}
+	idx += start
+	data := make([]byte, idx-len(begin))
+	copy(data, b[len(begin):idx])
+	buf.Next(idx + len(end))
+	t.pscan = 0
+	*evs = append(*evs, &EventPaste{t: time.Now(), raw: data, crlf: !t.rawpaste, noseq: t.noseq})
+	return true, true
+}
+
+// scanControlSeq looks for a complete CSI, OSC, or DCS control sequence at
+// the start of the buffer, of the kind that terminals send in reply to
+// queries.  It returns the length of the sequence if one is found, or
+// zero.  The partial result is true if the buffer could be the start of
+// such a sequence, but more data is needed.
+func scanControlSeq(b []byte) (n int, partial bool) {
+	if len(b) < 2 || b[0] != '\x1b' {
+		return 0, len(b) == 1 && b[0] == '\x1b'
+	}
+	switch b[1] {
+	case '[':
+		// CSI: parameter bytes, intermediate bytes, then a final byte
+		for i := 2; i < len(b); i++ {
+			switch {
+			case b[i] >= 0x20 && b[i] <= 0x3f:
+			case b[i] >= 0x40 && b[i] <= 0x7e:
+				return i + 1, false
+			default:
+				return 0, false
+			}
+		}
+		return 0, true
+	case ']', 'P', '_', '^':
+		// OSC, DCS, APC, PM: a string terminated by ST (or BEL for OSC)
+		for i := 2; i < len(b); i++ {
+			switch b[i] {
+			case '\a':
+				if b[1] == ']' {
+					return i + 1, false
+				}
+			case '\x1b':
+				if i+1 == len(b) {
+					return 0, true
+				}
+				if b[i+1] == '\\' {
+					return i + 2, false
+				}
+				return 0, false
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// parseReply delivers the replies to queries that have events of their
+// own, such as cursor position reports.
+func (t *tScreen) parseReply(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
+	b := buf.Bytes()
+	if t.escaped || !mayBeReply(b) {
+		return false, false
+	}
+	n, partial := scanControlSeq(b)
+	if n == 0 {
+		return partial, false
+	}
+	if t.kittyon && isKittyFlags(b[:n]) {
+		t.kitty = true
+		buf.Next(n)
+		t.escbuf.Reset()
+		return true, true
+	}
+	ev := replyEvent(string(b[:n]))
+	if ev == nil {
+		return false, false
+	}
+	buf.Next(n)
+	t.escbuf.Reset()
+	*evs = append(*evs, ev)
+	return true, true
+}
+
+// parseQueryReply gives a reply to the query waiting for it, straight
+// from the input, before it can be taken for a key, as a cursor position
+// report can be for a modified function key, such as Ctrl-F3.
+func (t *tScreen) parseQueryReply(buf *bytes.Buffer) (bool, bool) {
+	b := buf.Bytes()
+	if t.escaped || !t.queries.Waiting() || !mayBeReply(b) {
+		return false, false
+	}
+	n, partial := scanControlSeq(b)
+	if n == 0 {
+		return partial, false
+	}
+	ev := replyEvent(string(b[:n]))
+	if ev == nil || !t.queries.Deliver(ev) {
+		return false, false
+	}
+	buf.Next(n)
+	t.escbuf.Reset()
+	return true, true
+}
+
+// isKittyFlags returns true if the sequence is the reply to kittyQuery,
+// such as "\x1b[?1u".
+func isKittyFlags(seq []byte) bool {
+	if !bytes.HasPrefix(seq, []byte("\x1b[?")) || seq[len(seq)-1] != 'u' || len(seq) < 5 {
+		return false
+	}
+	for _, c := range seq[3 : len(seq)-1] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseResponse consumes terminal replies (device attributes, status
+// reports, OSC and DCS strings and the like) which were not recognized
+// as keys or mouse events.  This is only done in restricted mode, where
+// such replies are never solicited, and so are silently discarded.
+func (t *tScreen) parseResponse(buf *bytes.Buffer) (bool, bool) {
+	if t.escaped {
+		return false, false
+	}
+	n, partial := scanControlSeq(buf.Bytes())
+	if n == 0 {
+		return partial, false
+	}
+	buf.Next(n)
+	t.escbuf.Reset()
+	return true, true
+}
+
+func (t *tScreen) scanInput(in *tInput, expire bool) {
+	t.Lock()
+	t.escbuf = &in.escbuf
+	t.escaped = in.escaped
+	t.pscan = in.pscan
+	evs := t.collectEventsFromInput(&in.buf, expire)
+	for _, ev := range evs {
+		if o, ok := ev.(originSetter); ok && !in.arrived.IsZero() {
+			o.setReceived(in.arrived)
+		}
+	}
+	in.escaped = t.escaped
+	in.pscan = t.pscan
+	if t.combining || in.held != nil {
+		evs = in.combine(evs, expire || !t.combining)
+	}
+	if len(evs) > 0 {
+		now := time.Now()
+		if t.idle {
+			t.idle = false
+			wake := &EventIdle{t: now, since: t.lastin}
+			evs = append([]Event{wake}, evs...)
+		}
+		t.lastin = now
+	}
+	metrics, trace := t.metrics, t.trace
+	t.Unlock()
 
-			if err != nil {
-				// discard the paste since it is invalid
-				return true, true
+	if len(evs) > 0 {
+		d := time.Since(in.arrived)
+		if metrics != nil {
+			metrics(MetricInputLatency, d)
+			if expire {
+				metrics(MetricKeyTimeout, d)
 			}
-
-			*evs = append(*evs, NewEventPaste(string(data), t.escbuf.String()))
-			t.escbuf.Reset()
-			return true, true
 		}
-		// More still coming
-		return true, false
+		if trace != nil && expire {
+			trace.Printf("key timer delayed %d events by %v", len(evs), d)
+		}
+		if in.buf.Len() > 0 {
+			in.arrived = time.Now() // the rest is still pending
+		}
 	}
 
-	return false, false
-}
-
-func (t *tScreen) parseBracketedPaste(buf *bytes.Buffer, evs *[]Event) (bool, bool) {
-	// Replace all carriage returns with newlines
-	str := strings.Replace(buf.String(), "\r", "\n", -1)
-	if strings.HasPrefix(str, pasteBegin) || strings.HasPrefix(pasteBegin, str) {
-		idx := strings.Index(str, pasteEnd)
-		// The bracketed paste has started
-		if idx != -1 && idx >= len(pasteBegin) {
-			// The bracketed paste has ended
-			// Strip out the start and end sequences
-			t.escbuf.Write(buf.Next(idx + len(pasteEnd)))
-			text := str[len(pasteBegin):idx]
-			*evs = append(*evs, NewEventPaste(text, t.escbuf.String()))
-			t.escbuf.Reset()
-			return true, true
+	// Replies go to the queries waiting for them first, as the
+	// application may be waiting for one instead of reading events.
+	kept := evs[:0]
+	for _, ev := range evs {
+		if !t.queries.Deliver(ev) {
+			kept = append(kept, ev)
 		}
-		// There is still more coming
-		return true, false
 	}
-	return false, false
-}
-
-func (t *tScreen) scanInput(buf *bytes.Buffer, expire bool) {
-	evs := t.collectEventsFromInput(buf, expire)
+	evs = kept
 
 	for _, ev := range evs {
+		if o, ok := ev.(originSetter); ok {
+			o.setOrigin(in.origin)
+			o.setPosted(time.Now())
+		}
 		switch ev.(type) {
 		case *EventMouse:
 			t.PostEvent(ev)
@@ -1461,15 +4274,12 @@ func (t *tScreen) scanInput(buf *bytes.Buffer, expire bool) {
 	}
 }
 
-// Return an array of Events extracted from the supplied buffer. This is done
-// while holding the screen's lock - the events can then be queued for
+// Return an array of Events extracted from the supplied buffer. The caller
+// must hold the screen's lock - the events can then be queued for
 // application processing with the lock released.
 func (t *tScreen) collectEventsFromInput(buf *bytes.Buffer, expire bool) []Event {
 	res := make([]Event, 0, 20)
 
-	t.Lock()
-	defer t.Unlock()
-
 	for {
 		b := buf.Bytes()
 		if len(b) == 0 {
@@ -1489,13 +4299,21 @@ func (t *tScreen) collectEventsFromInput(buf *bytes.Buffer, expire bool) []Event
 			partials++
 		}
 
-		if part, comp := t.parseBracketedPaste(buf, &res); comp {
+		if t.bpaste {
+			if part, comp := t.parseBracketedPaste(buf, &res); comp {
+				continue
+			} else if part {
+				partials++
+			}
+		}
+
+		if part, comp := t.parseQueryReply(buf); comp {
 			continue
 		} else if part {
 			partials++
 		}
 
-		if part, comp := t.parseRune(buf, &res); comp {
+		if part, comp := t.parseRune(buf, &res, expire); comp {
 			continue
 		} else if part {
 			partials++
@@ -1507,10 +4325,16 @@ func (t *tScreen) collectEventsFromInput(buf *bytes.Buffer, expire bool) []Event
 			partials++
 		}
 
+		if part, comp := t.parseLockedKey(buf, &res); comp {
+			continue
+		} else if part {
+			partials++
+		}
+
 		// Only parse mouse records if this term claims to have
 		// mouse support
 
-		if t.ti.Mouse != "" {
+		if len(t.mouse) != 0 {
 			if part, comp := t.parseXtermMouse(buf, &res); comp {
 				continue
 			} else if part {
@@ -1524,6 +4348,22 @@ func (t *tScreen) collectEventsFromInput(buf *bytes.Buffer, expire bool) []Event
 			}
 		}
 
+		if !t.restrict {
+			if part, comp := t.parseReply(buf, &res); comp {
+				continue
+			} else if part {
+				partials++
+			}
+		}
+
+		if t.restrict {
+			if part, comp := t.parseResponse(buf); comp {
+				continue
+			} else if part {
+				partials++
+			}
+		}
+
 		if partials == 0 || expire {
 			if b[0] == '\x1b' {
 				strb := string(b)
@@ -1547,6 +4387,14 @@ func (t *tScreen) collectEventsFromInput(buf *bytes.Buffer, expire bool) []Event
 					res = append(res, NewEventKey(KeyEsc, 0, ModNone, "\x1b"))
 					t.escbuf.Reset()
 					t.escaped = false
+				} else if t.noescalt && b[1] >= ' ' && b[1] != 0x7f {
+					// The ESC stands alone, and the
+					// character is parsed afresh.
+					res = append(res, NewEventKey(KeyEsc, 0, ModNone, "\x1b"))
+					t.escbuf.Reset()
+					t.escaped = false
+					buf.ReadByte()
+					continue
 				} else {
 					t.escaped = true
 				}
@@ -1566,16 +4414,51 @@ func (t *tScreen) collectEventsFromInput(buf *bytes.Buffer, expire bool) []Event
 		}
 
 		// well we have some partial data, wait until we get
-		// some more
+		// some more, unless we have already buffered too much
+		if t.overflow(buf, &res) {
+			continue
+		}
 		break
 	}
 
 	return res
 }
 
+// overflow checks whether the partial sequence at the start of the buffer
+// has grown past the configured limit.  If it has, the sequence is
+// abandoned: an EventError is posted, followed by an EventRaw carrying
+// the data (truncated to the limit), and the buffered input is discarded
+// so that parsing can resume with fresh input.
+func (t *tScreen) overflow(buf *bytes.Buffer, evs *[]Event) bool {
+	limit := t.seqmax
+	b := buf.Bytes()
+	if bytes.HasPrefix(b, []byte(pasteBegin)) ||
+		bytes.HasPrefix(b, []byte(pasteOSC52Begin)) {
+		limit = t.pastemax
+	}
+	if limit <= 0 || t.escbuf.Len()+len(b) <= limit {
+		return false
+	}
+	t.escbuf.Write(b)
+	data := t.escbuf.Bytes()
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	*evs = append(*evs, NewEventError(ErrInputOverflow))
+	*evs = append(*evs, NewEventRaw(string(data)))
+	t.escbuf.Reset()
+	t.escaped = false
+	t.pscan = 0
+	buf.Reset()
+	return true
+}
+
 func (t *tScreen) mainLoop() {
-	buf := &bytes.Buffer{}
-	t.escbuf = &bytes.Buffer{}
+	// inputs with data that is waiting for an escape sequence to complete
+	pending := make(map[*tInput]bool)
+	// settles a burst of window size changes
+	var rstimer *time.Timer
+	var rsc <-chan time.Time
 	for {
 		select {
 		case <-t.quit:
@@ -1583,11 +4466,31 @@ func (t *tScreen) mainLoop() {
 			return
 		case <-t.sigwinch:
 			t.Lock()
-			t.cx = -1
-			t.cy = -1
-			t.resize()
-			t.cells.Invalidate()
-			t.draw()
+			if t.rsdelay <= 0 {
+				t.winch()
+				t.Unlock()
+				continue
+			}
+			// Restart the wait for the size to settle.
+			t.rsat = time.Now().Add(t.rsdelay)
+			if rstimer == nil {
+				rstimer = time.NewTimer(t.rsdelay)
+			} else {
+				if !rstimer.Stop() {
+					select {
+					case <-rstimer.C:
+					default:
+					}
+				}
+				rstimer.Reset(t.rsdelay)
+			}
+			rsc = rstimer.C
+			t.Unlock()
+			continue
+		case <-rsc:
+			rsc = nil
+			t.Lock()
+			t.winch()
 			t.Unlock()
 			continue
 		case <-t.keytimer.C:
@@ -1596,12 +4499,15 @@ func (t *tScreen) mainLoop() {
 			// then we assume the escape sequence reached it's
 			// conclusion, and process the chunk independently.
 			// This lets us detect conflicts such as a lone ESC.
-			if buf.Len() > 0 {
-				if time.Now().After(t.keyexpire) {
-					t.scanInput(buf, true)
+			for in := range pending {
+				if time.Now().After(in.expire) {
+					t.scanInput(in, true)
+				}
+				if !in.pending() {
+					delete(pending, in)
 				}
 			}
-			if buf.Len() > 0 {
+			if len(pending) > 0 {
 				if !t.keytimer.Stop() {
 					select {
 					case <-t.keytimer.C:
@@ -1611,16 +4517,21 @@ func (t *tScreen) mainLoop() {
 				t.keytimer.Reset(time.Millisecond * 50)
 			}
 		case chunk := <-t.keychan:
-			buf.Write(chunk)
-			t.keyexpire = time.Now().Add(time.Millisecond * 50)
-			t.scanInput(buf, false)
+			in := chunk.in
+			in.addInput(chunk.data, chunk.at)
+			t.scanInput(in, false)
+			if in.pending() {
+				pending[in] = true
+			} else {
+				delete(pending, in)
+			}
 			if !t.keytimer.Stop() {
 				select {
 				case <-t.keytimer.C:
 				default:
 				}
 			}
-			if buf.Len() > 0 {
+			if len(pending) > 0 {
 				t.keytimer.Reset(time.Millisecond * 50)
 			}
 		}
@@ -1628,29 +4539,101 @@ func (t *tScreen) mainLoop() {
 }
 
 func (t *tScreen) inputLoop() {
+	defer close(t.inputq)
+	quit := t.quit
 	for {
 		chunk := make([]byte, 4096)
 		n, e := t.in.Read(chunk)
 		switch e {
 		case nil:
+		case errInputStopped:
+			return
 		default:
 			t.PostEvent(NewEventError(e))
 			return
 		}
-		t.keychan <- chunk[:n]
+		select {
+		case t.keychan <- tChunk{in: t.input, data: chunk[:n], at: time.Now()}:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// stopInput interrupts the input loop, if the terminal allows it, and
+// waits for it to finish.
+func (t *tScreen) stopInput() {
+	if r, ok := t.in.(interface{ Interrupt() }); ok {
+		r.Interrupt()
+		<-t.inputq
+	}
+}
+
+// readInput reads from a stream added with AddInput, feeding the data to
+// the same parser used for the terminal.  The stream reaching its end is
+// not considered an error.
+func (t *tScreen) readInput(in *tInput) {
+	quit := t.quit
+	keychan := t.keychan
+	for {
+		chunk := make([]byte, 4096)
+		n, e := in.r.Read(chunk)
+		if n > 0 {
+			select {
+			case keychan <- tChunk{in: in, data: chunk[:n], at: time.Now()}:
+			case <-quit:
+				return
+			}
+		}
+		if e != nil {
+			if e != io.EOF {
+				t.PostEvent(NewEventError(e))
+			}
+			return
+		}
 	}
 }
 
 func (t *tScreen) Sync() {
+	t.SyncFrame()
+}
+
+func (t *tScreen) SyncFrame() FrameInfo {
+	start := time.Now()
 	t.Lock()
+	t.frame = FrameInfo{}
 	t.cx = -1
 	t.cy = -1
 	if !t.fini {
 		t.resize()
 		t.clear = true
 		t.cells.Invalidate()
-		t.draw()
+		if t.relayout() {
+			t.draw()
+			t.snapshot()
+		}
 	}
+	frame := t.frame
+	metrics := t.metrics
+	notify := t.textw.Check(&t.cells, &t.regions)
+	t.Unlock()
+	frame.Duration = time.Since(start)
+	if notify != nil {
+		notify()
+	}
+	if metrics != nil {
+		metrics(MetricShowLatency, time.Since(start))
+	}
+	return frame
+}
+
+func (t *tScreen) Invalidate(rect Rect) {
+	t.Lock()
+	t.cells.InvalidateRect(rect)
+	t.minsz.Invalidate()
+	t.cx = -1
+	t.cy = -1
+	t.curstyle = styleInvalid
 	t.Unlock()
 }
 
@@ -1658,6 +4641,75 @@ func (t *tScreen) CharacterSet() string {
 	return t.charset
 }
 
+func (t *tScreen) SetCharset(charset string) error {
+	charset = normalizeCharset(charset)
+	t.Lock()
+	defer t.Unlock()
+	if t.encs.Get(charset) == nil {
+		return ErrNoCharset
+	}
+	t.usercs = charset
+	return nil
+}
+
+func (t *tScreen) SetInputEncoding(charset string) error {
+	charset = normalizeCharset(charset)
+	t.Lock()
+	defer t.Unlock()
+	if t.encs.Get(charset) == nil {
+		return ErrNoCharset
+	}
+	t.incs = charset
+	return nil
+}
+
+func (t *tScreen) SetOutputEncoding(charset string) error {
+	charset = normalizeCharset(charset)
+	t.Lock()
+	defer t.Unlock()
+	if t.encs.Get(charset) == nil {
+		return ErrNoCharset
+	}
+	t.outcs = charset
+	return nil
+}
+
+func (t *tScreen) RegisterEncoding(charset string, enc encoding.Encoding) {
+	t.Lock()
+	t.encs.Register(charset, enc)
+	t.Unlock()
+}
+
+func (t *tScreen) SetEncodingFallback(fb EncodingFallback) {
+	t.Lock()
+	t.encs.SetFallback(fb)
+	t.Unlock()
+}
+
+func (t *tScreen) SetCaptureEscSeq(on bool) {
+	t.Lock()
+	t.noseq = !on
+	t.Unlock()
+}
+
+func (t *tScreen) SetNormalizeBackspace(on bool) {
+	t.Lock()
+	t.bsnorm = on
+	t.Unlock()
+}
+
+func (t *tScreen) SetEscapeAlt(on bool) {
+	t.Lock()
+	t.noescalt = !on
+	t.Unlock()
+}
+
+func (t *tScreen) SetUTF8Policy(policy UTF8Policy) {
+	t.Lock()
+	t.utf8pol = policy
+	t.Unlock()
+}
+
 func (t *tScreen) RegisterRuneFallback(orig rune, fallback string) {
 	t.Lock()
 	t.fallback[orig] = fallback
@@ -1670,9 +4722,48 @@ func (t *tScreen) UnregisterRuneFallback(orig rune) {
 	t.Unlock()
 }
 
+func (t *tScreen) OnResize(fn func(w, h int)) {
+	t.Lock()
+	t.onresize = fn
+	t.laidw, t.laidh = t.w, t.h
+	t.Unlock()
+}
+
+func (t *tScreen) Linearize() []TextBlock {
+	t.Lock()
+	defer t.Unlock()
+	return linearize(&t.cells, &t.regions)
+}
+
+func (t *tScreen) OnTextChange(fn func([]TextBlock)) {
+	t.Lock()
+	t.textw.Set(fn)
+	t.Unlock()
+}
+
+func (t *tScreen) SetMinSize(w, h int) {
+	t.Lock()
+	t.minsz.Set(w, h)
+	t.checkMinSize()
+	t.Unlock()
+}
+
+func (t *tScreen) SetGlyphPolicy(policy GlyphPolicy) {
+	t.Lock()
+	t.glyphs = policy
+	t.cells.Invalidate()
+	t.Unlock()
+}
+
 func (t *tScreen) CanDisplay(r rune, checkFallbacks bool) bool {
+	// The encoder is shared with drawing.
+	t.Lock()
+	defer t.Unlock()
 
-	if enc := t.encoder; enc != nil {
+	if _, ok := t.glyphs.Replace[r]; ok {
+		return checkFallbacks
+	}
+	if enc := t.encoder; enc != nil && t.glyphs.allows(r) {
 		nb := make([]byte, 6)
 		ob := make([]byte, 6)
 		num := utf8.EncodeRune(ob, r)
@@ -1697,10 +4788,50 @@ func (t *tScreen) CanDisplay(r rune, checkFallbacks bool) bool {
 	return false
 }
 
+func (t *tScreen) Pasting() bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.input != nil && t.input.pscan > 0 {
+		return true
+	}
+	for _, in := range t.inputs {
+		if in.pscan > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *tScreen) HasMouse() bool {
 	return len(t.mouse) != 0
 }
 
+func (t *tScreen) Has(c Capability) bool {
+	switch c {
+	case CapMouse:
+		return t.HasMouse()
+	case CapPaste:
+		t.Lock()
+		defer t.Unlock()
+		return t.canPaste()
+	case CapKeyBindings:
+		return true
+	case CapClipboard:
+		return t.HasClipboard(ClipboardSystem)
+	case CapTrueColor:
+		return t.Colors() >= 1<<24
+	case CapRequestResize:
+		t.Lock()
+		defer t.Unlock()
+		return t.inline == 0 && t.termIs(resizeTerms)
+	case CapAddInput:
+		t.Lock()
+		defer t.Unlock()
+		return !t.manual
+	}
+	return false
+}
+
 func (t *tScreen) HasKey(k Key) bool {
 	if k == KeyRune {
 		return true
@@ -1710,33 +4841,55 @@ func (t *tScreen) HasKey(k Key) bool {
 
 func (t *tScreen) Resize(int, int, int, int) {}
 
-func (t *tScreen) GetClipboard(register string) error {
-	if len(register) <= 0 {
-		return errors.New("No register provided")
+func (t *tScreen) RequestResize(w, h int) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.quit == nil || t.fini {
+		return ErrNoScreen
 	}
+	if w <= 0 || h <= 0 || t.inline > 0 || !t.termIs(resizeTerms) {
+		return ErrNotSupported
+	}
+	// The resize event follows when (and if) the window changes.
+	t.TPuts(fmt.Sprintf(resizeWindow, h, w))
+	return nil
+}
 
-	r := register[0]
-
-	if r != 'c' && r != 'p' {
-		return errors.New("Invalid register")
+func (t *tScreen) GetClipboard(register ClipboardRegister) error {
+	if t.restrict {
+		return ErrRestricted
+	}
+	if !register.Valid() {
+		return ErrBadRegister
 	}
 
+	r := register[0]
+
 	t.TPuts(fmt.Sprintf(pasteGet, r))
 
 	return nil
 }
 
-func (t *tScreen) SetClipboard(text, register string) error {
-	if len(register) <= 0 {
-		return errors.New("No register provided")
-	}
+func (t *tScreen) HasClipboard(register ClipboardRegister) bool {
+	// Reading may be forbidden, but setting is still possible.
+	return register.Valid()
+}
 
-	r := register[0]
+func (t *tScreen) SetClipboardHistory(entries, size int) {
+	t.cliphist.SetLimits(entries, size)
+}
+
+func (t *tScreen) ClipboardHistory() []string {
+	return t.cliphist.Texts()
+}
 
-	if r != 'c' && r != 'p' {
-		return errors.New("Invalid register")
+func (t *tScreen) SetClipboard(text string, register ClipboardRegister) error {
+	if !register.Valid() {
+		return ErrBadRegister
 	}
 
+	r := register[0]
+
 	t.TPuts(fmt.Sprintf(pasteClear, r))
 
 	var err error = nil
@@ -1748,6 +4901,110 @@ func (t *tScreen) SetClipboard(text, register string) error {
 	str := base64.StdEncoding.EncodeToString([]byte(text))
 
 	t.TPuts(fmt.Sprintf(pasteSet, r, str))
+	t.cliphist.Add(text)
 
 	return err
 }
+
+// The requests for the Query methods.  Strings are terminated by ST, as
+// the replies are terminated like the requests.
+const (
+	queryCursor  = "\x1b[6n"
+	queryFg      = "\x1b]10;?\x1b\\"
+	queryBg      = "\x1b]11;?\x1b\\"
+	queryPalette = "\x1b]4;%d;?\x1b\\"
+	queryTermcap = "\x1bP+q%s\x1b\\"
+)
+
+// query sends a request to the terminal, and waits for the replies that
+// the match functions accept, one for each.
+func (t *tScreen) query(req string, timeout time.Duration, match ...func(Event) bool) ([]Event, error) {
+	t.Lock()
+	if t.quit == nil || t.fini {
+		t.Unlock()
+		return nil, ErrNoScreen
+	}
+	if t.restrict {
+		t.Unlock()
+		return nil, ErrRestricted
+	}
+	ch := make(chan Event, len(match))
+	for _, m := range match {
+		t.queries.Add(m, timeout, func(ev Event) { ch <- ev })
+	}
+	t.TPuts(req)
+	t.Unlock()
+
+	evs := make([]Event, 0, len(match))
+	var err error
+	for range match {
+		if ev := <-ch; ev != nil {
+			evs = append(evs, ev)
+		} else {
+			err = ErrQueryTimeout
+		}
+	}
+	return evs, err
+}
+
+func (t *tScreen) QueryCursorPosition(timeout time.Duration) (int, int, error) {
+	evs, err := t.query(queryCursor, timeout, func(ev Event) bool {
+		_, ok := ev.(*EventCursorReport)
+		return ok
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	x, y := evs[0].(*EventCursorReport).Position()
+	t.Lock()
+	if t.inline > 0 {
+		y -= t.itop
+	}
+	t.Unlock()
+	return x, y, nil
+}
+
+func (t *tScreen) QueryDefaultColors(timeout time.Duration) (Color, Color, error) {
+	color := func(bg bool) func(Event) bool {
+		return func(ev Event) bool {
+			cr, ok := ev.(*EventColorReport)
+			return ok && cr.Index() < 0 && cr.Background() == bg
+		}
+	}
+	evs, err := t.query(queryFg+queryBg, timeout, color(false), color(true))
+	if err != nil {
+		return ColorDefault, ColorDefault, err
+	}
+	fg, bg := evs[0].(*EventColorReport), evs[1].(*EventColorReport)
+	if fg.Background() {
+		fg, bg = bg, fg
+	}
+	return fg.Color(), bg.Color(), nil
+}
+
+func (t *tScreen) QueryPaletteColor(index int, timeout time.Duration) (Color, error) {
+	if index < 0 || index > 255 {
+		return ColorDefault, ErrNotSupported
+	}
+	evs, err := t.query(fmt.Sprintf(queryPalette, index), timeout, func(ev Event) bool {
+		cr, ok := ev.(*EventColorReport)
+		return ok && cr.Index() == index
+	})
+	if err != nil {
+		return ColorDefault, err
+	}
+	return evs[0].(*EventColorReport).Color(), nil
+}
+
+func (t *tScreen) QueryTermcap(name string, timeout time.Duration) (string, bool, error) {
+	req := fmt.Sprintf(queryTermcap, hex.EncodeToString([]byte(name)))
+	evs, err := t.query(req, timeout, func(ev Event) bool {
+		tr, ok := ev.(*EventTermcapReport)
+		return ok && (tr.Name() == name || tr.Name() == "")
+	})
+	if err != nil {
+		return "", false, err
+	}
+	value, ok := evs[0].(*EventTermcapReport).Value()
+	return value, ok, nil
+}
@@ -27,13 +27,18 @@ type termiosPrivate syscall.Termios
 
 func (t *tScreen) termioInit() error {
 	var e error
+	var in *os.File
 	var newtios termiosPrivate
 	var fd uintptr
 	var tios uintptr
 	var ioc uintptr
 	t.tiosp = &termiosPrivate{}
 
-	if t.in, e = os.OpenFile("/dev/tty", os.O_RDONLY, 0); e != nil {
+	if in, e = os.OpenFile("/dev/tty", os.O_RDONLY, 0); e != nil {
+		goto failed
+	}
+	if t.in, e = newTtyReader(in); e != nil {
+		in.Close()
 		goto failed
 	}
 	if t.out, e = os.OpenFile("/dev/tty", os.O_WRONLY, 0); e != nil {
@@ -76,7 +81,7 @@ func (t *tScreen) termioInit() error {
 
 failed:
 	if t.in != nil {
-		t.in.(*os.File).Close()
+		t.in.(*ttyReader).Close()
 	}
 	if t.out != nil {
 		t.out.(*os.File).Close()
@@ -89,6 +94,7 @@ func (t *tScreen) termioFini() {
 	signal.Stop(t.sigwinch)
 
 	<-t.indoneq
+	t.stopInput()
 
 	if t.out != nil {
 		fd := uintptr(t.out.(*os.File).Fd())
@@ -98,10 +104,24 @@ func (t *tScreen) termioFini() {
 		t.out.(*os.File).Close()
 	}
 	if t.in != nil {
-		t.in.(*os.File).Close()
+		t.in.(*ttyReader).Close()
 	}
 }
 
+// drain waits until the output written to the terminal has been sent.
+func (t *tScreen) drain() error {
+	f, ok := t.out.(*os.File)
+	if !ok {
+		return nil
+	}
+	ioc := uintptr(syscall.TIOCDRAIN)
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioc, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
 func (t *tScreen) getWinSize() (int, int, error) {
 
 	fd := uintptr(t.out.(*os.File).Fd())
@@ -123,6 +123,20 @@ func (t *tScreen) termioFini() {
 	}
 }
 
+// drain waits until the output written to the terminal has been sent.
+func (t *tScreen) drain() error {
+	f, ok := t.out.(*poller.FD)
+	if !ok {
+		return nil
+	}
+	ioc := uintptr(syscall.TIOCDRAIN)
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(f.Sysfd()), ioc, 0)
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
 func (t *tScreen) getWinSize() (int, int, error) {
 
 	fd := uintptr(t.out.(*poller.FD).Sysfd())
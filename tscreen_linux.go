@@ -31,10 +31,15 @@ type termiosPrivate struct {
 
 func (t *tScreen) termioInit() error {
 	var e error
+	var in *os.File
 	var raw *unix.Termios
 	var tio *unix.Termios
 
-	if t.in, e = os.OpenFile("/dev/tty", os.O_RDONLY, 0); e != nil {
+	if in, e = os.OpenFile("/dev/tty", os.O_RDONLY, 0); e != nil {
+		goto failed
+	}
+	if t.in, e = newTtyReader(in); e != nil {
+		in.Close()
 		goto failed
 	}
 	if t.out, e = os.OpenFile("/dev/tty", os.O_WRONLY, 0); e != nil {
@@ -86,7 +91,7 @@ func (t *tScreen) termioInit() error {
 
 failed:
 	if t.in != nil {
-		t.in.(*os.File).Close()
+		t.in.(*ttyReader).Close()
 	}
 	if t.out != nil {
 		t.out.(*os.File).Close()
@@ -99,6 +104,7 @@ func (t *tScreen) termioFini() {
 	signal.Stop(t.sigwinch)
 
 	<-t.indoneq
+	t.stopInput()
 
 	if t.out != nil && t.tiosp != nil {
 		unix.IoctlSetTermios(int(t.out.(*os.File).Fd()), unix.TCSETSF, t.tiosp.tio)
@@ -106,8 +112,18 @@ func (t *tScreen) termioFini() {
 	}
 
 	if t.in != nil {
-		t.in.(*os.File).Close()
+		t.in.(*ttyReader).Close()
+	}
+}
+
+// drain waits until the output written to the terminal has been sent.
+func (t *tScreen) drain() error {
+	f, ok := t.out.(*os.File)
+	if !ok {
+		return nil
 	}
+	// This is how tcdrain is implemented.
+	return unix.IoctlSetInt(int(f.Fd()), unix.TCSBRK, 1)
 }
 
 func (t *tScreen) getWinSize() (int, int, error) {
@@ -0,0 +1,138 @@
+// +build plan9
+
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// On Plan 9 the terminal is the console device, /dev/cons.  Raw mode is
+// enabled by writing "rawon" to /dev/consctl, and lasts for as long as
+// that file is held open.  The console itself does not interpret escape
+// sequences, so output relies on a terminal emulator such as vt(1), which
+// also sets $TERM to describe itself.
+type termiosPrivate struct {
+	ctl *os.File
+}
+
+// consReader reads the console.  Nothing interrupts a read of the console
+// that is under way, so once it is stopped, whatever it reads is dropped,
+// and the input loop ends quietly, rather than being waited for.
+type consReader struct {
+	f       *os.File
+	stopped int32
+}
+
+func (r *consReader) Read(p []byte) (int, error) {
+	n, e := r.f.Read(p)
+	if atomic.LoadInt32(&r.stopped) != 0 {
+		return 0, errInputStopped
+	}
+	return n, e
+}
+
+// stop makes the read under way, and any after it, end the input loop.
+func (r *consReader) stop() {
+	atomic.StoreInt32(&r.stopped, 1)
+	r.f.Close()
+}
+
+func (t *tScreen) termioInit() error {
+	var e error
+	var ctl, in *os.File
+
+	if in, e = os.OpenFile("/dev/cons", os.O_RDONLY, 0); e != nil {
+		goto failed
+	}
+	t.in = &consReader{f: in}
+	if t.out, e = os.OpenFile("/dev/cons", os.O_WRONLY, 0); e != nil {
+		goto failed
+	}
+	if ctl, e = os.OpenFile("/dev/consctl", os.O_WRONLY, 0); e != nil {
+		goto failed
+	}
+	if _, e = io.WriteString(ctl, "rawon"); e != nil {
+		ctl.Close()
+		goto failed
+	}
+	t.tiosp = &termiosPrivate{ctl: ctl}
+
+	if w, h, e := t.getWinSize(); e == nil && w != 0 && h != 0 {
+		t.cells.Resize(w, h)
+	}
+
+	return nil
+
+failed:
+	if in != nil {
+		in.Close()
+	}
+	if t.out != nil {
+		t.out.(*os.File).Close()
+	}
+	return e
+}
+
+func (t *tScreen) termioFini() {
+
+	// The input loop may be blocked reading the console until a key is
+	// pressed, so it is stopped, but not waited for.
+	if r, ok := t.in.(*consReader); ok {
+		r.stop()
+	}
+	<-t.indoneq
+
+	if t.tiosp != nil && t.tiosp.ctl != nil {
+		io.WriteString(t.tiosp.ctl, "rawoff")
+		t.tiosp.ctl.Close()
+	}
+	if t.out != nil {
+		t.out.(*os.File).Close()
+	}
+}
+
+// drain does nothing, as writes to the console complete synchronously.
+func (t *tScreen) drain() error {
+	return nil
+}
+
+// getWinSize returns the size of the window.  There is no device that
+// reports this in character cells, so we depend on $LINES and $COLUMNS,
+// falling back to the size in the terminal description.
+func (t *tScreen) getWinSize() (int, int, error) {
+	var e error
+	cols, rows := t.ti.Columns, t.ti.Lines
+	if v := os.Getenv("COLUMNS"); v != "" {
+		if cols, e = strconv.Atoi(v); e != nil {
+			return -1, -1, e
+		}
+	}
+	if v := os.Getenv("LINES"); v != "" {
+		if rows, e = strconv.Atoi(v); e != nil {
+			return -1, -1, e
+		}
+	}
+	return cols, rows, nil
+}
+
+func (t *tScreen) Beep() error {
+	t.writeString(string(byte(7)))
+	return nil
+}
@@ -1,4 +1,4 @@
-// +build nacl plan9
+// +build nacl js
 
 // Copyright 2015 The TCell Authors
 //
@@ -27,6 +27,10 @@ func (t *tScreen) termioInit() error {
 func (t *tScreen) termioFini() {
 }
 
+func (t *tScreen) drain() error {
+	return nil
+}
+
 func (t *tScreen) getWinSize() (int, int, error) {
 	return 0, 0, ErrNoScreen
 }
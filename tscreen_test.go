@@ -0,0 +1,2274 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// mkTestTScreen returns a terminfo screen for xterm that has not been
+// initialized; it has no tty, but is sufficient to exercise the input
+// parser directly.
+func mkTestTScreen(t *testing.T) *tScreen {
+	term := os.Getenv("TERM")
+	os.Setenv("TERM", "xterm")
+	defer os.Setenv("TERM", term)
+
+	s, e := NewTerminfoScreen()
+	if e != nil {
+		t.Fatalf("Failed to get terminfo screen: %v", e)
+	}
+	ts := s.(*tScreen)
+	ts.escbuf = &bytes.Buffer{}
+	ts.input = &tInput{}
+	if enc := GetEncoding("UTF-8"); enc != nil {
+		ts.encoder = enc.NewEncoder()
+		ts.decoder = enc.NewDecoder()
+		ts.utf8in = true
+	}
+	ts.colors = newColorCache(colorCacheMax)
+	ts.palette = paletteValues(ts.nColors())
+	return ts
+}
+
+func TestInputOverflow(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetInputLimits(16, 32)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x1b]52;c;" + strings.Repeat("A", 40))
+	evs := s.collectEventsFromInput(buf, false)
+	if len(evs) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(evs))
+	}
+	if ev, ok := evs[0].(*EventError); !ok || ev.Err() != ErrInputOverflow {
+		t.Errorf("Expected overflow error, got %v", evs[0])
+	}
+	if ev, ok := evs[1].(*EventRaw); !ok || len(ev.EscSeq()) != 32 {
+		t.Errorf("Expected truncated raw event, got %v", evs[1])
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Input buffer not drained")
+	}
+
+	// A short partial sequence is left alone.
+	buf.WriteString("\x1b[<0;1")
+	if evs = s.collectEventsFromInput(buf, false); len(evs) != 0 {
+		t.Errorf("Unexpected events for partial sequence: %v", evs)
+	}
+
+	// And input afterwards parses normally.
+	buf.Reset()
+	buf.WriteString("x")
+	evs = s.collectEventsFromInput(buf, false)
+	if len(evs) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(evs))
+	}
+	if ev, ok := evs[0].(*EventKey); !ok || ev.Rune() != 'x' {
+		t.Errorf("Expected key event, got %v", evs[0])
+	}
+}
+
+func TestRestrictedDropsReplies(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetRestricted(true)
+
+	if e := s.GetClipboard("c"); e != ErrRestricted {
+		t.Errorf("Expected ErrRestricted, got %v", e)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x1b[?62;22c\x1b]11;rgb:0000/0000/0000\x07\x1b[Aq")
+	evs := s.collectEventsFromInput(buf, false)
+	if len(evs) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %v", len(evs), evs)
+	}
+	if ev, ok := evs[0].(*EventKey); !ok || ev.Key() != KeyUp {
+		t.Errorf("Expected KeyUp, got %v", evs[0])
+	}
+	if ev, ok := evs[1].(*EventKey); !ok || ev.Rune() != 'q' {
+		t.Errorf("Expected rune q, got %v", evs[1])
+	}
+}
+
+func TestInputOrigin(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.evch = make(chan Event, 10)
+
+	// A partial sequence on one input must not be spliced with
+	// data arriving on another.
+	tty := &tInput{}
+	extra := &tInput{origin: 1}
+	tty.buf.WriteString("\x1b[")
+	s.scanInput(tty, false)
+	extra.buf.WriteString("A")
+	s.scanInput(extra, false)
+	tty.buf.WriteString("B")
+	s.scanInput(tty, false)
+
+	ev := (<-s.evch).(*EventKey)
+	if ev.Rune() != 'A' || ev.Origin() != 1 {
+		t.Errorf("Expected rune A from origin 1, got %v from %d",
+			ev.Name(), ev.Origin())
+	}
+	ev = (<-s.evch).(*EventKey)
+	if ev.Key() != KeyDown || ev.Origin() != 0 {
+		t.Errorf("Expected KeyDown from origin 0, got %v from %d",
+			ev.Name(), ev.Origin())
+	}
+}
+
+func TestSoftBlink(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 2, 1
+	s.cells.Resize(2, 1)
+	s.curstyle = styleInvalid
+	s.SetSoftBlink(time.Second)
+	s.SetContent(0, 0, 'x', nil, StyleDefault.Blink(true))
+
+	s.draw()
+	if !strings.Contains(out.String(), "x") {
+		t.Errorf("Blinking text not shown: %q", out.String())
+	}
+	if strings.Contains(out.String(), s.ti.Blink) {
+		t.Errorf("Terminal blink used with soft blink: %q", out.String())
+	}
+
+	// Two ticks is half a cycle of normal blink.
+	out.Reset()
+	s.blinkct = 2
+	markBlinking(&s.cells)
+	s.draw()
+	if strings.Contains(out.String(), "x") {
+		t.Errorf("Blinking text not hidden: %q", out.String())
+	}
+}
+
+func TestRedrawShown(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 2, 1
+	s.cells.Resize(2, 1)
+	s.SetSoftBlink(time.Second)
+	s.SetContent(0, 0, 'x', nil, StyleDefault.Blink(true))
+	s.draw()
+	s.snapshot()
+
+	// The blink is redrawn from what was shown, not what has been set
+	// since, which waits for Show.
+	out.Reset()
+	s.SetContent(0, 0, 'y', nil, StyleDefault.Blink(true))
+	s.SetContent(1, 0, 'z', nil, StyleDefault)
+	s.blinkct = 2
+	s.redraw(markBlinking)
+	if strings.ContainsAny(out.String(), "yz") {
+		t.Errorf("Cells drawn before Show: %q", out.String())
+	}
+	s.blinkct = 0
+	out.Reset()
+	s.draw()
+	if !strings.Contains(out.String(), "yz") {
+		t.Errorf("Cells not drawn by Show: %q", out.String())
+	}
+}
+
+func TestBoldAsBright(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 1, 1
+	s.cells.Resize(1, 1)
+	s.SetBoldAsBright(true)
+	s.SetContent(0, 0, 'x', nil, StyleDefault.Foreground(ColorRed))
+	s.draw()
+	if !strings.Contains(out.String(), "\x1b[0;31;1m") {
+		t.Errorf("Expected bold maroon, got %q", out.String())
+	}
+
+	// Likewise with separate attribute sequences.
+	out.Reset()
+	s.sgrok = false
+	s.curstyle = styleInvalid
+	s.cells.Invalidate()
+	s.draw()
+	fg := s.ti.TParm(s.ti.SetFg, int(ColorMaroon&0xff))
+	if !strings.Contains(out.String(), fg) || !strings.Contains(out.String(), s.ti.Bold) {
+		t.Errorf("Expected bold maroon, got %q", out.String())
+	}
+}
+
+func TestCombinedSGR(t *testing.T) {
+	s := mkTestTScreen(t)
+	if !s.sgrok {
+		t.Fatalf("Expected xterm to allow combined SGR")
+	}
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 1, 1
+	s.cells.Resize(1, 1)
+	st := StyleDefault.Foreground(ColorMaroon).Background(ColorReset).
+		Italic(true).Reverse(true).Dim(true)
+	s.SetContent(0, 0, 'x', nil, st)
+	s.curstyle = styleInvalid
+	s.draw()
+	if !strings.Contains(out.String(), "\x1b(B\x1b[0;31;7;2;3mx") {
+		t.Errorf("Bad combined sequence %q", out.String())
+	}
+
+	if p, ok := parseSGR("\x1b[1m\x1b[38;5;9m"); !ok || p != "1;38;5;9" {
+		t.Errorf("Bad parse of joined sequences: %q", p)
+	}
+	if _, ok := parseSGR("\x1b[1m$<2>"); ok {
+		t.Errorf("Padding should not parse as SGR")
+	}
+}
+
+func TestSGRDelta(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 1, 1
+	s.cells.Resize(1, 1)
+
+	st := StyleDefault.Foreground(ColorMaroon).Bold(true).Dim(true).Underline(true)
+	for _, c := range []struct {
+		style Style
+		seq   string
+	}{
+		{st, "\x1b[1;2;4;31mx"},
+		{st.Bold(false), "\x1b[22;2mx"},
+		{st.Bold(false).Underline(false).Background(ColorNavy), "\x1b[24;44mx"},
+		{st.Bold(false).Underline(false).Foreground(ColorReset), "\x1b[39;49mx"},
+		{st.Bold(false).Underline(false).Foreground(ColorReset), "x"},
+		{StyleDefault, "\x1b[22mx"},
+		{StyleDefault.Reverse(true).Foreground(ColorRed), "\x1b[7;31mx"},
+	} {
+		s.SetContent(0, 0, 'x', nil, c.style)
+		s.cells.SetDirty(0, 0, true)
+		out.Reset()
+		s.draw()
+		if !strings.Contains(out.String(), "H"+c.seq) {
+			t.Errorf("Expected %q, got %q", c.seq, out.String())
+		}
+	}
+}
+
+func TestRGBForm(t *testing.T) {
+	old := os.Getenv("TCELL_RGBSEP")
+	defer os.Setenv("TCELL_RGBSEP", old)
+
+	s := mkTestTScreen(t)
+	shared := s.ti
+	os.Setenv("TCELL_RGBSEP", "colon")
+	s.setRGBForm()
+	if s.ti.SetFgRGB != rgbColonFg || s.ti.SetFgBgRGB != rgbColonFgBg {
+		t.Errorf("Colon form not selected: %q", s.ti.SetFgRGB)
+	}
+	if shared.SetFgRGB == rgbColonFg {
+		t.Errorf("Shared terminfo entry was modified")
+	}
+	if seq := s.ti.TParm(s.ti.SetFgRGB, 1, 2, 3); seq != "\x1b[38:2::1:2:3m" {
+		t.Errorf("Bad colon sequence %q", seq)
+	}
+
+	os.Setenv("TCELL_RGBSEP", "semicolon")
+	s.setRGBForm()
+	if s.ti.SetBgRGB != rgbSemiBg {
+		t.Errorf("Semicolon form not selected: %q", s.ti.SetBgRGB)
+	}
+
+	// The application can choose, but the environment overrides it.
+	s.quit = make(chan struct{})
+	s.truecolor = true
+	s.SetRGBSeparator(RGBSepColon)
+	if s.ti.SetFgRGB != rgbSemiFg {
+		t.Errorf("Environment not honored: %q", s.ti.SetFgRGB)
+	}
+	os.Setenv("TCELL_RGBSEP", "")
+	s.SetRGBSeparator(RGBSepColon)
+	if s.ti.SetFgRGB != rgbColonFg {
+		t.Errorf("Colon form not selected: %q", s.ti.SetFgRGB)
+	}
+	s.SetRGBSeparator(RGBSepAuto)
+	if s.ti.SetFgRGB != shared.SetFgRGB {
+		t.Errorf("Terminfo form not restored: %q", s.ti.SetFgRGB)
+	}
+}
+
+func TestManualPump(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+
+	if ev := s.PollEvent(); ev != nil {
+		t.Fatalf("Expected no event, got %v", ev)
+	}
+
+	// More events than a channel would hold, without blocking.
+	s.ProcessInput([]byte(strings.Repeat("a", 20)))
+	for i := 0; i < 20; i++ {
+		if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Rune() != 'a' {
+			t.Fatalf("Expected key %d", i)
+		}
+	}
+
+	// A lone escape is only reported once a tick finds it has expired.
+	s.ProcessInput([]byte("\x1b"))
+	s.Tick()
+	if ev := s.PollEvent(); ev != nil {
+		t.Errorf("Escape reported too soon: %v", ev)
+	}
+	s.input.expire = time.Now().Add(-time.Millisecond)
+	s.Tick()
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Key() != KeyEscape {
+		t.Errorf("Expected escape key, got %v", ev)
+	}
+
+	if _, e := s.AddInput(strings.NewReader("x")); e != ErrNotSupported {
+		t.Errorf("AddInput should not be supported, got %v", e)
+	}
+}
+
+// chanWriter delivers each write on a channel, or fails if closed.
+type chanWriter struct {
+	ch   chan string
+	fail bool
+}
+
+func (w *chanWriter) Write(b []byte) (int, error) {
+	if w.fail {
+		return 0, io.ErrClosedPipe
+	}
+	w.ch <- string(b)
+	return len(b), nil
+}
+
+func TestMirror(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.out = &bytes.Buffer{}
+	s.w, s.h = 2, 1
+	s.cells.Resize(2, 1)
+
+	w := &chanWriter{ch: make(chan string, 10)}
+	if e := s.Mirror(w); e != nil {
+		t.Fatalf("Mirror failed: %v", e)
+	}
+	if got := <-w.ch; !strings.HasPrefix(got, s.ti.EnterCA) {
+		t.Errorf("Mirror not initialized: %q", got)
+	}
+
+	s.SetContent(0, 0, 'z', nil, StyleDefault)
+	s.draw()
+	if got := <-w.ch; !strings.Contains(got, "z") {
+		t.Errorf("Frame not mirrored: %q", got)
+	}
+
+	// A failing writer is dropped.
+	w.fail = true
+	s.SetContent(0, 0, 'y', nil, StyleDefault)
+	s.draw()
+	for i := 0; i < 100; i++ {
+		s.mirrors.lk.Lock()
+		n := len(s.mirrors.sinks)
+		s.mirrors.lk.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Errorf("Failed mirror was not removed")
+}
+
+func TestMirrorRepaint(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.quit = make(chan struct{})
+	s.w, s.h = 3, 1
+	s.cells.Resize(3, 1)
+	s.SetContent(0, 0, 'a', nil, StyleDefault)
+	s.SetContent(1, 0, 'b', nil, StyleDefault)
+	s.draw()
+	s.snapshot()
+	s.SetContent(2, 0, 'c', nil, StyleDefault)
+
+	// The new mirror is painted what was shown, and the terminal is
+	// sent nothing.
+	out.Reset()
+	w := &chanWriter{ch: make(chan string, 10)}
+	if e := s.Mirror(w); e != nil {
+		t.Fatalf("Mirror failed: %v", e)
+	}
+	got := <-w.ch
+	if !strings.Contains(got, s.ti.Clear) || !strings.Contains(got, "ab") || strings.Contains(got, "c") {
+		t.Errorf("Bad repaint for mirror: %q", got)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Terminal sent %q", out.String())
+	}
+
+	// The change not yet shown is still drawn, and nothing else.
+	s.draw()
+	if got := out.String(); !strings.Contains(got, "c") || strings.Contains(got, "a") {
+		t.Errorf("Bad frame after mirror: %q", got)
+	}
+	if got := <-w.ch; got != out.String() {
+		t.Errorf("Mirror got %q, terminal got %q", got, out.String())
+	}
+}
+
+func TestInline(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.quit = make(chan struct{})
+
+	// A 6x5 terminal, with a live region of the bottom two lines.
+	s.inline = 2
+	s.itop = 3
+	s.w, s.h = 6, 2
+	s.cells.Resize(6, 2)
+
+	ss := NewSimulationScreen("")
+	if e := ss.Init(); e != nil {
+		t.Fatalf("Failed to init: %v", e)
+	}
+	defer ss.Fini()
+	ss.SetSize(6, 5)
+	vt := &vtEmulator{s: ss}
+	row := func(y int) string {
+		b := make([]rune, 6)
+		for x := range b {
+			b[x], _, _, _ = ss.GetContent(x, y)
+		}
+		return string(b)
+	}
+
+	s.SetContent(0, 0, 's', nil, StyleDefault)
+	s.SetContent(0, 1, 't', nil, StyleDefault)
+	s.draw()
+	s.snapshot()
+	vt.Write(out.Bytes())
+	out.Reset()
+	if row(3) != "s     " || row(4) != "t     " {
+		t.Errorf("Live region misplaced: %q %q", row(3), row(4))
+	}
+
+	if e := s.Println("one\ntwo"); e != nil {
+		t.Fatalf("Println failed: %v", e)
+	}
+	vt.Write(out.Bytes())
+	for y, want := range []string{"      ", "one   ", "two   ", "s     ", "t     "} {
+		if got := row(y); got != want {
+			t.Errorf("Row %d: got %q want %q", y, got, want)
+		}
+	}
+
+	// Combining marks are encoded with their character, as in a cell.
+	s.encoder = charmap.ISO8859_1.NewEncoder()
+	s.SetGlyphPolicy(GlyphPolicy{Marks: MarksFallback})
+	out.Reset()
+	if e := s.Println("é"); e != nil {
+		t.Fatalf("Println failed: %v", e)
+	}
+	if !strings.Contains(out.String(), "\xe9\r\n") {
+		t.Errorf("Println did not compose the mark: %q", out.String())
+	}
+
+	s.inline = 0
+	if e := s.Println("x"); e != ErrNotSupported {
+		t.Errorf("Expected ErrNotSupported, got %v", e)
+	}
+}
+
+func TestResizeWindow(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+
+	if e := s.RequestResize(80, 24); e != ErrNoScreen {
+		t.Errorf("Expected ErrNoScreen before Init, got %v", e)
+	}
+	s.quit = make(chan struct{})
+	if e := s.RequestResize(80, 24); e != nil {
+		t.Fatalf("RequestResize failed: %v", e)
+	}
+	if got := out.String(); got != "\x1b[8;24;80t" {
+		t.Errorf("Bad resize sequence: %q", got)
+	}
+
+	ti := *s.ti
+	ti.Name, ti.Aliases = "vt100", nil
+	s.ti = &ti
+	if e := s.RequestResize(80, 24); e != ErrNotSupported {
+		t.Errorf("Expected ErrNotSupported, got %v", e)
+	}
+}
+
+func TestResizeCoalesce(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	// Not a tty, so the size cannot be read, but redraws still happen.
+	f, e := ioutil.TempFile("", "tcell")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s.out = f
+
+	for i := 0; i < 3; i++ {
+		s.sigwinch <- os.Interrupt
+		s.Tick()
+	}
+	if s.rsat.IsZero() {
+		t.Fatalf("Resize should be waiting to settle")
+	}
+	s.rsat = time.Now().Add(-time.Millisecond)
+	s.Tick()
+	if !s.rsat.IsZero() {
+		t.Errorf("Resize should have happened")
+	}
+
+	s.SetResizeDelay(0)
+	s.sigwinch <- os.Interrupt
+	s.Tick()
+	if !s.rsat.IsZero() {
+		t.Errorf("Resize should not wait")
+	}
+}
+
+func TestSizePoll(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	f, e := ioutil.TempFile("", "tcell")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s.out = f
+
+	s.Tick()
+	if !s.pollat.IsZero() {
+		t.Errorf("Size polled when not enabled")
+	}
+	s.SetSizePoll(time.Hour)
+	s.Tick()
+	if s.pollat.IsZero() {
+		t.Errorf("Size not polled")
+	}
+	// The size is unknown, so it has not changed and nothing is drawn.
+	if fi, _ := f.Stat(); fi.Size() != 0 {
+		t.Errorf("Unexpected redraw")
+	}
+}
+
+func TestOnResizeShowOnly(t *testing.T) {
+	s := mkTestTScreen(t)
+	f, e := ioutil.TempFile("", "tcell")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s.out = f
+	s.quit = make(chan struct{})
+
+	calls := 0
+	s.OnResize(func(w, h int) {
+		calls++
+	})
+	// The size is changed, and redrawn, without a call to Show.
+	s.SetFixedSize(20, 5)
+	if w, h := s.Size(); w != 20 || h != 5 {
+		t.Fatalf("Size not changed: %dx%d", w, h)
+	}
+	if calls != 0 {
+		t.Errorf("Called other than from Show")
+	}
+	s.Show()
+	if calls != 1 {
+		t.Errorf("Called %d times, expected once", calls)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	f, e := ioutil.TempFile("", "tcell")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s.out = f
+
+	got := make(map[Metric]int)
+	s.SetMetrics(func(m Metric, d time.Duration) {
+		got[m]++
+	})
+
+	s.ProcessInput([]byte("a"))
+	if got[MetricInputLatency] != 1 || got[MetricKeyTimeout] != 0 {
+		t.Errorf("Bad metrics for key: %v", got)
+	}
+
+	s.ProcessInput([]byte("\x1b"))
+	s.input.expire = time.Now().Add(-time.Millisecond)
+	s.Tick()
+	if got[MetricInputLatency] != 2 || got[MetricKeyTimeout] != 1 {
+		t.Errorf("Bad metrics for escape: %v", got)
+	}
+
+	s.Show()
+	if got[MetricShowLatency] != 1 {
+		t.Errorf("Bad metrics for show: %v", got)
+	}
+}
+
+func TestInputTimestamps(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	s.out = ioutil.Discard
+
+	before := time.Now()
+	s.ProcessInput([]byte("\x1b"))
+	after := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	s.input.expire = time.Now().Add(-time.Millisecond)
+	s.Tick()
+	var ev *EventKey
+	for ev == nil {
+		ev, _ = s.PollEvent().(*EventKey)
+	}
+	// The key is stamped with when its byte was read, not when the
+	// escape sequence timer expired.
+	if ev.Key() != KeyEsc || ev.When().Before(before) || ev.When().After(after) {
+		t.Errorf("Bad key %v at %v, read between %v and %v", ev.Name(), ev.When(), before, after)
+	}
+	if ev.Latency() < 5*time.Millisecond {
+		t.Errorf("Latency too short: %v", ev.Latency())
+	}
+	if ev := NewEventKey(KeyRune, 'a', ModNone, ""); ev.Latency() != 0 {
+		t.Errorf("Latency of event not read from input: %v", ev.Latency())
+	}
+}
+
+func TestEnablePaste(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.quit = make(chan struct{})
+
+	s.DisablePaste()
+	if out.String() != pasteDisable {
+		t.Errorf("Expected disable sequence, got %q", out.String())
+	}
+	out.Reset()
+	s.DisablePaste()
+	if out.Len() != 0 {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	// While disabled, the markers are not treated as a paste.
+	buf := bytes.NewBufferString(pasteBegin + "x" + pasteEnd)
+	for _, ev := range s.collectEventsFromInput(buf, true) {
+		if _, ok := ev.(*EventPaste); ok {
+			t.Errorf("Unexpected paste event")
+		}
+	}
+
+	s.EnablePaste()
+	if out.String() != pasteEnable {
+		t.Errorf("Expected enable sequence, got %q", out.String())
+	}
+	buf = bytes.NewBufferString(pasteBegin + "x" + pasteEnd)
+	evs := s.collectEventsFromInput(buf, true)
+	if len(evs) != 1 {
+		t.Fatalf("Expected one event, got %v", evs)
+	}
+	if ev, ok := evs[0].(*EventPaste); !ok || ev.Text() != "x" {
+		t.Errorf("Expected paste of x, got %v", evs[0])
+	}
+}
+
+func TestRawPaste(t *testing.T) {
+	s := mkTestTScreen(t)
+	paste := func() *EventPaste {
+		buf := bytes.NewBufferString(pasteBegin + " a\r\nb \r" + pasteEnd)
+		evs := s.collectEventsFromInput(buf, true)
+		if len(evs) != 1 {
+			t.Fatalf("Expected one event, got %v", evs)
+		}
+		ev, ok := evs[0].(*EventPaste)
+		if !ok {
+			t.Fatalf("Expected paste event, got %v", evs[0])
+		}
+		return ev
+	}
+
+	ev := paste()
+	if ev.Text() != " a\n\nb \n" || string(ev.Raw()) != " a\r\nb \r" {
+		t.Errorf("Bad paste: %q, raw %q", ev.Text(), ev.Raw())
+	}
+	s.SetRawPaste(true)
+	ev = paste()
+	if ev.Text() != " a\r\nb \r" || string(ev.Raw()) != " a\r\nb \r" {
+		t.Errorf("Bad raw paste: %q, raw %q", ev.Text(), ev.Raw())
+	}
+}
+
+func TestPasteChunks(t *testing.T) {
+	s := mkTestTScreen(t)
+	buf := &bytes.Buffer{}
+	body := strings.Repeat("line\r", 1000)
+
+	// Delivered in pieces, with the end marker split.
+	data := pasteBegin + body + pasteEnd
+	var evs []Event
+	for len(data) > 0 {
+		n := 97
+		if n > len(data) {
+			n = len(data)
+		}
+		buf.WriteString(data[:n])
+		data = data[n:]
+		evs = append(evs, s.collectEventsFromInput(buf, false)...)
+	}
+	if len(evs) != 1 {
+		t.Fatalf("Expected one event, got %d", len(evs))
+	}
+	ev := evs[0].(*EventPaste)
+	want := strings.Repeat("line\n", 1000)
+	if ev.Text() != want {
+		t.Errorf("Bad paste text")
+	}
+	if b, _ := ioutil.ReadAll(ev.Reader()); string(b) != want {
+		t.Errorf("Bad paste from reader")
+	}
+	if lines := ev.Lines(); len(lines) != 1001 || string(lines[0]) != "line" {
+		t.Errorf("Bad paste lines: %d", len(lines))
+	}
+	if ev.EscSeq() != pasteBegin+body+pasteEnd {
+		t.Errorf("Bad escape sequence")
+	}
+	if s.pscan != 0 || buf.Len() != 0 {
+		t.Errorf("Paste state not reset")
+	}
+}
+
+func TestClipboardRegister(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+
+	if e := s.GetClipboard(ClipboardPrimary); e != nil {
+		t.Fatalf("GetClipboard failed: %v", e)
+	}
+	if out.String() != "\x1b]52;p;?\x1b\\" {
+		t.Errorf("Bad query %q", out.String())
+	}
+	out.Reset()
+	if e := s.SetClipboard("hi", ClipboardCut3); e != nil {
+		t.Fatalf("SetClipboard failed: %v", e)
+	}
+	if out.String() != "\x1b]52;3;!\x1b\\\x1b]52;3;aGk=\x1b\\" {
+		t.Errorf("Bad set %q", out.String())
+	}
+
+	for _, r := range []ClipboardRegister{"", "x", "8", "cp"} {
+		if s.HasClipboard(r) {
+			t.Errorf("Register %q should not be available", r)
+		}
+		if e := s.GetClipboard(r); e != ErrBadRegister {
+			t.Errorf("Register %q: expected ErrBadRegister, got %v", r, e)
+		}
+		if e := s.SetClipboard("x", r); e != ErrBadRegister {
+			t.Errorf("Register %q: expected ErrBadRegister, got %v", r, e)
+		}
+	}
+	if !s.HasClipboard(ClipboardSystem) {
+		t.Errorf("System clipboard should be available")
+	}
+}
+
+func TestCombining(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	f, e := ioutil.TempFile("", "tcell")
+	if e != nil {
+		t.Fatalf("TempFile: %v", e)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	s.out = f
+	s.SetCombining(true)
+
+	// The mark arrives separately, so the e must be held for it.
+	s.ProcessInput([]byte("xe"))
+	s.ProcessInput([]byte("̣́"))
+	if s.input.held == nil {
+		t.Fatalf("Last rune not held")
+	}
+	s.input.expire = time.Now().Add(-time.Millisecond)
+	s.Tick()
+	if s.input.pending() {
+		t.Errorf("Rune still held after timeout")
+	}
+
+	var got []string
+	for _, ev := range s.evq {
+		got = append(got, string(ev.(*EventKey).Runes()))
+	}
+	s.evq = nil
+	if len(got) != 2 || got[0] != "x" || got[1] != "ẹ́" {
+		t.Errorf("Bad key events: %q", got)
+	}
+
+	s.SetCombining(false)
+	s.ProcessInput([]byte("é"))
+	if len(s.evq) != 2 {
+		t.Errorf("Expected separate events, got %d", len(s.evq))
+	}
+}
+
+func TestSoftCursor(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 4, 2
+	s.cells.Resize(4, 2)
+	s.cells.Fill('x', StyleDefault)
+
+	// xterm can change the shape itself.
+	s.ShowCursorStyle(1, 0, CursorStyleBar)
+	s.draw()
+	if !strings.Contains(out.String(), "\x1b[6 q") {
+		t.Errorf("Shape not sent: %q", out.String())
+	}
+	if s.softcur {
+		t.Errorf("Unexpected software cursor")
+	}
+
+	// Others get a software cursor instead.
+	ti := *s.ti
+	ti.Name, ti.Aliases = "vt100", nil
+	s.ti = &ti
+	s.ShowCursorStyle(2, 1, CursorStyleUnderline)
+	if !s.softcur || !s.cells.Dirty(2, 1) {
+		t.Fatalf("Software cursor not used")
+	}
+	out.Reset()
+	s.draw()
+	if !strings.Contains(out.String(), "4mx") {
+		t.Errorf("Cursor not drawn: %q", out.String())
+	}
+	if _, _, st, _ := s.cells.GetContent(2, 1); st != StyleDefault {
+		t.Errorf("Cursor changed the cell style")
+	}
+
+	// Moving the cursor redraws the cell it left.
+	s.ShowCursor(0, 0)
+	if s.softcur || !s.cells.Dirty(2, 1) {
+		t.Errorf("Old cursor cell not redrawn")
+	}
+	s.SetSoftCursor(true)
+	if !s.softcur || !s.cells.Dirty(0, 0) {
+		t.Errorf("Software cursor not forced")
+	}
+}
+
+func TestTerminalResetString(t *testing.T) {
+	s := mkTestTScreen(t)
+	str, e := TerminalResetString("xterm")
+	if e != nil {
+		t.Fatalf("TerminalResetString failed: %v", e)
+	}
+	for _, seq := range []string{"\x1b[0 q", s.ti.ShowCursor, s.ti.ExitCA, pasteDisable} {
+		if !strings.Contains(str, seq) {
+			t.Errorf("Missing %q in %q", seq, str)
+		}
+	}
+	if _, e := TerminalResetString("no-such-terminal"); e == nil {
+		t.Errorf("Expected error for unknown terminal")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	s.out = &bytes.Buffer{}
+
+	s.SetIdleTimeout(time.Minute)
+	s.Tick()
+	if len(s.evq) != 0 {
+		t.Fatalf("Idle too soon")
+	}
+	s.lastin = time.Now().Add(-2 * time.Minute)
+	s.Tick()
+	s.Tick() // only once
+	if len(s.evq) != 1 {
+		t.Fatalf("Expected one event, got %d", len(s.evq))
+	}
+	if ev, ok := s.evq[0].(*EventIdle); !ok || !ev.Idle() {
+		t.Errorf("Expected idle event, got %v", s.evq[0])
+	}
+	s.evq = nil
+
+	s.ProcessInput([]byte("a"))
+	if len(s.evq) != 2 {
+		t.Fatalf("Expected two events, got %d", len(s.evq))
+	}
+	if ev, ok := s.evq[0].(*EventIdle); !ok || ev.Idle() {
+		t.Errorf("Expected wake event, got %v", s.evq[0])
+	}
+	if _, ok := s.evq[1].(*EventKey); !ok {
+		t.Errorf("Expected key event, got %v", s.evq[1])
+	}
+
+	// An idle event that cannot be posted is tried again later.
+	s.manual = false
+	s.evch = make(chan Event, 1)
+	s.evch <- NewEventPaste("", "")
+	s.lastin = time.Now().Add(-2 * time.Minute)
+	s.checkIdle(time.Now())
+	if s.idle {
+		t.Errorf("Idle without an event posted")
+	}
+	<-s.evch
+	s.checkIdle(time.Now())
+	if ev, ok := (<-s.evch).(*EventIdle); !ok || !ev.Idle() || !s.idle {
+		t.Errorf("Expected idle event, got %v", ev)
+	}
+}
+
+func TestTicker(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetManualPump(true)
+	s.out = &bytes.Buffer{}
+
+	s.StartTicker(time.Minute)
+	s.Tick()
+	if len(s.evq) != 0 {
+		t.Fatalf("Tick too soon")
+	}
+	s.ticks.last = time.Now().Add(-time.Minute)
+	s.Tick()
+	if len(s.evq) != 1 {
+		t.Fatalf("Expected one event, got %d", len(s.evq))
+	}
+	if _, ok := s.evq[0].(*EventTick); !ok {
+		t.Fatalf("Expected tick event, got %v", s.evq[0])
+	}
+
+	// The queue is still busy, so this one is coalesced.
+	s.ticks.last = time.Now().Add(-time.Minute)
+	s.Tick()
+	if len(s.evq) != 1 {
+		t.Fatalf("Tick not coalesced, got %d events", len(s.evq))
+	}
+	s.evq = nil
+	s.ticks.last = time.Now().Add(-time.Minute)
+	s.Tick()
+	if ev, ok := s.PollEvent().(*EventTick); !ok || ev.Skipped() != 1 {
+		t.Errorf("Expected tick with one skipped, got %v", ev)
+	}
+
+	s.StartTicker(0)
+	s.ticks.last = time.Now().Add(-time.Minute)
+	s.Tick()
+	if len(s.evq) != 0 {
+		t.Errorf("Ticker not stopped")
+	}
+}
+
+func TestClearRect(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 20, 3
+	s.cells.Resize(20, 3)
+	s.cells.Fill('x', StyleDefault)
+	s.draw()
+
+	s.ClearLine(0)
+	s.ClearRect(2, 1, 10, 1, StyleDefault)
+	s.ClearRect(2, 2, 10, 1, StyleDefault.Background(ColorRed))
+	out.Reset()
+	s.draw()
+	if !strings.Contains(out.String(), clearEOL) {
+		t.Errorf("Line not erased: %q", out.String())
+	}
+	if !strings.Contains(out.String(), "\x1b[10X") {
+		t.Errorf("Area not erased: %q", out.String())
+	}
+	if strings.Count(out.String(), " ") != 10 {
+		t.Errorf("Expected colored spaces only: %q", out.String())
+	}
+	for x := 0; x < 20; x++ {
+		if r, _, _, _ := s.GetContent(x, 0); r != ' ' || s.cells.Dirty(x, 0) {
+			t.Errorf("Bad cell %d: %q", x, r)
+		}
+	}
+	if r, _, _, _ := s.GetContent(12, 1); r != 'x' {
+		t.Errorf("Cleared outside the rectangle")
+	}
+
+	// Without erase character, only runs to the end of the line are
+	// erased, and blanks that were not cleared are drawn.
+	s.ech = false
+	s.cells.Fill('x', StyleDefault)
+	s.draw()
+	s.ClearRect(2, 1, 10, 1, StyleDefault)
+	s.cells.FillRect(Rect{X: 0, Y: 2, Width: 20, Height: 1}, ' ', StyleDefault)
+	out.Reset()
+	s.draw()
+	if strings.Contains(out.String(), "X") || strings.Contains(out.String(), clearEOL) {
+		t.Errorf("Unexpected erase: %q", out.String())
+	}
+	if strings.Count(out.String(), " ") != 30 {
+		t.Errorf("Expected spaces: %q", out.String())
+	}
+}
+
+func TestEraseAnimated(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 20, 1
+	s.cells.Resize(20, 1)
+	s.draw()
+
+	// The blank row is animated to a colored background, so it must
+	// be drawn, not erased.
+	plain := StyleDefault.Foreground(ColorGreen)
+	s.SetAnimation(plain, NewBlinkStyle(StyleDefault.Background(ColorMaroon), plain, time.Hour))
+	s.ClearRect(0, 0, 20, 1, plain)
+	out.Reset()
+	s.draw()
+	if strings.Contains(out.String(), clearEOL) {
+		t.Errorf("Animated row erased: %q", out.String())
+	}
+	if strings.Count(out.String(), " ") != 20 {
+		t.Errorf("Expected colored spaces: %q", out.String())
+	}
+}
+
+func TestCapAudit(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.out = &bytes.Buffer{}
+	logbuf := &bytes.Buffer{}
+	s.trace = log.New(logbuf, "", 0)
+	s.audit = newCapAudit(s.ti)
+
+	s.TPuts(s.ti.AttrOff)
+	s.TPuts(s.ti.AttrOff)
+	s.TPuts("")
+	s.TPuts("$<5>")
+	s.audit.report(s.ti, s.trace)
+
+	out := logbuf.String()
+	for _, want := range []string{
+		"AttrOff sent 2 times",
+		"empty string skipped 1 times at tscreen_test.go:",
+		"with padding \"$<5>\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in report:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "KeyF1") {
+		t.Errorf("Key capabilities reported:\n%s", out)
+	}
+}
+
+func TestTraceReinit(t *testing.T) {
+	f, e := ioutil.TempFile("", "tcelltrace")
+	if e != nil {
+		t.Fatalf("Failed to create trace file: %v", e)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	for k, v := range map[string]string{
+		"TCELL_TRACE": f.Name(), "TCELL_AUDIT": "1", "TCELL_VALIDATE": "1",
+	} {
+		old := os.Getenv(k)
+		os.Setenv(k, v)
+		defer os.Setenv(k, old)
+	}
+
+	s, e := NewHeadlessScreen("xterm", 20, 5)
+	if e != nil {
+		t.Fatalf("Failed to get headless screen: %v", e)
+	}
+	// The trace is reopened by each Init, after the last Fini closed it.
+	for i := 0; i < 2; i++ {
+		if e = s.Init(); e != nil {
+			t.Fatalf("Failed to initialize: %v", e)
+		}
+		s.SetContent(0, 0, 'x', nil, StyleDefault)
+		s.Show()
+		s.Fini()
+	}
+	b, e := ioutil.ReadFile(f.Name())
+	if e != nil {
+		t.Fatalf("Failed to read trace: %v", e)
+	}
+	if n := strings.Count(string(b), "audit: terminal"); n != 2 {
+		t.Errorf("Expected 2 audit reports, got %d:\n%s", n, b)
+	}
+}
+
+func TestOutputBudget(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.truecolor = true
+	s.w, s.h = 20, 3
+	s.cells.Resize(20, 3)
+	for i := 0; i < 60; i++ {
+		st := StyleDefault.Foreground(NewRGBColor(int32(i*4), 0, 0)).Bold(i%2 == 0)
+		s.cells.SetContent(i%20, i/20, 'x', nil, st)
+	}
+	s.curstyle = styleInvalid
+	s.draw()
+	full := out.Len()
+	if s.ti.SetFgRGB != "" && !strings.Contains(out.String(), "38;2;") {
+		t.Errorf("Expected 24-bit color: %q", out.String())
+	}
+
+	s.SetOutputBudget(full/2, DegradeAll)
+	s.cells.Invalidate()
+	s.curstyle = styleInvalid
+	out.Reset()
+	s.draw()
+	if out.Len() >= full {
+		t.Errorf("Frame not reduced, %d bytes of %d", out.Len(), full)
+	}
+	if strings.Contains(out.String(), "38;2;") || strings.Contains(out.String(), "\x1b[1m") {
+		t.Errorf("Frame not degraded: %q", out.String())
+	}
+	if strings.Count(out.String(), "x") != 60 {
+		t.Errorf("Cells missing from degraded frame: %q", out.String())
+	}
+
+	// Within the budget, nothing changes.
+	s.SetOutputBudget(full*2, DegradeAll)
+	s.cells.Invalidate()
+	s.curstyle = styleInvalid
+	out.Reset()
+	s.draw()
+	if out.Len() != full {
+		t.Errorf("Frame changed within budget, %d bytes of %d", out.Len(), full)
+	}
+}
+
+func TestCursorMoves(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 20, 3
+	s.cells.Resize(20, 3)
+	s.cells.Fill('.', StyleDefault)
+	s.draw()
+
+	// A short gap is written out again, a longer one skipped over,
+	// and the next line reached with a carriage return.
+	s.SetContent(1, 0, 'a', nil, StyleDefault)
+	s.SetContent(3, 0, 'b', nil, StyleDefault)
+	s.SetContent(12, 0, 'c', nil, StyleDefault)
+	s.SetContent(0, 1, 'd', nil, StyleDefault)
+	out.Reset()
+	s.draw()
+	if !strings.Contains(out.String(), "a.b\x1b[8Cc\r\nd") {
+		t.Errorf("Unexpected moves %q", out.String())
+	}
+
+	// Styled gaps are not written again.
+	s.SetContent(5, 2, 'e', nil, StyleDefault.Bold(true))
+	s.draw()
+	s.SetContent(4, 2, 'f', nil, StyleDefault)
+	s.SetContent(6, 2, 'g', nil, StyleDefault)
+	out.Reset()
+	s.draw()
+	if !strings.Contains(out.String(), "f\x1b[1Cg") {
+		t.Errorf("Unexpected moves %q", out.String())
+	}
+}
+
+func TestCornerCell(t *testing.T) {
+	s := mkTestTScreen(t)
+	ti := *s.ti
+	ti.Name, ti.Aliases = "sun", nil
+	s.ti = &ti
+	s.margin = findMargin(s.ti)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 4, 2
+	s.cells.Resize(4, 2)
+	s.cells.Fill('x', StyleDefault)
+	s.SetContent(3, 1, 'z', nil, StyleDefault)
+	s.draw()
+	if !strings.Contains(out.String(), "xxx\bz\b\x1b[@x") {
+		t.Errorf("Corner not inserted: %q", out.String())
+	}
+	if s.cells.Dirty(2, 1) || s.cells.Dirty(3, 1) {
+		t.Errorf("Corner cells left dirty")
+	}
+
+	// Terminals that wrap late just write it.
+	s = mkTestTScreen(t)
+	out = &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 4, 2
+	s.cells.Resize(4, 2)
+	s.cells.Fill('x', StyleDefault)
+	s.SetContent(3, 1, 'z', nil, StyleDefault)
+	s.draw()
+	if !strings.Contains(out.String(), "xxxz") {
+		t.Errorf("Corner not written: %q", out.String())
+	}
+}
+
+func TestGlyphPolicy(t *testing.T) {
+	s := mkTestTScreen(t)
+	if got := string(s.encodeRune('é', nil)); got != "é" {
+		t.Errorf("Default policy changed %q", got)
+	}
+
+	ti := *s.ti
+	ti.Name, ti.Aliases = "hz1500", nil
+	s.SetGlyphPolicy(glyphPolicy(&ti))
+	if got := string(s.encodeRune('~', nil)); got != "-" {
+		t.Errorf("Tilde not replaced: %q", got)
+	}
+	if got := string(s.encodeRune('é', nil)); got != "?" {
+		t.Errorf("Non-ASCII not replaced: %q", got)
+	}
+	if got := string(s.encodeRune('́', []byte("e"))); got != "e" {
+		t.Errorf("Combining character not elided: %q", got)
+	}
+	s.RegisterRuneFallback('é', "e")
+	if got := string(s.encodeRune('é', nil)); got != "e" {
+		t.Errorf("Fallback not used: %q", got)
+	}
+	if s.CanDisplay('~', false) || !s.CanDisplay('~', true) || !s.CanDisplay('a', false) {
+		t.Errorf("CanDisplay ignores the policy")
+	}
+}
+
+func TestMarkPolicy(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.encoder = charmap.ISO8859_1.NewEncoder()
+	cluster := func(mainc rune, combc ...rune) string {
+		return string(s.encodeCluster(mainc, combc, nil))
+	}
+
+	// U+0301 composes with e, but U+0302 does not compose with x.
+	if got := cluster('e', '\u0301'); got != "e" {
+		t.Errorf("Mark not elided: %q", got)
+	}
+	s.SetGlyphPolicy(GlyphPolicy{Marks: MarksFallback})
+	if got := cluster('e', '\u0301'); got != "\xe9" {
+		t.Errorf("Precomposed form not used: %q", got)
+	}
+	if got := cluster('x', '\u0302'); got != "x" {
+		t.Errorf("Mark without fallback not elided: %q", got)
+	}
+	s.RegisterRuneFallback('\u0302', "^")
+	if got := cluster('x', '\u0302'); got != "x^" {
+		t.Errorf("Mark fallback not used: %q", got)
+	}
+
+	s.SetGlyphPolicy(GlyphPolicy{Marks: MarksCluster})
+	if got := cluster('e', '\u0301'); got != "\xe9" {
+		t.Errorf("Precomposed form not used: %q", got)
+	}
+	if got := cluster('x', '\u0302'); got != "?" {
+		t.Errorf("Cluster not replaced: %q", got)
+	}
+	s.RegisterRuneFallback('\u0177', "y")
+	if got := cluster('y', '\u0302'); got != "y" {
+		t.Errorf("Cluster fallback not used: %q", got)
+	}
+	if got := cluster('a'); got != "a" {
+		t.Errorf("Plain character changed: %q", got)
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 4, 1
+	s.cells.Resize(4, 1)
+	key := StyleDefault.Foreground(ColorRed)
+	s.SetContent(0, 0, 'a', nil, key)
+	s.SetContent(1, 0, 'b', nil, StyleDefault)
+
+	start := time.Now()
+	s.anims.Set(key, NewBlinkStyle(StyleDefault, StyleDefault.Reverse(true), time.Second), start)
+	s.draw()
+	s.snapshot()
+	if strings.Contains(out.String(), "\x1b[31m") {
+		t.Errorf("Key style drawn: %q", out.String())
+	}
+	if d := s.anims.Next(start.Add(time.Second / 4)); d != time.Second*3/4 {
+		t.Errorf("Next phase in %v", d)
+	}
+
+	out.Reset()
+	s.animate(start.Add(time.Second / 2))
+	if out.Len() != 0 {
+		t.Errorf("Drawn before the phase changed: %q", out.String())
+	}
+	s.animate(start.Add(time.Second))
+	if !strings.Contains(out.String(), "\x1b[7ma") || strings.Contains(out.String(), "b") {
+		t.Errorf("Phase not drawn: %q", out.String())
+	}
+
+	s.anims.Set(key, AnimatedStyle{}, start)
+	if s.anims.Len() != 0 || s.anims.Apply(key) != key {
+		t.Errorf("Animation not removed")
+	}
+}
+
+func TestPadding(t *testing.T) {
+	s := mkTestTScreen(t)
+	ti := *s.ti
+	ti.PadChar = "\x00"
+	s.ti = &ti
+	out := &bytes.Buffer{}
+	s.out = out
+
+	s.SetPadding(PaddingStrict, 9600)
+	s.TPuts("x$<10>y")
+	if want := "x" + strings.Repeat("\x00", 10) + "y"; out.String() != want {
+		t.Errorf("Bad strict padding: %q", out.String())
+	}
+
+	out.Reset()
+	s.SetPadding(PaddingNone, 0)
+	start := time.Now()
+	s.TPuts("x$<100>y")
+	if out.String() != "xy" || time.Since(start) > 50*time.Millisecond {
+		t.Errorf("Padding not ignored: %q", out.String())
+	}
+}
+
+type writeLog struct {
+	writes []string
+}
+
+func (w *writeLog) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, string(b))
+	return len(b), nil
+}
+
+func TestFlushSize(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &writeLog{}
+	s.out = out
+	s.SetFlushSize(8)
+	s.buf.WriteString("abcdef\x1b[1mxyzé\x1b[0mé")
+	s.flush()
+	want := []string{"abcdef", "\x1b[1mxyz", "é\x1b[0mé"}
+	if len(out.writes) != len(want) {
+		t.Fatalf("Bad writes: %q", out.writes)
+	}
+	for i := range want {
+		if out.writes[i] != want[i] {
+			t.Errorf("Bad writes: %q", out.writes)
+			break
+		}
+	}
+
+	// No character is split.
+	out.writes = nil
+	s.buf.WriteString("abcdefgé")
+	s.flush()
+	if len(out.writes) != 2 || out.writes[0] != "abcdefg" {
+		t.Errorf("Character split: %q", out.writes)
+	}
+}
+
+func TestBadUTF8(t *testing.T) {
+	s := mkTestTScreen(t)
+	runes := func(evs []Event) string {
+		str := ""
+		for _, ev := range evs {
+			switch ev := ev.(type) {
+			case *EventKey:
+				str += string(ev.Rune())
+			case *EventRaw:
+				str += fmt.Sprintf("<%x>", ev.EscSeq())
+			}
+		}
+		return str
+	}
+	buf := &bytes.Buffer{}
+
+	// Overlong and surrogate encodings are bad one byte at a time.
+	s.SetUTF8Policy(UTF8Replace)
+	buf.WriteString("a\xc0\xafb\xed\xa0\x80日")
+	if got := runes(s.collectEventsFromInput(buf, false)); got != "a��b���日" {
+		t.Errorf("Bad replacement: %q", got)
+	}
+
+	// A truncated character waits for the rest, then is replaced whole.
+	buf.WriteString("\xe6\x97")
+	if evs := s.collectEventsFromInput(buf, false); len(evs) != 0 || buf.Len() != 2 {
+		t.Errorf("Truncated character not held: %q", runes(evs))
+	}
+	evs := s.collectEventsFromInput(buf, true)
+	if ev, ok := evs[0].(*EventKey); len(evs) != 1 || !ok || ev.EscSeq() != "\xe6\x97" {
+		t.Errorf("Truncated character not replaced: %q", runes(evs))
+	}
+
+	s.SetUTF8Policy(UTF8Raw)
+	buf.WriteString("\xffx")
+	if got := runes(s.collectEventsFromInput(buf, false)); got != "<ff>x" {
+		t.Errorf("Bad raw events: %q", got)
+	}
+
+	// A real replacement character is not bad input.
+	s.SetUTF8Policy(UTF8Drop)
+	buf.WriteString("\xffx\xef\xbf\xbd")
+	if got := runes(s.collectEventsFromInput(buf, false)); got != "x�" {
+		t.Errorf("Bad input not dropped: %q", got)
+	}
+}
+
+func TestCaptureEscSeq(t *testing.T) {
+	s := mkTestTScreen(t)
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x1bOA")
+	evs := s.collectEventsFromInput(buf, false)
+	if len(evs) != 1 || evs[0].EscSeq() != "\x1bOA" {
+		t.Fatalf("Sequence not captured: %v", evs)
+	}
+
+	s.SetCaptureEscSeq(false)
+	buf.WriteString("\x1bOAé\x1b[200~hello\x1b[201~")
+	evs = s.collectEventsFromInput(buf, false)
+	if len(evs) != 3 || evs[0].(*EventKey).Key() != KeyUp || evs[1].(*EventKey).Rune() != 'é' {
+		t.Fatalf("Bad events: %v", evs)
+	}
+	if ev, ok := evs[2].(*EventPaste); !ok || ev.Text() != "hello" {
+		t.Fatalf("Bad paste: %v", evs[2])
+	}
+	for _, ev := range evs {
+		if ev.EscSeq() != "" {
+			t.Errorf("Sequence captured: %q", ev.EscSeq())
+		}
+	}
+}
+
+func TestBindSequence(t *testing.T) {
+	s := mkTestTScreen(t)
+	key := func(seq string) Key {
+		buf := bytes.NewBufferString(seq)
+		evs := s.collectEventsFromInput(buf, true)
+		if ev, ok := evs[0].(*EventKey); ok && len(evs) == 1 {
+			return ev.Key()
+		}
+		return -1
+	}
+
+	s.BindSequence("\x1b[1~", KeyHome, ModNone)
+	if k := key("\x1b[1~"); k != KeyHome {
+		t.Errorf("New sequence gave %v", k)
+	}
+	s.BindSequence(s.ti.KeyHome, KeyEnd, ModShift)
+	if k := key(s.ti.KeyHome); k != KeyEnd {
+		t.Errorf("Replaced sequence gave %v", k)
+	}
+
+	s.UnbindSequence("\x1b[1~")
+	s.UnbindSequence(s.ti.KeyHome)
+	if k := key("\x1b[1~"); k == KeyHome {
+		t.Errorf("Sequence not unbound")
+	}
+}
+
+func TestKeyConflicts(t *testing.T) {
+	s := mkTestTScreen(t)
+	found := false
+	for _, ks := range s.KeySequences() {
+		if ks.Seq == s.ti.KeyF1 && ks.Key == KeyF1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Sequence for F1 not listed")
+	}
+	base := len(s.KeyConflicts())
+
+	s.prepareKey(KeyF60, s.ti.KeyF1)
+	s.BindSequence("\x1bO", KeyF61, ModNone)
+	dups, prefixes := 0, 0
+	for _, kc := range s.KeyConflicts() {
+		switch {
+		case !kc.Prefix && kc.Seq.Key == KeyF1 && kc.Other.Key == KeyF60:
+			dups++
+		case kc.Prefix && kc.Seq.Key == KeyF61 && kc.Other.Seq == s.ti.KeyF1:
+			prefixes++
+		}
+	}
+	if dups != 1 || prefixes != 1 {
+		t.Errorf("Conflicts not found: %v", s.KeyConflicts()[base:])
+	}
+}
+
+func TestNormalizeBackspace(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.SetNormalizeBackspace(true)
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x7f\x08\x1b\x7f")
+	evs := s.collectEventsFromInput(buf, true)
+	want := []struct {
+		mod ModMask
+		r   rune
+	}{
+		{ModNone, 0x7f},
+		{ModCtrl, 0x08},
+		{ModAlt, 0x7f},
+	}
+	if len(evs) != len(want) {
+		t.Fatalf("Expected %d events, got %v", len(want), evs)
+	}
+	for i, w := range want {
+		ev := evs[i].(*EventKey)
+		if ev.Key() != KeyBackspace || ev.Modifiers() != w.mod || ev.Rune() != w.r {
+			t.Errorf("Event %d: %v %v %q", i, ev.Key(), ev.Modifiers(), ev.Rune())
+		}
+	}
+}
+
+func TestKeypadEnter(t *testing.T) {
+	s := mkTestTScreen(t)
+	if !s.HasKey(KeyKPEnter) {
+		t.Errorf("Keypad Enter not mapped")
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x1bOM\r")
+	evs := s.collectEventsFromInput(buf, true)
+	if len(evs) != 2 {
+		t.Fatalf("Expected 2 events, got %v", evs)
+	}
+	if ev := evs[0].(*EventKey); ev.Key() != KeyKPEnter || ev.Name() != "KPEnter" {
+		t.Errorf("Got %v (%s) for keypad Enter", ev.Key(), ev.Name())
+	}
+	if ev := evs[1].(*EventKey); ev.Key() != KeyEnter {
+		t.Errorf("Got %v for Enter", ev.Key())
+	}
+}
+
+func TestLockModifiers(t *testing.T) {
+	s := mkTestTScreen(t)
+	buf := &bytes.Buffer{}
+
+	// Until the terminal confirms the protocol, its keys are not
+	// parsed, and nor are replies taken for keys.
+	s.kittyon = true
+	buf.WriteString("\x1b[1;66R")
+	evs := s.collectEventsFromInput(buf, true)
+	if len(evs) != 1 {
+		t.Fatalf("Expected 1 event, got %v", evs)
+	}
+	if _, ok := evs[0].(*EventCursorReport); !ok {
+		t.Errorf("Expected cursor report, got %v", evs[0])
+	}
+	buf.WriteString("\x1b[?1u")
+	if evs = s.collectEventsFromInput(buf, true); len(evs) != 0 || !s.kitty {
+		t.Fatalf("Protocol not confirmed: %v", evs)
+	}
+
+	// Nor once it has.
+	buf.WriteString("\x1b[1;66R")
+	evs = s.collectEventsFromInput(buf, true)
+	if len(evs) != 1 {
+		t.Fatalf("Expected 1 event, got %v", evs)
+	}
+	if _, ok := evs[0].(*EventCursorReport); !ok {
+		t.Errorf("Expected cursor report, got %v", evs[0])
+	}
+
+	// a and shift+a with caps lock, ctrl+a with num lock, the up
+	// arrow with caps lock, keypad Enter, keypad 1 with num lock and
+	// its text, and a release, which is dropped.
+	buf.WriteString("\x1b[97;65u\x1b[97:65;66u\x1b[97;133u\x1b[1;65A\x1b[57414u\x1b[57400;129;49u\x1b[97;1:3u")
+	evs = s.collectEventsFromInput(buf, true)
+	want := []struct {
+		key   Key
+		r     rune
+		mod   ModMask
+		locks ModMask
+	}{
+		{KeyRune, 'A', ModNone, ModCapsLock},
+		{KeyRune, 'a', ModNone, ModCapsLock},
+		{KeyCtrlA, 1, ModCtrl, ModNumLock},
+		{KeyUp, 0, ModNone, ModCapsLock},
+		{KeyKPEnter, 0, ModNone, ModNone},
+		{KeyRune, '1', ModNone, ModNumLock},
+	}
+	if len(evs) != len(want) {
+		t.Fatalf("Expected %d events, got %v", len(want), evs)
+	}
+	for i, w := range want {
+		ev := evs[i].(*EventKey)
+		if ev.Key() != w.key || ev.Rune() != w.r || ev.Modifiers() != w.mod || ev.Locks() != w.locks {
+			t.Errorf("Event %d: %v %q %v %v", i, ev.Key(), ev.Rune(), ev.Modifiers(), ev.Locks())
+		}
+	}
+}
+
+func TestEscapeAlt(t *testing.T) {
+	s := mkTestTScreen(t)
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x1ba")
+	evs := s.collectEventsFromInput(buf, true)
+	if len(evs) != 1 {
+		t.Fatalf("Expected 1 event, got %v", evs)
+	}
+	if ev := evs[0].(*EventKey); ev.Rune() != 'a' || ev.Modifiers() != ModAlt {
+		t.Errorf("Got %v %q", ev.Modifiers(), ev.Rune())
+	}
+
+	s.SetEscapeAlt(false)
+	buf.WriteString("\x1ba")
+	evs = s.collectEventsFromInput(buf, true)
+	if len(evs) != 2 {
+		t.Fatalf("Expected 2 events, got %v", evs)
+	}
+	if ev := evs[0].(*EventKey); ev.Key() != KeyEsc || ev.Modifiers() != ModNone {
+		t.Errorf("Got %v %v for ESC", ev.Key(), ev.Modifiers())
+	}
+	if ev := evs[1].(*EventKey); ev.Rune() != 'a' || ev.Modifiers() != ModNone {
+		t.Errorf("Got %v %q for key", ev.Modifiers(), ev.Rune())
+	}
+}
+
+func TestPasteCapability(t *testing.T) {
+	s := mkTestTScreen(t)
+	if !s.Has(CapPaste) {
+		t.Errorf("No paste capability for xterm")
+	}
+	s.SetRestricted(true)
+	if s.Has(CapPaste) {
+		t.Errorf("Paste capability while restricted")
+	}
+	s.SetRestricted(false)
+	s.ecma48 = false
+	if s.Has(CapPaste) {
+		t.Errorf("Paste capability without ECMA-48")
+	}
+}
+
+func TestNestedPaste(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.evch = make(chan Event, 10)
+
+	// Before Init there is no input to be pasting from.
+	in := s.input
+	s.input = nil
+	if s.Pasting() {
+		t.Errorf("Pasting before Init")
+	}
+	s.input = in
+
+	s.input.buf.WriteString(pasteBegin + "abc")
+	s.scanInput(s.input, false)
+	if !s.Pasting() {
+		t.Errorf("Not pasting after the start of a paste")
+	}
+
+	// The second paste ends the first, rather than being part of it.
+	s.input.buf.WriteString(pasteBegin + "def" + pasteEnd)
+	s.scanInput(s.input, false)
+	if s.Pasting() {
+		t.Errorf("Still pasting after the end of a paste")
+	}
+	for _, want := range []string{"abc", "def"} {
+		select {
+		case ev := <-s.evch:
+			if p, ok := ev.(*EventPaste); !ok || p.Text() != want {
+				t.Errorf("Expected paste %q, got %v", want, ev)
+			}
+		default:
+			t.Fatalf("Missing paste %q", want)
+		}
+	}
+}
+
+func TestMouseSupport(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.quit = make(chan struct{})
+
+	enable := s.ti.TParm(s.ti.MouseMode, 1)
+	s.EnableMouse()
+	s.EnableMouse()
+	if out.String() != enable {
+		t.Errorf("Expected one enable sequence, got %q", out.String())
+	}
+	out.Reset()
+	s.DisableMouse()
+	s.DisableMouse()
+	if out.String() != s.ti.TParm(s.ti.MouseMode, 0) {
+		t.Errorf("Expected one disable sequence, got %q", out.String())
+	}
+
+	s.SetMouseSupport(false)
+	out.Reset()
+	s.EnableMouse()
+	if s.HasMouse() || out.Len() != 0 {
+		t.Errorf("Mouse used when not supported: %q", out.String())
+	}
+
+	// Without a mouse in the terminal database, the SGR mouse is used.
+	ti := *s.ti
+	ti.Mouse, ti.MouseMode = "", ""
+	s.ti = &ti
+	s.SetMouseSupport(true)
+	s.EnableMouse()
+	if !s.HasMouse() || out.String() != ti.TParm(sgrMouseMode, 1) {
+		t.Errorf("Expected SGR mouse, got %q", out.String())
+	}
+	evs := s.collectEventsFromInput(bytes.NewBufferString("\x1b[<0;3;2M"), true)
+	if len(evs) != 1 {
+		t.Fatalf("Expected one event, got %v", evs)
+	}
+	if ev, ok := evs[0].(*EventMouse); !ok || ev.Buttons() != Button1 {
+		t.Errorf("Expected button 1, got %v", evs[0])
+	}
+}
+
+func TestCursorBlink(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.w, s.h = 4, 2
+	s.cells.Resize(4, 2)
+
+	s.SetCursorBlink(false)
+	s.ShowCursor(1, 0)
+	s.draw()
+	if !strings.Contains(out.String(), "\x1b[2 q") {
+		t.Errorf("Steady cursor not sent: %q", out.String())
+	}
+	out.Reset()
+	s.SetCursorBlink(true)
+	s.ShowCursorStyle(1, 0, CursorStyleBar)
+	s.draw()
+	if !strings.Contains(out.String(), "\x1b[5 q") {
+		t.Errorf("Blinking bar not sent: %q", out.String())
+	}
+
+	// Terminals without DECSCUSR use the very visible cursor.
+	ti := *s.ti
+	ti.Name, ti.Aliases = "vt100", nil
+	ti.VisCursor = "<cvvis>"
+	s.ti = &ti
+	out.Reset()
+	s.ShowCursor(2, 1)
+	s.draw()
+	if !strings.Contains(out.String(), "<cvvis>") {
+		t.Errorf("Very visible cursor not sent: %q", out.String())
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	s := mkTestTScreen(t)
+	for _, c := range []Capability{CapMouse, CapPaste, CapClipboard, CapKeyBindings, CapAddInput} {
+		if !s.Has(c) {
+			t.Errorf("Expected xterm to have %v", c)
+		}
+	}
+	if s.Has(Capability(0)) {
+		t.Errorf("Unknown capability reported")
+	}
+	s.SetMouseSupport(false)
+	if s.Has(CapMouse) {
+		t.Errorf("Mouse reported when not supported")
+	}
+	s.SetManualPump(true)
+	if s.Has(CapAddInput) {
+		t.Errorf("AddInput reported with a manual pump")
+	}
+}
+
+func TestHeadlessScreen(t *testing.T) {
+	s, e := NewHeadlessScreen("xterm", 20, 5)
+	if e != nil {
+		t.Fatalf("Failed to get headless screen: %v", e)
+	}
+	if e = s.Init(); e != nil {
+		t.Fatalf("Failed to initialize: %v", e)
+	}
+	defer s.Fini()
+
+	if w, h := s.Size(); w != 20 || h != 5 {
+		t.Errorf("Bad size %dx%d", w, h)
+	}
+	if _, ok := s.PollEvent().(*EventResize); !ok {
+		t.Errorf("Expected resize event")
+	}
+	n := s.BytesWritten()
+	s.SetContent(0, 0, 'x', nil, StyleDefault)
+	s.Show()
+	if s.BytesWritten() <= n {
+		t.Errorf("Output not counted")
+	}
+
+	s.SetSize(30, 6)
+	if w, h := s.Size(); w != 30 || h != 6 {
+		t.Errorf("Bad size after SetSize %dx%d", w, h)
+	}
+	s.ProcessInput([]byte("q"))
+	if ev, ok := s.PollEvent().(*EventResize); !ok {
+		t.Errorf("Expected resize event, got %v", ev)
+	}
+	if ev, ok := s.PollEvent().(*EventKey); !ok || ev.Rune() != 'q' {
+		t.Errorf("Expected key event, got %v", ev)
+	}
+}
+
+func BenchmarkHeadlessShow(b *testing.B) {
+	s, e := NewHeadlessScreen("xterm-256color", 80, 24)
+	if e != nil {
+		b.Fatalf("Failed to get headless screen: %v", e)
+	}
+	if e = s.Init(); e != nil {
+		b.Fatalf("Failed to initialize: %v", e)
+	}
+	defer s.Fini()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for y := 0; y < 24; y++ {
+			for x := 0; x < 80; x++ {
+				st := StyleDefault.Foreground(Color((i+x)%256) | ColorValid)
+				s.SetContent(x, y, rune('a'+(i+x+y)%26), nil, st)
+			}
+		}
+		s.Show()
+	}
+	b.SetBytes(s.BytesWritten() / int64(b.N))
+}
+
+func TestInjectEvents(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.quit = make(chan struct{})
+	s.evch = make(chan Event, 2)
+	s.RegisterRegion("button", Rect{X: 2, Y: 1, Width: 4, Height: 1})
+
+	if err := s.InjectKey(KeyRune, '\x01', ModNone); err != nil {
+		t.Fatalf("InjectKey: %v", err)
+	}
+	if err := s.InjectMouse(3, 1, Button1, ModShift); err != nil {
+		t.Fatalf("InjectMouse: %v", err)
+	}
+	if err := s.InjectKey(KeyF1, 0, ModNone); err != ErrEventQFull {
+		t.Errorf("Expected ErrEventQFull, got %v", err)
+	}
+
+	ek, ok := s.PollEvent().(*EventKey)
+	if !ok || ek.Key() != KeyCtrlA || ek.Modifiers() != ModCtrl || !ek.Synthetic() {
+		t.Errorf("Bad injected key %v", ek)
+	}
+	em, ok := s.PollEvent().(*EventMouse)
+	if !ok || em.Buttons() != Button1 || em.Region() != "button" || !em.Synthetic() {
+		t.Errorf("Bad injected mouse %v", em)
+	}
+
+	evs := s.collectEventsFromInput(bytes.NewBufferString("a"), true)
+	if len(evs) != 1 || evs[0].(*EventKey).Synthetic() {
+		t.Errorf("Typed key marked synthetic: %v", evs)
+	}
+}
+
+func TestPaletteColor(t *testing.T) {
+	s := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	s.out = out
+	s.quit = make(chan struct{})
+	s.truecolor = false
+	s.w, s.h = 2, 1
+	s.cells.Resize(2, 1)
+
+	c := NewHexColor(0x123456)
+	s.SetContent(0, 0, 'x', nil, StyleDefault.Foreground(c))
+	s.draw()
+	if v, _ := s.colors.Get(c); v == PaletteColor(3) {
+		t.Fatalf("Color fitted to index 3 before the palette changed")
+	}
+
+	out.Reset()
+	if err := s.SetPaletteColor(3, c); err != nil {
+		t.Fatalf("SetPaletteColor: %v", err)
+	}
+	if !strings.Contains(out.String(), "\x1b]4;3;rgb:12/34/56\x1b\\") {
+		t.Errorf("OSC 4 not sent: %q", out.String())
+	}
+	out.Reset()
+	s.draw()
+	if v, _ := s.colors.Get(c); v != PaletteColor(3) || !strings.Contains(out.String(), "33mx") {
+		t.Errorf("Cell not redrawn with new index: %q", out.String())
+	}
+
+	if err := s.SetPaletteColor(len(s.palette), c); err != ErrNotSupported {
+		t.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+
+	out.Reset()
+	s.ResetPalette()
+	if out.String() != "\x1b]104\x1b\\" {
+		t.Errorf("OSC 104 not sent: %q", out.String())
+	}
+	if v := s.fitColor(c); v == PaletteColor(3) {
+		t.Errorf("Palette not restored")
+	}
+	out.Reset()
+	s.ResetPalette()
+	if out.Len() != 0 {
+		t.Errorf("Palette reset twice: %q", out.String())
+	}
+}
+
+func TestSystemColors(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.truecolor = false
+
+	if seqs := s.colorSeqs(ColorRed, ColorNavy); strings.Contains(strings.Join(seqs, ""), "91") {
+		t.Errorf("Bright color sent to 8 color terminal: %q", seqs)
+	}
+	s.SetSystemColors(true)
+	if seqs := s.colorSeqs(ColorRed, ColorNavy); strings.Contains(strings.Join(seqs, ""), "91") {
+		t.Errorf("Bright system color sent to 8 color terminal: %q", seqs)
+	}
+	ti := *s.ti
+	ti.Colors = 16
+	s.ti = &ti
+	seqs := s.colorSeqs(ColorRed, ColorNavy)
+	if len(seqs) != 2 || seqs[0] != "\x1b[91m" || seqs[1] != "\x1b[44m" {
+		t.Errorf("Bad system color sequences %q", seqs)
+	}
+
+	// Other colors are fitted to the palette as usual.
+	seqs = s.colorSeqs(NewHexColor(0x808000), ColorDefault)
+	if len(seqs) != 1 || seqs[0] != s.ti.TParm(s.ti.SetFg, 3) {
+		t.Errorf("Bad palette color sequences %q", seqs)
+	}
+}
+
+func TestSupportedAttrs(t *testing.T) {
+	s := mkTestTScreen(t)
+	all := AttrBold | AttrBlink | AttrReverse | AttrUnderline | AttrDim |
+		AttrItalic | AttrStrikeThrough | AttrRapidBlink
+	if attrs := s.SupportedAttrs(); attrs != all {
+		t.Errorf("Bad attributes for xterm: %v", attrs)
+	}
+
+	ti := *s.ti
+	ti.Name, ti.Aliases, ti.Italic = "alacritty", nil, ""
+	s.ti = &ti
+	if attrs := s.SupportedAttrs(); attrs != all&^(AttrItalic|AttrBlink|AttrRapidBlink) {
+		t.Errorf("Bad attributes for quirky terminal: %v", attrs)
+	}
+	s.blinkdur = time.Second
+	if attrs := s.SupportedAttrs(); attrs != all&^AttrItalic {
+		t.Errorf("Soft blink not supported: %v", attrs)
+	}
+}
+
+func TestOutputValidator(t *testing.T) {
+	logged := &bytes.Buffer{}
+	c := newOutCheck(log.New(logged, "", 0), func() (int, int) { return 80, 24 })
+	check := func(out string, problem string) {
+		t.Helper()
+		logged.Reset()
+		c.Write([]byte(out))
+		if problem == "" && logged.Len() != 0 {
+			t.Errorf("Problem reported in %q: %s", out, logged)
+		} else if !strings.Contains(logged.String(), problem) {
+			t.Errorf("Problem %q not reported in %q: %s", problem, out, logged)
+		}
+	}
+	check("ab\x1b[1;31mc\x1b(B\x1b]52;c;eA==\a\x1b]0;x\x1b\\\x1b[?25l\x1b[24;80H", "")
+	check("\x1b[38;5;%p1%dm", "unexpanded parameter")
+	check("\x1b[1\x1b[m", "control sequence interrupted")
+	check("\x1b[25;1H", "cursor moved outside the screen")
+	check("\x1b[81G", "cursor moved outside the screen")
+	check("\x1b]0;title\x1b[m", "command string not terminated")
+	check("\x1b[1!2m", "parameter after intermediate byte")
+	check("\x1b]0;", "")
+	check("title\a", "")
+
+	// Sequences split across writes are put together.
+	check("\x1b[2", "")
+	check("5d", "cursor moved outside the screen")
+	check("\x1b]", "")
+	c.finish()
+	if !strings.Contains(logged.String(), "output ends within a sequence") {
+		t.Errorf("Unfinished sequence not reported: %s", logged)
+	}
+
+	s := mkTestTScreen(t)
+	logged.Reset()
+	s.valid = newOutCheck(log.New(logged, "", 0), func() (int, int) { return s.w, s.h })
+	s.out = &bytes.Buffer{}
+	s.quit = make(chan struct{})
+	s.w, s.h = 10, 3
+	s.cells.Resize(10, 3)
+	s.SetContent(9, 2, 'x', nil, StyleDefault.Foreground(ColorRed).Bold(true))
+	s.draw()
+	s.flush()
+	if logged.Len() != 0 {
+		t.Errorf("Problem reported for a drawing: %s", logged)
+	}
+}
+
+func TestColorCacheBounded(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.truecolor = false
+	for i := 0; i < colorCacheMax+100; i++ {
+		s.colorSeqs(NewHexColor(int32(i*97)), ColorDefault)
+	}
+	if n := s.colors.Len(); n != colorCacheMax {
+		t.Errorf("Color cache has %d entries", n)
+	}
+	// Colors of the palette are not cached.
+	s.colorSeqs(ColorMaroon, PaletteColor(3))
+	if _, ok := s.colors.Get(ColorMaroon); ok {
+		t.Errorf("Palette color cached")
+	}
+}
+
+func TestFrameInfo(t *testing.T) {
+	s, e := NewHeadlessScreen("xterm", 20, 5)
+	if e != nil {
+		t.Fatalf("Failed to get headless screen: %v", e)
+	}
+	if e = s.Init(); e != nil {
+		t.Fatalf("Failed to initialize: %v", e)
+	}
+	defer s.Fini()
+
+	fs, ok := s.(FrameScreen)
+	if !ok {
+		t.Fatalf("Headless screen is not a FrameScreen")
+	}
+	fs.Show()
+	s.SetContent(0, 0, 'x', nil, StyleDefault)
+	s.SetContent(1, 0, 'y', nil, StyleDefault)
+	n := s.BytesWritten()
+	info := fs.ShowFrame()
+	if info.Cells != 2 || int64(info.Bytes) != s.BytesWritten()-n || info.Degraded {
+		t.Errorf("Bad frame %+v", info)
+	}
+	if info = fs.ShowFrame(); info.Cells != 0 {
+		t.Errorf("Unchanged cells drawn: %+v", info)
+	}
+	if info = fs.SyncFrame(); info.Cells != 100 || info.Bytes == 0 {
+		t.Errorf("Bad frame for sync %+v", info)
+	}
+}
+
+func TestReplyEvents(t *testing.T) {
+	s := mkTestTScreen(t)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("\x1b[12;40R\x1b[?64;1;22c\x1b[>41;330;0c\x1b[?2004;1$y")
+	evs := s.collectEventsFromInput(buf, false)
+	if len(evs) != 4 {
+		t.Fatalf("Expected 4 events, got %d: %v", len(evs), evs)
+	}
+	if ev, ok := evs[0].(*EventCursorReport); !ok {
+		t.Errorf("Expected cursor report, got %v", evs[0])
+	} else if x, y := ev.Position(); x != 39 || y != 11 {
+		t.Errorf("Wrong position: %d,%d", x, y)
+	}
+	if ev, ok := evs[1].(*EventDeviceAttributes); !ok {
+		t.Errorf("Expected device attributes, got %v", evs[1])
+	} else if a := ev.Attributes(); ev.Secondary() || len(a) != 3 || a[0] != 64 || a[2] != 22 {
+		t.Errorf("Wrong primary attributes: %v", a)
+	}
+	if ev, ok := evs[2].(*EventDeviceAttributes); !ok {
+		t.Errorf("Expected device attributes, got %v", evs[2])
+	} else if a := ev.Attributes(); !ev.Secondary() || len(a) != 3 || a[0] != 41 {
+		t.Errorf("Wrong secondary attributes: %v", a)
+	}
+	if ev, ok := evs[3].(*EventModeReport); !ok {
+		t.Errorf("Expected mode report, got %v", evs[3])
+	} else if m, priv := ev.Mode(); m != 2004 || !priv || ev.Setting() != ModeSet {
+		t.Errorf("Wrong mode report: %d %v %d", m, priv, ev.Setting())
+	}
+
+	// A reply split across reads is put together.
+	buf.WriteString("\x1b[?1;")
+	if evs = s.collectEventsFromInput(buf, false); len(evs) != 0 {
+		t.Errorf("Unexpected events for partial reply: %v", evs)
+	}
+	buf.WriteString("2c")
+	evs = s.collectEventsFromInput(buf, false)
+	if len(evs) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(evs))
+	}
+	if _, ok := evs[0].(*EventDeviceAttributes); !ok {
+		t.Errorf("Expected device attributes, got %v", evs[0])
+	}
+
+	// Restricted screens discard replies.
+	s.SetRestricted(true)
+	buf.WriteString("\x1b[12;40R")
+	for _, ev := range s.collectEventsFromInput(buf, false) {
+		if _, ok := ev.(*EventCursorReport); ok {
+			t.Errorf("Reply delivered to restricted screen")
+		}
+	}
+}
+
+func TestQueries(t *testing.T) {
+	s := mkTestTScreen(t)
+	s.quit = make(chan struct{})
+	out := &bytes.Buffer{}
+	s.out = out
+
+	// reply waits for the query to be sent, and answers it.
+	reply := func(req, rep string) {
+		for {
+			s.Lock()
+			sent := strings.Contains(out.String(), req)
+			s.Unlock()
+			if sent {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		in := &tInput{}
+		in.addInput([]byte(rep), time.Now())
+		s.scanInput(in, false)
+	}
+
+	// Ctrl-F3 on xterm looks like a cursor position report.
+	go reply("\x1b[6n", "\x1b[1;5R")
+	if x, y, err := s.QueryCursorPosition(time.Second); err != nil || x != 4 || y != 0 {
+		t.Errorf("Wrong cursor position: %d,%d %v", x, y, err)
+	}
+
+	// Even when events do not keep their escape sequences.
+	s.SetCaptureEscSeq(false)
+	out.Reset()
+	go reply("\x1b[6n", "\x1b[1;5R")
+	if x, y, err := s.QueryCursorPosition(time.Second); err != nil || x != 4 || y != 0 {
+		t.Errorf("Wrong cursor position without capture: %d,%d %v", x, y, err)
+	}
+	s.SetCaptureEscSeq(true)
+
+	go reply("\x1b]11;?", "\x1b]10;rgb:ffff/ffff/ffff\x1b\\\x1b]11;rgb:00/80/f\x1b\\")
+	fg, bg, err := s.QueryDefaultColors(time.Second)
+	if err != nil || fg != NewRGBColor(255, 255, 255) || bg != NewRGBColor(0, 128, 255) {
+		t.Errorf("Wrong default colors: %v %v %v", fg, bg, err)
+	}
+
+	go reply("\x1bP+q636f6c6f7273", "\x1bP1+r636f6c6f7273=323536\x1b\\")
+	if v, ok, err := s.QueryTermcap("colors", time.Second); err != nil || !ok || v != "256" {
+		t.Errorf("Wrong capability: %q %v %v", v, ok, err)
+	}
+
+	if _, err := s.QueryPaletteColor(1, 10*time.Millisecond); err != ErrQueryTimeout {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+	if len(s.queries.list) != 0 {
+		t.Errorf("Queries left waiting: %d", len(s.queries.list))
+	}
+
+	s.SetRestricted(true)
+	if _, _, err := s.QueryCursorPosition(time.Second); err != ErrRestricted {
+		t.Errorf("Expected ErrRestricted, got %v", err)
+	}
+}
+
+func TestTermFallbacks(t *testing.T) {
+	term, saved := os.Getenv("TERM"), TermFallbacks
+	defer func() {
+		os.Setenv("TERM", term)
+		TermFallbacks = saved
+	}()
+
+	os.Setenv("TERM", "")
+	s, e := NewTerminfoScreen()
+	if e != nil {
+		t.Fatalf("No fallback screen: %v", e)
+	}
+	if name := s.(*tScreen).ti.Name; name != "xterm-256color" {
+		t.Errorf("Expected xterm-256color, got %s", name)
+	}
+
+	TermFallbacks = []string{"no-such-term", "ansi"}
+	if s, e = NewTerminfoScreen(); e != nil || s.(*tScreen).ti.Name != "ansi" {
+		t.Errorf("Expected ansi: %v", e)
+	}
+
+	TermFallbacks = nil
+	if _, e = NewTerminfoScreen(); e != ErrTermNotFound {
+		t.Errorf("Expected ErrTermNotFound, got %v", e)
+	}
+
+	os.Setenv("TERM", "ansi")
+	if s, e = NewTerminfoScreenForTerm("xterm"); e != nil || s.(*tScreen).ti.Name != "xterm" {
+		t.Errorf("Expected xterm: %v", e)
+	}
+}
+
+func TestFixedSize(t *testing.T) {
+	s, e := NewHeadlessScreen("xterm", 20, 5)
+	if e != nil {
+		t.Fatalf("Failed to get headless screen: %v", e)
+	}
+	s.SetFixedSize(40, 10)
+	if e = s.Init(); e != nil {
+		t.Fatalf("Failed to initialize: %v", e)
+	}
+	defer s.Fini()
+
+	if w, h := s.Size(); w != 40 || h != 10 {
+		t.Errorf("Bad size %dx%d", w, h)
+	}
+	s.SetSize(30, 6)
+	s.Show()
+	if w, h := s.Size(); w != 40 || h != 10 {
+		t.Errorf("Fixed size not kept: %dx%d", w, h)
+	}
+
+	s.SetFixedSize(0, 0)
+	if w, h := s.Size(); w != 30 || h != 6 {
+		t.Errorf("Size not detected again: %dx%d", w, h)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || netbsd || openbsd || dragonfly || solaris || illumos
+// +build linux freebsd netbsd openbsd dragonfly solaris illumos
+
+package tcell
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ttyReader reads from the tty, but can be interrupted.  A blocking
+// read cannot be woken up by closing the file, so instead we poll the
+// tty together with a pipe, and write to the pipe to stop.  Nothing is
+// read from the tty once interrupted, so no input is lost to a screen
+// that is initialized again later.
+type ttyReader struct {
+	f  *os.File
+	rp *os.File
+	wp *os.File
+}
+
+func newTtyReader(f *os.File) (*ttyReader, error) {
+	rp, wp, e := os.Pipe()
+	if e != nil {
+		return nil, e
+	}
+	return &ttyReader{f: f, rp: rp, wp: wp}, nil
+}
+
+func (r *ttyReader) Read(p []byte) (int, error) {
+	fds := []unix.PollFd{
+		{Fd: int32(r.f.Fd()), Events: unix.POLLIN},
+		{Fd: int32(r.rp.Fd()), Events: unix.POLLIN},
+	}
+	for {
+		fds[0].Revents, fds[1].Revents = 0, 0
+		if _, e := unix.Poll(fds, -1); e != nil {
+			if e == unix.EINTR {
+				continue
+			}
+			return 0, e
+		}
+		if fds[1].Revents != 0 {
+			return 0, errInputStopped
+		}
+		if fds[0].Revents != 0 {
+			// Readable, or an error or hangup that read reports.
+			return r.f.Read(p)
+		}
+	}
+}
+
+// Interrupt wakes up a pending Read, and makes all later ones fail.
+func (r *ttyReader) Interrupt() {
+	r.wp.Write([]byte{0})
+}
+
+func (r *ttyReader) Close() error {
+	r.rp.Close()
+	r.wp.Close()
+	return r.f.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || freebsd || netbsd || openbsd || dragonfly || solaris || illumos
+// +build linux freebsd netbsd openbsd dragonfly solaris illumos
+
+package tcell
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTtyReaderInterrupt(t *testing.T) {
+	in, out, e := os.Pipe()
+	if e != nil {
+		t.Fatalf("Pipe: %v", e)
+	}
+	defer out.Close()
+	r, e := newTtyReader(in)
+	if e != nil {
+		t.Fatalf("newTtyReader: %v", e)
+	}
+	defer r.Close()
+
+	buf := make([]byte, 16)
+	out.Write([]byte("a"))
+	if n, e := r.Read(buf); e != nil || string(buf[:n]) != "a" {
+		t.Fatalf("Read got %q, %v", buf[:n], e)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, e := r.Read(buf)
+		done <- e
+	}()
+	time.Sleep(time.Millisecond * 10)
+	r.Interrupt()
+	select {
+	case e := <-done:
+		if e != errInputStopped {
+			t.Errorf("Expected errInputStopped, got %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Read was not interrupted")
+	}
+
+	// Input arriving later is left for the next reader.
+	out.Write([]byte("b"))
+	if _, e := r.Read(buf); e != errInputStopped {
+		t.Errorf("Expected errInputStopped, got %v", e)
+	}
+	if n, _ := in.Read(buf); string(buf[:n]) != "b" {
+		t.Errorf("Input was consumed: %q", buf[:n])
+	}
+}
+
+func TestFiniFlushes(t *testing.T) {
+	s := mkTestTScreen(t)
+	r, w, e := os.Pipe()
+	if e != nil {
+		t.Fatalf("Pipe: %v", e)
+	}
+	defer r.Close()
+	s.out = w
+	s.quit = make(chan struct{})
+	s.indoneq = make(chan struct{})
+	close(s.indoneq)
+
+	// Output left in the buffer must reach the terminal before the
+	// sequences that restore it.
+	s.buffering = true
+	s.buf.WriteString("pending")
+	s.finish()
+	w.Close()
+
+	b, e := ioutil.ReadAll(r)
+	if e != nil {
+		t.Fatalf("ReadAll: %v", e)
+	}
+	if !strings.HasPrefix(string(b), "pending") || len(b) == len("pending") {
+		t.Errorf("Bad output on Fini: %q", b)
+	}
+}
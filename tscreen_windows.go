@@ -29,6 +29,10 @@ func (t *tScreen) termioFini() {
 	return
 }
 
+func (t *tScreen) drain() error {
+	return nil
+}
+
 func (t *tScreen) getWinSize() (int, int, error) {
 	return 0, 0, ErrNoScreen
 }
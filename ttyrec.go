@@ -0,0 +1,458 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// TtyrecWriter writes the data written to it as ttyrec frames.  Each
+// Write becomes one frame, stamped with the time it was written.  The
+// ttyrec format is understood by ttyplay, ipbt, and many other tools.
+//
+// A TtyrecWriter is most useful as a mirror, to record a session:
+//
+//	f, _ := os.Create("session.ttyrec")
+//	s.Mirror(NewTtyrecWriter(f))
+//
+// If the underlying writer is an io.Closer, it is closed when the
+// TtyrecWriter is closed.
+type TtyrecWriter struct {
+	w   io.Writer
+	now func() time.Time
+	lk  sync.Mutex
+}
+
+// NewTtyrecWriter returns a TtyrecWriter that writes frames to w.
+func NewTtyrecWriter(w io.Writer) *TtyrecWriter {
+	return &TtyrecWriter{w: w, now: time.Now}
+}
+
+// Write writes p as a single frame.
+func (t *TtyrecWriter) Write(p []byte) (int, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+
+	now := t.now()
+	hdr := make([]byte, 12, 12+len(p))
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(len(p)))
+	if _, err := t.w.Write(append(hdr, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying writer, if it is an io.Closer.
+func (t *TtyrecWriter) Close() error {
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ttyrecFrameMax is the longest frame that ReadTtyrecFrame accepts, so
+// that a corrupt or hostile recording cannot make it allocate without
+// limit.  Frames are the output of a single write, so this is generous.
+const ttyrecFrameMax = 16 << 20
+
+// TtyrecFrame is a single frame of a ttyrec recording.
+type TtyrecFrame struct {
+	When time.Time
+	Data []byte
+}
+
+// ReadTtyrecFrame reads the next frame from r.  It returns io.EOF
+// when there are no more frames.  A recording truncated in the middle
+// of a frame yields io.ErrUnexpectedEOF, and a frame longer than 16 MiB
+// yields ErrBadTtyrec.
+func ReadTtyrecFrame(r io.Reader) (TtyrecFrame, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return TtyrecFrame{}, err
+	}
+	sec := binary.LittleEndian.Uint32(hdr[0:])
+	usec := binary.LittleEndian.Uint32(hdr[4:])
+	n := binary.LittleEndian.Uint32(hdr[8:])
+	if n > ttyrecFrameMax {
+		return TtyrecFrame{}, ErrBadTtyrec
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return TtyrecFrame{}, err
+	}
+	when := time.Unix(int64(sec), int64(usec)*1000)
+	return TtyrecFrame{When: when, Data: data}, nil
+}
+
+// PlayTtyrec plays a ttyrec recording into a SimulationScreen, so that
+// its contents can be inspected offline.  Each frame is interpreted and
+// shown in turn, and then fn (if not nil) is called with the frame's
+// timestamp.  Playback stops early if fn returns false.  No attempt is
+// made to honor the timing of the recording; callers wanting that can
+// sleep in fn.
+//
+// The screen should be initialized, and sized to match the terminal
+// that was recorded.  Only the subset of the VT100/ECMA-48 control
+// sequences that TCell itself emits are interpreted; others are
+// ignored.
+func PlayTtyrec(r io.Reader, s SimulationScreen, fn func(when time.Time) bool) error {
+	vt := &vtEmulator{s: s}
+	for {
+		f, err := ReadTtyrecFrame(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		vt.Write(f.Data)
+		s.Show()
+		if fn != nil && !fn(f.When) {
+			return nil
+		}
+	}
+}
+
+// vtEmulator interprets terminal output, applying it to a Screen.  It
+// is deliberately minimal, understanding the sequences used by common
+// terminfo entries for cursor motion, erasure, and rendition.
+// Sequences split across writes are held until they are complete.
+type vtEmulator struct {
+	s     Screen
+	x, y  int
+	style Style
+	acs   bool
+	buf   []byte
+}
+
+func (vt *vtEmulator) Write(p []byte) (int, error) {
+	vt.buf = append(vt.buf, p...)
+	for len(vt.buf) > 0 {
+		n := vt.step(vt.buf)
+		if n == 0 {
+			break // incomplete, wait for more
+		}
+		vt.buf = vt.buf[n:]
+	}
+	return len(p), nil
+}
+
+// step consumes one character or control sequence from b, returning
+// the number of bytes used, or zero if more data is needed.
+func (vt *vtEmulator) step(b []byte) int {
+	switch b[0] {
+	case '\x1b':
+		return vt.escape(b)
+	case '\r':
+		vt.x = 0
+	case '\n':
+		vt.lineFeed()
+	case '\b':
+		vt.moveTo(vt.x-1, vt.y)
+	case '\t':
+		vt.moveTo((vt.x+8)&^7, vt.y)
+	default:
+		if b[0] < ' ' || b[0] == 0x7f {
+			return 1 // other controls, including BEL and SI/SO
+		}
+		if !utf8.FullRune(b) {
+			return 0
+		}
+		r, n := utf8.DecodeRune(b)
+		vt.put(r)
+		return n
+	}
+	return 1
+}
+
+func (vt *vtEmulator) escape(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+	switch b[1] {
+	case '[':
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				vt.csi(string(b[2:i]), b[i])
+				return i + 1
+			}
+		}
+		return 0
+	case ']', 'P', '_':
+		// OSC, DCS, APC: skip to BEL or ST.
+		for i := 2; i < len(b); i++ {
+			if b[i] == '\a' {
+				return i + 1
+			}
+			if b[i] == '\x1b' && i+1 < len(b) && b[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return 0
+	case '(', ')':
+		if len(b) < 3 {
+			return 0
+		}
+		if b[1] == '(' {
+			vt.acs = b[2] == '0'
+		}
+		return 3
+	}
+	return 2 // two byte sequences such as ESC =, ESC 7
+}
+
+func (vt *vtEmulator) csi(params string, final byte) {
+	private := strings.HasPrefix(params, "?")
+	if private {
+		params = params[1:]
+	}
+	args := strings.Split(params, ";")
+	arg := func(i, def int) int {
+		if i < len(args) {
+			if v, err := strconv.Atoi(args[i]); err == nil && v != 0 {
+				return v
+			}
+		}
+		return def
+	}
+	w, h := vt.s.Size()
+
+	switch final {
+	case 'H', 'f':
+		vt.moveTo(arg(1, 1)-1, arg(0, 1)-1)
+	case 'A':
+		vt.moveTo(vt.x, vt.y-arg(0, 1))
+	case 'B':
+		vt.moveTo(vt.x, vt.y+arg(0, 1))
+	case 'C':
+		vt.moveTo(vt.x+arg(0, 1), vt.y)
+	case 'D':
+		vt.moveTo(vt.x-arg(0, 1), vt.y)
+	case 'G':
+		vt.moveTo(arg(0, 1)-1, vt.y)
+	case 'd':
+		vt.moveTo(vt.x, arg(0, 1)-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			vt.erase(vt.x, vt.y, w, vt.y)
+			vt.erase(0, vt.y+1, w, h-1)
+		case 1:
+			vt.erase(0, 0, w, vt.y-1)
+			vt.erase(0, vt.y, vt.x+1, vt.y)
+		default:
+			vt.erase(0, 0, w, h-1)
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			vt.erase(vt.x, vt.y, w, vt.y)
+		case 1:
+			vt.erase(0, vt.y, vt.x+1, vt.y)
+		default:
+			vt.erase(0, vt.y, w, vt.y)
+		}
+	case 'X':
+		vt.erase(vt.x, vt.y, vt.x+arg(0, 1), vt.y)
+	case 'm':
+		if !private {
+			vt.sgr(params)
+		}
+	case 'h', 'l':
+		if private && params == "25" {
+			if final == 'h' {
+				vt.s.ShowCursor(vt.x, vt.y)
+			} else {
+				vt.s.HideCursor()
+			}
+		}
+	}
+}
+
+// sgr applies a Select Graphic Rendition sequence.  Extended colors
+// may use either semicolons, or ITU T.416 style colon sub-parameters.
+func (vt *vtEmulator) sgr(params string) {
+	args := strings.Split(params, ";")
+	num := func(s string) int {
+		v, _ := strconv.Atoi(s)
+		return v
+	}
+	// extended parses the arguments of 38 or 48 (after the selector
+	// itself), returning the color and the number of arguments used.
+	extended := func(a []string) (Color, int) {
+		if len(a) >= 2 && num(a[0]) == 5 {
+			return PaletteColor(num(a[1])), 2
+		}
+		if len(a) >= 4 && num(a[0]) == 2 {
+			if len(a) >= 5 && a[1] == "" {
+				a = a[1:] // empty colorspace id
+			}
+			return NewRGBColor(int32(num(a[1])), int32(num(a[2])), int32(num(a[3]))), 4
+		}
+		return ColorDefault, len(a)
+	}
+
+	st := vt.style
+	for i := 0; i < len(args); i++ {
+		sub := strings.Split(args[i], ":")
+		switch v := num(sub[0]); {
+		case v == 0:
+			st = StyleDefault
+		case v == 1:
+			st = st.Bold(true)
+		case v == 2:
+			st = st.Dim(true)
+		case v == 3:
+			st = st.Italic(true)
+		case v == 4:
+			st = st.Underline(true)
+		case v == 5:
+			st = st.Blink(true)
+		case v == 6:
+			st = st.RapidBlink(true)
+		case v == 7:
+			st = st.Reverse(true)
+		case v == 9:
+			st = st.StrikeThrough(true)
+		case v == 22:
+			st = st.Bold(false).Dim(false)
+		case v == 23:
+			st = st.Italic(false)
+		case v == 24:
+			st = st.Underline(false)
+		case v == 25:
+			st = st.Blink(false).RapidBlink(false)
+		case v == 27:
+			st = st.Reverse(false)
+		case v == 29:
+			st = st.StrikeThrough(false)
+		case v >= 30 && v <= 37:
+			st = st.Foreground(PaletteColor(v - 30))
+		case v == 38 || v == 48:
+			var c Color
+			if len(sub) > 1 {
+				c, _ = extended(sub[1:])
+			} else {
+				var n int
+				c, n = extended(args[i+1:])
+				i += n
+			}
+			if v == 38 {
+				st = st.Foreground(c)
+			} else {
+				st = st.Background(c)
+			}
+		case v == 39:
+			st = st.Foreground(ColorDefault)
+		case v >= 40 && v <= 47:
+			st = st.Background(PaletteColor(v - 40))
+		case v == 49:
+			st = st.Background(ColorDefault)
+		case v >= 90 && v <= 97:
+			st = st.Foreground(PaletteColor(v - 90 + 8))
+		case v >= 100 && v <= 107:
+			st = st.Background(PaletteColor(v - 100 + 8))
+		}
+	}
+	vt.style = st
+}
+
+func (vt *vtEmulator) put(r rune) {
+	if vt.acs {
+		if rr, ok := vtACSNames[byte(r)]; ok && r < 0x80 {
+			r = rr
+		}
+	}
+	w, _ := vt.s.Size()
+	width := RuneWidth(r)
+	if width == 0 {
+		// Combining character, attach it to the previous cell.
+		if vt.x > 0 {
+			mainc, combc, st, _ := vt.s.GetContent(vt.x-1, vt.y)
+			combc = append(append([]rune{}, combc...), r)
+			vt.s.SetContent(vt.x-1, vt.y, mainc, combc, st)
+		}
+		return
+	}
+	vt.s.SetContent(vt.x, vt.y, r, nil, vt.style)
+	vt.x += width
+	if vt.x > w {
+		vt.x = w
+	}
+}
+
+// lineFeed moves down a line, scrolling the screen up at the bottom.
+func (vt *vtEmulator) lineFeed() {
+	w, h := vt.s.Size()
+	if vt.y < h-1 {
+		vt.y++
+		return
+	}
+	for y := 1; y < h; y++ {
+		for x := 0; x < w; x++ {
+			mainc, combc, st, _ := vt.s.GetContent(x, y)
+			vt.s.SetContent(x, y-1, mainc, combc, st)
+		}
+	}
+	vt.erase(0, h-1, w, h-1)
+}
+
+func (vt *vtEmulator) moveTo(x, y int) {
+	w, h := vt.s.Size()
+	if x >= w {
+		x = w - 1
+	}
+	if y >= h {
+		y = h - 1
+	}
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	vt.x, vt.y = x, y
+}
+
+// erase clears cells from (x0, y0) up to (but not including) x1 on the
+// last row y1, using the current background.
+func (vt *vtEmulator) erase(x0, y0, x1, y1 int) {
+	w, _ := vt.s.Size()
+	_, bg, _ := vt.style.Decompose()
+	st := StyleDefault.Background(bg)
+	for y := y0; y <= y1; y++ {
+		start, end := 0, w
+		if y == y0 {
+			start = x0
+		}
+		if y == y1 {
+			end = x1
+		}
+		for x := start; x < end; x++ {
+			vt.s.SetContent(x, y, ' ', nil, st)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTtyrecFrames(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewTtyrecWriter(buf)
+	when := time.Unix(1600000000, 250000000)
+	w.now = func() time.Time { return when }
+	w.Write([]byte("hello"))
+	w.Write([]byte("world"))
+
+	for _, want := range []string{"hello", "world"} {
+		f, err := ReadTtyrecFrame(buf)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if string(f.Data) != want || !f.When.Equal(when) {
+			t.Errorf("Bad frame: %q at %v", f.Data, f.When)
+		}
+	}
+	if _, err := ReadTtyrecFrame(buf); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+
+	buf.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+	if _, err := ReadTtyrecFrame(buf); err != ErrBadTtyrec {
+		t.Errorf("Expected ErrBadTtyrec, got %v", err)
+	}
+}
+
+func TestTtyrecPlay(t *testing.T) {
+	ts := mkTestTScreen(t)
+	out := &bytes.Buffer{}
+	ts.out = out
+	ts.w, ts.h = 6, 2
+	ts.cells.Resize(6, 2)
+
+	rec := &bytes.Buffer{}
+	w := NewTtyrecWriter(rec)
+	st := StyleDefault.Foreground(ColorMaroon).Bold(true)
+	ts.SetContent(1, 0, 'A', nil, st)
+	ts.SetContent(2, 1, RuneHLine, nil, StyleDefault)
+	ts.draw()
+	w.Write(out.Bytes())
+	out.Reset()
+	ts.SetContent(3, 1, 'e', []rune{'́'}, StyleDefault.Reverse(true))
+	ts.draw()
+	w.Write(out.Bytes())
+
+	ss := NewSimulationScreen("")
+	if e := ss.Init(); e != nil {
+		t.Fatalf("Failed to init: %v", e)
+	}
+	defer ss.Fini()
+	ss.SetSize(6, 2)
+
+	frames := 0
+	if e := PlayTtyrec(rec, ss, func(time.Time) bool {
+		frames++
+		return true
+	}); e != nil {
+		t.Fatalf("Play failed: %v", e)
+	}
+	if frames != 2 {
+		t.Errorf("Expected 2 frames, got %d", frames)
+	}
+
+	cells, width, _ := ss.GetContents()
+	cell := func(x, y int) SimCell { return cells[y*width+x] }
+	if c := cell(1, 0); string(c.Runes) != "A" || c.Style != st {
+		t.Errorf("Bad cell: %q %v", c.Runes, c.Style)
+	}
+	if c := cell(2, 1); string(c.Runes) != string(RuneHLine) {
+		t.Errorf("Bad line drawing cell: %q", c.Runes)
+	}
+	if c := cell(3, 1); string(c.Runes) != "é" || c.Style != StyleDefault.Reverse(true) {
+		t.Errorf("Bad combining cell: %q %v", c.Runes, c.Style)
+	}
+	if c := cell(0, 0); string(c.Runes) != " " {
+		t.Errorf("Bad empty cell: %q", c.Runes)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+)
+
+// outCheck parses the output sent to the terminal, and logs the escape
+// sequences that are malformed.  It is enabled by setting TCELL_VALIDATE
+// as well as TCELL_TRACE, and is meant for catching mistakes in terminfo
+// entries, and in the sequences we build ourselves, which the terminal
+// would otherwise quietly misinterpret.  It reports:
+//
+//   - control sequences with bytes out of place, or left unfinished, as
+//     when a parameterized string is not expanded properly
+//   - strings, such as those of OSC, that are not terminated
+//   - cursor positions that are outside the screen
+//
+// Only ECMA-48 sequences are understood, so it is of little use for
+// terminals that use others.
+type outCheck struct {
+	l       *log.Logger
+	size    func() (int, int)
+	state   int
+	seq     []byte
+	reports int
+}
+
+// The states of the parser.
+const (
+	outGround = iota
+	outEsc    // after ESC
+	outInter  // in the intermediate bytes of an escape sequence
+	outCSI    // in a control sequence
+	outString // in a command string, such as OSC
+	outST     // after ESC in a command string
+)
+
+// outSeqMax limits the length of a control sequence; anything longer is
+// surely garbage.  Command strings are not limited, as they can carry
+// the clipboard.
+const outSeqMax = 128
+
+// outReportMax limits the number of problems that are logged, so that a
+// bad capability used for every cell does not flood the log.
+const outReportMax = 100
+
+func newOutCheck(l *log.Logger, size func() (int, int)) *outCheck {
+	return &outCheck{l: l, size: size}
+}
+
+// report logs a problem with the sequence collected so far.
+func (c *outCheck) report(problem string) {
+	c.reports++
+	switch {
+	case c.reports < outReportMax:
+		c.l.Printf("validate: %s: %q", problem, c.seq)
+	case c.reports == outReportMax:
+		c.l.Printf("validate: too many problems, no more are reported")
+	}
+}
+
+// Write checks the bytes, which are what is sent to the terminal, in the
+// order they are sent.  Sequences may be split across writes.
+func (c *outCheck) Write(b []byte) (int, error) {
+	for _, ch := range b {
+		c.check(ch)
+	}
+	return len(b), nil
+}
+
+func (c *outCheck) check(ch byte) {
+	switch c.state {
+	case outGround:
+		if ch == '\x1b' {
+			c.seq = append(c.seq[:0], ch)
+			c.state = outEsc
+		}
+
+	case outEsc, outInter:
+		c.seq = append(c.seq, ch)
+		switch {
+		case c.state == outEsc && ch == '[':
+			c.state = outCSI
+		case c.state == outEsc && (ch == ']' || ch == 'P' || ch == '_' || ch == '^' || ch == 'X'):
+			c.state = outString
+		case ch >= 0x20 && ch <= 0x2f:
+			c.state = outInter
+		case ch >= 0x30 && ch <= 0x7e:
+			c.state = outGround
+		default:
+			c.report("malformed escape sequence")
+			c.restart(ch)
+		}
+
+	case outCSI:
+		c.seq = append(c.seq, ch)
+		switch {
+		case ch >= 0x40 && ch <= 0x7e:
+			c.state = outGround
+			c.checkCSI()
+		case ch < 0x20 || ch > 0x7e:
+			c.report("control sequence interrupted")
+			c.restart(ch)
+		case len(c.seq) > outSeqMax:
+			c.report("control sequence too long")
+			c.state = outGround
+		}
+
+	case outString, outST:
+		if ch == '\a' || (c.state == outST && ch == '\\') {
+			c.state = outGround
+			c.seq = c.seq[:0]
+			return
+		}
+		if len(c.seq) < outSeqMax {
+			c.seq = append(c.seq, ch)
+		}
+		if c.state == outST {
+			// The ESC starts another sequence instead.
+			c.report("command string not terminated")
+			c.seq = append(c.seq[:0], '\x1b')
+			c.state = outEsc
+			c.check(ch)
+		} else if ch == '\x1b' {
+			c.state = outST
+		}
+	}
+}
+
+// restart resumes parsing after a malformed sequence, with the byte that
+// ended it, which may start another.
+func (c *outCheck) restart(ch byte) {
+	c.state = outGround
+	if ch == '\x1b' {
+		c.seq = append(c.seq[:0], ch)
+		c.state = outEsc
+	}
+}
+
+// checkCSI checks a complete control sequence.
+func (c *outCheck) checkCSI() {
+	body := c.seq[2 : len(c.seq)-1]
+	final := c.seq[len(c.seq)-1]
+	inter := false
+	for _, ch := range body {
+		if ch <= 0x2f {
+			inter = true
+		} else if inter {
+			c.report("parameter after intermediate byte")
+			return
+		}
+	}
+	// No sequence in use has a '%' intermediate byte; it is what is
+	// left when a parameterized string is sent without being expanded.
+	if bytes.IndexByte(body, '%') >= 0 {
+		c.report("unexpanded parameter")
+		return
+	}
+	if inter || (len(body) > 0 && body[0] >= 0x3c) {
+		// Private sequences are not checked further.
+		return
+	}
+
+	var row, col int
+	switch final {
+	case 'H', 'f':
+		row, col = c.param(body, 0), c.param(body, 1)
+	case 'G', '`':
+		col = c.param(body, 0)
+	case 'd':
+		row = c.param(body, 0)
+	default:
+		return
+	}
+	w, h := c.size()
+	if w > 0 && h > 0 && (row > h || col > w) {
+		c.report("cursor moved outside the screen")
+	}
+}
+
+// param returns the nth parameter of the sequence, which defaults to 1.
+func (c *outCheck) param(body []byte, n int) int {
+	params := bytes.Split(body, []byte{';'})
+	if n >= len(params) {
+		return 1
+	}
+	v, err := strconv.Atoi(string(params[n]))
+	if err != nil || v == 0 {
+		return 1
+	}
+	return v
+}
+
+// finish reports a sequence left unfinished when the output ends.
+func (c *outCheck) finish() {
+	if c.state != outGround {
+		c.report("output ends within a sequence")
+		c.state = outGround
+	}
+}
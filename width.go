@@ -0,0 +1,187 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+var runeWidthFunc atomic.Value
+
+// SetRuneWidthFunc replaces the function used to find how many cells a
+// rune occupies, which by default comes from the go-runewidth package.
+// This is useful when a terminal disagrees with the Unicode tables, for
+// example about ambiguous width or emoji characters.  The function must
+// return 0 for combining characters, 1 for normal ones, and 2 for wide
+// ones.  Passing nil restores the default.
+//
+// This should be done before anything is drawn, as the widths of cells
+// already drawn are not recomputed.
+func SetRuneWidthFunc(fn func(r rune) int) {
+	if fn == nil {
+		fn = runewidth.RuneWidth
+	}
+	runeWidthFunc.Store(fn)
+}
+
+// RuneWidth returns the number of cells that a rune occupies: 0 for a
+// combining character, 1 for most characters, and 2 for East Asian wide
+// characters.  This is what CellBuffer uses, so it honors any function
+// given to SetRuneWidthFunc.
+func RuneWidth(r rune) int {
+	if fn, ok := runeWidthFunc.Load().(func(rune) int); ok {
+		return fn(r)
+	}
+	return runewidth.RuneWidth(r)
+}
+
+// nextCluster returns the length in bytes of the first character of s,
+// along with any combining characters that follow it, and the number of
+// cells that they occupy when drawn.  Control characters, and combining
+// characters with nothing to combine with, are drawn as a space.
+func nextCluster(s string) (int, int) {
+	r, n := utf8.DecodeRuneInString(s)
+	width := RuneWidth(r)
+	if width == 0 || r < ' ' {
+		width = 1
+	}
+	for n < len(s) {
+		r, l := utf8.DecodeRuneInString(s[n:])
+		if r < ' ' || RuneWidth(r) != 0 {
+			break
+		}
+		n += l
+	}
+	return n, width
+}
+
+// splitCluster breaks the first character of s, as found by nextCluster,
+// into the rune to draw in its cell and the combining characters, which
+// are appended to combc[:0].  A control character is replaced by a space,
+// as is a combining character with nothing to combine with, which then
+// combines with the space.  It also returns the length in bytes and the
+// width that nextCluster gives.
+func splitCluster(s string, combc []rune) (rune, []rune, int, int) {
+	n, width := nextCluster(s)
+	mainc, l := utf8.DecodeRuneInString(s)
+	combc = combc[:0]
+	for _, c := range s[l:n] {
+		combc = append(combc, c)
+	}
+	switch {
+	case mainc < ' ':
+		mainc = ' '
+	case RuneWidth(mainc) == 0:
+		combc = append(combc, 0)
+		copy(combc[1:], combc)
+		combc[0] = mainc
+		mainc = ' '
+	}
+	return mainc, combc, n, width
+}
+
+// MeasureString returns the number of cells that the string occupies
+// when drawn one character per cell, with combining characters placed
+// in the cell of the character they follow.
+func MeasureString(s string) int {
+	total := 0
+	for len(s) > 0 {
+		n, width := nextCluster(s)
+		total += width
+		s = s[n:]
+	}
+	return total
+}
+
+// TruncateString shortens the string to fit in the given number of
+// cells, if it does not already, ending it with tail (such as "…") to
+// show that it was cut.  Wide characters are not split, so the result
+// may be a cell short.
+func TruncateString(s string, width int, tail string) string {
+	if MeasureString(s) <= width {
+		return s
+	}
+	avail := width - MeasureString(tail)
+	if avail < 0 {
+		avail, tail = width, ""
+	}
+	used, end := 0, 0
+	for end < len(s) {
+		n, w := nextCluster(s[end:])
+		if used+w > avail {
+			break
+		}
+		used += w
+		end += n
+	}
+	return s[:end] + tail
+}
+
+// WrapString breaks the string into lines that each fit in the given
+// number of cells.  Lines are broken at spaces where possible, and the
+// spaces at the break are dropped; words that are too long for a line
+// by themselves are broken wherever they must be.  Newlines in the
+// string always start a new line.
+func WrapString(s string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		for {
+			line, rest := wrapLine(para, width)
+			lines = append(lines, line)
+			if rest == "" {
+				break
+			}
+			para = rest
+		}
+	}
+	return lines
+}
+
+// wrapLine returns the first line of s that fits in width cells, and the
+// remainder of s with the spaces at the break removed.
+func wrapLine(s string, width int) (string, string) {
+	used, end, brk := 0, 0, -1
+	for end < len(s) {
+		n, w := nextCluster(s[end:])
+		if used+w > width {
+			break
+		}
+		if s[end] == ' ' {
+			brk = end
+		}
+		used += w
+		end += n
+	}
+	if end == len(s) {
+		return s, ""
+	}
+	if s[end] == ' ' {
+		brk = end
+	}
+	if brk > 0 {
+		end = brk
+	} else if end == 0 {
+		// Not even one character fits, so take it anyway.
+		end, _ = nextCluster(s)
+	}
+	return strings.TrimRight(s[:end], " "), strings.TrimLeft(s[end:], " ")
+}
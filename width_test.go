@@ -0,0 +1,115 @@
+// Copyright 2020 The TCell Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use file except in compliance with the License.
+// You may obtain a copy of the license at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMeasureString(t *testing.T) {
+	for s, w := range map[string]int{
+		"":          0,
+		"abc":       3,
+		"世界":        4,
+		"e\u0301":   1,
+		"\u0301x":   2,
+		"a\tb":      3,
+		"x世e\u0301": 4,
+	} {
+		if got := MeasureString(s); got != w {
+			t.Errorf("MeasureString(%q) = %d, expected %d", s, got, w)
+		}
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	cases := []struct {
+		s     string
+		width int
+		tail  string
+		res   string
+	}{
+		{"hello", 5, "…", "hello"},
+		{"hello world", 8, "…", "hello w…"},
+		{"世界世界", 6, "…", "世界…"},
+		{"世界世界", 5, "…", "世界…"},
+		{"e\u0301e\u0301e\u0301", 2, "", "e\u0301e\u0301"},
+		{"hello", 2, "...", "he"},
+	}
+	for _, c := range cases {
+		if got := TruncateString(c.s, c.width, c.tail); got != c.res {
+			t.Errorf("TruncateString(%q, %d) = %q, expected %q",
+				c.s, c.width, got, c.res)
+		}
+	}
+}
+
+func TestWrapString(t *testing.T) {
+	cases := []struct {
+		s     string
+		width int
+		lines []string
+	}{
+		{"the quick brown fox", 10, []string{"the quick", "brown fox"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"one\n\ntwo", 10, []string{"one", "", "two"}},
+		{"世界世界", 5, []string{"世界", "世界"}},
+		{"a    b", 2, []string{"a", "b"}},
+	}
+	for _, c := range cases {
+		if got := WrapString(c.s, c.width); !reflect.DeepEqual(got, c.lines) {
+			t.Errorf("WrapString(%q, %d) = %q, expected %q",
+				c.s, c.width, got, c.lines)
+		}
+	}
+}
+
+func TestRuneWidthFunc(t *testing.T) {
+	SetRuneWidthFunc(func(r rune) int {
+		if r == '★' {
+			return 2
+		}
+		return 1
+	})
+	defer SetRuneWidthFunc(nil)
+
+	if MeasureString("★x") != 3 {
+		t.Errorf("Override not used for measurement")
+	}
+	cb := &CellBuffer{}
+	cb.Resize(4, 1)
+	cb.SetContent(0, 0, '★', nil, StyleDefault)
+	if _, _, _, w := cb.GetContent(0, 0); w != 2 {
+		t.Errorf("Override not used by CellBuffer, width %d", w)
+	}
+}
+
+func TestSplitCluster(t *testing.T) {
+	for s, want := range map[string][]rune{
+		"e\u0301x": {'e', '\u0301'},
+		"\u0301x":  {' ', '\u0301'},
+		"\tx":      {' '},
+		"世":        {'世'},
+	} {
+		mainc, combc, n, w := splitCluster(s, nil)
+		if got := append([]rune{mainc}, combc...); !reflect.DeepEqual(got, want) {
+			t.Errorf("Bad cluster for %q: %q", s, got)
+		}
+		if wn, ww := nextCluster(s); n != wn || w != ww {
+			t.Errorf("Bad size for %q: %d %d", s, n, w)
+		}
+	}
+}